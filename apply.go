@@ -0,0 +1,535 @@
+package posts
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"slices"
+	"sort"
+)
+
+// ErrRevisionMismatch is returned when a Revision can't be applied to a Post
+// because it doesn't describe a change to that version of the Post. This
+// usually means the Revision was generated against a different version.
+var ErrRevisionMismatch = errors.New("revision does not match post")
+
+// ApplyRevision returns the Post that results from applying rev to base. It's
+// the inverse of GenerateRevision: applying the Revision GenerateRevision
+// returns for two Posts to the first Post returns the second.
+//
+// Properties a Revision doesn't describe, like Draft and PublishedAt, are
+// copied from base. The returned Post's Parts and Metadata always have
+// contiguous Positions starting at 0. Inline Parts that were changed have
+// their SHA256 set to the SHA 256 sum of their new Body; non-inline Parts
+// have their SHA256 set from the Revision, and a nil Body, as their bodies
+// live outside the Post and aren't recorded in Revisions.
+//
+// If rev can't be applied to base, an error wrapping ErrRevisionMismatch is
+// returned, and base is left unchanged. If that's because rev isn't
+// well-formed, like when it has an unknown DeltaOp, the error also wraps the
+// reason, like ErrUnknownDeltaOp.
+func ApplyRevision(base Post, rev Revision) (Post, error) {
+	base.NormalizeParts()
+	if err := rev.ValidateAgainst(base); err != nil {
+		return Post{}, fmt.Errorf("%w: %w", ErrRevisionMismatch, err)
+	}
+	post := base
+
+	var err error
+	post.Title, err = rev.TitleDelta.apply(base.Title)
+	if err != nil {
+		return Post{}, fmt.Errorf("%w: can't apply title delta: %v", ErrRevisionMismatch, err)
+	}
+	post.Slug, err = rev.SlugDelta.apply(base.Slug)
+	if err != nil {
+		return Post{}, fmt.Errorf("%w: can't apply slug delta: %v", ErrRevisionMismatch, err)
+	}
+
+	authors := make([]listChange, 0, len(rev.AuthorsDeltas))
+	for _, delta := range rev.AuthorsDeltas {
+		authors = append(authors, listChange{op: delta.Op, from: delta.FromPosition, to: delta.ToPosition, value: delta.Author})
+	}
+	post.Authors, err = rearrangeStrings(base.Authors, authors)
+	if err != nil {
+		return Post{}, fmt.Errorf("%w: can't apply authors deltas: %v", ErrRevisionMismatch, err)
+	}
+
+	streams := make([]listChange, 0, len(rev.StreamsDeltas))
+	for _, delta := range rev.StreamsDeltas {
+		streams = append(streams, listChange{op: delta.Op, from: delta.FromPosition, to: delta.ToPosition, value: delta.Stream})
+	}
+	post.Streams, err = rearrangeStrings(base.Streams, streams)
+	if err != nil {
+		return Post{}, fmt.Errorf("%w: can't apply streams deltas: %v", ErrRevisionMismatch, err)
+	}
+
+	post.Parts, err = applyPartDeltas(base.Parts, rev.PartsDeltas)
+	if err != nil {
+		return Post{}, fmt.Errorf("%w: can't apply parts deltas: %v", ErrRevisionMismatch, err)
+	}
+	post.Metadata, err = applyPartDeltas(base.Metadata, rev.MetadataDeltas)
+	if err != nil {
+		return Post{}, fmt.Errorf("%w: can't apply metadata deltas: %v", ErrRevisionMismatch, err)
+	}
+	return post, nil
+}
+
+// ApplyPartialRevision applies only some of rev's changes to p, for reviews
+// that accept some of the changes a Revision proposes and reject the rest. It
+// returns the Post with the accepted changes applied, and a residual Revision
+// of the rejected ones, relative to the returned Post, so that applying the
+// residual Revision to the returned Post gives the same Post as applying rev
+// to p.
+//
+// accept is called with each of rev's PartsDeltas and MetadataDeltas, and
+// returns true if the change it describes should be applied. A part that's
+// both moved and updated, with a DeltaMoveUpdate, is passed to accept as two
+// PartDeltas instead, a DeltaMove and a DeltaUpdate, so the move can be
+// accepted without the update, or the other way around. acceptAuthors
+// accepts the changes to the Post's Authors and Streams, and acceptTitle and
+// acceptSlug the changes to its Title and Slug, each as a whole.
+//
+// Parts whose move was rejected, or whose removal was rejected, stay after
+// the part that preceded them in p, while the other parts are arranged as rev
+// arranges them. The residual Revision has the same properties as rev, like
+// its Reason and AuthorID, except for its ID, which is left empty, as it's a
+// different Revision. If every change is accepted, the residual Revision is
+// empty; see Revision.IsEmpty.
+//
+// If rev can't be applied to p, the error ApplyRevision returns is returned.
+func ApplyPartialRevision(p Post, rev Revision, accept func(PartDelta) bool, acceptAuthors, acceptTitle, acceptSlug bool) (Post, Revision, error) {
+	full, err := ApplyRevision(p, rev)
+	if err != nil {
+		return Post{}, Revision{}, err
+	}
+	p.NormalizeParts()
+
+	partial := full
+	residual := Revision{
+		Public:    rev.Public,
+		Reason:    rev.Reason,
+		Status:    rev.Status,
+		AuthorID:  rev.AuthorID,
+		ActorType: rev.ActorType,
+		CreatedAt: rev.CreatedAt,
+	}
+	if !acceptTitle {
+		partial.Title = p.Title
+		residual.TitleDelta, residual.TitleUndo = rev.TitleDelta, rev.TitleUndo
+	}
+	if !acceptSlug {
+		partial.Slug = p.Slug
+		residual.SlugDelta, residual.SlugUndo = rev.SlugDelta, rev.SlugUndo
+	}
+	if !acceptAuthors {
+		partial.Authors, partial.Streams = p.Authors, p.Streams
+		residual.AuthorsDeltas, residual.StreamsDeltas = rev.AuthorsDeltas, rev.StreamsDeltas
+	}
+	partial.Parts, residual.PartsDeltas, err = partialPartDeltas(p.Parts, full.Parts, rev.PartsDeltas, accept)
+	if err != nil {
+		return Post{}, Revision{}, fmt.Errorf("%w: can't apply parts deltas: %v", ErrRevisionMismatch, err)
+	}
+	partial.Metadata, residual.MetadataDeltas, err = partialPartDeltas(p.Metadata, full.Metadata, rev.MetadataDeltas, accept)
+	if err != nil {
+		return Post{}, Revision{}, fmt.Errorf("%w: can't apply metadata deltas: %v", ErrRevisionMismatch, err)
+	}
+	return partial, residual, nil
+}
+
+// splitMoveUpdate splits a DeltaMoveUpdate into a DeltaMove that only moves
+// the part, and a DeltaUpdate that only changes it.
+func splitMoveUpdate(delta PartDelta) (PartDelta, PartDelta) {
+	move := PartDelta{
+		PartID:       delta.PartID,
+		Op:           DeltaMove,
+		FromPosition: delta.FromPosition,
+		ToPosition:   delta.ToPosition,
+		// non-inline parts record their SHA256 on every delta, and the
+		// move doesn't change it.
+		SHA256From: delta.SHA256From,
+		SHA256To:   delta.SHA256From,
+	}
+	update := delta
+	update.Op = DeltaUpdate
+	return move, update
+}
+
+// partialItem is a part in the list of parts ApplyPartialRevision returns.
+// base is the part's position in the original list, or -1 if it's being
+// added, change is the index of the PartDelta that changes it, or -1 if
+// there isn't one, and final is its position in the list of parts the full
+// Revision results in, or -1 if it's removed there. moved is set when the
+// part's move was accepted, so it's at the position the full Revision puts
+// it in, rather than where it was.
+type partialItem struct {
+	base   int
+	change int
+	final  int
+	moved  bool
+}
+
+// partialPartDeltas returns the parts that result from applying the deltas
+// accept accepts to base, and PartDeltas for the rest, relative to those
+// parts. full must be the result of applying every one of deltas to base.
+func partialPartDeltas(base, full []Part, deltas []PartDelta, accept func(PartDelta) bool) ([]Part, []PartDelta, error) {
+	if len(deltas) == 0 {
+		return base, nil, nil
+	}
+	changes := make([]listChange, 0, len(deltas))
+	for _, delta := range deltas {
+		changes = append(changes, listChange{op: delta.Op, from: delta.FromPosition, to: delta.ToPosition, value: delta.PartID})
+	}
+	slots, err := arrange(len(base), changes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// moves and updates are accepted separately, so a DeltaMoveUpdate
+	// can have either half rejected. Other deltas are accepted whole,
+	// which counts as both.
+	moved := make([]bool, len(deltas))
+	updated := make([]bool, len(deltas))
+	for i, delta := range deltas {
+		if delta.Op == DeltaMoveUpdate {
+			move, update := splitMoveUpdate(delta)
+			moved[i], updated[i] = accept(move), accept(update)
+			continue
+		}
+		moved[i] = accept(delta)
+		updated[i] = moved[i]
+	}
+	accepted := func(i int) bool {
+		return moved[i] && updated[i]
+	}
+
+	items := make([]partialItem, 0, len(slots))
+	var pending []partialItem
+	for pos, slot := range slots {
+		item := partialItem{base: slot.base, change: slot.change, final: pos}
+		if slot.change >= 0 {
+			switch deltas[slot.change].Op {
+			case DeltaAdd:
+				if !accepted(slot.change) {
+					continue
+				}
+			case DeltaMove, DeltaMoveUpdate:
+				if !moved[slot.change] {
+					pending = append(pending, item)
+					continue
+				}
+				item.moved = true
+			}
+		}
+		items = append(items, item)
+	}
+	for i, delta := range deltas {
+		if delta.Op == DeltaRemove && !accepted(i) {
+			pending = append(pending, partialItem{base: delta.FromPosition, change: i, final: -1})
+		}
+	}
+	// parts that stay where they were go after the closest part that
+	// preceded them and wasn't moved either, in their original order.
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].base < pending[j].base
+	})
+	for _, item := range pending {
+		at := 0
+		for pos, other := range items {
+			if other.base >= 0 && !other.moved && other.base < item.base {
+				at = pos + 1
+			}
+		}
+		items = slices.Insert(items, at, item)
+	}
+
+	var parts []Part
+	residual := make([]*PartDelta, len(deltas))
+	for pos, item := range items {
+		var delta PartDelta
+		if item.change >= 0 {
+			delta = deltas[item.change]
+		}
+		var part Part
+		switch {
+		case item.base < 0:
+			part = full[item.final]
+		case (delta.Op == DeltaUpdate || delta.Op == DeltaMoveUpdate) && updated[item.change]:
+			part = full[item.final]
+		default:
+			part = base[item.base]
+		}
+		part.Position = pos
+		parts = append(parts, part)
+
+		if item.change < 0 || accepted(item.change) {
+			continue
+		}
+		if delta.Op == DeltaMoveUpdate {
+			move, update := splitMoveUpdate(delta)
+			switch {
+			case updated[item.change]:
+				// the part has already been updated, so only the
+				// move is left, from the SHA256 the update left it
+				// with.
+				move.SHA256From, move.SHA256To = delta.SHA256To, delta.SHA256To
+				delta = move
+			case moved[item.change]:
+				delta = update
+			}
+		}
+		delta.FromPosition = pos
+		delta.ToPosition = item.final
+		residual[item.change] = &delta
+	}
+	var deltasLeft []PartDelta
+	for i, delta := range deltas {
+		if residual[i] != nil {
+			deltasLeft = append(deltasLeft, *residual[i])
+			continue
+		}
+		if delta.Op == DeltaAdd && !accepted(i) {
+			deltasLeft = append(deltasLeft, delta)
+		}
+	}
+	return parts, deltasLeft, nil
+}
+
+// listChange is a single add, remove, move, or update of an item in a list,
+// like an AuthorsDelta or PartDelta. FromPosition is relative to the list
+// before any of the changes are made, and ToPosition is relative to the list
+// after all of them are.
+type listChange struct {
+	op    DeltaOp
+	from  int
+	to    int
+	value string
+}
+
+// listSlot describes where the item at a position in a rearranged list comes
+// from. base is the item's position in the original list, or -1 if the item
+// is being added. change is the index of the listChange that places the item,
+// or -1 if the item is untouched.
+type listSlot struct {
+	base   int
+	change int
+}
+
+// arrange works out the order of a list of baseLen items after changes are
+// made to it. Items being removed or moved are taken out of the list, items
+// being added, moved, or updated are placed at their ToPosition, and every
+// other item fills in the remaining positions in its original order.
+func arrange(baseLen int, changes []listChange) ([]listSlot, error) {
+	taken := make([]bool, baseLen)
+	length := baseLen
+	for _, change := range changes {
+		switch change.op {
+		case DeltaAdd:
+			length++
+			continue
+		case DeltaRemove:
+			length--
+		case DeltaUpdate, DeltaMove, DeltaMoveUpdate:
+		default:
+			return nil, fmt.Errorf("unknown op %q", change.op)
+		}
+		if change.from < 0 || change.from >= baseLen {
+			return nil, fmt.Errorf("%s position %d is out of range for %d items", change.value, change.from, baseLen)
+		}
+		if taken[change.from] {
+			return nil, fmt.Errorf("position %d is changed more than once", change.from)
+		}
+		taken[change.from] = true
+	}
+	slots := make([]listSlot, length)
+	placed := make([]bool, length)
+	for i, change := range changes {
+		if change.op == DeltaRemove {
+			continue
+		}
+		if change.to < 0 || change.to >= length {
+			return nil, fmt.Errorf("%s position %d is out of range for %d items", change.value, change.to, length)
+		}
+		if placed[change.to] {
+			return nil, fmt.Errorf("more than one item is placed at position %d", change.to)
+		}
+		placed[change.to] = true
+		slot := listSlot{base: change.from, change: i}
+		if change.op == DeltaAdd {
+			slot.base = -1
+		}
+		slots[change.to] = slot
+	}
+	// the number of positions left over is always the same as the
+	// number of untouched items, so we'll never run out of either.
+	next := 0
+	for pos := range slots {
+		if placed[pos] {
+			continue
+		}
+		for taken[next] {
+			next++
+		}
+		slots[pos] = listSlot{base: next, change: -1}
+		next++
+	}
+	return slots, nil
+}
+
+// rearrangeStrings returns the result of making changes to a list of opaque
+// values like author IDs, where each change's value is the value being
+// added, removed, or moved.
+func rearrangeStrings(base []string, changes []listChange) ([]string, error) {
+	if len(changes) == 0 {
+		return base, nil
+	}
+	slots, err := arrange(len(base), changes)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if change.op != DeltaAdd && base[change.from] != change.value {
+			return nil, fmt.Errorf("expected %s at position %d, found %s", change.value, change.from, base[change.from])
+		}
+	}
+	if len(slots) == 0 {
+		return nil, nil
+	}
+	result := make([]string, 0, len(slots))
+	for _, slot := range slots {
+		if slot.change >= 0 {
+			result = append(result, changes[slot.change].value)
+			continue
+		}
+		result = append(result, base[slot.base])
+	}
+	return result, nil
+}
+
+// applyPartDeltas returns the result of applying deltas to parts, which must
+// have contiguous Positions starting at 0.
+func applyPartDeltas(parts []Part, deltas []PartDelta) ([]Part, error) {
+	if len(deltas) == 0 {
+		return parts, nil
+	}
+	changes := make([]listChange, 0, len(deltas))
+	for _, delta := range deltas {
+		changes = append(changes, listChange{op: delta.Op, from: delta.FromPosition, to: delta.ToPosition, value: delta.PartID})
+	}
+	slots, err := arrange(len(parts), changes)
+	if err != nil {
+		return nil, err
+	}
+	if len(slots) == 0 {
+		return nil, nil
+	}
+	result := make([]Part, 0, len(slots))
+	for pos, slot := range slots {
+		var part Part
+		if slot.base >= 0 {
+			part = parts[slot.base]
+		}
+		if slot.change >= 0 {
+			delta := deltas[slot.change]
+			part, err = applyPartDelta(part, delta)
+			if err != nil {
+				return nil, fmt.Errorf("part %s: %w", delta.PartID, err)
+			}
+		}
+		part.Position = pos
+		result = append(result, part)
+	}
+	return result, nil
+}
+
+// applyPartDelta returns the result of applying delta to part. When delta
+// adds a part, part should be the zero value.
+func applyPartDelta(part Part, delta PartDelta) (Part, error) {
+	part.ID = delta.PartID
+
+	headers, err := applyHeaderDeltas(part.Headers, delta.Headers)
+	if err != nil {
+		return part, err
+	}
+	part.Headers = headers
+
+	if delta.AnchorFrom != delta.AnchorTo {
+		if part.Anchor != delta.AnchorFrom {
+			return part, fmt.Errorf("anchor is %q, not %q", part.Anchor, delta.AnchorFrom)
+		}
+		part.Anchor = delta.AnchorTo
+	}
+
+	// non-inline parts have no inline body, so Body always describes a
+	// change from or to an empty string when a part's inline-ness
+	// changes.
+	var body string
+	if part.Inline {
+		body = string(part.Body)
+	}
+	var newBody string
+	if delta.Binary {
+		// binary bodies are recorded in full, so the body has to
+		// match the recorded one exactly.
+		if body != string(delta.BinaryBodyUndo) {
+			return part, errors.New("body does not match the binary body being replaced")
+		}
+		newBody = string(delta.BinaryBody)
+	} else {
+		newBody, err = delta.Body.apply(body)
+		if err != nil {
+			return part, fmt.Errorf("can't apply body delta: %w", err)
+		}
+	}
+
+	// SHA256To is only set when the part ends up non-inline.
+	if delta.SHA256To != "" {
+		part.Inline = false
+		part.Body = nil
+		part.SHA256 = delta.SHA256To
+		return part, nil
+	}
+	if !part.Inline || newBody != body {
+		part.Body = nil
+		if newBody != "" {
+			part.Body = []byte(newBody)
+		}
+	}
+	part.Inline = true
+	part.ComputeSHA256()
+	return part, nil
+}
+
+// applyHeaderDeltas returns the result of applying deltas to headers. Headers
+// left with no values are removed. Keys are matched in their canonical form,
+// the same way diffHeaders records them, and the headers that are changed end
+// up with canonical keys.
+func applyHeaderDeltas(headers map[string][]string, deltas map[string][]HeaderDelta) (map[string][]string, error) {
+	if len(deltas) == 0 {
+		return headers, nil
+	}
+	headers = canonicalHeaders(headers)
+	result := make(map[string][]string, len(headers)+len(deltas))
+	for header, values := range headers {
+		result[header] = values
+	}
+	for header, headerDeltas := range deltas {
+		header = textproto.CanonicalMIMEHeaderKey(header)
+		changes := make([]listChange, 0, len(headerDeltas))
+		for _, delta := range headerDeltas {
+			changes = append(changes, listChange{op: delta.Op, from: delta.FromPosition, to: delta.ToPosition, value: delta.Value})
+		}
+		values, err := rearrangeStrings(headers[header], changes)
+		if err != nil {
+			return nil, fmt.Errorf("can't apply %s header deltas: %w", header, err)
+		}
+		if len(values) == 0 {
+			delete(result, header)
+			continue
+		}
+		result[header] = values
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
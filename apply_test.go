@@ -0,0 +1,439 @@
+package posts
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// inlinePart returns an inline Part with its SHA256 filled in, the way
+// ApplyRevision leaves inline Parts it changes.
+func inlinePart(id string, pos int, body string) Part {
+	return Part{ID: id, Position: pos, Inline: true, Body: []byte(body), SHA256: sha256Hex([]byte(body))}
+}
+
+func TestApplyRevisionRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	base := Post{
+		ID:      "post",
+		Title:   "Hello, world",
+		Slug:    "hello-world",
+		Authors: []string{"alice", "bob"},
+		Streams: []string{"blog"},
+		Parts: []Part{
+			inlinePart("intro", 0, "An introduction."),
+			inlinePart("body", 1, "The body of the post."),
+			{ID: "image", Position: 2, Headers: map[string][]string{"Content-Type": {"image/png"}}, SHA256: "abc123"},
+		},
+		Metadata: []Part{
+			inlinePart("summary", 0, "A summary."),
+		},
+	}
+
+	tests := map[string]func(post *Post){
+		"no-change": func(post *Post) {},
+		"title-and-slug": func(post *Post) {
+			post.Title = "Goodbye, world"
+			post.Slug = "goodbye-world"
+		},
+		"authors": func(post *Post) {
+			post.Authors = []string{"carol", "bob", "alice"}
+		},
+		"streams": func(post *Post) {
+			post.Streams = []string{"featured", "blog"}
+		},
+		"update-body": func(post *Post) {
+			post.Parts[1] = inlinePart("body", 1, "The new body of the post.")
+		},
+		"add-part": func(post *Post) {
+			added := inlinePart("outro", 1, "Thanks for reading.")
+			added.Anchor = "outro"
+			post.Parts = append(post.Parts[:1], append([]Part{added}, post.Parts[1:]...)...)
+			for pos := range post.Parts {
+				post.Parts[pos].Position = pos
+			}
+		},
+		"remove-part": func(post *Post) {
+			post.Parts = []Part{post.Parts[0], post.Parts[2]}
+			post.Parts[1].Position = 1
+		},
+		"move-parts": func(post *Post) {
+			post.Parts = []Part{post.Parts[2], post.Parts[0], post.Parts[1]}
+			for pos := range post.Parts {
+				post.Parts[pos].Position = pos
+			}
+		},
+		"move-and-update": func(post *Post) {
+			post.Parts = []Part{inlinePart("body", 0, "Body first."), post.Parts[0], post.Parts[2]}
+			post.Parts[1].Position = 1
+		},
+		"headers": func(post *Post) {
+			post.Parts[2].Headers = map[string][]string{
+				"Content-Type": {"image/png"},
+				"X-Alt":        {"A picture"},
+			}
+			post.Parts[0].Headers = map[string][]string{"X-Role": {"heading"}}
+		},
+		"remove-header": func(post *Post) {
+			post.Parts[2].Headers = nil
+		},
+		"anchor": func(post *Post) {
+			post.Parts[0].Anchor = "intro"
+		},
+		"inline-to-non-inline": func(post *Post) {
+			post.Parts[1] = Part{ID: "body", Position: 1, SHA256: "def456"}
+		},
+		"non-inline-to-inline": func(post *Post) {
+			post.Parts[2] = inlinePart("image", 2, "Not an image anymore.")
+			post.Parts[2].Headers = map[string][]string{"Content-Type": {"image/png"}}
+		},
+		"non-inline-changed": func(post *Post) {
+			post.Parts[2].SHA256 = "def456"
+		},
+		"reorder-remove-and-add": func(post *Post) {
+			added := inlinePart("outro", 0, "Thanks for reading.")
+			post.Parts = []Part{post.Parts[2], added, post.Parts[0]}
+			for pos := range post.Parts {
+				post.Parts[pos].Position = pos
+			}
+		},
+		"metadata": func(post *Post) {
+			post.Metadata = []Part{
+				inlinePart("summary", 0, "A better summary."),
+				inlinePart("caption", 1, "A caption."),
+			}
+		},
+		"empty": func(post *Post) {
+			post.Title = ""
+			post.Slug = ""
+			post.Authors = nil
+			post.Streams = nil
+			post.Parts = nil
+			post.Metadata = nil
+		},
+	}
+
+	for name, modify := range tests {
+		name, modify := name, modify
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			want := base
+			want.Authors = append([]string(nil), base.Authors...)
+			want.Parts = append([]Part(nil), base.Parts...)
+			want.Metadata = append([]Part(nil), base.Metadata...)
+			modify(&want)
+
+			rev, err := GenerateRevision(base, want)
+			if err != nil {
+				t.Fatalf("unexpected error generating revision: %s", err)
+			}
+			got, err := ApplyRevision(base, rev)
+			if err != nil {
+				t.Fatalf("unexpected error applying revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected\n%+v\ngot\n%+v", want, got)
+			}
+
+			// and back again
+			rev, err = GenerateRevision(want, base)
+			if err != nil {
+				t.Fatalf("unexpected error generating reverse revision: %s", err)
+			}
+			got, err = ApplyRevision(want, rev)
+			if err != nil {
+				t.Fatalf("unexpected error applying reverse revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, base) {
+				t.Errorf("expected reverse to produce\n%+v\ngot\n%+v", base, got)
+			}
+		})
+	}
+}
+
+func TestApplyRevisionMismatch(t *testing.T) {
+	t.Parallel()
+
+	base := Post{
+		ID:      "post",
+		Title:   "Hello",
+		Authors: []string{"alice"},
+		Parts:   []Part{inlinePart("a", 0, "one"), inlinePart("b", 1, "two")},
+	}
+
+	tests := map[string]Revision{
+		"title-too-long":  {TitleDelta: "=10\t+!"},
+		"title-too-short": {TitleDelta: "=2\t+!"},
+		"malformed-title": {TitleDelta: "*5"},
+		"wrong-author": {AuthorsDeltas: []AuthorsDelta{
+			{Op: DeltaRemove, Author: "bob", FromPosition: 0, ToPosition: -1},
+		}},
+		"part-wrong-position": {PartsDeltas: []PartDelta{
+			{PartID: "a", Op: DeltaUpdate, FromPosition: 1, ToPosition: 1, Body: "=3\t+!"},
+		}},
+		"part-added-twice": {PartsDeltas: []PartDelta{
+			{PartID: "a", Op: DeltaAdd, FromPosition: -1, ToPosition: 0},
+		}},
+		"part-body-mismatch": {PartsDeltas: []PartDelta{
+			{PartID: "b", Op: DeltaUpdate, FromPosition: 1, ToPosition: 1, Body: "=30\t+!"},
+		}},
+		"part-out-of-range": {PartsDeltas: []PartDelta{
+			{PartID: "c", Op: DeltaAdd, FromPosition: -1, ToPosition: 5},
+		}},
+		"parts-collide": {PartsDeltas: []PartDelta{
+			{PartID: "a", Op: DeltaMove, FromPosition: 0, ToPosition: 1},
+			{PartID: "c", Op: DeltaAdd, FromPosition: -1, ToPosition: 1},
+		}},
+		"binary-body-mismatch": {PartsDeltas: []PartDelta{
+			{PartID: "a", Op: DeltaUpdate, FromPosition: 0, ToPosition: 0, Binary: true, Replace: true, BinaryBodyUndo: []byte("\xff\xfe"), BinaryBody: []byte("one")},
+		}},
+		"anchor-mismatch": {PartsDeltas: []PartDelta{
+			{PartID: "a", Op: DeltaUpdate, FromPosition: 0, ToPosition: 0, AnchorFrom: "old", AnchorTo: "new"},
+		}},
+		"unknown-op": {PartsDeltas: []PartDelta{
+			{PartID: "a", Op: "nope", FromPosition: 0, ToPosition: 0},
+		}},
+	}
+
+	for name, rev := range tests {
+		name, rev := name, rev
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ApplyRevision(base, rev)
+			if !errors.Is(err, ErrRevisionMismatch) {
+				t.Errorf("expected ErrRevisionMismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestApplyRevisionStaleBase(t *testing.T) {
+	t.Parallel()
+
+	v1 := Post{ID: "post", Parts: []Part{
+		inlinePart("a", 0, "one"),
+		{ID: "photo", Position: 1, SHA256: "1111", Headers: map[string][]string{"Content-Type": {"image/png"}}},
+	}}
+	v2 := v1.Clone()
+	v2.Parts[1].SHA256 = "2222"
+	v3 := v2.Clone()
+	v3.Parts[1].SHA256 = "3333"
+
+	rev, err := GenerateRevision(v2, v3)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	if _, err := ApplyRevision(v1, rev); !errors.Is(err, ErrRevisionMismatch) {
+		t.Errorf("expected ErrRevisionMismatch applying to a stale base, got %v", err)
+	}
+	got, err := ApplyRevision(v2, rev)
+	if err != nil {
+		t.Fatalf("unexpected error applying revision: %s", err)
+	}
+	if got.Parts[1].SHA256 != "3333" {
+		t.Errorf("expected SHA256 %q, got %q", "3333", got.Parts[1].SHA256)
+	}
+}
+
+func TestApplyPartialRevision(t *testing.T) {
+	t.Parallel()
+
+	base := Post{
+		ID:      "post",
+		Title:   "Hello, world",
+		Slug:    "hello-world",
+		Authors: []string{"alice"},
+		Parts: []Part{
+			inlinePart("intro", 0, "An introduction."),
+			inlinePart("body", 1, "The body of the post."),
+			{ID: "image", Position: 2, SHA256: "abc123"},
+			inlinePart("outro", 3, "Thanks for reading."),
+		},
+		Metadata: []Part{
+			inlinePart("summary", 0, "A summary."),
+		},
+	}
+	// the outro is moved to the top and updated at the same time, so it
+	// gets a DeltaMoveUpdate.
+	target := Post{
+		ID:      "post",
+		Title:   "Goodbye, world",
+		Slug:    "goodbye-world",
+		Authors: []string{"alice", "bob"},
+		Parts: []Part{
+			inlinePart("outro", 0, "Thanks for reading!"),
+			inlinePart("intro", 1, "An introduction."),
+			inlinePart("body", 2, "The new body of the post."),
+			inlinePart("added", 3, "A new part."),
+		},
+		Metadata: []Part{
+			inlinePart("summary", 0, "A better summary."),
+		},
+	}
+	rev, err := GenerateRevision(base, target)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	rev.ID = "rev"
+	rev.Reason = "Tidying up"
+	for _, delta := range rev.PartsDeltas {
+		if delta.PartID == "outro" && delta.Op != DeltaMoveUpdate {
+			t.Fatalf("expected the outro to be moved and updated, got %q", delta.Op)
+		}
+	}
+
+	acceptAll := func(PartDelta) bool { return true }
+	rejectAll := func(PartDelta) bool { return false }
+	partIDs := func(parts []Part) []string {
+		var ids []string
+		for _, part := range parts {
+			ids = append(ids, part.ID)
+		}
+		return ids
+	}
+	outro := func(post Post) Part {
+		for _, part := range post.Parts {
+			if part.ID == "outro" {
+				return part
+			}
+		}
+		return Part{}
+	}
+
+	tests := map[string]struct {
+		accept                                 func(PartDelta) bool
+		acceptAuthors, acceptTitle, acceptSlug bool
+		check                                  func(t *testing.T, partial Post)
+	}{
+		"accept-everything": {
+			accept:        acceptAll,
+			acceptAuthors: true,
+			acceptTitle:   true,
+			acceptSlug:    true,
+			check: func(t *testing.T, partial Post) {
+				if !reflect.DeepEqual(partial, target) {
+					t.Errorf("expected\n%+v\ngot\n%+v", target, partial)
+				}
+			},
+		},
+		"reject-everything": {
+			accept: rejectAll,
+			check: func(t *testing.T, partial Post) {
+				if !reflect.DeepEqual(partial, base) {
+					t.Errorf("expected\n%+v\ngot\n%+v", base, partial)
+				}
+			},
+		},
+		"title-and-slug": {
+			accept:      rejectAll,
+			acceptTitle: true,
+			acceptSlug:  true,
+			check: func(t *testing.T, partial Post) {
+				if partial.Title != target.Title || partial.Slug != target.Slug {
+					t.Errorf("expected title %q and slug %q, got %q and %q", target.Title, target.Slug, partial.Title, partial.Slug)
+				}
+				if !reflect.DeepEqual(partial.Authors, base.Authors) {
+					t.Errorf("expected authors %v, got %v", base.Authors, partial.Authors)
+				}
+			},
+		},
+		"additions-and-removals": {
+			accept: func(delta PartDelta) bool {
+				return delta.Op == DeltaAdd || delta.Op == DeltaRemove
+			},
+			check: func(t *testing.T, partial Post) {
+				want := []string{"intro", "body", "outro", "added"}
+				if got := partIDs(partial.Parts); !reflect.DeepEqual(got, want) {
+					t.Errorf("expected parts %v, got %v", want, got)
+				}
+			},
+		},
+		"reject-removal": {
+			accept: func(delta PartDelta) bool {
+				return delta.Op != DeltaRemove
+			},
+			check: func(t *testing.T, partial Post) {
+				want := []string{"outro", "intro", "body", "image", "added"}
+				if got := partIDs(partial.Parts); !reflect.DeepEqual(got, want) {
+					t.Errorf("expected parts %v, got %v", want, got)
+				}
+			},
+		},
+		"accept-move-reject-update": {
+			accept: func(delta PartDelta) bool {
+				return delta.PartID == "outro" && delta.Op == DeltaMove
+			},
+			check: func(t *testing.T, partial Post) {
+				want := []string{"outro", "intro", "body", "image"}
+				if got := partIDs(partial.Parts); !reflect.DeepEqual(got, want) {
+					t.Errorf("expected parts %v, got %v", want, got)
+				}
+				if got := outro(partial); string(got.Body) != "Thanks for reading." {
+					t.Errorf("expected the outro not to be updated, got %q", got.Body)
+				}
+			},
+		},
+		"accept-update-reject-move": {
+			accept: func(delta PartDelta) bool {
+				return delta.PartID == "outro" && delta.Op == DeltaUpdate
+			},
+			check: func(t *testing.T, partial Post) {
+				want := []string{"intro", "body", "image", "outro"}
+				if got := partIDs(partial.Parts); !reflect.DeepEqual(got, want) {
+					t.Errorf("expected parts %v, got %v", want, got)
+				}
+				if got := outro(partial); string(got.Body) != "Thanks for reading!" {
+					t.Errorf("expected the outro to be updated, got %q", got.Body)
+				}
+			},
+		},
+		"metadata-only": {
+			accept: func(delta PartDelta) bool {
+				return delta.PartID == "summary"
+			},
+			check: func(t *testing.T, partial Post) {
+				if !reflect.DeepEqual(partial.Metadata, target.Metadata) {
+					t.Errorf("expected metadata %+v, got %+v", target.Metadata, partial.Metadata)
+				}
+				if !reflect.DeepEqual(partial.Parts, base.Parts) {
+					t.Errorf("expected parts %+v, got %+v", base.Parts, partial.Parts)
+				}
+			},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			partial, residual, err := ApplyPartialRevision(base, rev, test.accept, test.acceptAuthors, test.acceptTitle, test.acceptSlug)
+			if err != nil {
+				t.Fatalf("unexpected error applying partial revision: %s", err)
+			}
+			test.check(t, partial)
+			if residual.ID != "" || residual.Reason != rev.Reason {
+				t.Errorf("expected a residual revision with no ID and reason %q, got ID %q and reason %q", rev.Reason, residual.ID, residual.Reason)
+			}
+
+			// the rejected changes still get the post to the target.
+			got, err := ApplyRevision(partial, residual)
+			if err != nil {
+				t.Fatalf("unexpected error applying residual revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, target) {
+				t.Errorf("expected the residual revision to produce\n%+v\ngot\n%+v", target, got)
+			}
+		})
+	}
+
+	if _, residual, err := ApplyPartialRevision(base, rev, acceptAll, true, true, true); err != nil || !residual.IsEmpty() {
+		t.Errorf("expected an empty residual revision accepting everything, got %+v, %v", residual, err)
+	}
+	if _, _, err := ApplyPartialRevision(target, rev, acceptAll, true, true, true); !errors.Is(err, ErrRevisionMismatch) {
+		t.Errorf("expected ErrRevisionMismatch applying to the wrong post, got %v", err)
+	}
+}
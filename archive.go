@@ -0,0 +1,212 @@
+package posts
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ArchiveVersion is the version of the archive format written by ExportPost.
+// ImportPost refuses archives with any other version.
+const ArchiveVersion = 1
+
+const (
+	// archiveManifestName is the name of the archive entry holding the
+	// archiveManifest.
+	archiveManifestName = "manifest.json"
+
+	// archiveBlobPrefix is prepended to the SHA256 of a non-inline Part's
+	// body to get the name of the archive entry holding it.
+	archiveBlobPrefix = "blobs/"
+)
+
+// archiveManifest describes the Post in an archive.
+type archiveManifest struct {
+	Version int
+	Post    Post
+}
+
+// ExportPost writes p to w as a tar archive, along with the bodies of its
+// non-inline Parts and Metadata parts, read from blobs. The archive holds a
+// JSON manifest of the Post, followed by one entry per body, named after
+// its SHA256. A body shared by several parts is only written once. The
+// archive can be read back with ImportPost.
+func ExportPost(ctx context.Context, w io.Writer, p Post, blobs BlobStore) error {
+	manifest, err := json.Marshal(archiveManifest{Version: ArchiveVersion, Post: p})
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %w", err)
+	}
+	archive := tar.NewWriter(w)
+	if err := writeArchiveEntry(archive, archiveManifestName, manifest); err != nil {
+		return err
+	}
+	for _, sha := range postBlobs(p) {
+		body, err := readBlobBody(ctx, blobs, sha)
+		if err != nil {
+			return err
+		}
+		if err := writeArchiveEntry(archive, archiveBlobPrefix+sha, body); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("error finishing archive: %w", err)
+	}
+	return nil
+}
+
+// DefaultMaxArchiveEntrySize is the largest archive entry ImportPost accepts
+// unless WithMaxArchiveEntrySize says otherwise.
+const DefaultMaxArchiveEntrySize = 256 << 20
+
+// ErrArchiveEntryTooLarge is returned when an archive entry is larger than
+// ImportPost accepts.
+var ErrArchiveEntryTooLarge = errors.New("archive entry too large")
+
+// ImportOption changes how ImportPost reads an archive.
+type ImportOption func(*importOptions)
+
+type importOptions struct {
+	maxEntrySize int64
+}
+
+// WithMaxArchiveEntrySize makes ImportPost reject any archive entry larger
+// than n bytes, instead of DefaultMaxArchiveEntrySize.
+func WithMaxArchiveEntrySize(n int64) ImportOption {
+	return func(opts *importOptions) {
+		opts.maxEntrySize = n
+	}
+}
+
+// ImportPost reads a Post written by ExportPost from r, storing the bodies of
+// its non-inline Parts and Metadata parts in blobs, and returns the Post.
+// Like any Post read from JSON, its non-inline parts have no Body; see
+// Part.MarshalJSON.
+//
+// Every body is checked against the SHA256 it's stored under before
+// anything is stored, and an error wrapping ErrSHA256Mismatch is returned
+// if one doesn't match. An error is also returned if the archive is missing
+// a body the Post needs. Every entry, including the manifest, is read into
+// memory, so an error wrapping ErrArchiveEntryTooLarge is returned for any
+// entry larger than DefaultMaxArchiveEntrySize, or the size set with
+// WithMaxArchiveEntrySize, without reading the rest of it.
+func ImportPost(ctx context.Context, r io.Reader, blobs BlobStore, opts ...ImportOption) (Post, error) {
+	options := importOptions{maxEntrySize: DefaultMaxArchiveEntrySize}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	archive := tar.NewReader(r)
+	var manifest *archiveManifest
+	bodies := map[string][]byte{}
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Post{}, fmt.Errorf("error reading archive: %w", err)
+		}
+		if header.Size > options.maxEntrySize {
+			return Post{}, fmt.Errorf("%w: archive entry %s is %d bytes, limit is %d", ErrArchiveEntryTooLarge, header.Name, header.Size, options.maxEntrySize)
+		}
+		// the tar reader already stops at the header's size, but the read
+		// is bounded too, one byte past the limit, so the limit doesn't
+		// depend on that.
+		contents, err := io.ReadAll(io.LimitReader(archive, options.maxEntrySize+1))
+		if err != nil {
+			return Post{}, fmt.Errorf("error reading archive entry %s: %w", header.Name, err)
+		}
+		if int64(len(contents)) > options.maxEntrySize {
+			return Post{}, fmt.Errorf("%w: archive entry %s is more than %d bytes", ErrArchiveEntryTooLarge, header.Name, options.maxEntrySize)
+		}
+		switch {
+		case header.Name == archiveManifestName:
+			manifest = &archiveManifest{}
+			if err := json.Unmarshal(contents, manifest); err != nil {
+				return Post{}, fmt.Errorf("error decoding manifest: %w", err)
+			}
+		case strings.HasPrefix(header.Name, archiveBlobPrefix):
+			sha := strings.TrimPrefix(header.Name, archiveBlobPrefix)
+			if sum := sha256Hex(contents); sum != sha {
+				return Post{}, fmt.Errorf("%w: archive entry %s has SHA256 %q", ErrSHA256Mismatch, header.Name, sum)
+			}
+			bodies[sha] = contents
+		default:
+			return Post{}, fmt.Errorf("unexpected archive entry %s", header.Name)
+		}
+	}
+	if manifest == nil {
+		return Post{}, errors.New("archive has no manifest")
+	}
+	if manifest.Version != ArchiveVersion {
+		return Post{}, fmt.Errorf("unsupported archive version %d", manifest.Version)
+	}
+	needed := postBlobs(manifest.Post)
+	for _, sha := range needed {
+		if _, ok := bodies[sha]; !ok {
+			return Post{}, fmt.Errorf("archive is missing the body with SHA256 %s", sha)
+		}
+	}
+	for _, sha := range needed {
+		if err := blobs.Put(ctx, sha, bytes.NewReader(bodies[sha])); err != nil {
+			return Post{}, fmt.Errorf("error storing body %s: %w", sha, err)
+		}
+	}
+	return manifest.Post, nil
+}
+
+// postBlobs returns the SHA256s of the bodies of p's non-inline Parts and
+// Metadata parts, each listed once, in the order they first appear.
+func postBlobs(p Post) []string {
+	var blobs []string
+	seen := map[string]struct{}{}
+	for _, parts := range [][]Part{p.Parts, p.Metadata} {
+		for _, part := range parts {
+			if part.Inline {
+				continue
+			}
+			if _, ok := seen[part.SHA256]; ok {
+				continue
+			}
+			seen[part.SHA256] = struct{}{}
+			blobs = append(blobs, part.SHA256)
+		}
+	}
+	return blobs
+}
+
+// readBlobBody returns the body stored in blobs under sha.
+func readBlobBody(ctx context.Context, blobs BlobStore, sha string) ([]byte, error) {
+	body, err := blobs.Get(ctx, sha)
+	if err != nil {
+		return nil, fmt.Errorf("error getting body %s: %w", sha, err)
+	}
+	defer body.Close()
+	contents, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading body %s: %w", sha, err)
+	}
+	return contents, nil
+}
+
+// writeArchiveEntry writes a file named name, holding contents, to archive.
+func writeArchiveEntry(archive *tar.Writer, name string, contents []byte) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(contents)),
+		Typeflag: tar.TypeReg,
+	}
+	if err := archive.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writing archive entry %s: %w", name, err)
+	}
+	if _, err := archive.Write(contents); err != nil {
+		return fmt.Errorf("error writing archive entry %s: %w", name, err)
+	}
+	return nil
+}
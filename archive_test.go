@@ -0,0 +1,178 @@
+package posts
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExportImportPost(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	image := []byte("\x89PNG not really")
+	header := []byte("GIF89a not really")
+	post := Post{
+		ID:          "post",
+		Title:       "Hello",
+		Slug:        "hello",
+		Authors:     []string{"alice"},
+		PublishedAt: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Parts: []Part{
+			{ID: "intro", Position: 0, Inline: true, Body: []byte("Hello"), Headers: map[string][]string{"Content-Type": {"text/plain"}}},
+			{ID: "photo", Position: 1, SHA256: sha256Hex(image), Headers: map[string][]string{"Content-Type": {"image/png"}}},
+			{ID: "photo-again", Position: 2, SHA256: sha256Hex(image), Headers: map[string][]string{"Content-Type": {"image/png"}}},
+		},
+		Metadata: []Part{
+			{ID: "header", Position: 0, SHA256: sha256Hex(header), Headers: map[string][]string{"Content-Type": {"image/gif"}}},
+		},
+	}
+	source := NewInMemoryBlobStore()
+	for _, body := range [][]byte{image, header} {
+		if err := source.Put(ctx, sha256Hex(body), bytes.NewReader(body)); err != nil {
+			t.Fatalf("unexpected error storing blob: %s", err)
+		}
+	}
+
+	var archive bytes.Buffer
+	if err := ExportPost(ctx, &archive, post, source); err != nil {
+		t.Fatalf("unexpected error exporting post: %s", err)
+	}
+	dest := NewInMemoryBlobStore()
+	imported, err := ImportPost(ctx, bytes.NewReader(archive.Bytes()), dest)
+	if err != nil {
+		t.Fatalf("unexpected error importing post: %s", err)
+	}
+	if !reflect.DeepEqual(imported, post) {
+		t.Errorf("expected\n%+v\ngot\n%+v", post, imported)
+	}
+	for _, body := range [][]byte{image, header} {
+		if got := readBlob(t, dest, sha256Hex(body)); !bytes.Equal(got, body) {
+			t.Errorf("expected imported body %q, got %q", body, got)
+		}
+	}
+}
+
+func TestExportPostMissingBlob(t *testing.T) {
+	t.Parallel()
+
+	post := Post{ID: "post", Parts: []Part{{ID: "photo", SHA256: sha256Hex([]byte("missing"))}}}
+	var archive bytes.Buffer
+	err := ExportPost(context.Background(), &archive, post, NewInMemoryBlobStore())
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestImportPostInvalid(t *testing.T) {
+	t.Parallel()
+
+	image := []byte("\x89PNG not really")
+	manifest := []byte(`{"Version":1,"Post":{"ID":"post","Parts":[{"ID":"photo","SHA256":"` + sha256Hex(image) + `"}]}}`)
+
+	tests := map[string]struct {
+		entries  map[string][]byte
+		mismatch bool
+	}{
+		"tampered-body": {
+			entries:  map[string][]byte{archiveManifestName: manifest, archiveBlobPrefix + sha256Hex(image): []byte("tampered")},
+			mismatch: true,
+		},
+		"missing-body": {
+			entries: map[string][]byte{archiveManifestName: manifest},
+		},
+		"missing-manifest": {
+			entries: map[string][]byte{archiveBlobPrefix + sha256Hex(image): image},
+		},
+		"unknown-version": {
+			entries: map[string][]byte{archiveManifestName: []byte(`{"Version":2,"Post":{"ID":"post"}}`)},
+		},
+		"unexpected-entry": {
+			entries: map[string][]byte{archiveManifestName: manifest, archiveBlobPrefix + sha256Hex(image): image, "extra.txt": nil},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var archive bytes.Buffer
+			writer := tar.NewWriter(&archive)
+			for _, entryName := range []string{archiveManifestName, archiveBlobPrefix + sha256Hex(image), "extra.txt"} {
+				contents, ok := test.entries[entryName]
+				if !ok {
+					continue
+				}
+				if err := writeArchiveEntry(writer, entryName, contents); err != nil {
+					t.Fatalf("unexpected error writing archive: %s", err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("unexpected error writing archive: %s", err)
+			}
+
+			store := NewInMemoryBlobStore()
+			_, err := ImportPost(context.Background(), &archive, store)
+			if err == nil {
+				t.Fatalf("expected an error importing archive")
+			}
+			if test.mismatch && !errors.Is(err, ErrSHA256Mismatch) {
+				t.Errorf("expected ErrSHA256Mismatch, got %v", err)
+			}
+			if exists, _ := store.Exists(context.Background(), sha256Hex(image)); exists {
+				t.Errorf("expected nothing to be stored from an invalid archive")
+			}
+		})
+	}
+}
+
+func TestImportPostMaxEntrySize(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	image := []byte("\x89PNG not really")
+	post := Post{ID: "post", Parts: []Part{{ID: "photo", SHA256: sha256Hex(image)}}}
+	source := NewInMemoryBlobStore()
+	if err := source.Put(ctx, sha256Hex(image), bytes.NewReader(image)); err != nil {
+		t.Fatalf("unexpected error storing blob: %s", err)
+	}
+	var archive bytes.Buffer
+	if err := ExportPost(ctx, &archive, post, source); err != nil {
+		t.Fatalf("unexpected error exporting post: %s", err)
+	}
+
+	tests := map[string]struct {
+		max     int64
+		wantErr bool
+	}{
+		"under-limit": {max: 1024},
+		"over-limit":  {max: int64(len(image)) - 1, wantErr: true},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			store := NewInMemoryBlobStore()
+			_, err := ImportPost(ctx, bytes.NewReader(archive.Bytes()), store, WithMaxArchiveEntrySize(test.max))
+			if !test.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error importing post: %s", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrArchiveEntryTooLarge) {
+				t.Errorf("expected ErrArchiveEntryTooLarge, got %v", err)
+			}
+			if exists, _ := store.Exists(ctx, sha256Hex(image)); exists {
+				t.Errorf("expected nothing to be stored from a rejected archive")
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package posts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// BlobStore captures the interface for storing and retrieving the bodies of
+// non-inline Parts, which live outside the database in something like an
+// object store. Bodies are addressed by their hex-encoded SHA 256 sum, the
+// same as a Part's SHA256.
+type BlobStore interface {
+	// Put stores the contents of body under sha256. It returns an error
+	// wrapping ErrSHA256Mismatch if body's SHA 256 sum isn't sha256.
+	// Storing the same body more than once must succeed without
+	// changing anything.
+	Put(ctx context.Context, sha256 string, body io.Reader) error
+
+	// Get retrieves the body stored under sha256, returning an error
+	// wrapping ErrNotFound if there isn't one. The caller must close the
+	// returned ReadCloser.
+	Get(ctx context.Context, sha256 string) (io.ReadCloser, error)
+
+	// Exists returns true if a body is stored under sha256.
+	Exists(ctx context.Context, sha256 string) (bool, error)
+
+	// Delete removes the body stored under sha256. Deleting a body that
+	// isn't stored must succeed without changing anything, so
+	// interrupted deletes can be retried.
+	Delete(ctx context.Context, sha256 string) error
+}
+
+// StorePart writes the Body of a non-inline Part to store under its SHA256.
+// An error wrapping ErrSHA256Mismatch is returned, and nothing is stored, if
+// the Part's SHA256 isn't the SHA 256 sum of its Body.
+//
+// Bodies are addressed by their content, so if store already has a body under
+// the Part's SHA256, like when the same image is used by another Part, it
+// isn't uploaded again.
+func StorePart(ctx context.Context, store BlobStore, part Part) error {
+	if part.Inline {
+		return fmt.Errorf("part %s is inline, so its body isn't stored as a blob", part.ID)
+	}
+	if err := part.VerifySHA256(); err != nil {
+		return err
+	}
+	exists, err := store.Exists(ctx, part.SHA256)
+	if err != nil {
+		return fmt.Errorf("error checking for body of part %s: %w", part.ID, err)
+	}
+	if exists {
+		return nil
+	}
+	if err := store.Put(ctx, part.SHA256, bytes.NewReader(part.Body)); err != nil {
+		return fmt.Errorf("error storing body of part %s: %w", part.ID, err)
+	}
+	return nil
+}
+
+// RevisionBlobs returns the SHA256s of the bodies rev's non-inline Parts and
+// Metadata parts need, in the order they first appear, for checking which
+// bodies need to be stored before rev is applied. Each SHA256 is only
+// listed once, even when several parts share it, like the same image used
+// twice. Parts whose SHA256 doesn't change aren't included, as their bodies
+// must already be stored.
+func RevisionBlobs(rev Revision) []string {
+	var blobs []string
+	seen := map[string]struct{}{}
+	for _, deltas := range [][]PartDelta{rev.PartsDeltas, rev.MetadataDeltas} {
+		for _, delta := range deltas {
+			if delta.SHA256To == "" || delta.SHA256To == delta.SHA256From {
+				continue
+			}
+			if _, ok := seen[delta.SHA256To]; ok {
+				continue
+			}
+			seen[delta.SHA256To] = struct{}{}
+			blobs = append(blobs, delta.SHA256To)
+		}
+	}
+	return blobs
+}
@@ -0,0 +1,155 @@
+package posts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestStorePart(t *testing.T) {
+	t.Parallel()
+
+	body := []byte("\x89PNG not really")
+	tests := map[string]struct {
+		part    Part
+		wantErr error
+		stored  bool
+	}{
+		"stored": {
+			part:   Part{ID: "image", Body: body, SHA256: sha256Hex(body)},
+			stored: true,
+		},
+		"hash-mismatch": {
+			part:    Part{ID: "image", Body: body, SHA256: sha256Hex([]byte("something else"))},
+			wantErr: ErrSHA256Mismatch,
+		},
+		"missing-hash": {
+			part:    Part{ID: "image", Body: body},
+			wantErr: ErrSHA256Mismatch,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			store := NewInMemoryBlobStore()
+			err := StorePart(ctx, store, test.part)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("expected error %v, got %v", test.wantErr, err)
+			}
+			exists, err := store.Exists(ctx, test.part.SHA256)
+			if err != nil {
+				t.Fatalf("unexpected error checking for blob: %s", err)
+			}
+			if exists != test.stored {
+				t.Fatalf("expected blob to exist to be %v, got %v", test.stored, exists)
+			}
+			if test.stored {
+				if got := readBlob(t, store, test.part.SHA256); !bytes.Equal(got, test.part.Body) {
+					t.Errorf("expected stored body %q, got %q", test.part.Body, got)
+				}
+			}
+		})
+	}
+}
+
+func TestStorePartInline(t *testing.T) {
+	t.Parallel()
+
+	store := NewInMemoryBlobStore()
+	part := inlinePart("intro", 0, "Hello")
+	if err := StorePart(context.Background(), store, part); err == nil {
+		t.Errorf("expected an error storing an inline part")
+	}
+}
+
+func TestStorePartDuplicate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := &countingBlobStore{BlobStore: NewInMemoryBlobStore()}
+	body := []byte("\x89PNG not really")
+	for _, id := range []string{"first", "second"} {
+		if err := StorePart(ctx, store, Part{ID: id, Body: body, SHA256: sha256Hex(body)}); err != nil {
+			t.Fatalf("unexpected error storing part %s: %s", id, err)
+		}
+	}
+	if store.puts != 1 {
+		t.Errorf("expected the shared body to be stored once, got %d puts", store.puts)
+	}
+}
+
+func TestRevisionBlobs(t *testing.T) {
+	t.Parallel()
+
+	image := []byte("\x89PNG not really")
+	other := []byte("GIF89a not really")
+	imagePart := func(id string, pos int, body []byte) Part {
+		return Part{ID: id, Position: pos, SHA256: sha256Hex(body), Headers: map[string][]string{"Content-Type": {"image/png"}}}
+	}
+	p1 := Post{ID: "post", Parts: []Part{
+		inlinePart("intro", 0, "Hello"),
+		imagePart("existing", 1, other),
+	}}
+	p2 := Post{ID: "post", Parts: []Part{
+		imagePart("existing", 0, other),
+		inlinePart("intro", 1, "Hello"),
+		imagePart("first", 2, image),
+		imagePart("second", 3, image),
+	}}
+
+	rev, err := GenerateRevision(p1, p2)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	var added int
+	for _, delta := range rev.PartsDeltas {
+		if delta.Body != "" || delta.BodyUndo != "" || delta.BinaryBody != nil {
+			t.Errorf("expected no body payload for part %s, got %+v", delta.PartID, delta)
+		}
+		if delta.Op == DeltaAdd {
+			added++
+			if delta.SHA256To != sha256Hex(image) {
+				t.Errorf("expected part %s to reference the shared blob, got %q", delta.PartID, delta.SHA256To)
+			}
+		}
+	}
+	if added != 2 {
+		t.Errorf("expected 2 added parts, got %+v", rev.PartsDeltas)
+	}
+	blobs := RevisionBlobs(rev)
+	if len(blobs) != 1 || blobs[0] != sha256Hex(image) {
+		t.Errorf("expected only the shared blob, got %v", blobs)
+	}
+}
+
+// countingBlobStore is a BlobStore that counts calls to Put.
+type countingBlobStore struct {
+	BlobStore
+	puts int
+}
+
+func (c *countingBlobStore) Put(ctx context.Context, sha256 string, body io.Reader) error {
+	c.puts++
+	return c.BlobStore.Put(ctx, sha256, body)
+}
+
+func readBlob(t *testing.T, store BlobStore, sha256 string) []byte {
+	t.Helper()
+
+	body, err := store.Get(context.Background(), sha256)
+	if err != nil {
+		t.Fatalf("unexpected error getting blob: %s", err)
+	}
+	defer body.Close()
+	contents, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("unexpected error reading blob: %s", err)
+	}
+	return contents
+}
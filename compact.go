@@ -0,0 +1,172 @@
+package posts
+
+// Compact returns a copy of the Revision with everything that doesn't affect
+// the result of applying it, or of applying its inverse, removed, so it takes
+// up as little space as possible when it's stored:
+//
+//   - Body, BodyUndo, BinaryBody, and BinaryBodyUndo are dropped from
+//     PartDeltas for parts that aren't inline before or after the change,
+//     whose content is described by SHA256From and SHA256To instead. Parts
+//     that are added or removed only count their side of the change; a
+//     removed inline part keeps its BodyUndo, so the inverse can add it
+//     back.
+//   - Deltas that only keep characters, like =5, are replaced with empty
+//     Deltas, which describe the same lack of change, and Replace is cleared
+//     from PartDeltas left without a body change to replace.
+//   - HeaderDeltas without an Op, and header keys without any HeaderDeltas
+//     left, are removed.
+//   - PartDeltas left without anything to change are removed if they're
+//     DeltaUpdate or don't have an Op and the part ends up in the same place
+//     without them, and become DeltaMove otherwise.
+//
+// The invariant Compact maintains is that, for any Post a Revision applies
+// to, ApplyRevision produces the same Post from the Revision and from its
+// compacted copy, and the same is true of their inverses. Compacting a
+// Revision that's already compact returns an equal Revision. Because empty
+// Deltas skip the length checks ApplyRevision does for non-empty ones, a
+// compacted Revision may apply to Posts the original would have been rejected
+// by; use ValidateAgainst to catch that.
+//
+// The Revision's ID and other properties describing it are kept as they are.
+func (r Revision) Compact() Revision {
+	r.TitleDelta = compactDelta(r.TitleDelta)
+	r.TitleUndo = compactDelta(r.TitleUndo)
+	r.SlugDelta = compactDelta(r.SlugDelta)
+	r.SlugUndo = compactDelta(r.SlugUndo)
+	r.PartsDeltas = compactPartDeltas(r.PartsDeltas)
+	r.MetadataDeltas = compactPartDeltas(r.MetadataDeltas)
+	return r
+}
+
+// compactDelta returns an empty Delta if d describes no change, or d if it
+// does.
+func compactDelta(d Delta) Delta {
+	if d.IsEmpty() {
+		return ""
+	}
+	return d
+}
+
+// compactPartDeltas returns a compacted copy of deltas, leaving deltas as it
+// is.
+func compactPartDeltas(deltas []PartDelta) []PartDelta {
+	if deltas == nil {
+		return nil
+	}
+	taken, placed := map[int]struct{}{}, map[int]struct{}{}
+	for _, delta := range deltas {
+		if delta.Op != DeltaAdd {
+			taken[delta.FromPosition] = struct{}{}
+		}
+		if delta.Op != DeltaRemove {
+			placed[delta.ToPosition] = struct{}{}
+		}
+	}
+	compacted := make([]PartDelta, 0, len(deltas))
+	for _, delta := range deltas {
+		delta.Headers = compactHeaderDeltas(delta.Headers)
+
+		// SHA256From and SHA256To are only set for the sides of the
+		// change where the part isn't inline; a part that's being
+		// added has no body before the change, and one that's being
+		// removed has none after it.
+		notInlineBefore := delta.SHA256From != "" || delta.Op == DeltaAdd
+		notInlineAfter := delta.SHA256To != "" || delta.Op == DeltaRemove
+		if notInlineBefore && notInlineAfter {
+			delta.Body, delta.BodyUndo = "", ""
+			delta.BinaryBody, delta.BinaryBodyUndo = nil, nil
+			delta.Binary, delta.Replace = false, false
+		}
+		delta.Body = compactDelta(delta.Body)
+		delta.BodyUndo = compactDelta(delta.BodyUndo)
+		if !delta.Binary && delta.Body == "" && delta.BodyUndo == "" {
+			// there's nothing left being replaced.
+			delta.Replace = false
+		}
+
+		if !changesPart(delta) {
+			switch delta.Op {
+			case DeltaUpdate, "":
+				if landsUntouched(taken, placed, delta.FromPosition, delta.ToPosition) {
+					delete(taken, delta.FromPosition)
+					delete(placed, delta.ToPosition)
+					continue
+				}
+				// the delta is still needed to put the part
+				// in its place.
+				delta.Op = DeltaMove
+			case DeltaMoveUpdate:
+				delta.Op = DeltaMove
+			}
+		}
+		compacted = append(compacted, delta)
+	}
+	return compacted
+}
+
+// changesPart returns true if delta changes the content of the part it
+// applies to, not counting any change to its position.
+func changesPart(delta PartDelta) bool {
+	return len(delta.Headers) > 0 || delta.AnchorFrom != delta.AnchorTo ||
+		delta.Body != "" || delta.BodyUndo != "" || delta.Binary ||
+		delta.SHA256From != delta.SHA256To
+}
+
+// compactHeaderDeltas returns a copy of deltas without any HeaderDeltas that
+// don't have an Op or header keys that don't have any HeaderDeltas, or nil
+// if there's nothing left.
+func compactHeaderDeltas(deltas map[string][]HeaderDelta) map[string][]HeaderDelta {
+	var compacted map[string][]HeaderDelta
+	for header, headerDeltas := range deltas {
+		var kept []HeaderDelta
+		for _, delta := range headerDeltas {
+			if delta.Op != "" {
+				kept = append(kept, delta)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		if compacted == nil {
+			compacted = map[string][]HeaderDelta{}
+		}
+		compacted[header] = kept
+	}
+	return compacted
+}
+
+// revisionDeltaOverhead is roughly how many bytes each delta in a Revision
+// takes up beyond its text: its op, positions, and field names.
+const revisionDeltaOverhead = 32
+
+// ByteSize returns an estimate of how many bytes the Revision takes up when
+// it's stored: the length of its deltas, IDs, values, and binary bodies, and
+// a fixed overhead for each delta. It's cheap to compute, and meant for
+// deciding things like whether a Revision is small enough to store inline or
+// should be offloaded to blob storage, not for exact accounting.
+func (r Revision) ByteSize() int {
+	size := len(r.ID) + len(r.Reason) + len(r.Status) + len(r.AuthorID) + len(r.ActorType) +
+		len(r.TitleDelta) + len(r.TitleUndo) + len(r.SlugDelta) + len(r.SlugUndo)
+	for _, delta := range r.AuthorsDeltas {
+		size += revisionDeltaOverhead + len(delta.Author)
+	}
+	for _, delta := range r.StreamsDeltas {
+		size += revisionDeltaOverhead + len(delta.Stream)
+	}
+	for _, deltas := range [][]PartDelta{r.PartsDeltas, r.MetadataDeltas} {
+		for _, delta := range deltas {
+			size += revisionDeltaOverhead + len(delta.PartID) +
+				len(delta.Body) + len(delta.BodyUndo) +
+				len(delta.BinaryBody) + len(delta.BinaryBodyUndo) +
+				len(delta.AnchorFrom) + len(delta.AnchorTo) +
+				len(delta.SHA256From) + len(delta.SHA256To)
+			for header, headerDeltas := range delta.Headers {
+				size += len(header)
+				for _, headerDelta := range headerDeltas {
+					size += revisionDeltaOverhead + len(headerDelta.Value)
+				}
+			}
+		}
+	}
+	return size
+}
@@ -0,0 +1,232 @@
+package posts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRevisionCompact(t *testing.T) {
+	t.Parallel()
+
+	base := Post{
+		ID:    "post",
+		Title: "Hello",
+		Slug:  "hello",
+		Parts: []Part{
+			inlinePart("intro", 0, "Hello, world"),
+			{ID: "image", Position: 1, SHA256: "abc123"},
+			inlinePart("outro", 2, "Goodbye"),
+		},
+	}
+
+	type testCase struct {
+		rev func(t *testing.T) Revision
+		// want is the compacted Revision, when it's worth spelling
+		// out.
+		want *Revision
+	}
+
+	tests := map[string]testCase{
+		"generated": {
+			rev: func(t *testing.T) Revision {
+				after := base.Clone()
+				after.Title = "Hello, world"
+				after.Parts[0].Body = []byte(strings.Repeat("Hello, world. ", 10))
+				after.Parts[0].ComputeSHA256()
+				after.Parts[1].Inline = true
+				after.Parts[1].Body = []byte("now inline")
+				after.Parts[1].ComputeSHA256()
+				after.Parts = after.Parts[:2]
+				rev, err := GenerateRevision(base, after)
+				if err != nil {
+					t.Fatalf("unexpected error generating revision: %s", err)
+				}
+				return rev
+			},
+		},
+		"no-op": {
+			rev: func(*testing.T) Revision {
+				return Revision{
+					TitleDelta: "=5",
+					TitleUndo:  "=5",
+					SlugDelta:  "=2\t=3",
+					PartsDeltas: []PartDelta{
+						{
+							PartID:       "intro",
+							Op:           DeltaUpdate,
+							FromPosition: 0,
+							ToPosition:   0,
+							Body:         "=12",
+							BodyUndo:     "=12",
+							Headers:      map[string][]HeaderDelta{"X-Tag": {}},
+						},
+						{
+							// non-inline parts have no body to
+							// patch.
+							PartID:       "image",
+							Op:           DeltaMoveUpdate,
+							FromPosition: 1,
+							ToPosition:   2,
+							Body:         "+stray",
+							BodyUndo:     "-5",
+							Replace:      true,
+							SHA256From:   "abc123",
+							SHA256To:     "abc123",
+						},
+						{
+							PartID:       "outro",
+							Op:           DeltaMove,
+							FromPosition: 2,
+							ToPosition:   1,
+						},
+					},
+				}
+			},
+			want: &Revision{
+				PartsDeltas: []PartDelta{
+					{
+						PartID:       "image",
+						Op:           DeltaMove,
+						FromPosition: 1,
+						ToPosition:   2,
+						SHA256From:   "abc123",
+						SHA256To:     "abc123",
+					},
+					{
+						PartID:       "outro",
+						Op:           DeltaMove,
+						FromPosition: 2,
+						ToPosition:   1,
+					},
+				},
+			},
+		},
+		// a part that doesn't change still needs its delta when the
+		// parts moving around it would shift it without one.
+		"pinned": {
+			rev: func(*testing.T) Revision {
+				return Revision{
+					PartsDeltas: []PartDelta{
+						{
+							PartID:       "outro",
+							Op:           DeltaMove,
+							FromPosition: 2,
+							ToPosition:   0,
+						},
+						{
+							PartID:       "image",
+							Op:           DeltaUpdate,
+							FromPosition: 1,
+							ToPosition:   1,
+							SHA256From:   "abc123",
+							SHA256To:     "abc123",
+						},
+					},
+				}
+			},
+			want: &Revision{
+				PartsDeltas: []PartDelta{
+					{
+						PartID:       "outro",
+						Op:           DeltaMove,
+						FromPosition: 2,
+						ToPosition:   0,
+					},
+					{
+						PartID:       "image",
+						Op:           DeltaMove,
+						FromPosition: 1,
+						ToPosition:   1,
+						SHA256From:   "abc123",
+						SHA256To:     "abc123",
+					},
+				},
+			},
+		},
+		"non-inline-sha256-changed": {
+			rev: func(*testing.T) Revision {
+				return Revision{
+					PartsDeltas: []PartDelta{{
+						PartID:       "image",
+						Op:           DeltaUpdate,
+						FromPosition: 1,
+						ToPosition:   1,
+						Binary:       true,
+						Replace:      true,
+						BinaryBody:   []byte{0xff},
+						SHA256From:   "abc123",
+						SHA256To:     "def456",
+					}},
+				}
+			},
+			want: &Revision{
+				PartsDeltas: []PartDelta{{
+					PartID:       "image",
+					Op:           DeltaUpdate,
+					FromPosition: 1,
+					ToPosition:   1,
+					SHA256From:   "abc123",
+					SHA256To:     "def456",
+				}},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rev := test.rev(t)
+			compacted := rev.Compact()
+			if test.want != nil && !reflect.DeepEqual(compacted, *test.want) {
+				t.Errorf("expected\n%+v\ngot\n%+v", *test.want, compacted)
+			}
+			if again := compacted.Compact(); !reflect.DeepEqual(again, compacted) {
+				t.Errorf("expected compacting again to change nothing, got\n%+v\nfrom\n%+v", again, compacted)
+			}
+			if !reflect.DeepEqual(rev, test.rev(t)) {
+				t.Errorf("expected Compact not to modify the original revision")
+			}
+			if compacted.ByteSize() > rev.ByteSize() {
+				t.Errorf("expected compacting to shrink the revision, got %d bytes from %d", compacted.ByteSize(), rev.ByteSize())
+			}
+
+			want, err := ApplyRevision(base, rev)
+			if err != nil {
+				t.Fatalf("unexpected error applying revision: %s", err)
+			}
+			got, err := ApplyRevision(base, compacted)
+			if err != nil {
+				t.Fatalf("unexpected error applying compacted revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected compacted revision to produce\n%+v\ngot\n%+v", want, got)
+			}
+		})
+	}
+}
+
+func TestRevisionByteSize(t *testing.T) {
+	t.Parallel()
+
+	small := Revision{TitleDelta: "=5\t+!"}
+	large := Revision{
+		TitleDelta: "=5\t+!",
+		PartsDeltas: []PartDelta{{
+			PartID: "part",
+			Op:     DeltaAdd,
+			Body:   Delta("+" + strings.Repeat("a", 1000)),
+		}},
+	}
+	if got := (Revision{}).ByteSize(); got != 0 {
+		t.Errorf("expected an empty revision to be 0 bytes, got %d", got)
+	}
+	if got := small.ByteSize(); got != len(small.TitleDelta) {
+		t.Errorf("expected %d bytes, got %d", len(small.TitleDelta), got)
+	}
+	if got := large.ByteSize(); got < 1000 {
+		t.Errorf("expected at least 1000 bytes, got %d", got)
+	}
+}
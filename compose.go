@@ -0,0 +1,636 @@
+package posts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ComposeRevisions folds revs, in the order they were made, into a single
+// Revision, such that applying it to a Post produces the same Post as
+// applying each of revs to it in turn. Changes to the same part are merged:
+// adding a part and then updating it becomes a single add, adding a part and
+// then removing it cancels out entirely, and so on.
+//
+// Revisions don't record the Post they apply to, so it's up to the caller to
+// only compose Revisions for the same Post, each made against the Post the
+// one before it produced. An error is returned if revs don't fit together,
+// like when one changes a part the one before it removed, or if any of them
+// isn't well-formed; see Revision.Validate.
+//
+// The composed Revision has no ID or Status. It's public if any of revs are,
+// and its Reason is all of their Reasons, one per line.
+func ComposeRevisions(revs ...Revision) (Revision, error) {
+	for pos, rev := range revs {
+		if err := rev.Validate(); err != nil {
+			return Revision{}, fmt.Errorf("can't compose revision %d: %w", pos, err)
+		}
+	}
+	var composed Revision
+	for pos, rev := range revs {
+		if pos == 0 {
+			composed = rev
+			composed.ID = ""
+			composed.Status = RevisionStatusUnset
+			continue
+		}
+		var err error
+		composed, err = composeRevisions(composed, rev)
+		if err != nil {
+			return Revision{}, fmt.Errorf("can't compose revision %d: %w", pos, err)
+		}
+	}
+	return composed, nil
+}
+
+// composeRevisions returns the Revision that makes the changes of first and
+// then the changes of second.
+func composeRevisions(first, second Revision) (Revision, error) {
+	composed := Revision{
+		Public: first.Public || second.Public,
+		Reason: first.Reason,
+	}
+	if second.Reason != "" {
+		if composed.Reason != "" {
+			composed.Reason += "\n"
+		}
+		composed.Reason += second.Reason
+	}
+
+	var err error
+	if composed.TitleDelta, err = composeDeltas(first.TitleDelta, second.TitleDelta); err != nil {
+		return Revision{}, fmt.Errorf("title: %w", err)
+	}
+	if composed.TitleUndo, err = composeDeltas(second.TitleUndo, first.TitleUndo); err != nil {
+		return Revision{}, fmt.Errorf("title: %w", err)
+	}
+	if composed.SlugDelta, err = composeDeltas(first.SlugDelta, second.SlugDelta); err != nil {
+		return Revision{}, fmt.Errorf("slug: %w", err)
+	}
+	if composed.SlugUndo, err = composeDeltas(second.SlugUndo, first.SlugUndo); err != nil {
+		return Revision{}, fmt.Errorf("slug: %w", err)
+	}
+	if composed.AuthorsDeltas, err = composeAuthorsDeltas(first.AuthorsDeltas, second.AuthorsDeltas); err != nil {
+		return Revision{}, fmt.Errorf("authors: %w", err)
+	}
+	if composed.StreamsDeltas, err = composeStreamsDeltas(first.StreamsDeltas, second.StreamsDeltas); err != nil {
+		return Revision{}, fmt.Errorf("streams: %w", err)
+	}
+	if composed.PartsDeltas, err = composePartDeltas(first.PartsDeltas, second.PartsDeltas); err != nil {
+		return Revision{}, fmt.Errorf("parts: %w", err)
+	}
+	if composed.MetadataDeltas, err = composePartDeltas(first.MetadataDeltas, second.MetadataDeltas); err != nil {
+		return Revision{}, fmt.Errorf("metadata: %w", err)
+	}
+	return composed, nil
+}
+
+// composedChange is the combination of a change from the first of two lists
+// of listChanges and the change to the same item from the second, either of
+// which may be missing. from is the item's position before both lists of
+// changes, to is its position after both, and either is -1 if the item isn't
+// present then. first and second are the indexes of the changes in their
+// lists, or -1 if the item wasn't changed by that list.
+type composedChange struct {
+	from, to      int
+	first, second int
+}
+
+// composeLists combines two lists of changes to a list, where second was
+// made to the list first produced, into the changes that have the same
+// effect as making both. Positions are mapped between the lists using the
+// rules arrange uses to place untouched items, so the length of the lists
+// isn't needed. Items that are added and then removed are left out
+// entirely, and an item that's removed and then added again is treated as
+// the same item, matched by value.
+func composeLists(first, second []listChange) ([]composedChange, error) {
+	taken1, placed1 := map[int]struct{}{}, map[int]struct{}{}
+	placedBy1 := map[int]int{}
+	for i, change := range first {
+		if change.op != DeltaAdd {
+			taken1[change.from] = struct{}{}
+		}
+		if change.op != DeltaRemove {
+			if _, ok := placed1[change.to]; ok {
+				return nil, fmt.Errorf("more than one item is placed at position %d", change.to)
+			}
+			placed1[change.to] = struct{}{}
+			placedBy1[change.to] = i
+		}
+	}
+	taken2, placed2 := map[int]struct{}{}, map[int]struct{}{}
+	for _, change := range second {
+		if change.op != DeltaAdd {
+			taken2[change.from] = struct{}{}
+		}
+		if change.op != DeltaRemove {
+			placed2[change.to] = struct{}{}
+		}
+	}
+
+	var composed []composedChange
+	consumed := make([]bool, len(first))
+	for j, change := range second {
+		result := composedChange{from: -1, to: change.to, first: -1, second: j}
+		if change.op == DeltaRemove {
+			result.to = -1
+		}
+		if change.op != DeltaAdd {
+			if i, ok := placedBy1[change.from]; ok {
+				// the item was placed here by the first list
+				// of changes, so its history starts there.
+				consumed[i] = true
+				result.first = i
+				if first[i].op != DeltaAdd {
+					result.from = first[i].from
+				}
+			} else {
+				// the item was untouched by the first list of
+				// changes, so it's in the same place among the
+				// untouched items as it was before them.
+				result.from = nthFree(taken1, freeRank(placed1, change.from))
+			}
+		}
+		if result.from < 0 && result.to < 0 {
+			// added and then removed again; nothing to see here.
+			continue
+		}
+		composed = append(composed, result)
+	}
+	for i, change := range first {
+		if consumed[i] {
+			continue
+		}
+		result := composedChange{from: change.from, to: -1, first: i, second: -1}
+		if change.op == DeltaAdd {
+			result.from = -1
+		}
+		if change.op != DeltaRemove {
+			// the second list of changes didn't touch the item, so
+			// it's in the same place among the untouched items
+			// after them as it was before them.
+			result.to = nthFree(placed2, freeRank(taken2, change.to))
+		}
+		composed = append(composed, result)
+	}
+
+	// an item removed by the first list of changes and added back by
+	// the second is really just being moved or updated.
+	removed := map[string]int{}
+	for pos, change := range composed {
+		if change.to < 0 && change.second < 0 {
+			removed[first[change.first].value] = pos
+		}
+	}
+	readded := map[int]bool{}
+	for pos, change := range composed {
+		if change.from >= 0 || change.first >= 0 {
+			continue
+		}
+		value := second[change.second].value
+		rmPos, ok := removed[value]
+		if !ok {
+			continue
+		}
+		delete(removed, value)
+		composed[rmPos].to = change.to
+		composed[rmPos].second = change.second
+		readded[pos] = true
+	}
+	merged := make([]composedChange, 0, len(composed))
+	for pos, change := range composed {
+		if !readded[pos] {
+			merged = append(merged, change)
+		}
+	}
+	return merged, nil
+}
+
+// freeRank returns how many of the positions before pos aren't in used.
+func freeRank(used map[int]struct{}, pos int) int {
+	rank := pos
+	for other := range used {
+		if other < pos {
+			rank--
+		}
+	}
+	return rank
+}
+
+// nthFree returns the nth position, counting from 0, that isn't in used.
+func nthFree(used map[int]struct{}, n int) int {
+	pos := 0
+	for {
+		if _, ok := used[pos]; !ok {
+			if n == 0 {
+				return pos
+			}
+			n--
+		}
+		pos++
+	}
+}
+
+// landsUntouched returns true if an item that a list of changes takes out of
+// position from and places at position to would end up at to anyway if the
+// changes left it untouched, as arrange fills the positions nothing is
+// placed at with the untouched items, in their original order. taken and
+// placed are the positions the changes take items out of and place items
+// at, including from and to. Each item found this way can be left out of the
+// changes, as long as from and to are removed from taken and placed before
+// checking the next.
+func landsUntouched(taken, placed map[int]struct{}, from, to int) bool {
+	return freeRank(taken, from) == freeRank(placed, to)
+}
+
+// composedPositions returns the positions the changes in composed take items
+// out of and place items at.
+func composedPositions(composed []composedChange) (taken, placed map[int]struct{}) {
+	taken, placed = map[int]struct{}{}, map[int]struct{}{}
+	for _, change := range composed {
+		if change.from >= 0 {
+			taken[change.from] = struct{}{}
+		}
+		if change.to >= 0 {
+			placed[change.to] = struct{}{}
+		}
+	}
+	return taken, placed
+}
+
+// composedOp returns the DeltaOp for a composed change from from to to,
+// where updated indicates the item's contents changed. If the change
+// doesn't do anything, an empty DeltaOp is returned.
+func composedOp(from, to int, updated bool) DeltaOp {
+	switch {
+	case from < 0:
+		return DeltaAdd
+	case to < 0:
+		return DeltaRemove
+	case from != to && updated:
+		return DeltaMoveUpdate
+	case from != to:
+		return DeltaMove
+	case updated:
+		return DeltaUpdate
+	}
+	return ""
+}
+
+func composeAuthorsDeltas(first, second []AuthorsDelta) ([]AuthorsDelta, error) {
+	changes1 := make([]listChange, 0, len(first))
+	for _, delta := range first {
+		changes1 = append(changes1, listChange{op: delta.Op, from: delta.FromPosition, to: delta.ToPosition, value: delta.Author})
+	}
+	changes2 := make([]listChange, 0, len(second))
+	for _, delta := range second {
+		changes2 = append(changes2, listChange{op: delta.Op, from: delta.FromPosition, to: delta.ToPosition, value: delta.Author})
+	}
+	composed, err := composeValues(changes1, changes2)
+	if err != nil {
+		return nil, err
+	}
+	var deltas []AuthorsDelta
+	for _, change := range composed {
+		deltas = append(deltas, AuthorsDelta{Op: change.op, Author: change.value, FromPosition: change.from, ToPosition: change.to})
+	}
+	return deltas, nil
+}
+
+func composeStreamsDeltas(first, second []StreamsDelta) ([]StreamsDelta, error) {
+	changes1 := make([]listChange, 0, len(first))
+	for _, delta := range first {
+		changes1 = append(changes1, listChange{op: delta.Op, from: delta.FromPosition, to: delta.ToPosition, value: delta.Stream})
+	}
+	changes2 := make([]listChange, 0, len(second))
+	for _, delta := range second {
+		changes2 = append(changes2, listChange{op: delta.Op, from: delta.FromPosition, to: delta.ToPosition, value: delta.Stream})
+	}
+	composed, err := composeValues(changes1, changes2)
+	if err != nil {
+		return nil, err
+	}
+	var deltas []StreamsDelta
+	for _, change := range composed {
+		deltas = append(deltas, StreamsDelta{Op: change.op, Stream: change.value, FromPosition: change.from, ToPosition: change.to})
+	}
+	return deltas, nil
+}
+
+// composeValues composes two lists of changes to a list of opaque values,
+// like author IDs, which can be added, removed, and moved, but not updated.
+// Values that end up back where they started are left out, unless the other
+// changes would shift them somewhere else if they were.
+func composeValues(first, second []listChange) ([]listChange, error) {
+	composed, err := composeLists(first, second)
+	if err != nil {
+		return nil, err
+	}
+	taken, placed := composedPositions(composed)
+	var changes []listChange
+	for _, change := range composed {
+		op := composedOp(change.from, change.to, false)
+		if op == "" {
+			if landsUntouched(taken, placed, change.from, change.to) {
+				delete(taken, change.from)
+				delete(placed, change.to)
+				continue
+			}
+			op = DeltaMove
+		}
+		var value string
+		if change.second >= 0 {
+			value = second[change.second].value
+		} else {
+			value = first[change.first].value
+		}
+		changes = append(changes, listChange{op: op, from: change.from, to: change.to, value: value})
+	}
+	return changes, nil
+}
+
+func composePartDeltas(first, second []PartDelta) ([]PartDelta, error) {
+	changes1 := make([]listChange, 0, len(first))
+	for _, delta := range first {
+		changes1 = append(changes1, listChange{op: delta.Op, from: delta.FromPosition, to: delta.ToPosition, value: delta.PartID})
+	}
+	changes2 := make([]listChange, 0, len(second))
+	for _, delta := range second {
+		changes2 = append(changes2, listChange{op: delta.Op, from: delta.FromPosition, to: delta.ToPosition, value: delta.PartID})
+	}
+	composed, err := composeLists(changes1, changes2)
+	if err != nil {
+		return nil, err
+	}
+	taken, placed := composedPositions(composed)
+	var deltas []PartDelta
+	for _, change := range composed {
+		var delta PartDelta
+		var updated bool
+		switch {
+		case change.first < 0:
+			delta = second[change.second]
+			updated = delta.Op == DeltaUpdate || delta.Op == DeltaMoveUpdate
+		case change.second < 0:
+			delta = first[change.first]
+			updated = delta.Op == DeltaUpdate || delta.Op == DeltaMoveUpdate
+		default:
+			delta, err = composePartDelta(first[change.first], second[change.second])
+			if err != nil {
+				return nil, fmt.Errorf("part %s: %w", second[change.second].PartID, err)
+			}
+			updated = true
+		}
+		delta.FromPosition, delta.ToPosition = change.from, change.to
+		delta.Op = composedOp(change.from, change.to, updated)
+		if delta.Op == "" {
+			if landsUntouched(taken, placed, change.from, change.to) {
+				delete(taken, change.from)
+				delete(placed, change.to)
+				continue
+			}
+			// the part ends up back where it started, but only
+			// because it's placed there; left untouched, the
+			// parts moving around it would shift it.
+			delta.Op = DeltaMove
+		}
+		deltas = append(deltas, delta)
+	}
+	return deltas, nil
+}
+
+// composePartDelta merges two changes to the same part into one. The
+// positions and Op of the result are left for the caller to fill in.
+func composePartDelta(first, second PartDelta) (PartDelta, error) {
+	delta := PartDelta{
+		PartID:     second.PartID,
+		Replace:    first.Replace || second.Replace,
+		SHA256From: first.SHA256From,
+		SHA256To:   second.SHA256To,
+	}
+	var err error
+	if delta.Headers, err = composeHeaderDeltas(first.Headers, second.Headers); err != nil {
+		return delta, err
+	}
+	if first.Binary || second.Binary {
+		delta.Binary, delta.Replace = true, true
+		if delta.BinaryBodyUndo, delta.BinaryBody, err = composeBinaryBodies(first, second); err != nil {
+			return delta, fmt.Errorf("body: %w", err)
+		}
+	} else {
+		if delta.Body, err = composeDeltas(first.Body, second.Body); err != nil {
+			return delta, fmt.Errorf("body: %w", err)
+		}
+		if delta.BodyUndo, err = composeDeltas(second.BodyUndo, first.BodyUndo); err != nil {
+			return delta, fmt.Errorf("body: %w", err)
+		}
+	}
+
+	// anchors are only recorded when they change, so the anchor before
+	// both changes comes from the first one to change it, and the anchor
+	// after both comes from the last one to change it.
+	delta.AnchorFrom, delta.AnchorTo = first.AnchorFrom, first.AnchorTo
+	if second.AnchorFrom != second.AnchorTo {
+		if first.AnchorFrom == first.AnchorTo {
+			delta.AnchorFrom = second.AnchorFrom
+		}
+		delta.AnchorTo = second.AnchorTo
+	}
+	if delta.AnchorFrom == delta.AnchorTo {
+		delta.AnchorFrom, delta.AnchorTo = "", ""
+	}
+	return delta, nil
+}
+
+// composeBinaryBodies returns the inline body of a part before and after two
+// changes to it, at least one of which records binary bodies in full. The
+// body in between is known from whichever change is binary, and the textual
+// change, if there is one, is patched onto it to work out the other.
+func composeBinaryBodies(first, second PartDelta) (before, after []byte, err error) {
+	middle := first.BinaryBody
+	if second.Binary {
+		middle = second.BinaryBodyUndo
+	}
+	before, after = first.BinaryBodyUndo, second.BinaryBody
+	if !first.Binary {
+		text, err := first.BodyUndo.apply(string(middle))
+		if err != nil {
+			return nil, nil, err
+		}
+		before = []byte(text)
+	}
+	if !second.Binary {
+		text, err := second.Body.apply(string(middle))
+		if err != nil {
+			return nil, nil, err
+		}
+		after = []byte(text)
+	}
+	return before, after, nil
+}
+
+func composeHeaderDeltas(first, second map[string][]HeaderDelta) (map[string][]HeaderDelta, error) {
+	composed := map[string][]HeaderDelta{}
+	for _, headers := range []map[string][]HeaderDelta{first, second} {
+		for header := range headers {
+			if _, ok := composed[header]; ok {
+				continue
+			}
+			changes1 := make([]listChange, 0, len(first[header]))
+			for _, delta := range first[header] {
+				changes1 = append(changes1, listChange{op: delta.Op, from: delta.FromPosition, to: delta.ToPosition, value: delta.Value})
+			}
+			changes2 := make([]listChange, 0, len(second[header]))
+			for _, delta := range second[header] {
+				changes2 = append(changes2, listChange{op: delta.Op, from: delta.FromPosition, to: delta.ToPosition, value: delta.Value})
+			}
+			changes, err := composeValues(changes1, changes2)
+			if err != nil {
+				return nil, fmt.Errorf("%s header: %w", header, err)
+			}
+			deltas := make([]HeaderDelta, 0, len(changes))
+			for _, change := range changes {
+				deltas = append(deltas, HeaderDelta{Op: change.op, Header: header, FromPosition: change.from, ToPosition: change.to, Value: change.value})
+			}
+			composed[header] = deltas
+		}
+	}
+	for header, deltas := range composed {
+		if len(deltas) == 0 {
+			delete(composed, header)
+		}
+	}
+	return composed, nil
+}
+
+// deltaOp is a single operation in a Delta: keeping or deleting count
+// characters, or inserting text.
+type deltaOp struct {
+	kind  byte
+	count int
+	text  []rune
+}
+
+// parseDelta splits d into its operations.
+func parseDelta(d Delta) ([]deltaOp, error) {
+	if d == "" {
+		return nil, nil
+	}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	var ops []deltaOp
+	for _, token := range strings.Split(string(d), "\t") {
+		if token[0] == '+' {
+			// Validate already made sure this decodes
+			text, _ := decodeInsert(token[1:])
+			ops = append(ops, deltaOp{kind: '+', count: len([]rune(text)), text: []rune(text)})
+			continue
+		}
+		count, err := strconv.Atoi(token[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid count %q: %w", token[1:], err)
+		}
+		ops = append(ops, deltaOp{kind: token[0], count: count})
+	}
+	return ops, nil
+}
+
+// composeDeltas returns the Delta that has the same effect as patching a
+// string with first and then patching the result with second. An empty Delta
+// changes nothing, so composing with one returns the other.
+func composeDeltas(first, second Delta) (Delta, error) {
+	if first == "" {
+		return second, nil
+	}
+	if second == "" {
+		return first, nil
+	}
+	ops1, err := parseDelta(first)
+	if err != nil {
+		return "", err
+	}
+	ops2, err := parseDelta(second)
+	if err != nil {
+		return "", err
+	}
+
+	var diffs []diffmatchpatch.Diff
+	emit := func(kind diffmatchpatch.Operation, text string) {
+		if text == "" {
+			return
+		}
+		if len(diffs) > 0 && diffs[len(diffs)-1].Type == kind {
+			diffs[len(diffs)-1].Text += text
+			return
+		}
+		diffs = append(diffs, diffmatchpatch.Diff{Type: kind, Text: text})
+	}
+	// compact deltas only record the length of kept and deleted text,
+	// so stand in for it with placeholder characters of the right
+	// length.
+	placeholder := func(count int) string {
+		return strings.Repeat("x", count)
+	}
+
+	// walk through second's operations, each of which consumes the
+	// output of first's operations.
+	i := 0
+	for _, op2 := range ops2 {
+		if op2.kind == '+' {
+			emit(diffmatchpatch.DiffInsert, string(op2.text))
+			continue
+		}
+		remaining := op2.count
+		for remaining > 0 {
+			if i >= len(ops1) {
+				return "", fmt.Errorf("second delta covers more than the text produced by the first")
+			}
+			op1 := &ops1[i]
+			if op1.kind == '-' {
+				// deletions don't produce any output for
+				// second to consume.
+				emit(diffmatchpatch.DiffDelete, placeholder(op1.count))
+				i++
+				continue
+			}
+			count := remaining
+			if op1.count < count {
+				count = op1.count
+			}
+			switch {
+			case op1.kind == '=' && op2.kind == '=':
+				emit(diffmatchpatch.DiffEqual, placeholder(count))
+			case op1.kind == '=' && op2.kind == '-':
+				emit(diffmatchpatch.DiffDelete, placeholder(count))
+			case op1.kind == '+' && op2.kind == '=':
+				emit(diffmatchpatch.DiffInsert, string(op1.text[:count]))
+			}
+			// text inserted by first and deleted by second never
+			// shows up at all.
+			if op1.kind == '+' {
+				op1.text = op1.text[count:]
+			}
+			op1.count -= count
+			remaining -= count
+			if op1.count == 0 {
+				i++
+			}
+		}
+	}
+	for ; i < len(ops1); i++ {
+		if ops1[i].kind != '-' {
+			return "", fmt.Errorf("second delta doesn't cover all of the text produced by the first")
+		}
+		emit(diffmatchpatch.DiffDelete, placeholder(ops1[i].count))
+	}
+	composed := NewDelta(diffs)
+	if composed.IsEmpty() {
+		// changes that cancel each other out leave a delta that only
+		// keeps text, which is the same as no change at all.
+		return "", nil
+	}
+	return composed, nil
+}
@@ -0,0 +1,125 @@
+package posts
+
+import (
+	"reflect"
+	"testing"
+)
+
+// revisionChain returns the Revisions between each of posts and the next.
+func revisionChain(t *testing.T, posts ...Post) []Revision {
+	t.Helper()
+
+	var revs []Revision
+	for pos := 1; pos < len(posts); pos++ {
+		rev, err := GenerateRevision(posts[pos-1], posts[pos])
+		if err != nil {
+			t.Fatalf("unexpected error generating revision %d: %s", pos, err)
+		}
+		revs = append(revs, rev)
+	}
+	return revs
+}
+
+func TestComposeRevisions(t *testing.T) {
+	t.Parallel()
+
+	base := Post{
+		ID:      "post",
+		Title:   "Hello",
+		Authors: []string{"alice"},
+		Parts:   []Part{inlinePart("a", 0, "one"), inlinePart("b", 1, "two")},
+	}
+
+	tests := map[string][]Post{
+		"update-then-update": {
+			base,
+			{ID: "post", Title: "Hello!", Authors: []string{"alice"}, Parts: []Part{inlinePart("a", 0, "one!"), inlinePart("b", 1, "two")}},
+			{ID: "post", Title: "Hello!!", Authors: []string{"alice"}, Parts: []Part{inlinePart("a", 0, "one!!"), inlinePart("b", 1, "two")}},
+		},
+		"add-then-update": {
+			base,
+			{ID: "post", Title: "Hello", Authors: []string{"alice"}, Parts: []Part{inlinePart("a", 0, "one"), inlinePart("c", 1, "three"), inlinePart("b", 2, "two")}},
+			{ID: "post", Title: "Hello", Authors: []string{"alice"}, Parts: []Part{inlinePart("a", 0, "one"), inlinePart("c", 1, "three!"), inlinePart("b", 2, "two")}},
+		},
+		"remove-then-add-back": {
+			base,
+			{ID: "post", Title: "Hello", Authors: []string{"alice"}, Parts: []Part{inlinePart("b", 0, "two")}},
+			{ID: "post", Title: "Hello", Authors: []string{"alice"}, Parts: []Part{inlinePart("b", 0, "two"), inlinePart("a", 1, "uno")}},
+		},
+		"text-then-binary-then-text": {
+			base,
+			{ID: "post", Title: "Hello", Authors: []string{"alice"}, Parts: []Part{inlinePart("a", 0, "one!"), inlinePart("b", 1, "two")}},
+			{ID: "post", Title: "Hello", Authors: []string{"alice"}, Parts: []Part{inlinePart("a", 0, "\xff\xfeone"), inlinePart("b", 1, "two")}},
+			{ID: "post", Title: "Hello", Authors: []string{"alice"}, Parts: []Part{inlinePart("a", 0, "one!!"), inlinePart("b", 1, "two")}},
+		},
+		"authors-and-moves": {
+			base,
+			{ID: "post", Title: "Hello", Authors: []string{"bob", "alice"}, Parts: []Part{inlinePart("b", 0, "two"), inlinePart("a", 1, "one")}},
+			{ID: "post", Title: "Hi", Authors: []string{"alice", "carol"}, Parts: []Part{inlinePart("c", 0, "three"), inlinePart("b", 1, "two"), inlinePart("a", 2, "one")}},
+		},
+	}
+
+	for name, posts := range tests {
+		name, posts := name, posts
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			composed, err := ComposeRevisions(revisionChain(t, posts...)...)
+			if err != nil {
+				t.Fatalf("unexpected error composing revisions: %s", err)
+			}
+			want := posts[len(posts)-1]
+			got, err := ApplyRevision(posts[0], composed)
+			if err != nil {
+				t.Fatalf("unexpected error applying composed revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected\n%+v\ngot\n%+v", want, got)
+			}
+			got, err = ApplyRevision(want, InvertRevision(composed))
+			if err != nil {
+				t.Fatalf("unexpected error applying inverted composed revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, posts[0]) {
+				t.Errorf("expected inverted composed revision to produce\n%+v\ngot\n%+v", posts[0], got)
+			}
+		})
+	}
+}
+
+func TestComposeRevisionsCoalesces(t *testing.T) {
+	t.Parallel()
+
+	base := Post{ID: "post", Parts: []Part{inlinePart("a", 0, "one")}}
+	added := Post{ID: "post", Parts: []Part{inlinePart("a", 0, "one"), inlinePart("b", 1, "two")}}
+	edited := Post{ID: "post", Parts: []Part{inlinePart("a", 0, "one!"), inlinePart("b", 1, "two")}}
+	edited2 := Post{ID: "post", Parts: []Part{inlinePart("a", 0, "one!!"), inlinePart("b", 1, "two")}}
+
+	composed, err := ComposeRevisions(revisionChain(t, base, added, base)...)
+	if err != nil {
+		t.Fatalf("unexpected error composing revisions: %s", err)
+	}
+	if len(composed.PartsDeltas) != 0 {
+		t.Errorf("expected adding and removing a part to cancel out, got %+v", composed.PartsDeltas)
+	}
+
+	composed, err = ComposeRevisions(revisionChain(t, added, edited, edited2)...)
+	if err != nil {
+		t.Fatalf("unexpected error composing revisions: %s", err)
+	}
+	if len(composed.PartsDeltas) != 1 {
+		t.Fatalf("expected updates to the same part to be coalesced, got %+v", composed.PartsDeltas)
+	}
+	if delta := composed.PartsDeltas[0]; delta.Op != DeltaUpdate || delta.PartID != "a" || delta.Body != "=3\t+!!" {
+		t.Errorf("expected a single update adding %q to a, got %+v", "!!", delta)
+	}
+}
+
+func TestComposeRevisionsMismatch(t *testing.T) {
+	t.Parallel()
+
+	_, err := ComposeRevisions(Revision{TitleDelta: "=5\t+!"}, Revision{TitleDelta: "=3"})
+	if err == nil {
+		t.Errorf("expected an error composing revisions that don't fit together")
+	}
+}
@@ -0,0 +1,161 @@
+package posts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ErrDeltaMismatch is returned when a Delta can't be applied to a string
+// because it describes a change to a string of a different length, usually
+// because it's being applied to the wrong base text.
+var ErrDeltaMismatch = errors.New("delta does not match text")
+
+// Delta is a diff between two strings in diffmatchpatch's compact delta
+// format: a tab-separated list of operations, where =3 keeps 3 characters,
+// -2 deletes 2 characters, and +ing inserts "ing", with inserted text
+// escaped using %xx notation. An empty Delta describes no change.
+type Delta string
+
+// NewDelta encodes diffs in compact delta format.
+func NewDelta(diffs []diffmatchpatch.Diff) Delta {
+	return Delta(diffmatchpatch.New().DiffToDelta(diffs))
+}
+
+// IsEmpty returns true if the Delta describes no change: either it's empty,
+// or it only keeps characters, like =5.
+func (d Delta) IsEmpty() bool {
+	if d == "" {
+		return true
+	}
+	for _, token := range strings.Split(string(d), "\t") {
+		if !strings.HasPrefix(token, "=") {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate returns an error if the Delta isn't well-formed compact delta
+// format. A well-formed Delta may still fail to apply to a string, if it
+// doesn't describe a change to a string of that length.
+func (d Delta) Validate() error {
+	if d == "" {
+		return nil
+	}
+	for pos, token := range strings.Split(string(d), "\t") {
+		if token == "" {
+			return fmt.Errorf("operation %d is empty", pos)
+		}
+		param := token[1:]
+		switch token[0] {
+		case '+':
+			if _, err := decodeInsert(param); err != nil {
+				return fmt.Errorf("operation %d: %w", pos, err)
+			}
+		case '=', '-':
+			if param == "" {
+				return fmt.Errorf("operation %d has no count", pos)
+			}
+			for _, r := range param {
+				if r < '0' || r > '9' {
+					return fmt.Errorf("operation %d has invalid count %q", pos, param)
+				}
+			}
+		default:
+			return fmt.Errorf("operation %d has invalid type %q", pos, token[0])
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes a Delta from a JSON string, returning an error if the
+// Delta isn't well-formed.
+func (d *Delta) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	if err := Delta(str).Validate(); err != nil {
+		return fmt.Errorf("invalid delta: %w", err)
+	}
+	*d = Delta(str)
+	return nil
+}
+
+// decodeInsert decodes the text of an insert operation the same way
+// diffmatchpatch does, where a literal + is a +, not a space.
+func decodeInsert(param string) (string, error) {
+	text, err := url.QueryUnescape(strings.ReplaceAll(param, "+", "%2b"))
+	if err != nil {
+		return "", err
+	}
+	if !utf8.ValidString(text) {
+		return "", errors.New("inserted text is not valid UTF-8")
+	}
+	return text, nil
+}
+
+// apply returns the result of patching text with the Delta. An empty Delta
+// leaves text unchanged. An error is returned if the Delta isn't well-formed,
+// or an error wrapping ErrDeltaMismatch if it doesn't describe a change to a
+// string the length of text.
+func (d Delta) apply(text string) (string, error) {
+	if d == "" {
+		return text, nil
+	}
+	if err := d.Validate(); err != nil {
+		return "", err
+	}
+	// diffmatchpatch panics instead of returning an error if the delta
+	// keeps or deletes more characters than text has, so check that
+	// ourselves first.
+	length := utf8.RuneCountInString(text)
+	var consumed int
+	for _, token := range strings.Split(string(d), "\t") {
+		if token[0] == '+' {
+			continue
+		}
+		count, err := strconv.Atoi(token[1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid count %q: %w", token[1:], err)
+		}
+		consumed += count
+		if consumed > length {
+			return "", fmt.Errorf("%w: delta covers more than the %d characters of the text", ErrDeltaMismatch, length)
+		}
+	}
+	if consumed != length {
+		return "", fmt.Errorf("%w: delta covers %d of the %d characters of the text", ErrDeltaMismatch, consumed, length)
+	}
+	dmp := diffmatchpatch.New()
+	diffs, err := dmp.DiffFromDelta(text, string(d))
+	if err != nil {
+		return "", err
+	}
+	return dmp.DiffText2(diffs), nil
+}
+
+// DiffStrings returns the compact delta format diff that patches a into b,
+// the format used by a Revision's TitleDelta, SlugDelta, and the Body of its
+// PartDeltas. Identical strings return an empty delta.
+func DiffStrings(a, b string) string {
+	return string(deltaFromStrings(a, b))
+}
+
+// ApplyStringDelta returns the result of patching original with delta, a diff
+// in compact delta format like those returned by DiffStrings. An empty delta
+// leaves original unchanged.
+//
+// If delta doesn't describe a change to a string the length of original,
+// which usually means it's being applied to the wrong base text, an error
+// wrapping ErrDeltaMismatch is returned instead of a garbled result.
+func ApplyStringDelta(original, delta string) (string, error) {
+	return Delta(delta).apply(original)
+}
@@ -0,0 +1,167 @@
+package posts
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+func TestDeltaValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		delta   Delta
+		wantErr bool
+	}{
+		"empty":            {delta: ""},
+		"keep":             {delta: "=5"},
+		"generated":        {delta: deltaFromStrings("Hello, world", "Goodbye, cruel world")},
+		"escaped-insert":   {delta: deltaFromStrings("", "100% \t tabs & ünïcode")},
+		"literal-plus":     {delta: "=1\t+a+b"},
+		"unknown-op":       {delta: "=3\t*2", wantErr: true},
+		"non-numeric-keep": {delta: "=abc", wantErr: true},
+		"negative-delete":  {delta: "=1\t--1", wantErr: true},
+		"signed-count":     {delta: "=+1", wantErr: true},
+		"missing-count":    {delta: "=", wantErr: true},
+		"empty-operation":  {delta: "=3\t\t-1", wantErr: true},
+		"trailing-tab":     {delta: "=3\t", wantErr: true},
+		"bad-escape":       {delta: "+%zz", wantErr: true},
+		"invalid-utf8":     {delta: "+%FF%FE", wantErr: true},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := test.delta.Validate()
+			if test.wantErr && err == nil {
+				t.Errorf("expected an error for %q, got nil", test.delta)
+			} else if !test.wantErr && err != nil {
+				t.Errorf("unexpected error for %q: %s", test.delta, err)
+			}
+		})
+	}
+}
+
+func TestDeltaIsEmpty(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		delta Delta
+		want  bool
+	}{
+		"empty":     {delta: "", want: true},
+		"keep":      {delta: "=5", want: true},
+		"keeps":     {delta: "=2\t=3", want: true},
+		"identical": {delta: deltaFromStrings("Hello", "Hello"), want: true},
+		"insert":    {delta: "=5\t+!", want: false},
+		"delete":    {delta: "=4\t-1", want: false},
+		"generated": {delta: deltaFromStrings("Hello", "Hello!"), want: false},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := test.delta.IsEmpty(); got != test.want {
+				t.Errorf("expected IsEmpty to be %v for %q, got %v", test.want, test.delta, got)
+			}
+		})
+	}
+}
+
+func TestNewDelta(t *testing.T) {
+	t.Parallel()
+
+	delta := NewDelta([]diffmatchpatch.Diff{
+		{Type: diffmatchpatch.DiffEqual, Text: "abc"},
+		{Type: diffmatchpatch.DiffDelete, Text: "de"},
+		{Type: diffmatchpatch.DiffInsert, Text: "ing"},
+	})
+	if delta != "=3\t-2\t+ing" {
+		t.Errorf("expected %q, got %q", "=3\t-2\t+ing", delta)
+	}
+	if err := delta.Validate(); err != nil {
+		t.Errorf("unexpected error validating: %s", err)
+	}
+}
+
+func TestDeltaUnmarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	var rev Revision
+	if err := json.Unmarshal([]byte(`{"TitleDelta":"=5\t+!"}`), &rev); err != nil {
+		t.Fatalf("unexpected error unmarshaling valid delta: %s", err)
+	}
+	if rev.TitleDelta != "=5\t+!" {
+		t.Errorf("expected title delta %q, got %q", "=5\t+!", rev.TitleDelta)
+	}
+
+	err := json.Unmarshal([]byte(`{"PartsDeltas":[{"PartID":"a","Body":"=five"}]}`), &rev)
+	if err == nil {
+		t.Errorf("expected an error unmarshaling malformed delta")
+	}
+}
+
+func TestApplyStringDelta(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		original string
+		delta    string
+		want     string
+		wantErr  bool
+		mismatch bool
+	}{
+		"generated":      {original: "Hello, world", delta: DiffStrings("Hello, world", "Goodbye, cruel world"), want: "Goodbye, cruel world"},
+		"empty":          {original: "Hello", delta: "", want: "Hello"},
+		"unicode":        {original: "héllo wörld", delta: DiffStrings("héllo wörld", "héllo, wörld!"), want: "héllo, wörld!"},
+		"from-empty":     {original: "", delta: DiffStrings("", "Hello"), want: "Hello"},
+		"base-too-short": {original: "Hello", delta: DiffStrings("Hello, world", "Goodbye, world"), wantErr: true, mismatch: true},
+		"base-too-long":  {original: "Hello, world!!", delta: DiffStrings("Hello, world", "Goodbye, world"), wantErr: true, mismatch: true},
+		"malformed":      {original: "Hello", delta: "=five", wantErr: true},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ApplyStringDelta(test.original, test.delta)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				if test.mismatch && !errors.Is(err, ErrDeltaMismatch) {
+					t.Errorf("expected ErrDeltaMismatch, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestDiffStrings(t *testing.T) {
+	t.Parallel()
+
+	if delta := DiffStrings("Hello", "Hello"); delta != "" {
+		t.Errorf("expected identical strings to have an empty delta, got %q", delta)
+	}
+	delta := DiffStrings("Hello", "Hello!")
+	if err := Delta(delta).Validate(); err != nil {
+		t.Errorf("unexpected error validating %q: %s", delta, err)
+	}
+	if delta != "=5\t+!" {
+		t.Errorf("expected %q, got %q", "=5\t+!", delta)
+	}
+}
@@ -3,6 +3,12 @@ package posts
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
@@ -19,13 +25,9 @@ func diffAuthors(a1, a2 []string) []AuthorsDelta {
 	for pos, author := range a2 {
 		a2Pos[author] = pos
 	}
-	longerAuthors := a1
-	if len(a2) > len(a1) {
-		longerAuthors = a2
-	}
-	// TODO: still missing any authors that were in the shorter list but
-	// not in the longer one
-	for _, author := range longerAuthors {
+	// visit every author in either list, so we catch authors that were
+	// only in the first list as well as ones only in the second.
+	for _, author := range union(a1, a2) {
 		var delta AuthorsDelta
 		pos1, ok := a1Pos[author]
 		if !ok {
@@ -58,6 +60,44 @@ func diffAuthors(a1, a2 []string) []AuthorsDelta {
 			// around, we're not doing anything to them, skip this.
 			continue
 		}
+		delta.Author = author
+		delta.FromPosition = pos1
+		delta.ToPosition = pos2
+		deltas = append(deltas, delta)
+	}
+	return deltas
+}
+
+// diffStreams returns the StreamsDeltas necessary to describe the difference
+// between two lists of streams.
+func diffStreams(s1, s2 []string) []StreamsDelta {
+	var deltas []StreamsDelta
+	s1Pos := make(map[string]int, len(s1))
+	s2Pos := make(map[string]int, len(s2))
+	for pos, stream := range s1 {
+		s1Pos[stream] = pos
+	}
+	for pos, stream := range s2 {
+		s2Pos[stream] = pos
+	}
+	// visit every stream in either list, so we catch streams that were
+	// only in the first list as well as ones only in the second.
+	for _, stream := range union(s1, s2) {
+		delta := StreamsDelta{Stream: stream}
+		pos1, ok1 := s1Pos[stream]
+		pos2, ok2 := s2Pos[stream]
+		switch {
+		case !ok1:
+			delta.Op = DeltaAdd
+			pos1 = -1
+		case !ok2:
+			delta.Op = DeltaRemove
+			pos2 = -1
+		case pos1 != pos2:
+			delta.Op = DeltaMove
+		default:
+			continue
+		}
 		delta.FromPosition = pos1
 		delta.ToPosition = pos2
 		deltas = append(deltas, delta)
@@ -65,51 +105,107 @@ func diffAuthors(a1, a2 []string) []AuthorsDelta {
 	return deltas
 }
 
+// union returns every value in either list: the values in l1, in order,
+// followed by the values that are only in l2, in order.
+func union(l1, l2 []string) []string {
+	seen := make(map[string]struct{}, len(l1))
+	values := make([]string, 0, len(l1)+len(l2))
+	for _, value := range l1 {
+		seen[value] = struct{}{}
+		values = append(values, value)
+	}
+	for _, value := range l2 {
+		if _, ok := seen[value]; !ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // diffParts returns the PartDeltas necessary to describe the difference
-// between two lists of parts.
-func diffParts(p1, p2 []Part) []PartDelta {
+// between two lists of parts. Only the fewest parts needed to reorder the
+// list are moved, so inserting a part doesn't move every part after it; see
+// stationaryValues. Every delta has its FromPosition in p1 and its
+// ToPosition in p2, as described on PartDelta.
+func diffParts(p1, p2 []Part, opts revisionOptions) []PartDelta {
 	var deltas []PartDelta
+	// collecting the deltas can't fail, so neither can streamParts
+	_ = streamParts(p1, p2, opts, func(delta PartDelta) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	return deltas
+}
+
+// streamParts calls emit with each of the PartDeltas necessary to describe
+// the difference between two lists of parts, one at a time, stopping and
+// returning the error if emit returns one.
+func streamParts(p1, p2 []Part, opts revisionOptions, emit func(PartDelta) error) error {
 	p1Pos := make(map[string]int, len(p1))
 	p2Pos := make(map[string]int, len(p2))
+	ids1 := make([]string, 0, len(p1))
+	ids2 := make([]string, 0, len(p2))
 	for pos, part := range p1 {
 		p1Pos[part.ID] = pos
+		ids1 = append(ids1, part.ID)
 	}
 	for pos, part := range p2 {
 		p2Pos[part.ID] = pos
+		ids2 = append(ids2, part.ID)
 	}
-	longer := p1
-	if len(p2) > len(p1) {
-		longer = p2
-	}
-	// TODO: still missing any parts that were in the shorter list but not
-	// in the longer one
-	for _, part := range longer {
+	stationary := stationaryValues(ids1, ids2)
+	// visit every part in either list, so we catch parts that were only
+	// in the first list as well as ones only in the second.
+	for _, id := range union(ids1, ids2) {
 		var delta PartDelta
-		delta.PartID = part.ID
-		pos1, ok := p1Pos[part.ID]
-		if !ok {
+		delta.PartID = id
+
+		// a part that's being added or removed is compared against
+		// the zero value of a Part, so everything about it shows up
+		// as a change.
+		var part1, part2 Part
+		pos1, ok := p1Pos[id]
+		if ok {
+			part1 = p1[pos1]
+		} else {
 			// if we can't find the position of the part in the
 			// first list, we know the part was added in the second
 			// list.
 			delta.Op = DeltaAdd
+
+			// position of -1 indicates "not present"
+			pos1 = -1
 		}
-		pos2, ok := p2Pos[part.ID]
-		if !ok {
+		pos2, ok := p2Pos[id]
+		if ok {
+			part2 = p2[pos2]
+		} else {
 			// if we can't find the position of the part in the
 			// second list, we know the part was removed in the
 			// second list.
 			delta.Op = DeltaRemove
+
+			// position of -1 indicates "not present"
+			pos2 = -1
 		}
-		if pos1 != pos2 && delta.Op == "" {
-			// if the positions aren't equal, we obviously moved
-			// the part.
+		if _, ok := stationary[id]; !ok && delta.Op == "" {
+			// the part is in both lists, but out of order
+			// with the parts that stay put, so it has to be
+			// moved. Parts that stay put may still change
+			// positions, as parts around them are added,
+			// removed, or moved, but they don't need moving.
 			delta.Op = DeltaMove
 		}
-		part1, part2 := p1[pos1], p2[pos2]
+		if cosmeticallyEqual(part1, part2) {
+			// the bodies only differ in ways the registered
+			// normalizer says don't matter, so we treat them as
+			// unchanged and keep the first body.
+			part2.Body = part1.Body
+		}
 		if delta.Op != DeltaAdd && delta.Op != DeltaRemove {
 			// if we're not adding, not deleting, we may still need
 			// to modify in place.
-			if bytes.Equal(part1.Body, part2.Body) {
+			if !bytes.Equal(part1.Body, part2.Body) || part1.Inline != part2.Inline || (!part2.Inline && part1.SHA256 != part2.SHA256) {
 				// need to check if we're already moving, in
 				// which case this is a move and update, not
 				// just a move.
@@ -126,6 +222,17 @@ func diffParts(p1, p2 []Part) []PartDelta {
 		} else if len(delta.Headers) != 0 && delta.Op == DeltaMove {
 			delta.Op = DeltaMoveUpdate
 		}
+		if part1.Anchor != part2.Anchor {
+			// changing the anchor is changing the part, just like
+			// changing its headers.
+			delta.AnchorFrom = part1.Anchor
+			delta.AnchorTo = part2.Anchor
+			if delta.Op == "" {
+				delta.Op = DeltaUpdate
+			} else if delta.Op == DeltaMove {
+				delta.Op = DeltaMoveUpdate
+			}
+		}
 		if delta.Op != "" {
 			// if there's any change at all, we want to record the
 			// old position, the new position, and the change the
@@ -146,7 +253,23 @@ func diffParts(p1, p2 []Part) []PartDelta {
 			// part had at the end. We don't want to record those
 			// bytes in the database.
 			if !part2.Inline {
-				delta.SHA256To = part1.SHA256
+				delta.SHA256To = part2.SHA256
+			}
+
+			// compact deltas can only hold UTF-8 text, so if the
+			// inline body changes and either version of it is
+			// binary, we record both versions in full, byte for
+			// byte, instead of patching them.
+			inlineChanged := part1.Inline != part2.Inline || !bytes.Equal(part1.Body, part2.Body)
+			if inlineChanged && (hasBinaryBody(part1) || hasBinaryBody(part2)) {
+				delta.Binary = true
+				delta.Replace = true
+				if part1.Inline {
+					delta.BinaryBodyUndo = append([]byte{}, part1.Body...)
+				}
+				if part2.Inline {
+					delta.BinaryBody = append([]byte{}, part2.Body...)
+				}
 			}
 
 			// if part1 is inline and part2 isn't, we're swapping
@@ -154,8 +277,9 @@ func diffParts(p1, p2 []Part) []PartDelta {
 			// as a patch for deleting the inline body, and rely on
 			// the SHA256To (which has already been set) to
 			// indicate the new content.
-			if part1.Inline && !part2.Inline {
-				delta.Body = deltaFromStrings("", string(part2.Body))
+			if !delta.Binary && part1.Inline && !part2.Inline {
+				delta.Body = deltaFromStrings(string(part1.Body), "")
+				delta.BodyUndo = deltaFromStrings("", string(part1.Body))
 			}
 
 			// if part1 isn't inline and part2 is, we're swapping a
@@ -163,26 +287,107 @@ func diffParts(p1, p2 []Part) []PartDelta {
 			// a patch for creating the inline body, and rely on
 			// the SHA256From (which has already been set) to
 			// indicate the old content.
-			if !part1.Inline && part2.Inline {
-				delta.Body = deltaFromStrings(string(part1.Body), "")
+			if !delta.Binary && !part1.Inline && part2.Inline {
+				delta.Body = deltaFromStrings("", string(part2.Body))
+				delta.BodyUndo = deltaFromStrings(string(part2.Body), "")
 			}
 
 			// if both parts are inline, we're doing a straight
 			// text update, and we just want to record the patch of
 			// that.
-			if part1.Inline && part2.Inline {
-				delta.Body = deltaFromStrings(string(part1.Body), string(part2.Body))
+			if !delta.Binary && part1.Inline && part2.Inline {
+				delta.Body = opts.bodyDelta(string(part1.Body), string(part2.Body))
+				delta.BodyUndo = opts.bodyDelta(string(part2.Body), string(part1.Body))
+
+				// if the patch turned out to be bigger than we're
+				// willing to store relative to the new body, just
+				// record the whole body being replaced instead.
+				if opts.exceedsMaxDeltaRatio(delta.Body, part2.Body) {
+					delta.Body = replacementDelta(string(part1.Body), string(part2.Body))
+					delta.BodyUndo = replacementDelta(string(part2.Body), string(part1.Body))
+					delta.Replace = true
+				}
+			}
+			if err := emit(delta); err != nil {
+				return err
 			}
-			deltas = append(deltas, delta)
 		}
 	}
-	return deltas
+	return nil
+}
+
+// stationaryValues returns the largest set of values that are in both l1 and
+// l2 and in the same order in each, so they can be left where they are while
+// every other value in both lists is moved around them. Each value must only
+// appear once in each list.
+//
+// As every value in both lists is in each list once, this is the longest
+// increasing subsequence of the values' positions in l1, taken in the order
+// the values appear in l2, which is found by patience sorting.
+func stationaryValues(l1, l2 []string) map[string]struct{} {
+	pos1 := make(map[string]int, len(l1))
+	for pos, value := range l1 {
+		pos1[value] = pos
+	}
+	var common []string
+	for _, value := range l2 {
+		if _, ok := pos1[value]; ok {
+			common = append(common, value)
+		}
+	}
+	// tails[n] is the index in common of the last value of the
+	// increasing subsequence of length n+1 found so far that ends with
+	// the smallest position, and prev links each value to the one before
+	// it in the subsequence it ended.
+	var tails []int
+	prev := make([]int, len(common))
+	for i, value := range common {
+		n := sort.Search(len(tails), func(n int) bool {
+			return pos1[common[tails[n]]] >= pos1[value]
+		})
+		prev[i] = -1
+		if n > 0 {
+			prev[i] = tails[n-1]
+		}
+		if n == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[n] = i
+		}
+	}
+	stationary := make(map[string]struct{}, len(tails))
+	if len(tails) == 0 {
+		return stationary
+	}
+	for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+		stationary[common[i]] = struct{}{}
+	}
+	return stationary
+}
 
+// hasBinaryBody returns true if part is inline and its Body can't be treated
+// as UTF-8 text, either because it isn't valid UTF-8 or because its headers
+// say it's binary.
+func hasBinaryBody(part Part) bool {
+	if !part.Inline {
+		return false
+	}
+	if !utf8.Valid(part.Body) {
+		return true
+	}
+	for _, encoding := range part.GetHeader("Content-Transfer-Encoding") {
+		if strings.EqualFold(encoding, "binary") {
+			return true
+		}
+	}
+	return part.ContentType() == "application/octet-stream"
 }
 
 // diffHeaders returns the HeaderDeltas necessary to describe the difference
-// between two header maps.
+// between two header maps. Keys are compared and recorded in their canonical
+// form, so changing only the case of a key isn't a change.
 func diffHeaders(h1, h2 map[string][]string) map[string][]HeaderDelta {
+	h1, h2 = canonicalHeaders(h1), canonicalHeaders(h2)
 	deltas := map[string][]HeaderDelta{}
 	headers := map[string]struct{}{}
 	for header := range h1 {
@@ -192,10 +397,6 @@ func diffHeaders(h1, h2 map[string][]string) map[string][]HeaderDelta {
 		headers[header] = struct{}{}
 	}
 	for header := range headers {
-		headerLonger := h1[header]
-		if len(h2[header]) > len(headerLonger) {
-			headerLonger = h2[header]
-		}
 		hpos1 := make(map[string]int, len(h1[header]))
 		for pos, val := range h1[header] {
 			hpos1[val] = pos
@@ -204,35 +405,276 @@ func diffHeaders(h1, h2 map[string][]string) map[string][]HeaderDelta {
 		for pos, val := range h2[header] {
 			hpos2[val] = pos
 		}
-		// TODO: still missing any values that were in the shorter list
-		// but not in the longer one
-		for _, h := range headerLonger {
-			var headerDelta HeaderDelta
-			pos, ok := hpos1[h]
-			if !ok {
-				// we don't have a position in the first part's
-				// headers, so it must be newly added
-				headerDelta.Op = DeltaAdd
+		// visit every value in either list, so we catch values that
+		// were only in the first list as well as ones only in the
+		// second.
+		for _, value := range union(h1[header], h2[header]) {
+			delta := HeaderDelta{Value: value}
+			pos1, ok1 := hpos1[value]
+			pos2, ok2 := hpos2[value]
+			switch {
+			case !ok1:
+				delta.Op = DeltaAdd
+				// position of -1 indicates "not present"
+				pos1 = -1
+			case !ok2:
+				delta.Op = DeltaRemove
+				pos2 = -1
+			case pos1 != pos2:
+				delta.Op = DeltaMove
+			default:
+				continue
 			}
-			headerDelta.FromPosition = pos
-			pos, ok = hpos2[h]
+			delta.FromPosition = pos1
+			delta.ToPosition = pos2
+			deltas[header] = append(deltas[header], delta)
+		}
+	}
+	return deltas
+}
+
+// ErrIDMismatch is returned when two Posts that should be versions of the
+// same Post have different IDs, like the Posts passed to GenerateRevision.
+var ErrIDMismatch = errors.New("post IDs don't match")
+
+// ErrPartChangedSection is returned when a Part moves from a Post's Parts in
+// one version of the Post to its Metadata in the other, or the other way
+// around. That's almost always a bug in the caller, and can't be represented
+// as a Revision without it looking like unrelated content was removed and
+// added.
+var ErrPartChangedSection = errors.New("part changed sections")
+
+// checkSections returns an error wrapping ErrPartChangedSection if any part
+// moved between sections from p1 to p2: it's in p1's Parts and p2's
+// Metadata, but not p2's Parts or p1's Metadata, or the other way around.
+// A part that's in both sections of the same version isn't a problem on its
+// own, as Parts and Metadata are diffed separately; neither is one that's
+// added to or removed from one section while staying in the other.
+func checkSections(p1, p2 Post) error {
+	if err := checkSectionMove(p1.Parts, p1.Metadata, p2.Parts, p2.Metadata); err != nil {
+		return err
+	}
+	return checkSectionMove(p1.Metadata, p1.Parts, p2.Metadata, p2.Parts)
+}
+
+// checkSectionMove returns an error wrapping ErrPartChangedSection if any
+// part is in from1 and to2, but not from2 or to1.
+func checkSectionMove(from1, to1, from2, to2 []Part) error {
+	ids := func(parts []Part) map[string]struct{} {
+		set := make(map[string]struct{}, len(parts))
+		for _, part := range parts {
+			set[part.ID] = struct{}{}
+		}
+		return set
+	}
+	inTo1, inFrom2, inTo2 := ids(to1), ids(from2), ids(to2)
+	for _, part := range from1 {
+		if _, ok := inTo2[part.ID]; !ok {
+			continue
+		}
+		_, stayed := inFrom2[part.ID]
+		_, already := inTo1[part.ID]
+		if !stayed && !already {
+			return fmt.Errorf("%w: part %s moved between Parts and Metadata", ErrPartChangedSection, part.ID)
+		}
+	}
+	return nil
+}
+
+// RevisionOption configures the way GenerateRevision describes the
+// difference between two Posts.
+type RevisionOption func(*revisionOptions)
+
+type revisionOptions struct {
+	maxDeltaRatio float64
+	granularity   DiffGranularity
+	authorID      string
+	actorType     PostEventActorType
+	createdAt     time.Time
+}
+
+// WithAuthor records authorID and actorType as the actor that made the
+// Revision, in its AuthorID and ActorType properties.
+func WithAuthor(authorID string, actorType PostEventActorType) RevisionOption {
+	return func(opts *revisionOptions) {
+		opts.authorID = authorID
+		opts.actorType = actorType
+	}
+}
+
+// WithCreatedAt records t as when the Revision was made, in its CreatedAt
+// property.
+func WithCreatedAt(t time.Time) RevisionOption {
+	return func(opts *revisionOptions) {
+		opts.createdAt = t
+	}
+}
+
+// WithMaxDeltaRatio caps the size of a part's Body delta at r times the size
+// of the part's new body. When a delta would be larger than that, the part is
+// recorded as having its whole body replaced instead, and the PartDelta's
+// Replace property is set. A ratio of zero or less disables the cap, which is
+// the default.
+func WithMaxDeltaRatio(r float64) RevisionOption {
+	return func(opts *revisionOptions) {
+		opts.maxDeltaRatio = r
+	}
+}
+
+// DiffGranularity is an enum for indicating the units GenerateRevision
+// compares inline Part bodies in. Coarser units produce deltas that are
+// easier to review, as every change covers whole words or lines, and that
+// are often smaller for large rewrites of prose, at the cost of recording
+// unchanged characters in changed units as deleted and inserted again.
+type DiffGranularity string
+
+const (
+	// DiffGranularityDefault compares bodies character by character, the
+	// same as DiffGranularityCharacter.
+	DiffGranularityDefault DiffGranularity = ""
+
+	// DiffGranularityCharacter compares bodies character by character,
+	// producing the smallest changes.
+	DiffGranularityCharacter DiffGranularity = "character"
+
+	// DiffGranularityWord compares bodies word by word, where a word is a
+	// run of characters that aren't whitespace, and each run of
+	// whitespace between them is compared as a word of its own.
+	DiffGranularityWord DiffGranularity = "word"
+
+	// DiffGranularityLine compares bodies line by line, where each line
+	// includes the newline that ends it.
+	DiffGranularityLine DiffGranularity = "line"
+)
+
+// Valid returns true if the DiffGranularity is one of the DiffGranularities
+// defined in this package.
+func (g DiffGranularity) Valid() bool {
+	switch g {
+	case DiffGranularityDefault, DiffGranularityCharacter, DiffGranularityWord, DiffGranularityLine:
+		return true
+	}
+	return false
+}
+
+// WithDiffGranularity sets the units the bodies of inline parts are compared
+// in to g. Titles and slugs are always compared character by character.
+// Whatever the granularity, Body deltas are in the same format, so
+// ApplyRevision doesn't need to know which was used. GenerateRevision returns
+// an error if g isn't Valid.
+func WithDiffGranularity(g DiffGranularity) RevisionOption {
+	return func(opts *revisionOptions) {
+		opts.granularity = g
+	}
+}
+
+// bodyDelta returns a Delta that patches body1 to match body2, comparing
+// them in the units opts calls for.
+func (opts revisionOptions) bodyDelta(body1, body2 string) Delta {
+	switch opts.granularity {
+	case DiffGranularityWord:
+		return tokenDelta(body1, body2, splitWords)
+	case DiffGranularityLine:
+		return tokenDelta(body1, body2, splitLines)
+	}
+	return deltaFromStrings(body1, body2)
+}
+
+// surrogateStart and surrogateEnd bound the runes reserved for UTF-16
+// surrogate pairs, which can't be encoded in UTF-8.
+const (
+	surrogateStart = 0xd800
+	surrogateEnd   = 0xe000
+)
+
+// tokenDelta returns a Delta that patches str1 to match str2, comparing them
+// one token at a time, where split breaks a string into tokens that can be
+// joined back together to make it.
+//
+// Each distinct token is stood in for by a single rune, so diffmatchpatch can
+// diff the tokens like characters, and the diffs are then expanded back into
+// the tokens they stand for. diffmatchpatch's own DiffLinesToChars works the
+// same way for lines, but can run into the surrogate range, which isn't
+// valid in UTF-8 text, so tokens are numbered here instead, skipping it. If
+// there are too many distinct tokens to number, the strings are compared
+// character by character instead.
+func tokenDelta(str1, str2 string, split func(string) []string) Delta {
+	if str1 == str2 {
+		return ""
+	}
+	runes := map[string]rune{}
+	tokens := map[rune]string{}
+	next := rune(1)
+	encode := func(str string) ([]rune, bool) {
+		var encoded []rune
+		for _, token := range split(str) {
+			r, ok := runes[token]
 			if !ok {
-				// we don't have a position in the second
-				// part's headers, so it must be removed
-				headerDelta.Op = DeltaRemove
-			}
-			headerDelta.ToPosition = pos
-			if headerDelta.FromPosition != headerDelta.ToPosition && headerDelta.Op == "" {
-				headerDelta.Op = DeltaMove
-			}
-			headerDelta.Value = h
-			if headerDelta.Op != "" {
-				deltas[header] = append(deltas[header], headerDelta)
+				if next >= surrogateStart && next < surrogateEnd {
+					next = surrogateEnd
+				}
+				if next > utf8.MaxRune {
+					return nil, false
+				}
+				r = next
+				next++
+				runes[token] = r
+				tokens[r] = token
 			}
+			encoded = append(encoded, r)
 		}
+		return encoded, true
 	}
-	return deltas
+	encoded1, ok1 := encode(str1)
+	encoded2, ok2 := encode(str2)
+	if !ok1 || !ok2 {
+		return deltaFromStrings(str1, str2)
+	}
+	diffs := diffmatchpatch.New().DiffMainRunes(encoded1, encoded2, false)
+	for i, diff := range diffs {
+		var text strings.Builder
+		for _, r := range diff.Text {
+			text.WriteString(tokens[r])
+		}
+		diffs[i].Text = text.String()
+	}
+	return NewDelta(diffs)
+}
+
+// splitWords splits str into runs of whitespace and runs of everything else.
+func splitWords(str string) []string {
+	var words []string
+	start, space := 0, false
+	for i, r := range str {
+		if i > start && unicode.IsSpace(r) != space {
+			words = append(words, str[start:i])
+			start = i
+		}
+		space = unicode.IsSpace(r)
+	}
+	if start < len(str) {
+		words = append(words, str[start:])
+	}
+	return words
+}
+
+// splitLines splits str into lines, each including the newline that ends
+// it, if there is one.
+func splitLines(str string) []string {
+	lines := strings.SplitAfter(str, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
 
+// exceedsMaxDeltaRatio returns true if delta is too big to be worth storing
+// as a patch against a body of newBody.
+func (opts revisionOptions) exceedsMaxDeltaRatio(delta Delta, newBody []byte) bool {
+	if opts.maxDeltaRatio <= 0 {
+		return false
+	}
+	return float64(len(delta)) > opts.maxDeltaRatio*float64(len(newBody))
 }
 
 // GenerateRevision creates a Revision based on the two Posts. Note that
@@ -240,25 +682,93 @@ func diffHeaders(h1, h2 map[string][]string) map[string][]HeaderDelta {
 // It is the caller's responsibility to ensure the order of the Posts is
 // consistent, in order to obtain meaningful Revisions. As a general rule of
 // thumb, the posts should be in ascending chronological order.
-func GenerateRevision(p1, p2 Post) (Revision, error) {
-	var rev Revision
+//
+// Changes to inline bodies that a normalizer registered with
+// RegisterBodyNormalizer considers cosmetic aren't recorded. An error is
+// returned if the Posts' titles or slugs differ and either isn't valid
+// UTF-8, as deltas can only record changes to UTF-8 text.
+func GenerateRevision(p1, p2 Post, opts ...RevisionOption) (Revision, error) {
+	var parts []PartDelta
+	rev, err := generateRevision(p1, p2, opts, func(delta PartDelta) error {
+		parts = append(parts, delta)
+		return nil
+	})
+	if err != nil {
+		return rev, err
+	}
+	rev.PartsDeltas = parts
+	return rev, nil
+}
+
+// GenerateRevisionStreaming works like GenerateRevision, except instead of
+// collecting the PartDeltas for the Post's Parts in the returned Revision's
+// PartsDeltas property, it calls emit with each of them as they're computed,
+// so callers can write them somewhere without holding them all in memory.
+// Everything else, including MetadataDeltas, is returned in the Revision as
+// usual.
+//
+// If emit returns an error, GenerateRevisionStreaming stops and returns it.
+func GenerateRevisionStreaming(p1, p2 Post, emit func(PartDelta) error, opts ...RevisionOption) (Revision, error) {
+	return generateRevision(p1, p2, opts, emit)
+}
+
+func generateRevision(p1, p2 Post, opts []RevisionOption, emitParts func(PartDelta) error) (Revision, error) {
+	var options revisionOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	rev := Revision{
+		AuthorID:  options.authorID,
+		ActorType: options.actorType,
+		CreatedAt: options.createdAt,
+	}
 	if p1.ID != p2.ID {
-		return rev, errors.New("post IDs must match")
+		return rev, fmt.Errorf("%w: can't generate a revision from post %s to post %s", ErrIDMismatch, p1.ID, p2.ID)
 	}
+	if !options.granularity.Valid() {
+		return rev, fmt.Errorf("unknown diff granularity %q", options.granularity)
+	}
+	if err := checkSections(p1, p2); err != nil {
+		return rev, err
+	}
+
+	// make sure we're diffing the parts in the order their Positions say
+	// they're in, so the positions in the deltas never have gaps.
+	p1.NormalizeParts()
+	p2.NormalizeParts()
+	// compact deltas can only hold UTF-8 text, and would silently
+	// replace anything else with U+FFFD, so refuse to record a change
+	// to a title or slug that isn't UTF-8.
 	if p1.Title != p2.Title {
+		if err := checkUTF8("title", p1.Title, p2.Title); err != nil {
+			return rev, err
+		}
 		rev.TitleDelta = deltaFromStrings(p1.Title, p2.Title)
+		rev.TitleUndo = deltaFromStrings(p2.Title, p1.Title)
 	}
 	if p1.Slug != p2.Slug {
+		if err := checkUTF8("slug", p1.Slug, p2.Slug); err != nil {
+			return rev, err
+		}
 		rev.SlugDelta = deltaFromStrings(p1.Slug, p2.Slug)
+		rev.SlugUndo = deltaFromStrings(p2.Slug, p1.Slug)
 	}
 	rev.AuthorsDeltas = diffAuthors(p1.Authors, p2.Authors)
-	rev.PartsDeltas = diffParts(p1.Parts, p2.Parts)
-	rev.MetadataDeltas = diffParts(p1.Metadata, p2.Metadata)
+	rev.StreamsDeltas = diffStreams(p1.Streams, p2.Streams)
+	rev.MetadataDeltas = diffParts(p1.Metadata, p2.Metadata, options)
+	if err := streamParts(p1.Parts, p2.Parts, options, emitParts); err != nil {
+		return rev, err
+	}
 	return rev, nil
 }
 
 // get the compact delta format diff between two strings
-func deltaFromStrings(str1, str2 string) string {
+func deltaFromStrings(str1, str2 string) Delta {
+	// identical strings have no changes to record, and an empty Delta
+	// says that more clearly than one that keeps every character.
+	if str1 == str2 {
+		return ""
+	}
 	dmp := diffmatchpatch.New()
 
 	// find the differences between the strings
@@ -270,5 +780,29 @@ func deltaFromStrings(str1, str2 string) string {
 	// converts the diffs to compact delta format. E.g.:
 	//
 	// =3\t-2\t+ing -> Keep 3 chars, delete 2 chars, insert 'ing'.
-	return dmp.DiffToDelta(diffs)
+	return NewDelta(diffs)
+}
+
+// checkUTF8 returns an error if either version of the property named field
+// isn't valid UTF-8.
+func checkUTF8(field, before, after string) error {
+	for _, value := range []string{before, after} {
+		if !utf8.ValidString(value) {
+			return fmt.Errorf("%s %q is not valid UTF-8", field, value)
+		}
+	}
+	return nil
+}
+
+// get the compact delta format diff that deletes all of str1 and inserts all
+// of str2, without trying to find anything the two have in common
+func replacementDelta(str1, str2 string) Delta {
+	var diffs []diffmatchpatch.Diff
+	if str1 != "" {
+		diffs = append(diffs, diffmatchpatch.Diff{Type: diffmatchpatch.DiffDelete, Text: str1})
+	}
+	if str2 != "" {
+		diffs = append(diffs, diffmatchpatch.Diff{Type: diffmatchpatch.DiffInsert, Text: str2})
+	}
+	return NewDelta(diffs)
 }
@@ -0,0 +1,1006 @@
+package posts
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRevisionMaxDeltaRatio(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		before      string
+		after       string
+		ratio       float64
+		wantBody    Delta
+		wantReplace bool
+	}
+
+	tests := map[string]testCase{
+		"rewrite-triggers-fallback": {
+			before:      "a1b2c3d4e5",
+			after:       "a9b8c7d6e5",
+			ratio:       1,
+			wantBody:    "-10\t+a9b8c7d6e5",
+			wantReplace: true,
+		},
+		"small-edit-keeps-delta": {
+			before:   "hello world",
+			after:    "hello world!",
+			ratio:    1,
+			wantBody: "=11\t+!",
+		},
+		"no-ratio-keeps-delta": {
+			before:   "a1b2c3d4e5",
+			after:    "a9b8c7d6e5",
+			wantBody: "=1\t-1\t+9\t=1\t-1\t+8\t=1\t-1\t+7\t=1\t-1\t+6\t=2",
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p1 := Post{ID: "post", Parts: []Part{{ID: "part", Inline: true, Body: []byte(test.before)}}}
+			p2 := Post{ID: "post", Parts: []Part{{ID: "part", Inline: true, Body: []byte(test.after)}}}
+
+			var opts []RevisionOption
+			if test.ratio != 0 {
+				opts = append(opts, WithMaxDeltaRatio(test.ratio))
+			}
+			rev, err := GenerateRevision(p1, p2, opts...)
+			if err != nil {
+				t.Fatalf("unexpected error generating revision: %s", err)
+			}
+			if len(rev.PartsDeltas) != 1 {
+				t.Fatalf("expected 1 part delta, got %d: %+v", len(rev.PartsDeltas), rev.PartsDeltas)
+			}
+			delta := rev.PartsDeltas[0]
+			if delta.Body != test.wantBody {
+				t.Errorf("expected body delta %q, got %q", test.wantBody, delta.Body)
+			}
+			if delta.Replace != test.wantReplace {
+				t.Errorf("expected Replace to be %v, got %v", test.wantReplace, delta.Replace)
+			}
+		})
+	}
+}
+
+func TestGenerateRevisionStreaming(t *testing.T) {
+	t.Parallel()
+
+	p1 := Post{
+		ID:      "post",
+		Title:   "Before",
+		Authors: []string{"alice"},
+		Parts: []Part{
+			{ID: "a", Inline: true, Body: []byte("unchanged")},
+			{ID: "b", Inline: true, Body: []byte("changed")},
+			{ID: "c", Inline: true, Body: []byte("also changed")},
+		},
+		Metadata: []Part{
+			{ID: "summary", Inline: true, Body: []byte("A summary.")},
+		},
+	}
+	p2 := Post{
+		ID:      "post",
+		Title:   "After",
+		Authors: []string{"alice", "bob"},
+		Parts: []Part{
+			{ID: "a", Inline: true, Body: []byte("unchanged")},
+			{ID: "b", Inline: true, Body: []byte("changed!")},
+			{ID: "c", Inline: true, Body: []byte("also changed!")},
+			{ID: "d", Inline: true, Body: []byte("added")},
+		},
+		Metadata: []Part{
+			{ID: "summary", Inline: true, Body: []byte("A new summary.")},
+		},
+	}
+
+	want, err := GenerateRevision(p1, p2)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+
+	var emitted []PartDelta
+	got, err := GenerateRevisionStreaming(p1, p2, func(delta PartDelta) error {
+		emitted = append(emitted, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error generating streaming revision: %s", err)
+	}
+	if len(emitted) != 3 {
+		t.Errorf("expected emit to be called once per changed part, was called %d times", len(emitted))
+	}
+	if len(got.PartsDeltas) != 0 {
+		t.Errorf("expected no PartsDeltas in streamed revision, got %+v", got.PartsDeltas)
+	}
+	got.PartsDeltas = emitted
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected streamed revision to match\n%+v\ngot\n%+v", want, got)
+	}
+}
+
+func TestGenerateRevisionStreamingEmitError(t *testing.T) {
+	t.Parallel()
+
+	p1 := Post{ID: "post", Parts: []Part{
+		{ID: "a", Inline: true, Body: []byte("one")},
+		{ID: "b", Inline: true, Body: []byte("two")},
+	}}
+	p2 := Post{ID: "post", Parts: []Part{
+		{ID: "a", Inline: true, Body: []byte("uno")},
+		{ID: "b", Inline: true, Body: []byte("dos")},
+	}}
+
+	emitErr := errors.New("storage unavailable")
+	var calls int
+	_, err := GenerateRevisionStreaming(p1, p2, func(delta PartDelta) error {
+		calls++
+		return emitErr
+	})
+	if !errors.Is(err, emitErr) {
+		t.Errorf("expected emit error to be returned, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected emit to stop being called after an error, was called %d times", calls)
+	}
+}
+
+func TestGenerateRevisionPartChangedSection(t *testing.T) {
+	t.Parallel()
+
+	summary := Part{ID: "summary", Inline: true, Body: []byte("A summary.")}
+	summary.ComputeSHA256()
+	tests := map[string]struct {
+		p1, p2  Post
+		wantErr bool
+	}{
+		"parts-to-metadata": {
+			p1:      Post{ID: "post", Parts: []Part{summary}},
+			p2:      Post{ID: "post", Metadata: []Part{summary}},
+			wantErr: true,
+		},
+		"metadata-to-parts": {
+			p1:      Post{ID: "post", Metadata: []Part{summary}},
+			p2:      Post{ID: "post", Parts: []Part{summary}},
+			wantErr: true,
+		},
+		"in-both": {
+			p1: Post{ID: "post", Parts: []Part{summary}, Metadata: []Part{summary}},
+			p2: Post{ID: "post", Parts: []Part{summary}, Metadata: []Part{summary}},
+		},
+		"added-to-metadata": {
+			p1: Post{ID: "post", Parts: []Part{summary}},
+			p2: Post{ID: "post", Parts: []Part{summary}, Metadata: []Part{summary}},
+		},
+		"removed-from-parts": {
+			p1: Post{ID: "post", Parts: []Part{summary}, Metadata: []Part{summary}},
+			p2: Post{ID: "post", Metadata: []Part{summary}},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rev, err := GenerateRevision(test.p1, test.p2)
+			if test.wantErr {
+				if !errors.Is(err, ErrPartChangedSection) {
+					t.Errorf("expected ErrPartChangedSection, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got, err := ApplyRevision(test.p1, rev)
+			if err != nil {
+				t.Fatalf("unexpected error applying revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, test.p2) {
+				t.Errorf("expected %+v, got %+v", test.p2, got)
+			}
+		})
+	}
+}
+
+func TestGenerateRevisionDiffGranularity(t *testing.T) {
+	t.Parallel()
+
+	before := "It was a bright cold day in April.\n\n" +
+		"The quick brown fox jumps over the lazy dog.\n\n" +
+		"Déjà vu, all over again 😀\n"
+	after := "It was a bright cold day in April.\n\n" +
+		"The quick brown fix jumps over the lazy dog.\n\n" +
+		"Déjà vu, all over again 😀\n" +
+		"The end.\n"
+	p1 := Post{ID: "post", Parts: []Part{inlinePart("body", 0, before)}}
+	p2 := Post{ID: "post", Parts: []Part{inlinePart("body", 0, after)}}
+
+	tests := map[DiffGranularity][]string{
+		DiffGranularityDefault:   {"i", "The end.\n"},
+		DiffGranularityCharacter: {"i", "The end.\n"},
+		DiffGranularityWord:      {"fix", "The end.\n"},
+		DiffGranularityLine:      {"The quick brown fix jumps over the lazy dog.\n", "The end.\n"},
+	}
+
+	for granularity, wantInserted := range tests {
+		granularity, wantInserted := granularity, wantInserted
+		t.Run(string(granularity), func(t *testing.T) {
+			t.Parallel()
+
+			rev, err := GenerateRevision(p1, p2, WithDiffGranularity(granularity))
+			if err != nil {
+				t.Fatalf("unexpected error generating revision: %s", err)
+			}
+			if len(rev.PartsDeltas) != 1 {
+				t.Fatalf("expected 1 part delta, got %+v", rev.PartsDeltas)
+			}
+			if got := insertedText(rev.PartsDeltas[0].Body); !reflect.DeepEqual(got, wantInserted) {
+				t.Errorf("expected inserted text %q, got %q", wantInserted, got)
+			}
+
+			got, err := ApplyRevision(p1, rev)
+			if err != nil {
+				t.Fatalf("unexpected error applying revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, p2) {
+				t.Errorf("expected\n%+v\ngot\n%+v", p2, got)
+			}
+			got, err = ApplyRevision(p2, InvertRevision(rev))
+			if err != nil {
+				t.Fatalf("unexpected error applying inverted revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, p1) {
+				t.Errorf("expected inverted revision to produce\n%+v\ngot\n%+v", p1, got)
+			}
+		})
+	}
+
+	if _, err := GenerateRevision(p1, p2, WithDiffGranularity("paragraph")); err == nil {
+		t.Errorf("expected an error generating a revision with an unknown granularity")
+	}
+}
+
+func TestTokenDeltaManyTokens(t *testing.T) {
+	t.Parallel()
+
+	// more distinct lines than there are runes before the surrogate
+	// range, which can't stand in for them.
+	var lines strings.Builder
+	for n := 0; n < 60000; n++ {
+		fmt.Fprintf(&lines, "line %d\n", n)
+	}
+	before := lines.String()
+	after := before + "line 60000\n"
+	delta := tokenDelta(before, after, splitLines)
+	got, err := delta.apply(before)
+	if err != nil {
+		t.Fatalf("unexpected error applying delta: %s", err)
+	}
+	if got != after {
+		t.Errorf("expected applying the delta to add the last line, got %d bytes instead of %d", len(got), len(after))
+	}
+}
+
+func TestGenerateRevisionIDMismatch(t *testing.T) {
+	t.Parallel()
+
+	_, err := GenerateRevision(Post{ID: "post"}, Post{ID: "other"})
+	if !errors.Is(err, ErrIDMismatch) {
+		t.Errorf("expected ErrIDMismatch, got %v", err)
+	}
+	if _, err := GenerateRevisionStreaming(Post{ID: "post"}, Post{ID: "other"}, func(PartDelta) error { return nil }); !errors.Is(err, ErrIDMismatch) {
+		t.Errorf("expected ErrIDMismatch streaming, got %v", err)
+	}
+}
+
+func TestGenerateRevisionPositionGaps(t *testing.T) {
+	t.Parallel()
+
+	p1 := Post{ID: "post", Parts: []Part{
+		{ID: "a", Position: 0, Inline: true, Body: []byte("a")},
+		{ID: "b", Position: 2, Inline: true, Body: []byte("b")},
+		{ID: "c", Position: 5, Inline: true, Body: []byte("c")},
+	}}
+	p2 := Post{ID: "post", Parts: []Part{
+		{ID: "a", Position: 0, Inline: true, Body: []byte("a")},
+		{ID: "b", Position: 1, Inline: true, Body: []byte("b")},
+		{ID: "c", Position: 2, Inline: true, Body: []byte("c")},
+	}}
+
+	rev, err := GenerateRevision(p1, p2)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	if len(rev.PartsDeltas) != 0 {
+		t.Errorf("expected closing gaps not to produce deltas, got %+v", rev.PartsDeltas)
+	}
+	if p1.Parts[2].Position != 5 {
+		t.Errorf("expected GenerateRevision not to modify its inputs, got %+v", p1.Parts)
+	}
+}
+
+func TestGenerateRevisionAnchorChange(t *testing.T) {
+	t.Parallel()
+
+	p1 := Post{ID: "post", Parts: []Part{
+		{ID: "a", Anchor: "intro", Inline: true, Body: []byte("body")},
+		{ID: "b", Anchor: "old", Inline: true, Body: []byte("body")},
+	}}
+	p2 := Post{ID: "post", Parts: []Part{
+		{ID: "b", Anchor: "new", Inline: true, Body: []byte("body")},
+		{ID: "a", Anchor: "intro", Inline: true, Body: []byte("body")},
+	}}
+
+	rev, err := GenerateRevision(p1, p2)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	// swapping two parts only needs one of them to move, and a stays
+	// put, so only b, which is also changed, has a delta.
+	if len(rev.PartsDeltas) != 1 {
+		t.Fatalf("expected 1 part delta, got %+v", rev.PartsDeltas)
+	}
+	changed := rev.PartsDeltas[0]
+	if changed.PartID != "b" || changed.Op != DeltaMoveUpdate {
+		t.Errorf("expected b to be moved and updated, got %+v", changed)
+	}
+	if changed.AnchorFrom != "old" || changed.AnchorTo != "new" {
+		t.Errorf("expected b's anchor to change from %q to %q, got %q to %q", "old", "new", changed.AnchorFrom, changed.AnchorTo)
+	}
+
+	unmoved := Post{ID: "post", Parts: []Part{
+		{ID: "a", Anchor: "intro", Inline: true, Body: []byte("body")},
+		{ID: "b", Anchor: "new", Inline: true, Body: []byte("body")},
+	}}
+	rev, err = GenerateRevision(p1, unmoved)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	if len(rev.PartsDeltas) != 1 || rev.PartsDeltas[0].Op != DeltaUpdate {
+		t.Errorf("expected an anchor change alone to be an update, got %+v", rev.PartsDeltas)
+	}
+}
+
+func TestGenerateRevisionShiftedPositions(t *testing.T) {
+	t.Parallel()
+
+	base := Post{ID: "post", Parts: []Part{
+		inlinePart("a", 0, "a"),
+		inlinePart("b", 1, "b"),
+		inlinePart("c", 2, "c"),
+		inlinePart("d", 3, "d"),
+		inlinePart("e", 4, "e"),
+	}}
+	// reorder, remove d, and insert x in the middle, all at once.
+	want := Post{ID: "post", Parts: []Part{
+		inlinePart("e", 0, "e"),
+		inlinePart("a", 1, "a"),
+		inlinePart("x", 2, "x"),
+		inlinePart("c", 3, "c"),
+		inlinePart("b", 4, "b"),
+	}}
+
+	rev, err := GenerateRevision(base, want)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	type position struct {
+		id       string
+		op       DeltaOp
+		from, to int
+	}
+	// a and b stay in the same order, so they're left where they are,
+	// and only c and e are moved around them.
+	wantPositions := []position{
+		{id: "c", op: DeltaMove, from: 2, to: 3},
+		{id: "d", op: DeltaRemove, from: 3, to: -1},
+		{id: "e", op: DeltaMove, from: 4, to: 0},
+		{id: "x", op: DeltaAdd, from: -1, to: 2},
+	}
+	var gotPositions []position
+	for _, delta := range rev.PartsDeltas {
+		gotPositions = append(gotPositions, position{id: delta.PartID, op: delta.Op, from: delta.FromPosition, to: delta.ToPosition})
+	}
+	if !reflect.DeepEqual(gotPositions, wantPositions) {
+		t.Errorf("expected positions %+v, got %+v", wantPositions, gotPositions)
+	}
+
+	got, err := ApplyRevision(base, rev)
+	if err != nil {
+		t.Fatalf("unexpected error applying revision: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected\n%+v\ngot\n%+v", want, got)
+	}
+
+	// the deltas describe a single rearrangement, so the order they're
+	// listed in doesn't matter.
+	reversed := rev
+	reversed.PartsDeltas = nil
+	for i := len(rev.PartsDeltas) - 1; i >= 0; i-- {
+		reversed.PartsDeltas = append(reversed.PartsDeltas, rev.PartsDeltas[i])
+	}
+	got, err = ApplyRevision(base, reversed)
+	if err != nil {
+		t.Fatalf("unexpected error applying reversed revision: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected reversed deltas to produce\n%+v\ngot\n%+v", want, got)
+	}
+
+	got, err = ApplyRevision(want, InvertRevision(rev))
+	if err != nil {
+		t.Fatalf("unexpected error applying inverted revision: %s", err)
+	}
+	if !reflect.DeepEqual(got, base) {
+		t.Errorf("expected inverted revision to produce\n%+v\ngot\n%+v", base, got)
+	}
+}
+
+func TestGenerateRevisionMinimalMoves(t *testing.T) {
+	t.Parallel()
+
+	base := Post{ID: "post", Parts: []Part{
+		inlinePart("a", 0, "a"),
+		inlinePart("b", 1, "b"),
+		inlinePart("c", 2, "c"),
+		inlinePart("d", 3, "d"),
+		inlinePart("e", 4, "e"),
+	}}
+
+	type position struct {
+		id       string
+		op       DeltaOp
+		from, to int
+	}
+
+	tests := map[string]struct {
+		parts []Part
+		want  []position
+	}{
+		"insert-at-top": {
+			parts: []Part{
+				inlinePart("x", 0, "x"),
+				inlinePart("a", 1, "a"),
+				inlinePart("b", 2, "b"),
+				inlinePart("c", 3, "c"),
+				inlinePart("d", 4, "d"),
+				inlinePart("e", 5, "e"),
+			},
+			want: []position{{id: "x", op: DeltaAdd, from: -1, to: 0}},
+		},
+		"remove-from-top": {
+			parts: []Part{
+				inlinePart("b", 0, "b"),
+				inlinePart("c", 1, "c"),
+				inlinePart("d", 2, "d"),
+				inlinePart("e", 3, "e"),
+			},
+			want: []position{{id: "a", op: DeltaRemove, from: 0, to: -1}},
+		},
+		// a part that's shifted by an insertion and edited is updated,
+		// not moved.
+		"insert-and-edit": {
+			parts: []Part{
+				inlinePart("x", 0, "x"),
+				inlinePart("a", 1, "a"),
+				inlinePart("b", 2, "b!"),
+				inlinePart("c", 3, "c"),
+				inlinePart("d", 4, "d"),
+				inlinePart("e", 5, "e"),
+			},
+			want: []position{
+				{id: "b", op: DeltaUpdate, from: 1, to: 2},
+				{id: "x", op: DeltaAdd, from: -1, to: 0},
+			},
+		},
+		"move-to-top": {
+			parts: []Part{
+				inlinePart("e", 0, "e"),
+				inlinePart("a", 1, "a"),
+				inlinePart("b", 2, "b"),
+				inlinePart("c", 3, "c"),
+				inlinePart("d", 4, "d"),
+			},
+			want: []position{{id: "e", op: DeltaMove, from: 4, to: 0}},
+		},
+		"swap-neighbours": {
+			parts: []Part{
+				inlinePart("a", 0, "a"),
+				inlinePart("c", 1, "c"),
+				inlinePart("b", 2, "b"),
+				inlinePart("d", 3, "d"),
+				inlinePart("e", 4, "e"),
+			},
+			want: []position{{id: "c", op: DeltaMove, from: 2, to: 1}},
+		},
+		"reverse": {
+			parts: []Part{
+				inlinePart("e", 0, "e"),
+				inlinePart("d", 1, "d"),
+				inlinePart("c", 2, "c"),
+				inlinePart("b", 3, "b"),
+				inlinePart("a", 4, "a"),
+			},
+			want: []position{
+				{id: "b", op: DeltaMove, from: 1, to: 3},
+				{id: "c", op: DeltaMove, from: 2, to: 2},
+				{id: "d", op: DeltaMove, from: 3, to: 1},
+				{id: "e", op: DeltaMove, from: 4, to: 0},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			want := Post{ID: "post", Parts: test.parts}
+			rev, err := GenerateRevision(base, want)
+			if err != nil {
+				t.Fatalf("unexpected error generating revision: %s", err)
+			}
+			var got []position
+			for _, delta := range rev.PartsDeltas {
+				got = append(got, position{id: delta.PartID, op: delta.Op, from: delta.FromPosition, to: delta.ToPosition})
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected deltas %+v, got %+v", test.want, got)
+			}
+
+			applied, err := ApplyRevision(base, rev)
+			if err != nil {
+				t.Fatalf("unexpected error applying revision: %s", err)
+			}
+			if !reflect.DeepEqual(applied, want) {
+				t.Errorf("expected\n%+v\ngot\n%+v", want, applied)
+			}
+			inverted, err := ApplyRevision(want, InvertRevision(rev))
+			if err != nil {
+				t.Fatalf("unexpected error applying inverted revision: %s", err)
+			}
+			if !reflect.DeepEqual(inverted, base) {
+				t.Errorf("expected inverted revision to produce\n%+v\ngot\n%+v", base, inverted)
+			}
+		})
+	}
+}
+
+func TestGenerateRevisionBinaryBody(t *testing.T) {
+	t.Parallel()
+
+	binary := "\x89PNG\xff\xfe\x00\xff\xfe"
+	octetStream := map[string][]string{"Content-Type": {"application/octet-stream"}}
+	binaryEncoding := map[string][]string{"Content-Transfer-Encoding": {"binary"}}
+
+	tests := map[string]struct {
+		before, after Part
+		wantBinary    bool
+	}{
+		"binary-changed": {
+			before:     inlinePart("a", 0, binary),
+			after:      inlinePart("a", 0, binary+"\xff"),
+			wantBinary: true,
+		},
+		"text-to-binary": {
+			before:     inlinePart("a", 0, "plain text"),
+			after:      inlinePart("a", 0, binary),
+			wantBinary: true,
+		},
+		"binary-to-text": {
+			before:     inlinePart("a", 0, binary),
+			after:      inlinePart("a", 0, "plain text"),
+			wantBinary: true,
+		},
+		"binary-to-non-inline": {
+			before:     inlinePart("a", 0, binary),
+			after:      Part{ID: "a", Position: 0, SHA256: "abc123"},
+			wantBinary: true,
+		},
+		"non-inline-to-binary": {
+			before:     Part{ID: "a", Position: 0, SHA256: "abc123"},
+			after:      inlinePart("a", 0, binary),
+			wantBinary: true,
+		},
+		"octet-stream": {
+			before:     Part{ID: "a", Position: 0, Inline: true, Headers: octetStream, Body: []byte("abc"), SHA256: sha256Hex([]byte("abc"))},
+			after:      Part{ID: "a", Position: 0, Inline: true, Headers: octetStream, Body: []byte("abd"), SHA256: sha256Hex([]byte("abd"))},
+			wantBinary: true,
+		},
+		"binary-transfer-encoding": {
+			before:     Part{ID: "a", Position: 0, Inline: true, Headers: binaryEncoding, Body: []byte("abc"), SHA256: sha256Hex([]byte("abc"))},
+			after:      Part{ID: "a", Position: 0, Inline: true, Headers: binaryEncoding, Body: []byte("abd"), SHA256: sha256Hex([]byte("abd"))},
+			wantBinary: true,
+		},
+		"text-changed": {
+			before:     inlinePart("a", 0, "plain text"),
+			after:      inlinePart("a", 0, "plainer text"),
+			wantBinary: false,
+		},
+		"binary-moved": {
+			before:     inlinePart("a", 0, binary),
+			after:      inlinePart("a", 1, binary),
+			wantBinary: false,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p1 := Post{ID: "post", Parts: []Part{test.before}}
+			p2 := Post{ID: "post", Parts: []Part{test.after}}
+			if test.after.Position == 1 {
+				p2.Parts = []Part{inlinePart("b", 0, "b"), test.after}
+				p1.Parts = append(p1.Parts, inlinePart("b", 1, "b"))
+			}
+
+			rev, err := GenerateRevision(p1, p2)
+			if err != nil {
+				t.Fatalf("unexpected error generating revision: %s", err)
+			}
+			for _, delta := range rev.PartsDeltas {
+				if delta.PartID != "a" {
+					continue
+				}
+				if delta.Binary != test.wantBinary {
+					t.Errorf("expected Binary to be %v, got %v", test.wantBinary, delta.Binary)
+				}
+				if delta.Binary && (delta.Body != "" || delta.BodyUndo != "" || !delta.Replace) {
+					t.Errorf("expected binary delta to have no body deltas and Replace set, got %+v", delta)
+				}
+			}
+
+			got, err := ApplyRevision(p1, rev)
+			if err != nil {
+				t.Fatalf("unexpected error applying revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, p2) {
+				t.Errorf("expected\n%+v\ngot\n%+v", p2, got)
+			}
+			got, err = ApplyRevision(p2, InvertRevision(rev))
+			if err != nil {
+				t.Fatalf("unexpected error applying inverted revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, p1) {
+				t.Errorf("expected inverted revision to produce\n%+v\ngot\n%+v", p1, got)
+			}
+		})
+	}
+}
+
+func TestGenerateRevisionHeaderCase(t *testing.T) {
+	t.Parallel()
+
+	p1 := Post{ID: "post", Parts: []Part{
+		{ID: "a", Inline: true, Body: []byte("body"), Headers: map[string][]string{"content-type": {"text/plain"}}},
+	}}
+	p2 := Post{ID: "post", Parts: []Part{
+		{ID: "a", Inline: true, Body: []byte("body"), Headers: map[string][]string{"Content-Type": {"text/plain"}}},
+	}}
+
+	rev, err := GenerateRevision(p1, p2)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	if len(rev.PartsDeltas) != 0 {
+		t.Errorf("expected a case-only header change to produce no part deltas, got %+v", rev.PartsDeltas)
+	}
+	if deltas := diffHeaders(p1.Parts[0].Headers, p2.Parts[0].Headers); len(deltas) != 0 {
+		t.Errorf("expected no header deltas, got %+v", deltas)
+	}
+
+	p2.Parts[0].Headers = map[string][]string{"Content-Type": {"text/html"}}
+	rev, err = GenerateRevision(p1, p2)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	if len(rev.PartsDeltas) != 1 {
+		t.Fatalf("expected a single part delta, got %+v", rev.PartsDeltas)
+	}
+	if deltas := rev.PartsDeltas[0].Headers; len(deltas) != 1 || deltas["Content-Type"] == nil {
+		t.Errorf("expected only Content-Type to change, got %+v", deltas)
+	}
+	got, err := ApplyRevision(p1, rev)
+	if err != nil {
+		t.Fatalf("unexpected error applying revision: %s", err)
+	}
+	if ct := got.Parts[0].ContentType(); ct != "text/html" {
+		t.Errorf("expected content type %q, got %q", "text/html", ct)
+	}
+}
+
+func TestGenerateRevisionEmptyPost(t *testing.T) {
+	t.Parallel()
+
+	empty := Post{ID: "post"}
+	full := Post{
+		ID:      "post",
+		Title:   "Hello",
+		Slug:    "hello",
+		Authors: []string{"alice", "bob"},
+		Streams: []string{"blog"},
+		Parts: []Part{
+			{ID: "a", Position: 0, Inline: true, Body: []byte("Hello"), Headers: map[string][]string{"Content-Type": {"text/plain"}}},
+			{ID: "b", Position: 1, Inline: true, Body: []byte("No headers")},
+			{ID: "c", Position: 2, SHA256: "abc123", Headers: map[string][]string{"Content-Type": {"image/png"}}},
+		},
+		Metadata: []Part{
+			{ID: "m", Position: 0, Inline: true, Body: []byte("Summary"), Headers: map[string][]string{RoleHeader: {RoleSummary}}},
+		},
+	}
+
+	tests := map[string]struct {
+		from, to Post
+		op       DeltaOp
+	}{
+		"empty-to-full": {from: empty, to: full, op: DeltaAdd},
+		"full-to-empty": {from: full, to: empty, op: DeltaRemove},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rev, err := GenerateRevision(test.from, test.to)
+			if err != nil {
+				t.Fatalf("unexpected error generating revision: %s", err)
+			}
+			if len(rev.AuthorsDeltas) != 2 || len(rev.StreamsDeltas) != 1 || len(rev.PartsDeltas) != 3 || len(rev.MetadataDeltas) != 1 {
+				t.Fatalf("expected every author, stream, and part to change, got %+v", rev)
+			}
+			for _, delta := range rev.AuthorsDeltas {
+				if delta.Op != test.op || (test.op == DeltaAdd && delta.FromPosition != -1) || (test.op == DeltaRemove && delta.ToPosition != -1) {
+					t.Errorf("expected author %s to be %s, got %+v", delta.Author, test.op, delta)
+				}
+			}
+			for _, deltas := range [][]PartDelta{rev.PartsDeltas, rev.MetadataDeltas} {
+				for _, delta := range deltas {
+					if delta.Op != test.op || (test.op == DeltaAdd && delta.FromPosition != -1) || (test.op == DeltaRemove && delta.ToPosition != -1) {
+						t.Errorf("expected part %s to be %s, got %+v", delta.PartID, test.op, delta)
+					}
+				}
+			}
+			got, err := ApplyRevision(test.from, rev)
+			if err != nil {
+				t.Fatalf("unexpected error applying revision: %s", err)
+			}
+			if diff, err := GenerateRevision(got, test.to); err != nil || !diff.IsEmpty() {
+				t.Errorf("expected applying the revision to produce\n%+v\ngot\n%+v", test.to, got)
+			}
+		})
+	}
+}
+
+func TestGenerateRevisionNilHeaders(t *testing.T) {
+	t.Parallel()
+
+	p1 := Post{ID: "post", Parts: []Part{{ID: "a", Inline: true, Body: []byte("body")}}}
+	p2 := Post{ID: "post", Parts: []Part{{ID: "a", Inline: true, Body: []byte("body"), Headers: map[string][]string{}}}}
+	rev, err := GenerateRevision(p1, p2)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	if !rev.IsEmpty() {
+		t.Errorf("expected nil and empty headers to be the same, got %+v", rev)
+	}
+
+	p2.Parts[0].Headers = map[string][]string{"Content-Type": {"text/plain"}}
+	for _, pair := range [][2]Post{{p1, p2}, {p2, p1}} {
+		rev, err := GenerateRevision(pair[0], pair[1])
+		if err != nil {
+			t.Fatalf("unexpected error generating revision: %s", err)
+		}
+		if len(rev.PartsDeltas) != 1 || len(rev.PartsDeltas[0].Headers["Content-Type"]) != 1 {
+			t.Fatalf("expected a single header change, got %+v", rev.PartsDeltas)
+		}
+		got, err := ApplyRevision(pair[0], rev)
+		if err != nil {
+			t.Fatalf("unexpected error applying revision: %s", err)
+		}
+		if !headersEqual(got.Parts[0].Headers, pair[1].Parts[0].Headers) {
+			t.Errorf("expected headers %v, got %v", pair[1].Parts[0].Headers, got.Parts[0].Headers)
+		}
+	}
+}
+
+func TestGenerateRevisionStreams(t *testing.T) {
+	t.Parallel()
+
+	p1 := Post{ID: "post", Streams: []string{"blog", "tech"}}
+	p2 := Post{ID: "post", Streams: []string{"tech", "archive"}}
+
+	rev, err := GenerateRevision(p1, p2)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	want := []StreamsDelta{
+		{Op: DeltaRemove, Stream: "blog", FromPosition: 0, ToPosition: -1},
+		{Op: DeltaMove, Stream: "tech", FromPosition: 1, ToPosition: 0},
+		{Op: DeltaAdd, Stream: "archive", FromPosition: -1, ToPosition: 1},
+	}
+	if !reflect.DeepEqual(rev.StreamsDeltas, want) {
+		t.Errorf("expected\n%+v\ngot\n%+v", want, rev.StreamsDeltas)
+	}
+	if !rev.HasStructuralChanges() {
+		t.Errorf("expected a stream change to be structural")
+	}
+}
+
+func TestGenerateRevisionEqualLengthDisjoint(t *testing.T) {
+	t.Parallel()
+
+	p1 := Post{
+		ID:      "post",
+		Authors: []string{"alice", "bob"},
+		Parts: []Part{
+			inlinePart("a", 0, "one"),
+			inlinePart("b", 1, "two"),
+		},
+	}
+	p1.Parts[0].Headers = map[string][]string{"X-Tag": {"x", "y"}}
+	p2 := Post{
+		ID:      "post",
+		Authors: []string{"alice", "carol"},
+		Parts: []Part{
+			inlinePart("a", 0, "one"),
+			inlinePart("c", 1, "three"),
+		},
+	}
+	p2.Parts[0].Headers = map[string][]string{"X-Tag": {"x", "z"}}
+
+	rev, err := GenerateRevision(p1, p2)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+
+	wantAuthors := []AuthorsDelta{
+		{Op: DeltaRemove, Author: "bob", FromPosition: 1, ToPosition: -1},
+		{Op: DeltaAdd, Author: "carol", FromPosition: -1, ToPosition: 1},
+	}
+	if !reflect.DeepEqual(rev.AuthorsDeltas, wantAuthors) {
+		t.Errorf("expected authors deltas\n%+v\ngot\n%+v", wantAuthors, rev.AuthorsDeltas)
+	}
+
+	ops := map[string]DeltaOp{}
+	for _, delta := range rev.PartsDeltas {
+		ops[delta.PartID] = delta.Op
+	}
+	wantOps := map[string]DeltaOp{"a": DeltaUpdate, "b": DeltaRemove, "c": DeltaAdd}
+	if !reflect.DeepEqual(ops, wantOps) {
+		t.Errorf("expected part ops %v, got %v", wantOps, ops)
+	}
+
+	headerOps := map[string]DeltaOp{}
+	for _, delta := range rev.PartsDeltas {
+		if delta.PartID != "a" {
+			continue
+		}
+		for _, headerDelta := range delta.Headers["X-Tag"] {
+			headerOps[headerDelta.Value] = headerDelta.Op
+		}
+	}
+	wantHeaderOps := map[string]DeltaOp{"y": DeltaRemove, "z": DeltaAdd}
+	if !reflect.DeepEqual(headerOps, wantHeaderOps) {
+		t.Errorf("expected header ops %v, got %v", wantHeaderOps, headerOps)
+	}
+
+	got, err := ApplyRevision(p1, rev)
+	if err != nil {
+		t.Fatalf("unexpected error applying revision: %s", err)
+	}
+	if !reflect.DeepEqual(got, p2) {
+		t.Errorf("expected revision to round trip to\n%+v\ngot\n%+v", p2, got)
+	}
+}
+
+func TestDiffHeaders(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		h1, h2 map[string][]string
+		want   map[string][]HeaderDelta
+	}{
+		"equal-length-disjoint": {
+			h1: map[string][]string{"X-Tag": {"a", "b"}},
+			h2: map[string][]string{"X-Tag": {"a", "c"}},
+			want: map[string][]HeaderDelta{"X-Tag": {
+				{Op: DeltaRemove, Value: "b", FromPosition: 1, ToPosition: -1},
+				{Op: DeltaAdd, Value: "c", FromPosition: -1, ToPosition: 1},
+			}},
+		},
+		"equal-length-swapped": {
+			h1: map[string][]string{"X-Tag": {"a", "b"}},
+			h2: map[string][]string{"X-Tag": {"b", "a"}},
+			want: map[string][]HeaderDelta{"X-Tag": {
+				{Op: DeltaMove, Value: "a", FromPosition: 0, ToPosition: 1},
+				{Op: DeltaMove, Value: "b", FromPosition: 1, ToPosition: 0},
+			}},
+		},
+		"shorter-second": {
+			h1: map[string][]string{"X-Tag": {"a", "b"}},
+			h2: map[string][]string{"X-Tag": {"b"}},
+			want: map[string][]HeaderDelta{"X-Tag": {
+				{Op: DeltaRemove, Value: "a", FromPosition: 0, ToPosition: -1},
+				{Op: DeltaMove, Value: "b", FromPosition: 1, ToPosition: 0},
+			}},
+		},
+		"header-removed": {
+			h1: map[string][]string{"Content-Type": {"text/plain"}, "X-Tag": {"a", "b"}},
+			h2: map[string][]string{"Content-Type": {"text/plain"}},
+			want: map[string][]HeaderDelta{"X-Tag": {
+				{Op: DeltaRemove, Value: "a", FromPosition: 0, ToPosition: -1},
+				{Op: DeltaRemove, Value: "b", FromPosition: 1, ToPosition: -1},
+			}},
+		},
+		"header-added": {
+			h2: map[string][]string{"X-Tag": {"a"}},
+			want: map[string][]HeaderDelta{"X-Tag": {
+				{Op: DeltaAdd, Value: "a", FromPosition: -1, ToPosition: 0},
+			}},
+		},
+		"unchanged": {
+			h1:   map[string][]string{"X-Tag": {"a", "b"}},
+			h2:   map[string][]string{"X-Tag": {"a", "b"}},
+			want: map[string][]HeaderDelta{},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := diffHeaders(test.h1, test.h2)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected\n%+v\ngot\n%+v", test.want, got)
+			}
+			applied, err := applyHeaderDeltas(test.h1, got)
+			if err != nil {
+				t.Fatalf("unexpected error applying header deltas: %s", err)
+			}
+			if !headersEqual(applied, test.h2) {
+				t.Errorf("expected deltas to produce\n%+v\ngot\n%+v", test.h2, applied)
+			}
+		})
+	}
+}
+
+func TestGenerateRevisionInvalidUTF8(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		p1, p2  Post
+		wantErr bool
+	}{
+		"title-changed":   {p1: Post{ID: "post", Title: "a"}, p2: Post{ID: "post", Title: "a\xff"}, wantErr: true},
+		"title-unchanged": {p1: Post{ID: "post", Title: "a\xff"}, p2: Post{ID: "post", Title: "a\xff", Slug: "a"}},
+		"slug-changed":    {p1: Post{ID: "post", Slug: "\xffa"}, p2: Post{ID: "post", Slug: "a"}, wantErr: true},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := GenerateRevision(test.p1, test.p2)
+			if test.wantErr && err == nil {
+				t.Errorf("expected an error, got nil")
+			} else if !test.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package posts
+
+import (
+	"fmt"
+	"html/template"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// PostDiffView is a human-readable rendering of the differences between two
+// versions of a Post, with insertions and deletions marked up in HTML.
+type PostDiffView struct {
+	// Title is the diff of the Post's title, as HTML.
+	Title template.HTML
+
+	// Slug is the diff of the Post's slug, as HTML.
+	Slug template.HTML
+
+	// Parts contains the diffs of the bodies of the inline parts that are
+	// in both versions of the Post, in the order they appear in the first
+	// version.
+	Parts []PartDiffView
+
+	// AddedParts contains the IDs of the parts that are only in the second
+	// version of the Post.
+	AddedParts []string
+
+	// RemovedParts contains the IDs of the parts that are only in the
+	// first version of the Post.
+	RemovedParts []string
+
+	// AddedAuthors contains the IDs of the authors that are only in the
+	// second version of the Post.
+	AddedAuthors []string
+
+	// RemovedAuthors contains the IDs of the authors that are only in the
+	// first version of the Post.
+	RemovedAuthors []string
+}
+
+// PartDiffView is a human-readable rendering of the differences between two
+// versions of a Part.
+type PartDiffView struct {
+	// PartID is the ID of the part the diff is for.
+	PartID string
+
+	// Changed is true if the part's body is different between the two
+	// versions.
+	Changed bool
+
+	// Binary is true if the part's body is binary, rather than UTF-8 text,
+	// in either version. Binary bodies can't be diffed as text, so Body
+	// only holds a placeholder for them.
+	Binary bool
+
+	// Body is the diff of the part's body, as HTML.
+	Body template.HTML
+}
+
+// RenderDiff describes the differences between two versions of a Post in a
+// form suitable for displaying to humans. Like GenerateRevision, which it uses
+// to find the differences, it's not commutative, and p1 should be the earlier
+// version of the Post.
+func RenderDiff(p1, p2 Post) (PostDiffView, error) {
+	var view PostDiffView
+	rev, err := GenerateRevision(p1, p2)
+	if err != nil {
+		return view, err
+	}
+	dmp := diffmatchpatch.New()
+
+	view.Title, err = renderDelta(dmp, p1.Title, rev.TitleDelta)
+	if err != nil {
+		return view, fmt.Errorf("error rendering title diff: %w", err)
+	}
+	view.Slug, err = renderDelta(dmp, p1.Slug, rev.SlugDelta)
+	if err != nil {
+		return view, fmt.Errorf("error rendering slug diff: %w", err)
+	}
+
+	for _, delta := range rev.AuthorsDeltas {
+		switch delta.Op {
+		case DeltaAdd:
+			view.AddedAuthors = append(view.AddedAuthors, delta.Author)
+		case DeltaRemove:
+			view.RemovedAuthors = append(view.RemovedAuthors, delta.Author)
+		}
+	}
+
+	bodyDeltas := map[string]PartDelta{}
+	for _, delta := range rev.PartsDeltas {
+		switch delta.Op {
+		case DeltaAdd:
+			view.AddedParts = append(view.AddedParts, delta.PartID)
+		case DeltaRemove:
+			view.RemovedParts = append(view.RemovedParts, delta.PartID)
+		default:
+			bodyDeltas[delta.PartID] = delta
+		}
+	}
+
+	before := partsByID(p1.Parts)
+	after := partsByID(p2.Parts)
+	for _, id := range CommonParts(p1, p2) {
+		part, part2 := before[id], after[id]
+		if !part.Inline || !part2.Inline {
+			continue
+		}
+		delta := bodyDeltas[part.ID]
+		partView := PartDiffView{
+			PartID:  part.ID,
+			Changed: delta.Body != "" || delta.Binary,
+			Binary:  delta.Binary || hasBinaryBody(part) || hasBinaryBody(part2),
+		}
+		if partView.Binary {
+			partView.Body = renderBinaryPlaceholder(partView.Changed)
+			view.Parts = append(view.Parts, partView)
+			continue
+		}
+		partView.Body, err = renderDelta(dmp, string(part.Body), delta.Body)
+		if err != nil {
+			return view, fmt.Errorf("error rendering diff for part %s: %w", part.ID, err)
+		}
+		view.Parts = append(view.Parts, partView)
+	}
+	return view, nil
+}
+
+// CommonParts returns the IDs of the Parts that are in both a and b, in the
+// order they appear in a.
+func CommonParts(a, b Post) []string {
+	inB := partsByID(b.Parts)
+	var common []string
+	for _, part := range a.Parts {
+		if _, ok := inB[part.ID]; ok {
+			common = append(common, part.ID)
+		}
+	}
+	return common
+}
+
+func partsByID(parts []Part) map[string]Part {
+	byID := make(map[string]Part, len(parts))
+	for _, part := range parts {
+		byID[part.ID] = part
+	}
+	return byID
+}
+
+// renderBinaryPlaceholder returns the HTML shown in place of a diff for a
+// part with a binary body.
+func renderBinaryPlaceholder(changed bool) template.HTML {
+	if changed {
+		return "<span>binary content changed</span>"
+	}
+	return "<span>binary content unchanged</span>"
+}
+
+// renderDelta returns the HTML rendering of delta applied to text. An empty
+// delta renders text unchanged.
+func renderDelta(dmp *diffmatchpatch.DiffMatchPatch, text string, delta Delta) (template.HTML, error) {
+	var diffs []diffmatchpatch.Diff
+	if delta == "" {
+		diffs = []diffmatchpatch.Diff{{Type: diffmatchpatch.DiffEqual, Text: text}}
+	} else {
+		var err error
+		diffs, err = dmp.DiffFromDelta(text, string(delta))
+		if err != nil {
+			return "", err
+		}
+	}
+	// DiffPrettyHtml escapes the text of every diff, so this is safe to
+	// render as-is.
+	return template.HTML(dmp.DiffPrettyHtml(diffs)), nil
+}
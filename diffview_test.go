@@ -0,0 +1,191 @@
+package posts
+
+import (
+	"html/template"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRenderDiff(t *testing.T) {
+	t.Parallel()
+
+	p1 := Post{
+		ID:      "post",
+		Title:   "Hello World",
+		Slug:    "hello-world",
+		Authors: []string{"alice", "bob"},
+		Parts: []Part{
+			{ID: "intro", Inline: true, Body: []byte("The quick brown fox.")},
+			{ID: "outro", Inline: true, Body: []byte("<b>Goodbye</b>")},
+			{ID: "gone", Inline: true, Body: []byte("Removed.")},
+		},
+	}
+	p2 := Post{
+		ID:      "post",
+		Title:   "Hello, Brave World",
+		Slug:    "hello-world",
+		Authors: []string{"alice"},
+		Parts: []Part{
+			{ID: "intro", Inline: true, Body: []byte("The slow brown fox.")},
+			{ID: "outro", Inline: true, Body: []byte("<b>Goodbye</b>")},
+		},
+	}
+
+	view, err := RenderDiff(p1, p2)
+	if err != nil {
+		t.Fatalf("unexpected error rendering diff: %s", err)
+	}
+
+	title := string(view.Title)
+	if !strings.Contains(title, `<ins style="background:#e6ffe6;">, Brave</ins>`) {
+		t.Errorf("expected title to mark the insertion, got %s", title)
+	}
+	if view.Slug != "<span>hello-world</span>" {
+		t.Errorf("expected unchanged slug, got %s", view.Slug)
+	}
+
+	if len(view.Parts) != 2 {
+		t.Fatalf("expected 2 part views, got %d: %+v", len(view.Parts), view.Parts)
+	}
+	intro := view.Parts[0]
+	if intro.PartID != "intro" || !intro.Changed {
+		t.Errorf("expected a changed intro part, got %+v", intro)
+	}
+	if !strings.Contains(string(intro.Body), `<del style="background:#ffe6e6;">quick</del>`) {
+		t.Errorf("expected intro body to mark the deletion, got %s", intro.Body)
+	}
+	if !strings.Contains(string(intro.Body), `<ins style="background:#e6ffe6;">slow</ins>`) {
+		t.Errorf("expected intro body to mark the insertion, got %s", intro.Body)
+	}
+	outro := view.Parts[1]
+	if outro.PartID != "outro" || outro.Changed {
+		t.Errorf("expected an unchanged outro part, got %+v", outro)
+	}
+	if outro.Body != "<span>&lt;b&gt;Goodbye&lt;/b&gt;</span>" {
+		t.Errorf("expected escaped outro body, got %s", outro.Body)
+	}
+
+	if want := []string{"gone"}; !reflect.DeepEqual(view.RemovedParts, want) {
+		t.Errorf("expected removed parts %v, got %v", want, view.RemovedParts)
+	}
+	if len(view.AddedParts) != 0 {
+		t.Errorf("expected no added parts, got %v", view.AddedParts)
+	}
+	if want := []string{"bob"}; !reflect.DeepEqual(view.RemovedAuthors, want) {
+		t.Errorf("expected removed authors %v, got %v", want, view.RemovedAuthors)
+	}
+	if len(view.AddedAuthors) != 0 {
+		t.Errorf("expected no added authors, got %v", view.AddedAuthors)
+	}
+}
+
+func TestCommonParts(t *testing.T) {
+	t.Parallel()
+
+	partsWithIDs := func(ids ...string) []Part {
+		parts := make([]Part, 0, len(ids))
+		for _, id := range ids {
+			parts = append(parts, Part{ID: id})
+		}
+		return parts
+	}
+
+	tests := map[string]struct {
+		a, b []Part
+		want []string
+	}{
+		"overlapping": {
+			a:    partsWithIDs("a", "b", "c", "d"),
+			b:    partsWithIDs("d", "x", "b", "y"),
+			want: []string{"b", "d"},
+		},
+		"disjoint": {
+			a:    partsWithIDs("a", "b"),
+			b:    partsWithIDs("c", "d"),
+			want: nil,
+		},
+		"identical": {
+			a:    partsWithIDs("a", "b"),
+			b:    partsWithIDs("a", "b"),
+			want: []string{"a", "b"},
+		},
+		"empty": {
+			a:    nil,
+			b:    partsWithIDs("a"),
+			want: nil,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := CommonParts(Post{Parts: test.a}, Post{Parts: test.b})
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestRenderDiffBinary(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		before, after []byte
+		wantChanged   bool
+		wantBody      template.HTML
+	}{
+		"changed": {
+			before:      []byte{0xff, 0x01, 0x02},
+			after:       []byte{0xff, 0x09, 0x09, 0x09},
+			wantChanged: true,
+			wantBody:    "<span>binary content changed</span>",
+		},
+		"unchanged": {
+			before:   []byte{0xff, 0x01, 0x02},
+			after:    []byte{0xff, 0x01, 0x02},
+			wantBody: "<span>binary content unchanged</span>",
+		},
+		"text to binary": {
+			before:      []byte("hello"),
+			after:       []byte{0xff, 0x01, 0x02},
+			wantChanged: true,
+			wantBody:    "<span>binary content changed</span>",
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p1 := Post{ID: "post", Parts: []Part{{ID: "blob", Inline: true, Body: test.before}}}
+			p2 := Post{ID: "post", Parts: []Part{{ID: "blob", Inline: true, Body: test.after}}}
+
+			view, err := RenderDiff(p1, p2)
+			if err != nil {
+				t.Fatalf("unexpected error rendering diff: %s", err)
+			}
+			if len(view.Parts) != 1 {
+				t.Fatalf("expected 1 part view, got %d: %+v", len(view.Parts), view.Parts)
+			}
+			part := view.Parts[0]
+			if !part.Binary {
+				t.Errorf("expected a binary part view, got %+v", part)
+			}
+			if part.Changed != test.wantChanged {
+				t.Errorf("expected Changed to be %v, got %v", test.wantChanged, part.Changed)
+			}
+			if part.Body != test.wantBody {
+				t.Errorf("expected body %q, got %q", test.wantBody, part.Body)
+			}
+			if strings.ContainsRune(string(part.Body), utf8.RuneError) {
+				t.Errorf("expected no replacement characters in body, got %q", part.Body)
+			}
+		})
+	}
+}
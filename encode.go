@@ -0,0 +1,135 @@
+package posts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// RevisionEncodingVersion is the version of the envelope EncodeRevision wraps
+// Revisions in. DecodeRevision refuses envelopes with any other version.
+const RevisionEncodingVersion = 1
+
+// revisionEnvelope is the versioned wrapper EncodeRevision stores Revisions
+// in, so the encoding can change without older Revisions being misread.
+type revisionEnvelope struct {
+	Version  int             `json:"v"`
+	Revision json.RawMessage `json:"revision"`
+}
+
+// EncodeRevision returns r encoded as JSON, wrapped in an envelope recording
+// the RevisionEncodingVersion, like {"v":1,"revision":{...}}, for storing
+// Revisions somewhere they may be read back by a newer version of this
+// package. DecodeRevision reads it back.
+//
+// Binary bodies are encoded as base64, and Deltas as JSON strings, so both
+// survive the round trip byte for byte. JSON strings can only hold valid
+// UTF-8, though, and encoding/json would silently replace anything else, so
+// an error is returned instead if any of r's strings, like a Delta or a
+// header value, isn't valid UTF-8. An error is also returned if r isn't
+// well-formed; see Revision.Validate.
+func EncodeRevision(r Revision) ([]byte, error) {
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("error encoding revision %s: %w", r.ID, err)
+	}
+	if err := checkRevisionUTF8(r); err != nil {
+		return nil, fmt.Errorf("error encoding revision %s: %w", r.ID, err)
+	}
+	revision, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding revision %s: %w", r.ID, err)
+	}
+	return json.Marshal(revisionEnvelope{Version: RevisionEncodingVersion, Revision: revision})
+}
+
+// DecodeRevision returns the Revision EncodeRevision encoded in data. An
+// error is returned if data isn't an envelope EncodeRevision could have
+// written, if its version isn't RevisionEncodingVersion, or if the Revision
+// in it isn't well-formed; see Revision.Validate. Unknown DeltaOps are
+// reported with an error wrapping ErrUnknownDeltaOp.
+func DecodeRevision(data []byte) (Revision, error) {
+	var envelope revisionEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return Revision{}, fmt.Errorf("error decoding revision envelope: %w", err)
+	}
+	if envelope.Version != RevisionEncodingVersion {
+		return Revision{}, fmt.Errorf("unsupported revision encoding version %d", envelope.Version)
+	}
+	if len(envelope.Revision) == 0 {
+		return Revision{}, errors.New("revision envelope has no revision")
+	}
+	var r Revision
+	if err := json.Unmarshal(envelope.Revision, &r); err != nil {
+		return Revision{}, fmt.Errorf("error decoding revision: %w", err)
+	}
+	if err := r.Validate(); err != nil {
+		return Revision{}, fmt.Errorf("error decoding revision %s: %w", r.ID, err)
+	}
+	return r, nil
+}
+
+// checkRevisionUTF8 returns an error if any of the strings in r isn't valid
+// UTF-8.
+func checkRevisionUTF8(r Revision) error {
+	fields := [][3]string{
+		{"ID", r.ID, ""},
+		{"reason", r.Reason, ""},
+		{"status", string(r.Status), ""},
+		{"author", r.AuthorID, string(r.ActorType)},
+		{"title delta", string(r.TitleDelta), string(r.TitleUndo)},
+		{"slug delta", string(r.SlugDelta), string(r.SlugUndo)},
+	}
+	for _, field := range fields {
+		if err := checkUTF8(field[0], field[1], field[2]); err != nil {
+			return err
+		}
+	}
+	for _, delta := range r.AuthorsDeltas {
+		if err := checkUTF8("author", delta.Author, ""); err != nil {
+			return err
+		}
+	}
+	for _, delta := range r.StreamsDeltas {
+		if err := checkUTF8("stream", delta.Stream, ""); err != nil {
+			return err
+		}
+	}
+	for _, deltas := range [][]PartDelta{r.PartsDeltas, r.MetadataDeltas} {
+		for _, delta := range deltas {
+			if err := checkPartDeltaUTF8(delta); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkPartDeltaUTF8 returns an error if any of the strings in delta isn't
+// valid UTF-8. Its binary bodies can hold anything.
+func checkPartDeltaUTF8(delta PartDelta) error {
+	if !utf8.ValidString(delta.PartID) {
+		return fmt.Errorf("part ID %q is not valid UTF-8", delta.PartID)
+	}
+	fields := [][3]string{
+		{"body delta", string(delta.Body), string(delta.BodyUndo)},
+		{"anchor", delta.AnchorFrom, delta.AnchorTo},
+		{"SHA256", delta.SHA256From, delta.SHA256To},
+	}
+	for _, field := range fields {
+		if err := checkUTF8("part "+delta.PartID+" "+field[0], field[1], field[2]); err != nil {
+			return err
+		}
+	}
+	for key, headerDeltas := range delta.Headers {
+		if err := checkUTF8("part "+delta.PartID+" header key", key, ""); err != nil {
+			return err
+		}
+		for _, headerDelta := range headerDeltas {
+			if err := checkUTF8("part "+delta.PartID+" header "+key, headerDelta.Header, headerDelta.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package posts
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeRevision(t *testing.T) {
+	t.Parallel()
+
+	before := Post{
+		ID:    "post",
+		Title: "Hello\tworld",
+		Parts: []Part{
+			inlinePart("intro", 0, "100% done"),
+			inlinePart("data", 1, "text for now"),
+		},
+	}
+	after := before.Clone()
+	after.Title = "Hello,\tworld 😀 +%"
+	after.Parts[0].Body = []byte("100%\tdone\n+more")
+	after.Parts[0].ComputeSHA256()
+	after.Parts[0].SetHeader("X-Tag", "tab\there")
+	after.Parts[1].Body = []byte{0xfe, 0xff, 0x00, '\t'}
+	after.Parts[1].ComputeSHA256()
+
+	createdAt := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	rev, err := GenerateRevision(before, after, WithAuthor("alice", PostEventActorTypeUser), WithCreatedAt(createdAt))
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	rev.ID = "rev"
+	if !rev.PartsDeltas[len(rev.PartsDeltas)-1].Binary {
+		t.Fatalf("expected a binary body change, got %+v", rev.PartsDeltas)
+	}
+
+	encoded, err := EncodeRevision(rev)
+	if err != nil {
+		t.Fatalf("unexpected error encoding revision: %s", err)
+	}
+	if !bytes.HasPrefix(encoded, []byte(`{"v":1,"revision":{`)) {
+		t.Errorf("expected a version 1 envelope, got %s", encoded)
+	}
+	decoded, err := DecodeRevision(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error decoding revision: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, rev) {
+		t.Errorf("expected\n%+v\ngot\n%+v", rev, decoded)
+	}
+	got, err := ApplyRevision(before, decoded)
+	if err != nil {
+		t.Fatalf("unexpected error applying decoded revision: %s", err)
+	}
+	if !reflect.DeepEqual(got, after) {
+		t.Errorf("expected decoded revision to produce\n%+v\ngot\n%+v", after, got)
+	}
+}
+
+func TestEncodeRevisionInvalidUTF8(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]Revision{
+		"reason": {Reason: "bad \xff"},
+		"delta":  {TitleDelta: "+\xfe"},
+		"header": {PartsDeltas: []PartDelta{{
+			PartID:       "part",
+			Op:           DeltaUpdate,
+			FromPosition: 0,
+			ToPosition:   0,
+			Headers: map[string][]HeaderDelta{"X-Tag": {{
+				Op:           DeltaAdd,
+				Header:       "X-Tag",
+				FromPosition: -1,
+				ToPosition:   0,
+				Value:        "\xff",
+			}}},
+		}}},
+	}
+
+	for name, rev := range tests {
+		name, rev := name, rev
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := EncodeRevision(rev); err == nil || !strings.Contains(err.Error(), "not valid UTF-8") {
+				t.Errorf("expected an invalid UTF-8 error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeRevision(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		data string
+		// err is part of the error expected.
+		err     string
+		wrapped error
+	}{
+		"unknown-version": {
+			data: `{"v":2,"revision":{"ID":"rev"}}`,
+			err:  "unsupported revision encoding version 2",
+		},
+		"no-version": {
+			data: `{"revision":{"ID":"rev"}}`,
+			err:  "unsupported revision encoding version 0",
+		},
+		"no-revision": {
+			data: `{"v":1}`,
+			err:  "revision envelope has no revision",
+		},
+		"not-an-envelope": {
+			data: `[]`,
+			err:  "error decoding revision envelope",
+		},
+		"unknown-op": {
+			data:    `{"v":1,"revision":{"PartsDeltas":[{"PartID":"part","Op":"explode"}]}}`,
+			err:     "error decoding revision",
+			wrapped: ErrUnknownDeltaOp,
+		},
+		"invalid-delta": {
+			data: `{"v":1,"revision":{"TitleDelta":"?5"}}`,
+			err:  "error decoding revision",
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := DecodeRevision([]byte(test.data))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+			if test.wrapped != nil && !errors.Is(err, test.wrapped) {
+				t.Errorf("expected error wrapping %q, got %s", test.wrapped, err)
+			}
+		})
+	}
+}
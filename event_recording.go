@@ -0,0 +1,217 @@
+package posts
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type actorContextKey struct{}
+
+// actor describes who is taking an action, as stored in a context by
+// WithActor.
+type actor struct {
+	id        string
+	actorType PostEventActorType
+	ip        string
+	sessionID string
+}
+
+// WithActor returns a copy of ctx that carries who is taking an action and
+// where they're taking it from, for an EventRecordingStorer to fill in the
+// PostEvents it records. See PostEvent for what each value means.
+func WithActor(ctx context.Context, actorID string, actorType PostEventActorType, ip, sessionID string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor{
+		id:        actorID,
+		actorType: actorType,
+		ip:        ip,
+		sessionID: sessionID,
+	})
+}
+
+// actorFromContext returns the actor stored in ctx by WithActor, or an empty
+// actor if there isn't one.
+func actorFromContext(ctx context.Context) actor {
+	a, _ := ctx.Value(actorContextKey{}).(actor)
+	return a
+}
+
+// EventRecordingStorer is a Storer that records a PostEvent in an EventStorer
+// for every change it makes to a Post through the Storer it wraps, so callers
+// don't need to remember to. Use NewEventRecordingStorer to create one.
+//
+// The type of each event is chosen by PostEventTypeFor, by comparing the Post
+// before and after the change: Create records PostEventTypeCreated, Delete
+// records PostEventTypeDeleted, Restore records PostEventTypeRestored,
+// Publish and Unpublish record PostEventTypePublished and
+// PostEventTypeUnpublished, and Update and MovePostStream record
+// PostEventTypeUpdated. A Revision can't change a Post's Draft property, so
+// Update only records PostEventTypePublished or PostEventTypeUnpublished
+// instead when it wraps a Storer whose Update changes Draft some other way;
+// none of the Storers in this package do. Who took the action is taken from
+// the context passed to each method; see WithActor.
+// DeletePermanently isn't recorded, as it erases the Post events would refer
+// to.
+//
+// Events are only recorded after the wrapped Storer's operation succeeds.
+// Updates that the wrapped Storer ignores because they're retries of a
+// Revision that was already applied don't record another event, and neither
+// do Delete, Publish, and Unpublish calls that find the Post already deleted,
+// published, or unpublished. If the operation succeeds but the event can't be
+// recorded, the error is returned, but the operation isn't undone.
+//
+// Reading the Post before and after an Update isn't atomic with the Update
+// itself, so when several updates to the same Post race, the event type
+// chosen for each may not be exact.
+type EventRecordingStorer struct {
+	Storer
+	events EventStorer
+	now    func() time.Time
+}
+
+// NewEventRecordingStorer returns an EventRecordingStorer that wraps s and
+// records events in events.
+func NewEventRecordingStorer(s Storer, events EventStorer) *EventRecordingStorer {
+	return &EventRecordingStorer{Storer: s, events: events, now: time.Now}
+}
+
+// Create creates post using the wrapped Storer, then records a
+// PostEventTypeCreated event.
+func (e *EventRecordingStorer) Create(ctx context.Context, post Post) error {
+	if err := e.Storer.Create(ctx, post); err != nil {
+		return err
+	}
+	return e.record(ctx, nil, post)
+}
+
+// Update applies rev using the wrapped Storer, then records an event
+// describing the change.
+func (e *EventRecordingStorer) Update(ctx context.Context, postID string, version int, rev Revision) error {
+	before, err := e.Storer.Get(ctx, postID)
+	if err != nil {
+		return err
+	}
+	if err := e.Storer.Update(ctx, postID, version, rev); err != nil {
+		return err
+	}
+	after, err := e.Storer.Get(ctx, postID)
+	if err != nil {
+		return fmt.Errorf("error getting updated post %s to record event: %w", postID, err)
+	}
+	if after.Version == before.Version {
+		// the update was a retry of a revision that was already
+		// applied, so nothing changed.
+		return nil
+	}
+	return e.record(ctx, &before, after)
+}
+
+// Delete deletes the Post indicated by id using the wrapped Storer, then
+// records a PostEventTypeDeleted event if it wasn't already deleted.
+func (e *EventRecordingStorer) Delete(ctx context.Context, id string) (Post, error) {
+	before, err := e.Storer.Get(ctx, id)
+	if err != nil {
+		return Post{}, err
+	}
+	after, err := e.Storer.Delete(ctx, id)
+	if err != nil {
+		return Post{}, err
+	}
+	if before.Deleted == after.Deleted {
+		return after, nil
+	}
+	if err := e.record(ctx, &before, after); err != nil {
+		return after, err
+	}
+	return after, nil
+}
+
+// Restore restores the Post indicated by id using the wrapped Storer, then
+// records a PostEventTypeRestored event.
+func (e *EventRecordingStorer) Restore(ctx context.Context, id string) (Post, error) {
+	after, err := e.Storer.Restore(ctx, id)
+	if err != nil {
+		return Post{}, err
+	}
+	before := after
+	before.Deleted = true
+	if err := e.record(ctx, &before, after); err != nil {
+		return after, err
+	}
+	return after, nil
+}
+
+// Publish publishes the Post indicated by id using the wrapped Storer, then
+// records a PostEventTypePublished event if it was a draft.
+func (e *EventRecordingStorer) Publish(ctx context.Context, id string, opts ...PublishOption) (Post, error) {
+	before, err := e.Storer.Get(ctx, id)
+	if err != nil {
+		return Post{}, err
+	}
+	after, err := e.Storer.Publish(ctx, id, opts...)
+	if err != nil {
+		return Post{}, err
+	}
+	if before.Draft == after.Draft {
+		return after, nil
+	}
+	if err := e.record(ctx, &before, after); err != nil {
+		return after, err
+	}
+	return after, nil
+}
+
+// Unpublish unpublishes the Post indicated by id using the wrapped Storer,
+// then records a PostEventTypeUnpublished event if it was published.
+func (e *EventRecordingStorer) Unpublish(ctx context.Context, id string) (Post, error) {
+	before, err := e.Storer.Get(ctx, id)
+	if err != nil {
+		return Post{}, err
+	}
+	after, err := e.Storer.Unpublish(ctx, id)
+	if err != nil {
+		return Post{}, err
+	}
+	if before.Draft == after.Draft {
+		return after, nil
+	}
+	if err := e.record(ctx, &before, after); err != nil {
+		return after, err
+	}
+	return after, nil
+}
+
+// MovePostStream moves the Post indicated by postID between streams using the
+// wrapped Storer, then records a PostEventTypeUpdated event.
+func (e *EventRecordingStorer) MovePostStream(ctx context.Context, postID, fromStream, toStream string) (Post, error) {
+	before, err := e.Storer.Get(ctx, postID)
+	if err != nil {
+		return Post{}, err
+	}
+	after, err := e.Storer.MovePostStream(ctx, postID, fromStream, toStream)
+	if err != nil {
+		return Post{}, err
+	}
+	if err := e.record(ctx, &before, after); err != nil {
+		return after, err
+	}
+	return after, nil
+}
+
+// record records an event describing the change from before to after, with
+// the actor stored in ctx.
+func (e *EventRecordingStorer) record(ctx context.Context, before *Post, after Post) error {
+	event, err := NewPostEvent(before, after, e.now())
+	if err != nil {
+		return fmt.Errorf("error creating %s event for post %s: %w", PostEventTypeFor(before, after), after.ID, err)
+	}
+	a := actorFromContext(ctx)
+	event.Actor = a.id
+	event.ActorType = a.actorType
+	event.IP = a.ip
+	event.SessionID = a.sessionID
+	if err := e.events.RecordEvent(ctx, event); err != nil {
+		return fmt.Errorf("error recording %s event for post %s: %w", event.Type, after.ID, err)
+	}
+	return nil
+}
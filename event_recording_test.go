@@ -0,0 +1,200 @@
+package posts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// publishingStorer is a Storer whose Update publishes the Post as well as
+// bumping its Version, standing in for a Storer whose Update can change a
+// Post's Draft property.
+type publishingStorer struct {
+	Storer
+	post Post
+}
+
+func (p *publishingStorer) Get(_ context.Context, id string) (Post, error) {
+	if id != p.post.ID {
+		return Post{}, fmt.Errorf("%w: post %s", ErrNotFound, id)
+	}
+	return p.post, nil
+}
+
+func (p *publishingStorer) Update(_ context.Context, postID string, version int, rev Revision) error {
+	if postID != p.post.ID {
+		return fmt.Errorf("%w: post %s", ErrNotFound, postID)
+	}
+	if version != p.post.Version {
+		return fmt.Errorf("%w: post %s", ErrVersionConflict, postID)
+	}
+	p.post.Draft = false
+	p.post.Version++
+	return nil
+}
+
+func TestEventRecordingStorer(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	events := NewInMemoryEventStorer()
+	storer := NewEventRecordingStorer(NewInMemoryStorer(), events)
+	// each event is a minute after the last, so they list in a
+	// predictable order.
+	storer.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+	ctx := WithActor(context.Background(), "alice", PostEventActorTypeUser, "192.0.2.1", "session")
+
+	post := Post{ID: "post", Title: "Hello", Draft: true}
+	if err := storer.Create(ctx, post); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+	updated := post
+	updated.Title = "Hello, world"
+	rev, err := GenerateRevision(post, updated)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	rev.ID = "rev"
+	if err := storer.Update(ctx, post.ID, 0, rev); err != nil {
+		t.Fatalf("unexpected error updating post: %s", err)
+	}
+	// retrying the update doesn't change the post, so it shouldn't
+	// record another event.
+	if err := storer.Update(ctx, post.ID, 0, rev); err != nil {
+		t.Fatalf("unexpected error retrying update: %s", err)
+	}
+	// failed operations shouldn't record events.
+	if err := storer.Update(ctx, post.ID, 0, Revision{ID: "stale"}); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+	if _, err := storer.Delete(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	deleted, err := storer.Delete(ctx, post.ID)
+	if err != nil {
+		t.Fatalf("unexpected error deleting post: %s", err)
+	}
+	if !deleted.Deleted {
+		t.Errorf("expected the deleted post to be returned, got %+v", deleted)
+	}
+	// deleting it again doesn't change the post, so it shouldn't record
+	// another event.
+	if _, err := storer.Delete(ctx, post.ID); err != nil {
+		t.Fatalf("unexpected error deleting post again: %s", err)
+	}
+	if _, err := storer.Restore(context.Background(), post.ID); err != nil {
+		t.Fatalf("unexpected error restoring post: %s", err)
+	}
+
+	got, err := events.ListEvents(ctx, post.ID, EventFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error listing events: %s", err)
+	}
+	var types []PostEventType
+	for _, event := range got {
+		types = append(types, event.Type)
+	}
+	want := []PostEventType{PostEventTypeRestored, PostEventTypeDeleted, PostEventTypeUpdated, PostEventTypeCreated}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("expected events %v, got %v", want, types)
+	}
+
+	updates, err := events.ListEvents(ctx, post.ID, EventFilter{Types: []PostEventType{PostEventTypeUpdated}})
+	if err != nil {
+		t.Fatalf("unexpected error listing events: %s", err)
+	}
+	if len(updates) != 1 {
+		t.Fatalf("expected a single updated event, got %+v", updates)
+	}
+	wantUpdated := PostEvent{
+		ID:        updates[0].ID,
+		PostID:    post.ID,
+		Type:      PostEventTypeUpdated,
+		IP:        "192.0.2.1",
+		Actor:     "alice",
+		ActorType: PostEventActorTypeUser,
+		SessionID: "session",
+		Timestamp: time.Date(2020, time.January, 1, 0, 2, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(updates, []PostEvent{wantUpdated}) {
+		t.Errorf("expected\n%+v\ngot\n%+v", []PostEvent{wantUpdated}, updates)
+	}
+	restored, err := events.ListEvents(ctx, post.ID, EventFilter{Types: []PostEventType{PostEventTypeRestored}})
+	if err != nil {
+		t.Fatalf("unexpected error listing events: %s", err)
+	}
+	if len(restored) != 1 || restored[0].Actor != "" {
+		t.Errorf("expected a restored event without an actor, got %+v", restored)
+	}
+}
+
+func TestEventRecordingStorerUpdatePublishes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	events := NewInMemoryEventStorer()
+	wrapped := &publishingStorer{post: Post{ID: "post", Draft: true}}
+	storer := NewEventRecordingStorer(wrapped, events)
+
+	if err := storer.Update(ctx, "post", 0, Revision{ID: "rev"}); err != nil {
+		t.Fatalf("unexpected error updating post: %s", err)
+	}
+	if err := storer.Update(ctx, "post", 0, Revision{ID: "stale"}); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+
+	got, err := events.ListEvents(ctx, "post", EventFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error listing events: %s", err)
+	}
+	if len(got) != 1 || got[0].Type != PostEventTypePublished {
+		t.Errorf("expected a single published event, got %+v", got)
+	}
+}
+
+func TestEventRecordingStorerPublish(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	events := NewInMemoryEventStorer()
+	storer := NewEventRecordingStorer(NewInMemoryStorer(), events)
+	if err := storer.Create(ctx, Post{ID: "post", Draft: true}); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+	if _, err := storer.Publish(ctx, "post"); err != nil {
+		t.Fatalf("unexpected error publishing post: %s", err)
+	}
+	// publishing again changes nothing, so it shouldn't record another
+	// event.
+	if _, err := storer.Publish(ctx, "post"); err != nil {
+		t.Fatalf("unexpected error publishing published post: %s", err)
+	}
+	if _, err := storer.Unpublish(ctx, "post"); err != nil {
+		t.Fatalf("unexpected error unpublishing post: %s", err)
+	}
+	if _, err := storer.Unpublish(ctx, "post"); err != nil {
+		t.Fatalf("unexpected error unpublishing draft: %s", err)
+	}
+	if _, err := storer.Publish(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	got, err := events.ListEvents(ctx, "post", EventFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error listing events: %s", err)
+	}
+	counts := map[PostEventType]int{}
+	for _, event := range got {
+		counts[event.Type]++
+	}
+	want := map[PostEventType]int{PostEventTypeCreated: 1, PostEventTypePublished: 1, PostEventTypeUnpublished: 1}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("expected events %v, got %v", want, counts)
+	}
+}
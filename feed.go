@@ -0,0 +1,87 @@
+package posts
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Feed is an ordered list of summaries of the Posts in a Stream, suitable for
+// rendering as RSS, a JSON feed, or similar.
+type Feed struct {
+	// StreamID is the ID of the Stream the Feed was generated for.
+	StreamID string
+
+	// Items are the summaries of the Posts in the Stream, sorted by their
+	// PublishedAt property descending.
+	Items []FeedItem
+}
+
+// FeedItem is a summary of a single Post in a Feed.
+type FeedItem struct {
+	// ID is the ID of the Post being summarized.
+	ID string
+
+	// Title is the Post's title.
+	Title string
+
+	// Slug is the Post's slug.
+	Slug string
+
+	// Summary is the body of the Post's summary Metadata part, if it has
+	// one. See RoleSummary.
+	Summary string
+
+	// PublishedAt is the last time the Post was published.
+	PublishedAt time.Time
+
+	// Authors are the IDs of the Post's authors.
+	Authors []string
+}
+
+// GenerateFeed builds a Feed of the published Posts in the Stream identified
+// by streamID, using s to list them. At most limit items will be included; a
+// limit of zero or less includes every Post in the Stream. The ordering and
+// limit are passed on to s, so it only has to return the Posts in the Feed.
+func GenerateFeed(ctx context.Context, s Storer, streamID string, limit int) (Feed, error) {
+	feed := Feed{StreamID: streamID}
+	draft := false
+	filter := PostFilter{
+		Streams:     []string{streamID},
+		StreamsMode: StringListFilterModeContainsAny,
+		Draft:       &draft,
+		OrderBy:     PostOrderFieldPublishedAt,
+		Descending:  true,
+	}
+	if limit > 0 {
+		filter.Limit = limit
+	}
+	posts, err := s.List(ctx, filter)
+	if err != nil {
+		return feed, err
+	}
+
+	// Storers should already be returning these sorted and limited, but
+	// feeds are useless if they're out of order, so let's not leave it to
+	// chance.
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].PublishedAt.After(posts[j].PublishedAt)
+	})
+	if limit > 0 && len(posts) > limit {
+		posts = posts[:limit]
+	}
+
+	feed.Items = make([]FeedItem, 0, len(posts))
+	for _, post := range posts {
+		summary, _ := post.Summary()
+		feed.Items = append(feed.Items, FeedItem{
+			ID:          post.ID,
+			Title:       post.Title,
+			Slug:        post.Slug,
+			Summary:     summary,
+			PublishedAt: post.PublishedAt,
+			Authors:     post.Authors,
+		})
+	}
+	return feed, nil
+}
@@ -0,0 +1,118 @@
+package posts
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// listStorer is a Storer that only knows how to List, returning the same
+// Posts regardless of the filter, and recording the filter it was called
+// with. As it ignores the filter's ordering and limit, it checks that
+// GenerateFeed still sorts and limits the Posts itself.
+type listStorer struct {
+	Storer
+	posts  []Post
+	filter PostFilter
+}
+
+func (l *listStorer) List(_ context.Context, filter PostFilter) ([]Post, error) {
+	l.filter = filter
+	return l.posts, nil
+}
+
+func TestGenerateFeed(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	storer := &listStorer{
+		posts: []Post{
+			{ID: "oldest", Title: "Oldest", PublishedAt: base},
+			{ID: "newest", Title: "Newest", PublishedAt: base.Add(72 * time.Hour), Metadata: []Part{
+				{ID: "summary", Inline: true, Body: []byte("The newest post."), Headers: map[string][]string{
+					RoleHeader: {RoleSummary},
+				}},
+			}},
+			{ID: "middle", Title: "Middle", PublishedAt: base.Add(24 * time.Hour)},
+			{ID: "newer", Title: "Newer", PublishedAt: base.Add(48 * time.Hour)},
+		},
+	}
+
+	feed, err := GenerateFeed(context.Background(), storer, "stream", 3)
+	if err != nil {
+		t.Fatalf("unexpected error generating feed: %s", err)
+	}
+
+	if len(storer.filter.Streams) != 1 || storer.filter.Streams[0] != "stream" {
+		t.Errorf("expected posts to be filtered to the stream, got filter %+v", storer.filter)
+	}
+	if storer.filter.Draft == nil || *storer.filter.Draft {
+		t.Errorf("expected drafts to be filtered out, got filter %+v", storer.filter)
+	}
+	if storer.filter.OrderBy != PostOrderFieldPublishedAt || !storer.filter.Descending {
+		t.Errorf("expected posts to be ordered by PublishedAt descending, got filter %+v", storer.filter)
+	}
+	if storer.filter.Limit != 3 {
+		t.Errorf("expected the limit to be passed to the storer, got filter %+v", storer.filter)
+	}
+
+	want := []string{"newest", "newer", "middle"}
+	if len(feed.Items) != len(want) {
+		t.Fatalf("expected %d items, got %d: %+v", len(want), len(feed.Items), feed.Items)
+	}
+	for pos, id := range want {
+		if feed.Items[pos].ID != id {
+			t.Errorf("expected item %d to be %q, got %q", pos, id, feed.Items[pos].ID)
+		}
+	}
+	if feed.Items[0].Summary != "The newest post." {
+		t.Errorf("expected summary %q, got %q", "The newest post.", feed.Items[0].Summary)
+	}
+}
+
+func TestGenerateFeedInMemoryStorer(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	base := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	storer := NewInMemoryStorer()
+	for _, post := range []Post{
+		{ID: "oldest", Streams: []string{"stream"}, PublishedAt: base},
+		{ID: "newest", Streams: []string{"stream"}, PublishedAt: base.Add(48 * time.Hour)},
+		{ID: "middle", Streams: []string{"stream", "other"}, PublishedAt: base.Add(24 * time.Hour)},
+		{ID: "draft", Streams: []string{"stream"}, Draft: true, PublishedAt: base.Add(72 * time.Hour)},
+		{ID: "other", Streams: []string{"other"}, PublishedAt: base.Add(72 * time.Hour)},
+	} {
+		if err := storer.Create(ctx, post); err != nil {
+			t.Fatalf("unexpected error creating post: %s", err)
+		}
+	}
+
+	tests := map[string]struct {
+		limit int
+		want  []string
+	}{
+		"limited":   {limit: 2, want: []string{"newest", "middle"}},
+		"unlimited": {limit: 0, want: []string{"newest", "middle", "oldest"}},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			feed, err := GenerateFeed(ctx, storer, "stream", test.limit)
+			if err != nil {
+				t.Fatalf("unexpected error generating feed: %s", err)
+			}
+			var got []string
+			for _, item := range feed.Items {
+				got = append(got, item.ID)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
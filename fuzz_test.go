@@ -0,0 +1,249 @@
+package posts
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// fuzzSource hands out the bytes of a fuzz input one at a time, as the
+// choices made by fuzzPost. Once the bytes run out, every choice is zero, so
+// any input, including an empty one, describes a Post.
+type fuzzSource struct {
+	data []byte
+}
+
+func (s *fuzzSource) byte() byte {
+	if len(s.data) < 1 {
+		return 0
+	}
+	b := s.data[0]
+	s.data = s.data[1:]
+	return b
+}
+
+// intn returns a choice between 0 and n, exclusive.
+func (s *fuzzSource) intn(n int) int {
+	return int(s.byte()) % n
+}
+
+// fuzzRunes are the pieces fuzzSource.text builds strings out of, chosen to
+// include multi-byte characters, characters outside the Basic Multilingual
+// Plane, and characters compact deltas escape. Invalid UTF-8 is only ever
+// added to inline bodies, with fuzzPartBinary, as titles and slugs must be
+// valid UTF-8; see GenerateRevision.
+var fuzzRunes = []string{"a", "b", " ", "\n", "é", "😀", "%", "\t", "+"}
+
+// text returns a string of up to max of the fuzzRunes.
+func (s *fuzzSource) text(max int) string {
+	var text string
+	for n := s.intn(max + 1); n > 0; n-- {
+		text += fuzzRunes[s.intn(len(fuzzRunes))]
+	}
+	return text
+}
+
+// list returns up to max distinct values made of prefix and a number, in an
+// arbitrary order.
+func (s *fuzzSource) list(prefix string, max int) []string {
+	var values []string
+	for n := s.intn(max + 1); n > 0; n-- {
+		value := fmt.Sprint(prefix, s.intn(max+1))
+		if indexOf(values, value) < 0 {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// The bits of the flags byte fuzzPost reads for each part.
+const (
+	fuzzPartInline = 1 << iota
+	fuzzPartMetadata
+	fuzzPartHeaders
+	fuzzPartAnchor
+	fuzzPartBinary
+	fuzzPartPrepend
+	fuzzPartGap
+)
+
+// fuzzPost returns a Post described by the choices in s: its title, slug,
+// authors, and streams, then for each part, its flags, ID, body or SHA256,
+// headers, and anchor. Parts can be inline or not, binary or text, in Parts
+// or Metadata, and out of Position order in the slice or with gaps between
+// their Positions. Parts and Metadata draw their IDs from different sets,
+// so a part never changes sections between two Posts.
+func fuzzPost(s *fuzzSource) Post {
+	post := Post{
+		ID:      "post",
+		Title:   s.text(6),
+		Slug:    s.text(3),
+		Authors: s.list("author", 4),
+		Streams: s.list("stream", 3),
+	}
+	var positions [2]int
+	for n := s.intn(8); n > 0; n-- {
+		flags := s.byte()
+		section, prefix := &post.Parts, "part"
+		if flags&fuzzPartMetadata != 0 {
+			section, prefix = &post.Metadata, "meta"
+		}
+		part := Part{ID: fmt.Sprint(prefix, s.intn(6))}
+		if partIndex(*section, part.ID) >= 0 {
+			continue
+		}
+		if flags&fuzzPartInline != 0 {
+			part.Inline = true
+			part.Body = []byte(s.text(8))
+			if flags&fuzzPartBinary != 0 {
+				part.Body = append(part.Body, 0xfe, s.byte())
+			}
+			if len(part.Body) == 0 {
+				// empty bodies are nil, the same as they are
+				// when decoded from JSON.
+				part.Body = nil
+			}
+			part.ComputeSHA256()
+		} else {
+			part.SHA256 = fmt.Sprint("sha", s.intn(3))
+		}
+		if flags&fuzzPartHeaders != 0 {
+			part.Headers = map[string][]string{}
+			for _, key := range []string{"Content-Type", "X-Tag"} {
+				if values := s.list("v", 3); len(values) > 0 {
+					part.Headers[key] = values
+				}
+			}
+			if len(part.Headers) == 0 {
+				part.Headers = nil
+			}
+		}
+		if flags&fuzzPartAnchor != 0 {
+			part.Anchor = fmt.Sprint("anchor", s.intn(3))
+		}
+		index := 0
+		if flags&fuzzPartMetadata != 0 {
+			index = 1
+		}
+		part.Position = positions[index]
+		positions[index]++
+		if flags&fuzzPartGap != 0 {
+			positions[index]++
+		}
+		if flags&fuzzPartPrepend != 0 {
+			*section = insertPart(*section, 0, part)
+		} else {
+			*section = append(*section, part)
+		}
+	}
+	return post
+}
+
+// checkRoundTrip fails t if the Revision GenerateRevision returns for p1 and
+// p2, with opts, doesn't turn p1 into p2, even after being encoded as JSON,
+// or if its inverse doesn't turn p2 back into p1, or if the same isn't true
+// once the Revision is compacted.
+func checkRoundTrip(t *testing.T, p1, p2 Post, opts ...RevisionOption) {
+	t.Helper()
+	rev, err := GenerateRevision(p1, p2, opts...)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	encoded, err := json.Marshal(rev)
+	if err != nil {
+		t.Fatalf("unexpected error encoding revision: %s", err)
+	}
+	var decoded Revision
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unexpected error decoding revision: %s", err)
+	}
+	want1, want2 := p1, p2
+	want1.NormalizeParts()
+	want2.NormalizeParts()
+	got, err := ApplyRevision(p1, decoded)
+	if err != nil {
+		t.Fatalf("unexpected error applying revision: %s\nfrom %+v\nto   %+v\nrev  %+v", err, p1, p2, rev)
+	}
+	if !reflect.DeepEqual(got, want2) {
+		t.Fatalf("expected\n%#v\ngot\n%#v\nfrom %+v\nrev  %+v", want2, got, p1, rev)
+	}
+	got, err = ApplyRevision(p2, InvertRevision(decoded))
+	if err != nil {
+		t.Fatalf("unexpected error applying inverted revision: %s\nfrom %+v\nto   %+v\nrev  %+v", err, p2, p1, rev)
+	}
+	if !reflect.DeepEqual(got, want1) {
+		t.Fatalf("expected inverted revision to produce\n%#v\ngot\n%#v\nrev %+v", want1, got, rev)
+	}
+	compacted := decoded.Compact()
+	got, err = ApplyRevision(p1, compacted)
+	if err != nil {
+		t.Fatalf("unexpected error applying compacted revision: %s\nfrom %+v\nto   %+v\nrev  %+v", err, p1, p2, compacted)
+	}
+	if !reflect.DeepEqual(got, want2) {
+		t.Fatalf("expected compacted revision to produce\n%#v\ngot\n%#v\nfrom %+v\nrev  %+v", want2, got, p1, compacted)
+	}
+	got, err = ApplyRevision(p2, InvertRevision(compacted))
+	if err != nil {
+		t.Fatalf("unexpected error applying inverted compacted revision: %s\nfrom %+v\nto   %+v\nrev  %+v", err, p2, p1, compacted)
+	}
+	if !reflect.DeepEqual(got, want1) {
+		t.Fatalf("expected inverted compacted revision to produce\n%#v\ngot\n%#v\nrev %+v", want1, got, compacted)
+	}
+}
+
+func FuzzRevisionRoundTrip(f *testing.F) {
+	seeds := map[string][2][]byte{
+		"empty": {nil, nil},
+		// equal-length author lists with different members, where
+		// only diffing the longer list would miss a change.
+		"disjoint-authors": {
+			{0, 0, 2, 1, 2, 0},
+			{0, 0, 2, 1, 3, 0},
+		},
+		// a part removed from the front, shifting every other part's
+		// position without changing it.
+		"shifted-positions": {
+			{0, 0, 0, 0, 3, fuzzPartInline, 0, 1, 0, fuzzPartInline, 1, 1, 1, fuzzPartInline, 2, 1, 2},
+			{0, 0, 0, 0, 2, fuzzPartInline, 1, 1, 1, fuzzPartInline, 2, 1, 2},
+		},
+		// a non-inline part whose SHA256 changes, which must be
+		// recorded even though there's no body to diff.
+		"sha256-changed": {
+			{0, 0, 0, 0, 1, 0, 0, 0},
+			{0, 0, 0, 0, 1, 0, 0, 1},
+		},
+		// a part going from non-inline to inline and back.
+		"inline-swap": {
+			{0, 0, 0, 0, 1, 0, 0, 2},
+			{0, 0, 0, 0, 1, fuzzPartInline, 0, 2, 4, 5},
+		},
+		// a binary body, which can't be recorded as a compact delta.
+		"binary": {
+			{0, 0, 0, 0, 1, fuzzPartInline, 0, 1, 0},
+			{0, 0, 0, 0, 1, fuzzPartInline | fuzzPartBinary, 0, 1, 0, 0xff},
+		},
+		// equal-length header value lists with different members,
+		// and a header disappearing entirely.
+		"headers": {
+			{0, 0, 0, 0, 1, fuzzPartHeaders, 0, 0, 2, 1, 2, 1, 0},
+			{0, 0, 0, 0, 1, fuzzPartHeaders, 0, 0, 2, 1, 3, 0},
+		},
+		// parts out of Position order in the slice, with gaps
+		// between their Positions, alongside Metadata.
+		"position-gaps": {
+			{0, 0, 0, 0, 3, fuzzPartGap, 0, 0, fuzzPartPrepend | fuzzPartGap, 1, 0, fuzzPartMetadata, 0, 0},
+			{0, 0, 0, 0, 2, fuzzPartPrepend, 1, 0, fuzzPartMetadata | fuzzPartAnchor, 0, 0, 1},
+		},
+	}
+	for _, seed := range seeds {
+		f.Add(seed[0], seed[1])
+	}
+	f.Fuzz(func(t *testing.T, data1, data2 []byte) {
+		p1 := fuzzPost(&fuzzSource{data: data1})
+		p2 := fuzzPost(&fuzzSource{data: data2})
+		for _, granularity := range []DiffGranularity{DiffGranularityCharacter, DiffGranularityWord, DiffGranularityLine} {
+			checkRoundTrip(t, p1, p2, WithDiffGranularity(granularity))
+		}
+	})
+}
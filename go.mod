@@ -8,4 +8,4 @@ require (
 	github.com/stretchr/testify v1.2.2 // indirect
 )
 
-go 1.17
+go 1.23
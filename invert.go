@@ -0,0 +1,106 @@
+package posts
+
+// InvertAuthorsDeltas returns the AuthorsDeltas that undo deltas, such that
+// applying deltas to a list of authors and then applying the inverted deltas
+// to the result produces the original list of authors.
+//
+// Additions become removals and removals become additions, and every delta's
+// FromPosition and ToPosition are swapped.
+func InvertAuthorsDeltas(deltas []AuthorsDelta) []AuthorsDelta {
+	if deltas == nil {
+		return nil
+	}
+	inverted := make([]AuthorsDelta, 0, len(deltas))
+	for _, delta := range deltas {
+		delta.Op = invertOp(delta.Op)
+		delta.FromPosition, delta.ToPosition = delta.ToPosition, delta.FromPosition
+		inverted = append(inverted, delta)
+	}
+	return inverted
+}
+
+// InvertRevision returns the Revision that undoes rev, such that applying rev
+// to a Post and then applying the inverted Revision to the result produces
+// the original Post.
+//
+// Additions become removals and removals become additions, FromPosition and
+// ToPosition are swapped, and so are every other before and after pair, like
+// SHA256From and SHA256To. Textual changes are inverted by swapping each
+// delta with its undo delta, like TitleDelta and TitleUndo, so rev needs to
+// have been created by GenerateRevision or otherwise have its undo deltas
+// set.
+//
+// The inverted Revision has no ID, Reason, Status, AuthorID, ActorType, or
+// CreatedAt, as it describes a new change.
+func InvertRevision(rev Revision) Revision {
+	return Revision{
+		Public:         rev.Public,
+		TitleDelta:     rev.TitleUndo,
+		TitleUndo:      rev.TitleDelta,
+		SlugDelta:      rev.SlugUndo,
+		SlugUndo:       rev.SlugDelta,
+		AuthorsDeltas:  InvertAuthorsDeltas(rev.AuthorsDeltas),
+		StreamsDeltas:  invertStreamsDeltas(rev.StreamsDeltas),
+		PartsDeltas:    invertPartDeltas(rev.PartsDeltas),
+		MetadataDeltas: invertPartDeltas(rev.MetadataDeltas),
+	}
+}
+
+// invertOp returns the DeltaOp that undoes op.
+func invertOp(op DeltaOp) DeltaOp {
+	switch op {
+	case DeltaAdd:
+		return DeltaRemove
+	case DeltaRemove:
+		return DeltaAdd
+	}
+	return op
+}
+
+func invertStreamsDeltas(deltas []StreamsDelta) []StreamsDelta {
+	if deltas == nil {
+		return nil
+	}
+	inverted := make([]StreamsDelta, 0, len(deltas))
+	for _, delta := range deltas {
+		delta.Op = invertOp(delta.Op)
+		delta.FromPosition, delta.ToPosition = delta.ToPosition, delta.FromPosition
+		inverted = append(inverted, delta)
+	}
+	return inverted
+}
+
+func invertPartDeltas(deltas []PartDelta) []PartDelta {
+	if deltas == nil {
+		return nil
+	}
+	inverted := make([]PartDelta, 0, len(deltas))
+	for _, delta := range deltas {
+		delta.Op = invertOp(delta.Op)
+		delta.FromPosition, delta.ToPosition = delta.ToPosition, delta.FromPosition
+		delta.Headers = invertHeaderDeltas(delta.Headers)
+		delta.Body, delta.BodyUndo = delta.BodyUndo, delta.Body
+		delta.BinaryBody, delta.BinaryBodyUndo = delta.BinaryBodyUndo, delta.BinaryBody
+		delta.AnchorFrom, delta.AnchorTo = delta.AnchorTo, delta.AnchorFrom
+		delta.SHA256From, delta.SHA256To = delta.SHA256To, delta.SHA256From
+		inverted = append(inverted, delta)
+	}
+	return inverted
+}
+
+func invertHeaderDeltas(deltas map[string][]HeaderDelta) map[string][]HeaderDelta {
+	if deltas == nil {
+		return nil
+	}
+	inverted := make(map[string][]HeaderDelta, len(deltas))
+	for header, headerDeltas := range deltas {
+		invertedHeader := make([]HeaderDelta, 0, len(headerDeltas))
+		for _, delta := range headerDeltas {
+			delta.Op = invertOp(delta.Op)
+			delta.FromPosition, delta.ToPosition = delta.ToPosition, delta.FromPosition
+			invertedHeader = append(invertedHeader, delta)
+		}
+		inverted[header] = invertedHeader
+	}
+	return inverted
+}
@@ -0,0 +1,213 @@
+package posts
+
+import (
+	"reflect"
+	"testing"
+)
+
+// applyAuthorsDeltas replays deltas against authors. Authors being removed or
+// moved are taken out of the list, authors being added or moved are placed
+// at their ToPosition, and every other author fills in the remaining
+// positions in their original order.
+func applyAuthorsDeltas(t *testing.T, authors []string, deltas []AuthorsDelta) []string {
+	t.Helper()
+
+	taken := map[int]struct{}{}
+	placed := map[int]string{}
+	length := len(authors)
+	for _, delta := range deltas {
+		switch delta.Op {
+		case DeltaAdd:
+			placed[delta.ToPosition] = delta.Author
+			length++
+		case DeltaRemove:
+			taken[delta.FromPosition] = struct{}{}
+			length--
+		case DeltaMove:
+			taken[delta.FromPosition] = struct{}{}
+			placed[delta.ToPosition] = delta.Author
+		default:
+			t.Fatalf("unexpected authors delta op %q", delta.Op)
+		}
+	}
+	var remaining []string
+	for pos, author := range authors {
+		if _, ok := taken[pos]; !ok {
+			remaining = append(remaining, author)
+		}
+	}
+	result := make([]string, 0, length)
+	for pos := 0; pos < length; pos++ {
+		if author, ok := placed[pos]; ok {
+			result = append(result, author)
+			continue
+		}
+		if len(remaining) < 1 {
+			t.Fatalf("ran out of authors filling position %d", pos)
+		}
+		result = append(result, remaining[0])
+		remaining = remaining[1:]
+	}
+	return result
+}
+
+func TestInvertAuthorsDeltas(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		before []string
+		after  []string
+	}{
+		"add": {
+			before: []string{"a", "b"},
+			after:  []string{"a", "b", "c"},
+		},
+		"remove": {
+			before: []string{"a", "b", "c"},
+			after:  []string{"a", "c"},
+		},
+		"move": {
+			before: []string{"a", "b", "c"},
+			after:  []string{"c", "a", "b"},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			deltas := diffAuthors(test.before, test.after)
+			if got := applyAuthorsDeltas(t, test.before, deltas); !reflect.DeepEqual(got, test.after) {
+				t.Fatalf("expected deltas to produce %v, got %v", test.after, got)
+			}
+			inverted := InvertAuthorsDeltas(deltas)
+			if got := applyAuthorsDeltas(t, test.after, inverted); !reflect.DeepEqual(got, test.before) {
+				t.Errorf("expected inverted deltas to produce %v, got %v", test.before, got)
+			}
+			if got := InvertAuthorsDeltas(inverted); !reflect.DeepEqual(got, deltas) {
+				t.Errorf("expected inverting twice to produce %+v, got %+v", deltas, got)
+			}
+		})
+	}
+}
+
+func TestInvertAuthorsDeltasOps(t *testing.T) {
+	t.Parallel()
+
+	deltas := []AuthorsDelta{
+		{Op: DeltaAdd, Author: "a", FromPosition: -1, ToPosition: 2},
+		{Op: DeltaRemove, Author: "b", FromPosition: 1, ToPosition: -1},
+		{Op: DeltaMove, Author: "c", FromPosition: 0, ToPosition: 1},
+	}
+	want := []AuthorsDelta{
+		{Op: DeltaRemove, Author: "a", FromPosition: 2, ToPosition: -1},
+		{Op: DeltaAdd, Author: "b", FromPosition: -1, ToPosition: 1},
+		{Op: DeltaMove, Author: "c", FromPosition: 1, ToPosition: 0},
+	}
+	if got := InvertAuthorsDeltas(deltas); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestInvertRevision(t *testing.T) {
+	t.Parallel()
+
+	intro := inlinePart("intro", 0, "An introduction to the post.")
+	intro.Anchor = "intro"
+	intro.Headers = map[string][]string{"Content-Type": {"text/plain"}, RoleHeader: {RoleHeading}}
+	image := Part{ID: "image", Position: 1, Headers: map[string][]string{"Content-Type": {"image/png"}}, SHA256: "abc123"}
+	base := Post{
+		ID:       "post",
+		Title:    "Hello, world",
+		Slug:     "hello-world",
+		Authors:  []string{"alice", "bob"},
+		Streams:  []string{"blog", "tech"},
+		Parts:    []Part{intro, image, inlinePart("outro", 2, "Thanks for reading.")},
+		Metadata: []Part{inlinePart("summary", 0, "A summary.")},
+	}
+
+	tests := map[string]struct {
+		modify func(post *Post)
+		opts   []RevisionOption
+	}{
+		"title-and-slug": {
+			modify: func(post *Post) {
+				post.Title = "Hi"
+				post.Slug = "hi"
+			},
+		},
+		"authors-and-streams": {
+			modify: func(post *Post) {
+				post.Authors = []string{"bob", "carol"}
+				post.Streams = []string{"tech"}
+			},
+		},
+		"remove-parts": {
+			modify: func(post *Post) {
+				post.Parts = []Part{inlinePart("outro", 0, "Thanks for reading.")}
+				post.Metadata = nil
+			},
+		},
+		"add-and-move-parts": {
+			modify: func(post *Post) {
+				post.Parts = []Part{post.Parts[2], inlinePart("new", 1, "Something new."), post.Parts[0], post.Parts[1]}
+				for pos := range post.Parts {
+					post.Parts[pos].Position = pos
+				}
+			},
+		},
+		"update-parts": {
+			modify: func(post *Post) {
+				post.Parts[0].Body = []byte("An intro.")
+				post.Parts[0].SHA256 = sha256Hex(post.Parts[0].Body)
+				post.Parts[0].Anchor = "introduction"
+				post.Parts[0].Headers = map[string][]string{"Content-Type": {"text/markdown"}}
+				post.Parts[1] = inlinePart("image", 1, "No longer an image.")
+				post.Parts[2] = Part{ID: "outro", Position: 2, SHA256: "def456"}
+			},
+		},
+		"replace-body": {
+			modify: func(post *Post) {
+				post.Parts[2] = inlinePart("outro", 2, "Something else entirely.")
+			},
+			opts: []RevisionOption{WithMaxDeltaRatio(0.1)},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			after := base
+			after.Authors = append([]string(nil), base.Authors...)
+			after.Parts = append([]Part(nil), base.Parts...)
+			test.modify(&after)
+
+			rev, err := GenerateRevision(base, after, test.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error generating revision: %s", err)
+			}
+			got, err := ApplyRevision(base, rev)
+			if err != nil {
+				t.Fatalf("unexpected error applying revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, after) {
+				t.Fatalf("expected revision to produce\n%+v\ngot\n%+v", after, got)
+			}
+
+			inverted := InvertRevision(rev)
+			got, err = ApplyRevision(after, inverted)
+			if err != nil {
+				t.Fatalf("unexpected error applying inverted revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, base) {
+				t.Errorf("expected inverted revision to produce\n%+v\ngot\n%+v", base, got)
+			}
+			if twice := InvertRevision(inverted); !reflect.DeepEqual(twice, rev) {
+				t.Errorf("expected inverting twice to produce\n%+v\ngot\n%+v", rev, twice)
+			}
+		})
+	}
+}
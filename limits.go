@@ -0,0 +1,129 @@
+package posts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrLimitExceeded is returned when a write would create a Post larger than
+// the Limits a Storer was configured with allow.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// Limits describes the largest Post a Storer should accept. Zero values mean
+// there is no limit.
+type Limits struct {
+	// MaxInlineBytes is the maximum combined size of the bodies of all the
+	// inline Parts and Metadata in a Post.
+	MaxInlineBytes int
+
+	// MaxParts is the maximum number of Parts and Metadata, combined, in a
+	// Post.
+	MaxParts int
+
+	// MaxTitleLength is the maximum number of characters in a Post's
+	// title.
+	MaxTitleLength int
+
+	// MaxAuthors is the maximum number of authors a Post can have.
+	MaxAuthors int
+}
+
+// Check returns an error wrapping ErrLimitExceeded if post is larger than
+// the Limits allow.
+func (l Limits) Check(post Post) error {
+	if l.MaxTitleLength > 0 {
+		if length := utf8.RuneCountInString(post.Title); length > l.MaxTitleLength {
+			return fmt.Errorf("%w: title is %d characters, limit is %d", ErrLimitExceeded, length, l.MaxTitleLength)
+		}
+	}
+	if l.MaxAuthors > 0 && len(post.Authors) > l.MaxAuthors {
+		return fmt.Errorf("%w: post has %d authors, limit is %d", ErrLimitExceeded, len(post.Authors), l.MaxAuthors)
+	}
+	if parts := len(post.Parts) + len(post.Metadata); l.MaxParts > 0 && parts > l.MaxParts {
+		return fmt.Errorf("%w: post has %d parts, limit is %d", ErrLimitExceeded, parts, l.MaxParts)
+	}
+	if l.MaxInlineBytes > 0 {
+		var size int
+		for _, parts := range [][]Part{post.Parts, post.Metadata} {
+			for _, part := range parts {
+				if part.Inline {
+					size += len(part.Body)
+				}
+			}
+		}
+		if size > l.MaxInlineBytes {
+			return fmt.Errorf("%w: post has %d inline bytes, limit is %d", ErrLimitExceeded, size, l.MaxInlineBytes)
+		}
+	}
+	return nil
+}
+
+// WithLimits wraps s so that writes creating or updating Posts to be larger
+// than limits allow, and proposals of Revisions that would, are rejected
+// with an error wrapping ErrLimitExceeded before they reach s.
+func WithLimits(s Storer, limits Limits) Storer {
+	return limitedStorer{Storer: s, limits: limits}
+}
+
+type limitedStorer struct {
+	Storer
+	limits Limits
+}
+
+func (l limitedStorer) Create(ctx context.Context, post Post) error {
+	if err := l.limits.Check(post); err != nil {
+		return err
+	}
+	return l.Storer.Create(ctx, post)
+}
+
+// Update checks the limits against the Post rev would produce. A Revision
+// that doesn't apply to the current Post is only passed on to the wrapped
+// Storer if it's a retry of the Revision most recently applied to it, which
+// Update needs to accept; otherwise, the error is returned.
+func (l limitedStorer) Update(ctx context.Context, postID string, version int, rev Revision) error {
+	post, err := l.Storer.Get(ctx, postID)
+	if err != nil {
+		return err
+	}
+	updated, err := ApplyRevision(post, rev)
+	if err != nil {
+		if rev.ID == "" {
+			return err
+		}
+		latest, ok, latestErr := l.Storer.LatestRevision(ctx, postID)
+		if latestErr != nil {
+			return latestErr
+		}
+		if !ok || latest.ID != rev.ID {
+			return err
+		}
+		return l.Storer.Update(ctx, postID, version, rev)
+	}
+	if err := l.limits.Check(updated); err != nil {
+		return err
+	}
+	return l.Storer.Update(ctx, postID, version, rev)
+}
+
+// ProposeRevision checks the limits against the Post rev would produce if it
+// were applied to the current Post, so Revisions that are too large are
+// rejected when they're proposed, as Storers apply the proposed Revision
+// itself when an approved proposal is passed to Update. An error is also
+// returned if rev doesn't apply to the current Post.
+func (l limitedStorer) ProposeRevision(ctx context.Context, postID string, rev Revision) (string, error) {
+	post, err := l.Storer.Get(ctx, postID)
+	if err != nil {
+		return "", err
+	}
+	updated, err := ApplyRevision(post, rev)
+	if err != nil {
+		return "", err
+	}
+	if err := l.limits.Check(updated); err != nil {
+		return "", err
+	}
+	return l.Storer.ProposeRevision(ctx, postID, rev)
+}
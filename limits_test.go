@@ -0,0 +1,259 @@
+package posts
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// createStorer is a Storer that only knows how to Create, recording the
+// Posts it was asked to create.
+type createStorer struct {
+	Storer
+	created []Post
+}
+
+func (c *createStorer) Create(_ context.Context, post Post) error {
+	c.created = append(c.created, post)
+	return nil
+}
+
+func TestWithLimitsCreate(t *testing.T) {
+	t.Parallel()
+
+	limits := Limits{
+		MaxInlineBytes: 10,
+		MaxParts:       2,
+		MaxTitleLength: 5,
+		MaxAuthors:     1,
+	}
+	valid := Post{
+		ID:      "post",
+		Title:   "Héllo",
+		Authors: []string{"alice"},
+		Parts: []Part{
+			{ID: "text", Inline: true, Body: []byte("12345")},
+			{ID: "image", Body: []byte(strings.Repeat("x", 100))},
+		},
+	}
+
+	tests := map[string]struct {
+		modify  func(post *Post)
+		wantErr bool
+	}{
+		"within-limits": {
+			modify: func(post *Post) {},
+		},
+		"title-too-long": {
+			modify:  func(post *Post) { post.Title = "Hello!" },
+			wantErr: true,
+		},
+		"too-many-authors": {
+			modify:  func(post *Post) { post.Authors = append(post.Authors, "bob") },
+			wantErr: true,
+		},
+		"too-many-parts": {
+			modify: func(post *Post) {
+				post.Metadata = []Part{{ID: "summary", Inline: true}}
+			},
+			wantErr: true,
+		},
+		"too-many-inline-bytes": {
+			modify: func(post *Post) {
+				post.Parts = []Part{{ID: "text", Inline: true, Body: []byte("12345678901")}}
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			post := valid
+			test.modify(&post)
+			underlying := &createStorer{}
+			err := WithLimits(underlying, limits).Create(context.Background(), post)
+			if test.wantErr {
+				if !errors.Is(err, ErrLimitExceeded) {
+					t.Errorf("expected ErrLimitExceeded, got %v", err)
+				}
+				if len(underlying.created) != 0 {
+					t.Errorf("expected post not to reach the underlying Storer")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(underlying.created) != 1 {
+				t.Errorf("expected post to reach the underlying Storer")
+			}
+		})
+	}
+}
+
+// updateStorer is a Storer that holds a single Post, recording the Revisions
+// it was asked to apply to it.
+type updateStorer struct {
+	Storer
+	post    Post
+	updates []Revision
+}
+
+func (u *updateStorer) Get(_ context.Context, id string) (Post, error) {
+	if id != u.post.ID {
+		return Post{}, errors.New("post not found")
+	}
+	return u.post, nil
+}
+
+func (u *updateStorer) Update(_ context.Context, postID string, version int, rev Revision) error {
+	u.updates = append(u.updates, rev)
+	return nil
+}
+
+func (u *updateStorer) LatestRevision(_ context.Context, postID string) (Revision, bool, error) {
+	if len(u.updates) == 0 {
+		return Revision{}, false, nil
+	}
+	return u.updates[len(u.updates)-1], true, nil
+}
+
+func TestWithLimitsUpdate(t *testing.T) {
+	t.Parallel()
+
+	limits := Limits{MaxTitleLength: 5}
+	post := Post{ID: "post", Title: "Hello"}
+
+	tests := map[string]struct {
+		title   string
+		wantErr bool
+	}{
+		"within-limits": {
+			title: "Hi",
+		},
+		"title-too-long": {
+			title:   "Hello!",
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			updated := post
+			updated.Title = test.title
+			rev, err := GenerateRevision(post, updated)
+			if err != nil {
+				t.Fatalf("unexpected error generating revision: %s", err)
+			}
+			underlying := &updateStorer{post: post}
+			err = WithLimits(underlying, limits).Update(context.Background(), post.ID, post.Version, rev)
+			if test.wantErr {
+				if !errors.Is(err, ErrLimitExceeded) {
+					t.Errorf("expected ErrLimitExceeded, got %v", err)
+				}
+				if len(underlying.updates) != 0 {
+					t.Errorf("expected revision not to reach the underlying Storer")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(underlying.updates) != 1 {
+				t.Errorf("expected revision to reach the underlying Storer")
+			}
+		})
+	}
+}
+
+func TestWithLimitsProposal(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	underlying := NewInMemoryStorer()
+	storer := WithLimits(underlying, Limits{MaxTitleLength: 5})
+	post := Post{ID: "post", Title: "Hello"}
+	if err := storer.Create(ctx, post); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+
+	long, err := GenerateRevision(post, Post{ID: "post", Title: "Hello, world"})
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	if _, err := storer.ProposeRevision(ctx, post.ID, long); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded proposing a revision over the limits, got %v", err)
+	}
+	if _, err := storer.ProposeRevision(ctx, post.ID, Revision{TitleDelta: "=100"}); !errors.Is(err, ErrRevisionMismatch) {
+		t.Errorf("expected ErrRevisionMismatch proposing a revision that doesn't apply, got %v", err)
+	}
+
+	short, err := GenerateRevision(post, Post{ID: "post", Title: "Hi"})
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	id, err := storer.ProposeRevision(ctx, post.ID, short)
+	if err != nil {
+		t.Fatalf("unexpected error proposing revision: %s", err)
+	}
+	if err := storer.ApproveRevision(ctx, id); err != nil {
+		t.Fatalf("unexpected error approving revision: %s", err)
+	}
+	// Update applies the approved proposal, not the Revision passed to
+	// it, which only names the proposal.
+	if err := storer.Update(ctx, post.ID, post.Version, Revision{ID: id}); err != nil {
+		t.Fatalf("unexpected error applying approved revision: %s", err)
+	}
+	got, err := storer.Get(ctx, post.ID)
+	if err != nil {
+		t.Fatalf("unexpected error getting post: %s", err)
+	}
+	if got.Title != "Hi" {
+		t.Errorf("expected title %q, got %q", "Hi", got.Title)
+	}
+}
+
+func TestWithLimitsUpdateMismatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := WithLimits(NewInMemoryStorer(), Limits{MaxTitleLength: 5})
+	post := Post{ID: "post", Title: "Hello"}
+	if err := storer.Create(ctx, post); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+	rev, err := GenerateRevision(post, Post{ID: "post", Title: "Hi"})
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	rev.ID = "rev"
+	if err := storer.Update(ctx, post.ID, post.Version, rev); err != nil {
+		t.Fatalf("unexpected error updating post: %s", err)
+	}
+
+	// the revision no longer applies, but retrying it is still fine.
+	if err := storer.Update(ctx, post.ID, post.Version, rev); err != nil {
+		t.Errorf("unexpected error retrying update: %s", err)
+	}
+	mismatched := Revision{ID: "other", TitleDelta: "=100"}
+	if err := storer.Update(ctx, post.ID, post.Version+1, mismatched); !errors.Is(err, ErrRevisionMismatch) {
+		t.Errorf("expected ErrRevisionMismatch for a revision that doesn't apply, got %v", err)
+	}
+
+	// revisions that don't apply and aren't retries never reach the
+	// wrapped Storer, where they could be applied unchecked.
+	underlying := &updateStorer{post: post}
+	if err := WithLimits(underlying, Limits{}).Update(ctx, post.ID, post.Version, mismatched); !errors.Is(err, ErrRevisionMismatch) {
+		t.Errorf("expected ErrRevisionMismatch, got %v", err)
+	}
+	if len(underlying.updates) != 0 {
+		t.Errorf("expected revision not to reach the underlying Storer")
+	}
+}
@@ -0,0 +1,267 @@
+package posts
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SourceHeader is the Part header holding the URL a non-inline Part's body
+// can be retrieved from, for Parts whose body hasn't been retrieved yet,
+// like images PartsFromMarkdown finds in a document.
+const SourceHeader = "X-Source"
+
+// MarkdownOption configures the way PartsFromMarkdown splits a document into
+// Parts.
+type MarkdownOption func(*markdownOptions)
+
+type markdownOptions struct {
+	fetch func(src string) ([]byte, error)
+}
+
+// FetchMarkdownImages makes PartsFromMarkdown call fetch with the URL of each
+// image in the document, as it's written in the document, and use the bytes
+// it returns as the image Part's body. If fetch returns an error,
+// PartsFromMarkdown stops and returns it.
+func FetchMarkdownImages(fetch func(src string) ([]byte, error)) MarkdownOption {
+	return func(opts *markdownOptions) {
+		opts.fetch = fetch
+	}
+}
+
+var (
+	// markdownHeadingPattern matches an ATX heading line, like "## Heading".
+	markdownHeadingPattern = regexp.MustCompile(`^ {0,3}#{1,6}(\s|$)`)
+
+	// markdownFencePattern matches the line opening a fenced code block, with
+	// the fence as its first submatch.
+	markdownFencePattern = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+
+	// markdownImagePattern matches a line holding nothing but an image, like
+	// ![alt](src "title"), with the alt text, source, and title as its
+	// submatches.
+	markdownImagePattern = regexp.MustCompile(`^ {0,3}!\[([^\]]*)\]\(\s*<?([^\s<>()]+)>?(?:\s+"([^"]*)")?\s*\)\s*$`)
+)
+
+// PartsFromMarkdown splits a Markdown document into Parts, one for each of
+// its blocks, so each can be edited on its own. Blocks are separated by
+// blank lines, and headings, fenced code blocks, and images that are on a
+// line of their own are always blocks of their own:
+//
+//   - Headings, paragraphs, and fenced code blocks become inline
+//     text/markdown Parts holding their Markdown source. Headings have a
+//     RoleHeader of RoleHeading. Blank lines inside fenced code blocks
+//     don't split them.
+//   - Images become non-inline Parts with a Content-Type based on their
+//     URL, and the image's alt text and title in their AltHeader and
+//     CaptionHeader. Images with either have a RoleHeader of RoleFigure.
+//     Images embedded in the document as data URLs have their body
+//     decoded, and so do images whose bytes FetchMarkdownImages is
+//     passed a way to fetch. Other images are left without a body or
+//     SHA256, with their URL in their SourceHeader, for the caller to
+//     retrieve before storing the Part.
+//
+// Every other block, like lists, block quotes, and tables, is kept as it is
+// in a Part of its own, and images in the middle of a paragraph are left in
+// it. Each Part gets a new random UUID as its ID, and Positions in the order
+// the blocks appear in the document, starting from 0. Joining the bodies of
+// the text Parts, and the images written back as Markdown, with blank lines
+// between them gives a document that renders the same as the original.
+//
+// An error is returned if an embedded image can't be decoded, or if fetching
+// an image fails.
+func PartsFromMarkdown(doc []byte, opts ...MarkdownOption) ([]Part, error) {
+	var options markdownOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var parts []Part
+	add := func(part Part) error {
+		id, err := newUUID()
+		if err != nil {
+			return err
+		}
+		part.ID = id
+		part.Position = len(parts)
+		if part.Body != nil {
+			part.ComputeSHA256()
+		}
+		parts = append(parts, part)
+		return nil
+	}
+
+	var paragraph []string
+	flush := func() error {
+		if len(paragraph) < 1 {
+			return nil
+		}
+		err := add(markdownTextPart(strings.Join(paragraph, "\n"), ""))
+		paragraph = nil
+		return err
+	}
+
+	lines := strings.Split(string(bytes.ReplaceAll(doc, []byte("\r\n"), []byte("\n"))), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		fence := markdownFencePattern.FindStringSubmatch(line)
+		heading := markdownHeadingPattern.MatchString(line)
+		image := markdownImagePattern.FindStringSubmatch(line)
+		if fence == nil && !heading && image == nil {
+			paragraph = append(paragraph, line)
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		var err error
+		switch {
+		case fence != nil:
+			end := i + 1
+			for end < len(lines) && !closesFence(lines[end], fence[1]) {
+				end++
+			}
+			// a fence that's never closed runs to the end of the
+			// document.
+			end = min(end, len(lines)-1)
+			block := strings.TrimRight(strings.Join(lines[i:end+1], "\n"), "\n")
+			err = add(markdownTextPart(block, ""))
+			i = end
+		case heading:
+			err = add(markdownTextPart(line, RoleHeading))
+		default:
+			var part Part
+			part, err = markdownImagePart(image[1], image[2], image[3], options)
+			if err == nil {
+				err = add(part)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// closesFence returns true if line closes a fenced code block opened with
+// fence: it has to be a fence made of the same character, at least as long,
+// with nothing after it.
+func closesFence(line, fence string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+	run := strings.TrimLeft(trimmed, fence[:1])
+	if len(trimmed)-len(run) < len(fence) {
+		return false
+	}
+	return strings.TrimSpace(run) == ""
+}
+
+// markdownTextPart returns an inline text/markdown Part holding source, with
+// a RoleHeader of role, if it's set.
+func markdownTextPart(source, role string) Part {
+	part := Part{
+		Headers: map[string][]string{"Content-Type": {"text/markdown"}},
+		Body:    []byte(source),
+		Inline:  true,
+	}
+	if role != "" {
+		part.SetHeader(RoleHeader, role)
+	}
+	return part
+}
+
+// markdownImagePart returns a non-inline Part for an image with the passed
+// alt text, source, and title, as described by PartsFromMarkdown.
+func markdownImagePart(alt, src, title string, options markdownOptions) (Part, error) {
+	var part Part
+	if alt != "" {
+		part.SetHeader(AltHeader, alt)
+	}
+	if title != "" {
+		part.SetHeader(CaptionHeader, title)
+	}
+	if alt != "" || title != "" {
+		part.SetHeader(RoleHeader, RoleFigure)
+	}
+
+	if strings.HasPrefix(src, "data:") {
+		contentType, body, err := decodeDataURL(src)
+		if err != nil {
+			return Part{}, fmt.Errorf("error decoding embedded image: %w", err)
+		}
+		part.SetHeader("Content-Type", contentType)
+		part.Body = body
+		return part, nil
+	}
+
+	part.SetHeader("Content-Type", imageContentType(src))
+	part.SetHeader(SourceHeader, src)
+	if options.fetch != nil {
+		body, err := options.fetch(src)
+		if err != nil {
+			return Part{}, fmt.Errorf("error fetching image %s: %w", src, err)
+		}
+		// an empty body still has a SHA256, so the Part is complete.
+		if body == nil {
+			body = []byte{}
+		}
+		part.Body = body
+	}
+	return part, nil
+}
+
+// imageContentType returns the media type of the image at src, based on the
+// extension of its path, or application/octet-stream if it isn't known.
+func imageContentType(src string) string {
+	p := src
+	if u, err := url.Parse(src); err == nil {
+		p = u.Path
+	}
+	if contentType := mime.TypeByExtension(path.Ext(p)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// decodeDataURL returns the media type and contents of a data URL, like
+// data:image/png;base64,iVBORw0KGgo=.
+func decodeDataURL(src string) (string, []byte, error) {
+	meta, data, ok := strings.Cut(strings.TrimPrefix(src, "data:"), ",")
+	if !ok {
+		return "", nil, fmt.Errorf("data URL has no data")
+	}
+	meta, encoded := strings.CutSuffix(meta, ";base64")
+	contentType := meta
+	if contentType == "" || strings.HasPrefix(contentType, ";") {
+		// data URLs without a media type are US-ASCII text.
+		contentType = "text/plain" + contentType
+	}
+	if encoded {
+		body, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return "", nil, err
+		}
+		return contentType, body, nil
+	}
+	body, err := url.PathUnescape(data)
+	if err != nil {
+		return "", nil, err
+	}
+	return contentType, []byte(body), nil
+}
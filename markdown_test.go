@@ -0,0 +1,148 @@
+package posts
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPartsFromMarkdown(t *testing.T) {
+	t.Parallel()
+
+	markdown := map[string][]string{"Content-Type": {"text/markdown"}}
+	heading := map[string][]string{"Content-Type": {"text/markdown"}, RoleHeader: {RoleHeading}}
+	textPart := func(headers map[string][]string, body string) Part {
+		part := Part{Headers: headers, Inline: true, Body: []byte(body)}
+		part.ComputeSHA256()
+		return part
+	}
+	// the eight bytes every PNG starts with.
+	png := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+	errFetch := errors.New("can't fetch")
+
+	tests := map[string]struct {
+		doc  string
+		opts []MarkdownOption
+		want []Part
+		// err is part of the error expected, if one is.
+		err string
+	}{
+		"document": {
+			doc: "# Title\n\nFirst paragraph\ncontinues here.\n\n\n" +
+				"```go\nfunc main() {\n\n}\n```\n" +
+				"![A cat](images/cat.png \"Our cat\")\n\n" +
+				"## Second heading\nLast paragraph.\n",
+			want: []Part{
+				textPart(heading, "# Title"),
+				textPart(markdown, "First paragraph\ncontinues here."),
+				textPart(markdown, "```go\nfunc main() {\n\n}\n```"),
+				{Headers: map[string][]string{
+					"Content-Type": {"image/png"},
+					AltHeader:      {"A cat"},
+					CaptionHeader:  {"Our cat"},
+					RoleHeader:     {RoleFigure},
+					SourceHeader:   {"images/cat.png"},
+				}},
+				textPart(heading, "## Second heading"),
+				textPart(markdown, "Last paragraph."),
+			},
+		},
+		"crlf": {
+			doc: "Hello,\r\nworld.\r\n\r\nGoodbye.",
+			want: []Part{
+				textPart(markdown, "Hello,\nworld."),
+				textPart(markdown, "Goodbye."),
+			},
+		},
+		"empty": {
+			doc: "\n\n",
+		},
+		"unclosed-fence": {
+			doc: "~~~~\ncode\n~~~\n\nmore code\n\n",
+			want: []Part{
+				textPart(markdown, "~~~~\ncode\n~~~\n\nmore code"),
+			},
+		},
+		"inline-image": {
+			doc: "See ![a cat](cat.png) here.",
+			want: []Part{
+				textPart(markdown, "See ![a cat](cat.png) here."),
+			},
+		},
+		"embedded-image": {
+			doc: "![](data:image/png;base64,iVBORw0KGgo=)",
+			want: []Part{
+				{
+					Headers: map[string][]string{"Content-Type": {"image/png"}},
+					Body:    png,
+					SHA256:  sha256Hex(png),
+				},
+			},
+		},
+		"fetched-image": {
+			doc: "![A cat](https://example.com/cat.png?size=large)",
+			opts: []MarkdownOption{FetchMarkdownImages(func(src string) ([]byte, error) {
+				if src != "https://example.com/cat.png?size=large" {
+					return nil, errFetch
+				}
+				return png, nil
+			})},
+			want: []Part{
+				{
+					Headers: map[string][]string{
+						"Content-Type": {"image/png"},
+						AltHeader:      {"A cat"},
+						RoleHeader:     {RoleFigure},
+						SourceHeader:   {"https://example.com/cat.png?size=large"},
+					},
+					Body:   png,
+					SHA256: sha256Hex(png),
+				},
+			},
+		},
+		"fetch-error": {
+			doc: "![A cat](cat.png)",
+			opts: []MarkdownOption{FetchMarkdownImages(func(string) ([]byte, error) {
+				return nil, errFetch
+			})},
+			err: "can't fetch",
+		},
+		"invalid-embedded-image": {
+			doc: "![](data:image/png;base64,!!!)",
+			err: "error decoding embedded image",
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			parts, err := PartsFromMarkdown([]byte(test.doc), test.opts...)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			ids := map[string]bool{}
+			for pos := range parts {
+				if !uuidPattern.MatchString(parts[pos].ID) || ids[parts[pos].ID] {
+					t.Errorf("expected part %d to have a new UUID, got %q", pos, parts[pos].ID)
+				}
+				ids[parts[pos].ID] = true
+				parts[pos].ID = ""
+			}
+			for pos := range test.want {
+				test.want[pos].Position = pos
+			}
+			if !reflect.DeepEqual(parts, test.want) {
+				t.Errorf("expected\n%+v\ngot\n%+v", test.want, parts)
+			}
+		})
+	}
+}
@@ -0,0 +1,1051 @@
+package posts
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InMemoryStorer is a Storer that keeps everything in memory, for use in
+// tests and local development. It's safe for concurrent use. Use
+// NewInMemoryStorer to create one.
+//
+// Deleted Posts can still be retrieved with Get, but are left out of List,
+// Count, PostsByAuthor, and Query unless the PostFilter's Deleted property
+// asks for them.
+//
+// Nothing an InMemoryStorer does blocks, so it can't be interrupted part way
+// through. Instead, every method checks its context before it starts, and
+// returns its error without doing anything if it's canceled or its deadline
+// has passed.
+//
+// Posts are cloned on their way in and out, so callers can modify the Posts
+// they pass to Create and get back from Get, List, and the rest without
+// changing what's stored. Revisions are cloned the same way, on their way
+// into Update and ProposeRevision and out of LatestRevision and
+// SubscribeRevisions.
+type InMemoryStorer struct {
+	// RequireApproval makes Update refuse to apply Revisions that weren't
+	// proposed with ProposeRevision and approved with ApproveRevision.
+	RequireApproval bool
+
+	mu          sync.RWMutex
+	now         func() time.Time
+	posts       map[string]Post
+	history     map[string][]Revision
+	applied     map[string]map[string]struct{}
+	proposals   map[string]proposal
+	subscribers map[string][]*subscription
+	streams     map[string]Stream
+}
+
+var (
+	_ Storer       = (*InMemoryStorer)(nil)
+	_ StreamStorer = (*InMemoryStorer)(nil)
+)
+
+// proposal is a Revision that has been proposed for a Post.
+type proposal struct {
+	postID string
+	rev    Revision
+}
+
+// NewInMemoryStorer returns an empty InMemoryStorer.
+func NewInMemoryStorer() *InMemoryStorer {
+	return &InMemoryStorer{
+		now:         time.Now,
+		posts:       map[string]Post{},
+		history:     map[string][]Revision{},
+		applied:     map[string]map[string]struct{}{},
+		proposals:   map[string]proposal{},
+		subscribers: map[string][]*subscription{},
+		streams:     map[string]Stream{},
+	}
+}
+
+// Create stores post. It returns an error wrapping ErrInvalidPost if post has
+// no ID, or an error wrapping ErrAlreadyExists if a Post with the same ID has
+// already been created.
+func (m *InMemoryStorer) Create(ctx context.Context, post Post) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if post.ID == "" {
+		return fmt.Errorf("%w: post ID must be set", ErrInvalidPost)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.posts[post.ID]; ok {
+		return fmt.Errorf("%w: post %s", ErrAlreadyExists, post.ID)
+	}
+	m.posts[post.ID] = post.Clone()
+	return nil
+}
+
+// Update applies rev to the Post indicated by postID using ApplyRevision, as
+// long as the Post's Version is still version. If rev.ID matches a Revision
+// that was proposed with ProposeRevision, the proposed Revision is applied,
+// and it must have been approved; otherwise, rev is applied as it is, unless
+// RequireApproval is set.
+func (m *InMemoryStorer) Update(ctx context.Context, postID string, version int, rev Revision) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	post, ok := m.posts[postID]
+	if !ok {
+		return fmt.Errorf("%w: post %s", ErrNotFound, postID)
+	}
+	// retries are checked for first, as the retried update is what
+	// moved the Post past version.
+	if _, ok := m.applied[postID][rev.ID]; ok && rev.ID != "" {
+		return nil
+	}
+	if post.Version != version {
+		return fmt.Errorf("%w: post %s is at version %d, not %d", ErrVersionConflict, postID, post.Version, version)
+	}
+	proposed, isProposal := m.proposals[rev.ID]
+	isProposal = isProposal && rev.ID != ""
+	if isProposal {
+		if proposed.postID != postID {
+			return fmt.Errorf("revision %s was proposed for post %s, not %s", rev.ID, proposed.postID, postID)
+		}
+		if proposed.rev.Status != RevisionStatusApproved {
+			return fmt.Errorf("%w: revision %s is %s", ErrRevisionNotApproved, rev.ID, proposed.rev.Status)
+		}
+		rev = proposed.rev
+		rev.Status = RevisionStatusApplied
+	} else if m.RequireApproval {
+		return fmt.Errorf("%w: revision %s was never proposed", ErrRevisionNotApproved, rev.ID)
+	}
+	if err := m.apply(postID, rev); err != nil {
+		return err
+	}
+	if isProposal {
+		proposed.rev = rev
+		m.proposals[rev.ID] = proposed
+	}
+	return nil
+}
+
+// apply applies rev to the Post indicated by postID, increments its Version,
+// records rev in the Post's history, and sends it to any subscribers. The
+// caller must hold m.mu for writing, and the Post must exist.
+func (m *InMemoryStorer) apply(postID string, rev Revision) error {
+	post, err := ApplyRevision(m.posts[postID], rev)
+	if err != nil {
+		return err
+	}
+	post.Version++
+	m.posts[postID] = post
+	m.history[postID] = append(m.history[postID], rev.Clone())
+	if rev.ID != "" {
+		if m.applied[postID] == nil {
+			m.applied[postID] = map[string]struct{}{}
+		}
+		m.applied[postID][rev.ID] = struct{}{}
+	}
+	for _, sub := range m.subscribers[postID] {
+		sub.send(rev.Clone())
+	}
+	return nil
+}
+
+// Delete marks the Post indicated by id as deleted.
+func (m *InMemoryStorer) Delete(ctx context.Context, id string) (Post, error) {
+	if err := ctx.Err(); err != nil {
+		return Post{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	post, ok := m.posts[id]
+	if !ok {
+		return Post{}, fmt.Errorf("%w: post %s", ErrNotFound, id)
+	}
+	if !post.Deleted {
+		post.Deleted = true
+		post.Version++
+		m.posts[id] = post
+	}
+	return post.Clone(), nil
+}
+
+// DeletePermanently removes the Post indicated by id, its history, and any
+// Revisions proposed for it, after removing the bodies of its non-inline
+// parts that no other Post uses from blobs. The bodies are found in the
+// Post's current Parts and Metadata and in every Revision applied to it, so
+// bodies it used in the past are removed too. The InMemoryStorer stays
+// locked while blobs is called, so the Posts using each body can't change in
+// the meantime.
+func (m *InMemoryStorer) DeletePermanently(ctx context.Context, id string, blobs BlobStore, opts ...DeleteOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var options deleteOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	post, ok := m.posts[id]
+	if !ok {
+		return fmt.Errorf("%w: post %s", ErrNotFound, id)
+	}
+	if !post.Deleted && !options.force {
+		return fmt.Errorf("%w: post %s must be deleted before it can be deleted permanently", ErrNotDeleted, id)
+	}
+	shared := map[string]struct{}{}
+	for otherID := range m.posts {
+		if otherID == id {
+			continue
+		}
+		for _, sha256 := range m.postBlobs(otherID) {
+			shared[sha256] = struct{}{}
+		}
+	}
+	for _, sha256 := range m.postBlobs(id) {
+		if _, ok := shared[sha256]; ok {
+			continue
+		}
+		if err := blobs.Delete(ctx, sha256); err != nil {
+			return fmt.Errorf("error deleting blob %s of post %s: %w", sha256, id, err)
+		}
+	}
+	delete(m.posts, id)
+	delete(m.history, id)
+	delete(m.applied, id)
+	for revisionID, proposed := range m.proposals {
+		if proposed.postID == id {
+			delete(m.proposals, revisionID)
+		}
+	}
+	return nil
+}
+
+// postBlobs returns the SHA256s of the bodies of the non-inline parts of the
+// Post indicated by id, now or in any Revision applied to it, each listed
+// once. The caller must hold m.mu.
+func (m *InMemoryStorer) postBlobs(id string) []string {
+	var blobs []string
+	seen := map[string]struct{}{}
+	add := func(sha256 string) {
+		if _, ok := seen[sha256]; ok || sha256 == "" {
+			return
+		}
+		seen[sha256] = struct{}{}
+		blobs = append(blobs, sha256)
+	}
+	post := m.posts[id]
+	for _, parts := range [][]Part{post.Parts, post.Metadata} {
+		for _, part := range parts {
+			if !part.Inline {
+				add(part.SHA256)
+			}
+		}
+	}
+	for _, rev := range m.history[id] {
+		for _, deltas := range [][]PartDelta{rev.PartsDeltas, rev.MetadataDeltas} {
+			for _, delta := range deltas {
+				add(delta.SHA256From)
+				add(delta.SHA256To)
+			}
+		}
+	}
+	return blobs
+}
+
+// Restore marks the Post indicated by id as no longer deleted.
+func (m *InMemoryStorer) Restore(ctx context.Context, id string) (Post, error) {
+	if err := ctx.Err(); err != nil {
+		return Post{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	post, ok := m.posts[id]
+	if !ok {
+		return Post{}, fmt.Errorf("%w: post %s", ErrNotFound, id)
+	}
+	if !post.Deleted {
+		return Post{}, fmt.Errorf("%w: post %s", ErrNotDeleted, id)
+	}
+	post.Deleted = false
+	post.Version++
+	m.posts[id] = post
+	return post.Clone(), nil
+}
+
+// Publish marks the Post indicated by id as published, setting its
+// PublishedAt to the current time if it has never been published or
+// RefreshPublishedAt is passed.
+func (m *InMemoryStorer) Publish(ctx context.Context, id string, opts ...PublishOption) (Post, error) {
+	if err := ctx.Err(); err != nil {
+		return Post{}, err
+	}
+	var options publishOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	post, ok := m.posts[id]
+	if !ok {
+		return Post{}, fmt.Errorf("%w: post %s", ErrNotFound, id)
+	}
+	if !post.Draft {
+		return post.Clone(), nil
+	}
+	post.Draft = false
+	post.ScheduledFor = nil
+	if post.PublishedAt.IsZero() || options.refresh {
+		post.PublishedAt = m.now()
+	}
+	post.Version++
+	m.posts[id] = post
+	return post.Clone(), nil
+}
+
+// Unpublish marks the Post indicated by id as a draft.
+func (m *InMemoryStorer) Unpublish(ctx context.Context, id string) (Post, error) {
+	if err := ctx.Err(); err != nil {
+		return Post{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	post, ok := m.posts[id]
+	if !ok {
+		return Post{}, fmt.Errorf("%w: post %s", ErrNotFound, id)
+	}
+	if !post.Draft {
+		post.Draft = true
+		post.Version++
+		m.posts[id] = post
+	}
+	return post.Clone(), nil
+}
+
+// Get returns the Post indicated by id, or an error wrapping ErrNotFound if
+// there isn't one.
+func (m *InMemoryStorer) Get(ctx context.Context, id string) (Post, error) {
+	if err := ctx.Err(); err != nil {
+		return Post{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	post, ok := m.posts[id]
+	if !ok {
+		return Post{}, fmt.Errorf("%w: post %s", ErrNotFound, id)
+	}
+	return post.Clone(), nil
+}
+
+// GetMany returns the Posts indicated by ids, keyed by their IDs, leaving out
+// any IDs that don't match a Post.
+func (m *InMemoryStorer) GetMany(ctx context.Context, ids []string) (map[string]Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	posts := make(map[string]Post, len(ids))
+	for _, id := range ids {
+		if _, ok := posts[id]; ok {
+			continue
+		}
+		if post, ok := m.posts[id]; ok {
+			posts[id] = post.Clone()
+		}
+	}
+	return posts, nil
+}
+
+// List returns the Posts that match filter, sorted as described by its
+// OrderBy and Descending properties.
+func (m *InMemoryStorer) List(ctx context.Context, filter PostFilter) ([]Post, error) {
+	var posts []Post
+	for post, err := range m.ListIter(ctx, filter) {
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
+
+// ListIter yields the Posts that match filter, in the order List returns
+// them. The matching Posts are gathered up front, so the InMemoryStorer isn't
+// locked while the caller handles each one, and can be changed from inside
+// the loop; changes made during iteration aren't reflected in the Posts
+// yielded. ctx is checked before the Posts are gathered and before each one
+// is yielded.
+func (m *InMemoryStorer) ListIter(ctx context.Context, filter PostFilter) iter.Seq2[Post, error] {
+	return func(yield func(Post, error) bool) {
+		if err := ctx.Err(); err != nil {
+			yield(Post{}, err)
+			return
+		}
+		m.mu.RLock()
+		posts, err := m.filter(filter)
+		m.mu.RUnlock()
+		if err != nil {
+			yield(Post{}, err)
+			return
+		}
+		if filter.Limit > 0 && len(posts) > filter.Limit {
+			posts = posts[:filter.Limit]
+		}
+		for _, post := range posts {
+			if err := ctx.Err(); err != nil {
+				yield(Post{}, err)
+				return
+			}
+			if !yield(post.Clone(), nil) {
+				return
+			}
+		}
+	}
+}
+
+// Count returns the number of Posts that match filter, ignoring its Limit.
+func (m *InMemoryStorer) Count(ctx context.Context, filter PostFilter) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	posts, err := m.filter(filter)
+	if err != nil {
+		return 0, err
+	}
+	return len(posts), nil
+}
+
+// filter returns every Post that matches filter, sorted as described by its
+// OrderBy and Descending properties, ignoring its Limit. The caller must hold
+// m.mu for reading.
+func (m *InMemoryStorer) filter(filter PostFilter) ([]Post, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	now := m.now()
+	var posts []Post
+	for _, post := range m.posts {
+		if filter.MatchesAt(post, now) {
+			posts = append(posts, post)
+		}
+	}
+	if err := sortPosts(posts, filter.OrderBy, filter.Descending); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// sortPosts sorts posts by the property indicated by orderBy, as described by
+// PostFilter's OrderBy property.
+func sortPosts(posts []Post, orderBy PostOrderField, descending bool) error {
+	var compare func(a, b Post) int
+	switch orderBy {
+	case PostOrderFieldDefault:
+		compare = func(a, b Post) int { return compareTimes(b.PublishedAt, a.PublishedAt) }
+		descending = false
+	case PostOrderFieldPublishedAt:
+		compare = func(a, b Post) int { return compareTimes(a.PublishedAt, b.PublishedAt) }
+	case PostOrderFieldTitle:
+		compare = func(a, b Post) int { return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)) }
+	case PostOrderFieldSlug:
+		compare = func(a, b Post) int { return strings.Compare(a.Slug, b.Slug) }
+	default:
+		return fmt.Errorf("unknown order field %q", orderBy)
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if c := compare(posts[i], posts[j]); c != 0 {
+			return (c < 0) != descending
+		}
+		// break ties consistently, so results don't depend on map
+		// ordering.
+		return posts[i].ID < posts[j].ID
+	})
+	return nil
+}
+
+// compareTimes returns -1 if a is before b, 1 if it's after, and 0 if they're
+// the same instant.
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// LatestRevision returns the Revision most recently applied to the Post
+// indicated by postID.
+func (m *InMemoryStorer) LatestRevision(ctx context.Context, postID string) (Revision, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Revision{}, false, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.posts[postID]; !ok {
+		return Revision{}, false, fmt.Errorf("%w: post %s", ErrNotFound, postID)
+	}
+	history := m.history[postID]
+	if len(history) == 0 {
+		return Revision{}, false, nil
+	}
+	return history[len(history)-1].Clone(), true, nil
+}
+
+// PostsByAuthor returns the Posts by author that match filter, and how many
+// there are without the filter's Limit.
+func (m *InMemoryStorer) PostsByAuthor(ctx context.Context, author string, filter PostFilter) ([]Post, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	filter.Authors = []string{author}
+	filter.AuthorsMode = StringListFilterModeContainsAny
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	posts, err := m.filter(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := len(posts)
+	if filter.Limit > 0 && len(posts) > filter.Limit {
+		posts = posts[:filter.Limit]
+	}
+	for i := range posts {
+		posts[i] = posts[i].Clone()
+	}
+	return posts, total, nil
+}
+
+// ProposeRevision records rev as a proposed change to the Post indicated by
+// postID. If rev has no ID, one is generated.
+func (m *InMemoryStorer) ProposeRevision(ctx context.Context, postID string, rev Revision) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.posts[postID]; !ok {
+		return "", fmt.Errorf("%w: post %s", ErrNotFound, postID)
+	}
+	if rev.ID == "" {
+		id, err := newUUID()
+		if err != nil {
+			return "", err
+		}
+		rev.ID = id
+	}
+	if _, ok := m.proposals[rev.ID]; ok {
+		return "", fmt.Errorf("%w: revision %s", ErrAlreadyExists, rev.ID)
+	}
+	rev.Status = RevisionStatusProposed
+	m.proposals[rev.ID] = proposal{postID: postID, rev: rev.Clone()}
+	return rev.ID, nil
+}
+
+// ApproveRevision approves the proposed Revision indicated by revisionID.
+// Only Revisions that are still proposed can be approved.
+func (m *InMemoryStorer) ApproveRevision(ctx context.Context, revisionID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.review(revisionID, RevisionStatusApproved, RevisionStatusProposed)
+}
+
+// RejectRevision rejects the proposed Revision indicated by revisionID. Only
+// Revisions that haven't been applied can be rejected.
+func (m *InMemoryStorer) RejectRevision(ctx context.Context, revisionID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.review(revisionID, RevisionStatusRejected, RevisionStatusProposed, RevisionStatusApproved)
+}
+
+// review moves the proposed Revision indicated by revisionID to status, as
+// long as it's currently in one of from.
+func (m *InMemoryStorer) review(revisionID string, status RevisionStatus, from ...RevisionStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	proposed, ok := m.proposals[revisionID]
+	if !ok {
+		return fmt.Errorf("%w: revision %s", ErrNotFound, revisionID)
+	}
+	for _, current := range from {
+		if proposed.rev.Status == current {
+			proposed.rev.Status = status
+			m.proposals[revisionID] = proposed
+			return nil
+		}
+	}
+	return fmt.Errorf("revision %s is %s, and can't be %s", revisionID, proposed.rev.Status, status)
+}
+
+// SubscribeRevisions returns a channel that receives every Revision applied
+// to the Post indicated by postID until ctx is canceled. Revisions are
+// queued for slow receivers, so Update never blocks on them. Each receiver
+// gets its own clone of every Revision.
+func (m *InMemoryStorer) SubscribeRevisions(ctx context.Context, postID string) (<-chan Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.posts[postID]; !ok {
+		return nil, fmt.Errorf("%w: post %s", ErrNotFound, postID)
+	}
+	sub := &subscription{
+		wake: make(chan struct{}, 1),
+		out:  make(chan Revision),
+	}
+	m.subscribers[postID] = append(m.subscribers[postID], sub)
+	go func() {
+		sub.run(ctx)
+		m.unsubscribe(postID, sub)
+	}()
+	return sub.out, nil
+}
+
+func (m *InMemoryStorer) unsubscribe(postID string, sub *subscription) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subs := m.subscribers[postID]
+	for pos, candidate := range subs {
+		if candidate == sub {
+			m.subscribers[postID] = append(subs[:pos:pos], subs[pos+1:]...)
+			break
+		}
+	}
+	if len(m.subscribers[postID]) == 0 {
+		delete(m.subscribers, postID)
+	}
+}
+
+// subscription queues the Revisions for a single call to SubscribeRevisions.
+type subscription struct {
+	mu    sync.Mutex
+	queue []Revision
+	wake  chan struct{}
+	out   chan Revision
+}
+
+// send queues rev for delivery without blocking.
+func (s *subscription) send(rev Revision) {
+	s.mu.Lock()
+	s.queue = append(s.queue, rev)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers queued Revisions in order until ctx is canceled, then closes
+// the subscription's channel.
+func (s *subscription) run(ctx context.Context) {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		next := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		select {
+		case s.out <- next:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// MovePostStream moves the Post indicated by postID from fromStream to
+// toStream, recording the change as a Revision.
+func (m *InMemoryStorer) MovePostStream(ctx context.Context, postID, fromStream, toStream string) (Post, error) {
+	if err := ctx.Err(); err != nil {
+		return Post{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.posts[postID]; !ok {
+		return Post{}, fmt.Errorf("%w: post %s", ErrNotFound, postID)
+	}
+	err := m.changeStreams(postID, func(post *Post) error {
+		return post.MoveStream(fromStream, toStream)
+	})
+	if err != nil {
+		return Post{}, err
+	}
+	return m.posts[postID].Clone(), nil
+}
+
+// changeStreams calls change with a copy of the Post indicated by postID, and
+// records the changes it makes as a Revision. The caller must hold m.mu for
+// writing, and the Post must exist.
+func (m *InMemoryStorer) changeStreams(postID string, change func(post *Post) error) error {
+	post := m.posts[postID]
+	changed := post
+	changed.Streams = append([]string(nil), post.Streams...)
+	if err := change(&changed); err != nil {
+		return err
+	}
+	rev, err := GenerateRevision(post, changed)
+	if err != nil {
+		return err
+	}
+	rev.ID, err = newUUID()
+	if err != nil {
+		return err
+	}
+	return m.apply(postID, rev)
+}
+
+// CreateStream stores stream. It returns an error if stream has no ID, or an
+// error wrapping ErrAlreadyExists if a Stream with the same ID has already
+// been created.
+func (m *InMemoryStorer) CreateStream(ctx context.Context, stream Stream) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if stream.ID == "" {
+		return errors.New("stream ID must be set")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.streams[stream.ID]; ok {
+		return fmt.Errorf("%w: stream %s", ErrAlreadyExists, stream.ID)
+	}
+	m.streams[stream.ID] = stream
+	return nil
+}
+
+// GetStream returns the Stream indicated by id, or an error wrapping
+// ErrNotFound if there isn't one.
+func (m *InMemoryStorer) GetStream(ctx context.Context, id string) (Stream, error) {
+	if err := ctx.Err(); err != nil {
+		return Stream{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stream, ok := m.streams[id]
+	if !ok {
+		return Stream{}, fmt.Errorf("%w: stream %s", ErrNotFound, id)
+	}
+	return stream, nil
+}
+
+// UpdateStream replaces the Stream with the same ID as stream.
+func (m *InMemoryStorer) UpdateStream(ctx context.Context, stream Stream) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.streams[stream.ID]; !ok {
+		return fmt.Errorf("%w: stream %s", ErrNotFound, stream.ID)
+	}
+	m.streams[stream.ID] = stream
+	return nil
+}
+
+// DeleteStream deletes the Stream indicated by id, refusing to if any Posts
+// are still in it or removing it from them first, depending on mode.
+func (m *InMemoryStorer) DeleteStream(ctx context.Context, id string, mode DeleteStreamMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if mode != DeleteStreamModeRefuse && mode != DeleteStreamModeCascade {
+		return fmt.Errorf("unknown delete stream mode %q", mode)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.streams[id]; !ok {
+		return fmt.Errorf("%w: stream %s", ErrNotFound, id)
+	}
+	var members []string
+	for postID, post := range m.posts {
+		if inStream(post, id) {
+			members = append(members, postID)
+		}
+	}
+	sort.Strings(members)
+	if len(members) > 0 && mode == DeleteStreamModeRefuse {
+		return fmt.Errorf("%w: stream %s has %d posts", ErrStreamNotEmpty, id, len(members))
+	}
+	for _, postID := range members {
+		if err := m.changeStreams(postID, func(post *Post) error { return removeStream(post, id) }); err != nil {
+			return fmt.Errorf("error removing post %s from stream %s: %w", postID, id, err)
+		}
+	}
+	delete(m.streams, id)
+	return nil
+}
+
+// ListStreams returns every Stream, sorted by their Title, then by their ID.
+func (m *InMemoryStorer) ListStreams(ctx context.Context) ([]Stream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	streams := make([]Stream, 0, len(m.streams))
+	for _, stream := range m.streams {
+		streams = append(streams, stream)
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		if streams[i].Title != streams[j].Title {
+			return streams[i].Title < streams[j].Title
+		}
+		return streams[i].ID < streams[j].ID
+	})
+	return streams, nil
+}
+
+// AddPostToStream adds the Stream indicated by streamID to the end of the
+// Streams of the Post indicated by postID, recording the change as a
+// Revision.
+func (m *InMemoryStorer) AddPostToStream(ctx context.Context, postID, streamID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	post, ok := m.posts[postID]
+	if !ok {
+		return fmt.Errorf("%w: post %s", ErrNotFound, postID)
+	}
+	if _, ok := m.streams[streamID]; !ok {
+		return fmt.Errorf("%w: stream %s", ErrNotFound, streamID)
+	}
+	if inStream(post, streamID) {
+		return nil
+	}
+	return m.changeStreams(postID, func(post *Post) error {
+		post.Streams = append(post.Streams, streamID)
+		return nil
+	})
+}
+
+// RemovePostFromStream removes the Stream indicated by streamID from the
+// Streams of the Post indicated by postID, recording the change as a
+// Revision. The Stream doesn't need to exist, so Posts can be removed from
+// Streams that were deleted some other way.
+func (m *InMemoryStorer) RemovePostFromStream(ctx context.Context, postID, streamID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.posts[postID]; !ok {
+		return fmt.Errorf("%w: post %s", ErrNotFound, postID)
+	}
+	return m.changeStreams(postID, func(post *Post) error { return removeStream(post, streamID) })
+}
+
+// inStream returns true if post is in the Stream indicated by streamID.
+func inStream(post Post, streamID string) bool {
+	for _, stream := range post.Streams {
+		if stream == streamID {
+			return true
+		}
+	}
+	return false
+}
+
+// removeStream removes the Stream indicated by streamID from post's Streams,
+// returning an error wrapping ErrPostNotInStream if post isn't in it.
+func removeStream(post *Post, streamID string) error {
+	streams := make([]string, 0, len(post.Streams))
+	for _, stream := range post.Streams {
+		if stream != streamID {
+			streams = append(streams, stream)
+		}
+	}
+	if len(streams) == len(post.Streams) {
+		return fmt.Errorf("%w: post %s is not in stream %s", ErrPostNotInStream, post.ID, streamID)
+	}
+	post.Streams = streams
+	return nil
+}
+
+// Query returns the Posts matching filter that MatchQuery finds q in, best
+// match first.
+func (m *InMemoryStorer) Query(ctx context.Context, q string, filter PostFilter) ([]QueryResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	posts, err := m.filter(filter)
+	if err != nil {
+		return nil, err
+	}
+	var results []QueryResult
+	for _, post := range posts {
+		if result, ok := MatchQuery(post, q); ok {
+			result.Post = result.Post.Clone()
+			results = append(results, result)
+		}
+	}
+	SortQueryResults(results)
+	if filter.Limit > 0 && len(results) > filter.Limit {
+		results = results[:filter.Limit]
+	}
+	return results, nil
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", fmt.Errorf("error generating ID: %w", err)
+	}
+	id[6] = (id[6] & 0x0f) | 0x40 // version 4
+	id[8] = (id[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16]), nil
+}
+
+// InMemoryEventStorer is an EventStorer that keeps everything in memory, for
+// use in tests and local development. It's safe for concurrent use. Use
+// NewInMemoryEventStorer to create one.
+type InMemoryEventStorer struct {
+	mu     sync.RWMutex
+	ids    map[string]struct{}
+	events map[string][]PostEvent
+}
+
+var _ EventStorer = (*InMemoryEventStorer)(nil)
+
+// NewInMemoryEventStorer returns an empty InMemoryEventStorer.
+func NewInMemoryEventStorer() *InMemoryEventStorer {
+	return &InMemoryEventStorer{
+		ids:    map[string]struct{}{},
+		events: map[string][]PostEvent{},
+	}
+}
+
+// RecordEvent stores event. It returns an error if event has no ID or PostID,
+// or an error wrapping ErrAlreadyExists if an event with the same ID has
+// already been recorded.
+func (m *InMemoryEventStorer) RecordEvent(_ context.Context, event PostEvent) error {
+	if event.ID == "" {
+		return errors.New("event ID must be set")
+	}
+	if event.PostID == "" {
+		return errors.New("event post ID must be set")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.ids[event.ID]; ok {
+		return fmt.Errorf("%w: event %s", ErrAlreadyExists, event.ID)
+	}
+	m.ids[event.ID] = struct{}{}
+	m.events[event.PostID] = append(m.events[event.PostID], event)
+	return nil
+}
+
+// ListEvents returns the events recorded for the Post indicated by postID
+// that match filter, most recent first. Events with the same Timestamp are
+// sorted by ID.
+func (m *InMemoryEventStorer) ListEvents(_ context.Context, postID string, filter EventFilter) ([]PostEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	events, ok := m.events[postID]
+	if !ok {
+		return nil, fmt.Errorf("%w: post %s", ErrEventNotFound, postID)
+	}
+	results := []PostEvent{}
+	for _, event := range events {
+		if filter.Matches(event) {
+			results = append(results, event)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].Timestamp.Equal(results[j].Timestamp) {
+			return results[i].Timestamp.After(results[j].Timestamp)
+		}
+		return results[i].ID < results[j].ID
+	})
+	return results, nil
+}
+
+// InMemoryBlobStore is a BlobStore that keeps everything in memory, for use
+// in tests and local development. It's safe for concurrent use. Use
+// NewInMemoryBlobStore to create one.
+type InMemoryBlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+var _ BlobStore = (*InMemoryBlobStore)(nil)
+
+// NewInMemoryBlobStore returns an empty InMemoryBlobStore.
+func NewInMemoryBlobStore() *InMemoryBlobStore {
+	return &InMemoryBlobStore{
+		blobs: map[string][]byte{},
+	}
+}
+
+// Put reads all of body and stores it under sha256, as long as it's the SHA
+// 256 sum of body.
+func (m *InMemoryBlobStore) Put(_ context.Context, sha256 string, body io.Reader) error {
+	contents, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("error reading body: %w", err)
+	}
+	if sum := sha256Hex(contents); sum != sha256 {
+		return fmt.Errorf("%w: body stored as %q has SHA256 %q", ErrSHA256Mismatch, sha256, sum)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.blobs[sha256]; !ok {
+		m.blobs[sha256] = contents
+	}
+	return nil
+}
+
+// Get returns the body stored under sha256.
+func (m *InMemoryBlobStore) Get(_ context.Context, sha256 string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	contents, ok := m.blobs[sha256]
+	if !ok {
+		return nil, fmt.Errorf("%w: blob %s", ErrNotFound, sha256)
+	}
+	return io.NopCloser(bytes.NewReader(contents)), nil
+}
+
+// Exists returns true if a body is stored under sha256.
+func (m *InMemoryBlobStore) Exists(_ context.Context, sha256 string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.blobs[sha256]
+	return ok, nil
+}
+
+// Delete removes the body stored under sha256, if there is one.
+func (m *InMemoryBlobStore) Delete(_ context.Context, sha256 string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blobs, sha256)
+	return nil
+}
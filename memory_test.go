@@ -0,0 +1,1452 @@
+package posts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInMemoryStorerCreate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryStorer()
+	if err := storer.Create(ctx, Post{}); !errors.Is(err, ErrInvalidPost) {
+		t.Errorf("expected ErrInvalidPost creating a post without an ID, got %v", err)
+	}
+	post := Post{ID: "post", Title: "Hello"}
+	if err := storer.Create(ctx, post); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+	if err := storer.Create(ctx, post); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists creating a duplicate post, got %v", err)
+	}
+	got, err := storer.Get(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error getting post: %s", err)
+	}
+	if !reflect.DeepEqual(got, post) {
+		t.Errorf("expected %+v, got %+v", post, got)
+	}
+	if _, err := storer.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound getting a missing post, got %v", err)
+	}
+}
+
+func TestInMemoryStorerUpdate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryStorer()
+	post := Post{ID: "post", Title: "Hello", Parts: []Part{inlinePart("a", 0, "one")}}
+	if err := storer.Create(ctx, post); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+	if _, ok, err := storer.LatestRevision(ctx, "post"); err != nil || ok {
+		t.Errorf("expected no latest revision, got %v, %v", ok, err)
+	}
+
+	updated := Post{ID: "post", Title: "Hello!", Parts: []Part{inlinePart("a", 0, "one"), inlinePart("b", 1, "two")}}
+	rev, err := GenerateRevision(post, updated)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	rev.ID = "rev"
+
+	// applying it twice should be the same as applying it once
+	for i := 0; i < 2; i++ {
+		if err := storer.Update(ctx, "post", 0, rev); err != nil {
+			t.Fatalf("unexpected error updating post: %s", err)
+		}
+	}
+	updated.Version = 1
+	got, err := storer.Get(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error getting post: %s", err)
+	}
+	if !reflect.DeepEqual(got, updated) {
+		t.Errorf("expected %+v, got %+v", updated, got)
+	}
+	latest, ok, err := storer.LatestRevision(ctx, "post")
+	if err != nil || !ok {
+		t.Fatalf("expected a latest revision, got %v, %v", ok, err)
+	}
+	if latest.ID != "rev" {
+		t.Errorf("expected latest revision to be %q, got %q", "rev", latest.ID)
+	}
+
+	if err := storer.Update(ctx, "post", 1, Revision{TitleDelta: "=100"}); !errors.Is(err, ErrRevisionMismatch) {
+		t.Errorf("expected ErrRevisionMismatch, got %v", err)
+	}
+	if err := storer.Update(ctx, "missing", 0, rev); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestInMemoryStorerUpdateClonesRevision(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryStorer()
+	post := Post{ID: "post", Parts: []Part{inlinePart("a", 0, "one")}}
+	if err := storer.Create(ctx, post); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+	rev, err := GenerateRevision(post, Post{ID: "post", Parts: []Part{inlinePart("a", 0, "one"), inlinePart("b", 1, "two")}})
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	rev.ID = "rev"
+	want := rev.Clone()
+	if err := storer.Update(ctx, "post", 0, rev); err != nil {
+		t.Fatalf("unexpected error updating post: %s", err)
+	}
+
+	// changing the caller's revision afterwards shouldn't change the one
+	// that was recorded.
+	rev.PartsDeltas[0].PartID = "changed"
+	rev.PartsDeltas[0].Body = "+changed"
+
+	latest, ok, err := storer.LatestRevision(ctx, "post")
+	if err != nil || !ok {
+		t.Fatalf("expected a latest revision, got %v, %v", ok, err)
+	}
+	if !reflect.DeepEqual(latest, want) {
+		t.Errorf("expected %+v, got %+v", want, latest)
+	}
+}
+
+func TestInMemoryStorerLatestRevisionClone(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryStorer()
+	post := Post{ID: "post", Parts: []Part{inlinePart("a", 0, "one")}}
+	if err := storer.Create(ctx, post); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+	updated := Post{ID: "post", Parts: []Part{inlinePart("a", 0, "one")}}
+	updated.Parts[0].Headers = map[string][]string{"Content-Type": {"text/plain"}}
+	rev, err := GenerateRevision(post, updated)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	if err := storer.Update(ctx, "post", 0, rev); err != nil {
+		t.Fatalf("unexpected error updating post: %s", err)
+	}
+
+	first, ok, err := storer.LatestRevision(ctx, "post")
+	if err != nil || !ok {
+		t.Fatalf("expected a latest revision, got %v, %v", ok, err)
+	}
+	want := first.Clone()
+	first.PartsDeltas[0].PartID = "changed"
+	first.PartsDeltas[0].Headers["Content-Type"][0].Value = "+changed"
+	first.PartsDeltas[0].Headers["X-Tag"] = nil
+
+	second, ok, err := storer.LatestRevision(ctx, "post")
+	if err != nil || !ok {
+		t.Fatalf("expected a latest revision, got %v, %v", ok, err)
+	}
+	if !reflect.DeepEqual(second, want) {
+		t.Errorf("expected modifying the returned revision to leave the stored one unchanged\n%+v\ngot\n%+v", want, second)
+	}
+}
+
+func TestInMemoryStorerApproval(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryStorer()
+	storer.RequireApproval = true
+	post := Post{ID: "post", Title: "Hello"}
+	if err := storer.Create(ctx, post); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+	rev, err := GenerateRevision(post, Post{ID: "post", Title: "Goodbye"})
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+
+	if err := storer.Update(ctx, "post", 0, rev); !errors.Is(err, ErrRevisionNotApproved) {
+		t.Errorf("expected ErrRevisionNotApproved for an unproposed revision, got %v", err)
+	}
+	id, err := storer.ProposeRevision(ctx, "post", rev)
+	if err != nil {
+		t.Fatalf("unexpected error proposing revision: %s", err)
+	}
+	rev.ID = id
+	if err := storer.Update(ctx, "post", 0, rev); !errors.Is(err, ErrRevisionNotApproved) {
+		t.Errorf("expected ErrRevisionNotApproved for a proposed revision, got %v", err)
+	}
+	if err := storer.ApproveRevision(ctx, id); err != nil {
+		t.Fatalf("unexpected error approving revision: %s", err)
+	}
+	if err := storer.Update(ctx, "post", 0, rev); err != nil {
+		t.Fatalf("unexpected error applying approved revision: %s", err)
+	}
+	latest, _, err := storer.LatestRevision(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error getting latest revision: %s", err)
+	}
+	if latest.Status != RevisionStatusApplied {
+		t.Errorf("expected applied revision to have status %q, got %q", RevisionStatusApplied, latest.Status)
+	}
+	if err := storer.RejectRevision(ctx, id); err == nil {
+		t.Errorf("expected an error rejecting an applied revision")
+	}
+
+	rejected, err := storer.ProposeRevision(ctx, "post", Revision{TitleDelta: "-7\t+Hi"})
+	if err != nil {
+		t.Fatalf("unexpected error proposing revision: %s", err)
+	}
+	if err := storer.RejectRevision(ctx, rejected); err != nil {
+		t.Fatalf("unexpected error rejecting revision: %s", err)
+	}
+	if err := storer.ApproveRevision(ctx, rejected); err == nil {
+		t.Errorf("expected an error approving a rejected revision")
+	}
+	if err := storer.Update(ctx, "post", 1, Revision{ID: rejected}); !errors.Is(err, ErrRevisionNotApproved) {
+		t.Errorf("expected ErrRevisionNotApproved for a rejected revision, got %v", err)
+	}
+}
+
+func TestInMemoryStorerDelete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryStorer()
+	if err := storer.Create(ctx, Post{ID: "post", Title: "Hello"}); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+	deleted, err := storer.Delete(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error deleting post: %s", err)
+	}
+	if !deleted.Deleted || deleted.Title != "Hello" {
+		t.Errorf("expected the deleted post to be returned, got %+v", deleted)
+	}
+	deleted.Title = "Changed"
+	post, err := storer.Get(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error getting deleted post: %s", err)
+	}
+	if !post.Deleted {
+		t.Errorf("expected post to be marked deleted")
+	}
+	if post.Title != "Hello" {
+		t.Errorf("expected changing the returned post not to change the stored post, got title %q", post.Title)
+	}
+	again, err := storer.Delete(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error deleting post again: %s", err)
+	}
+	if !reflect.DeepEqual(again, post) {
+		t.Errorf("expected deleting a deleted post to return it unchanged, got %+v", again)
+	}
+	posts, err := storer.List(ctx, PostFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error listing posts: %s", err)
+	}
+	if len(posts) != 0 {
+		t.Errorf("expected deleted post not to be listed, got %+v", posts)
+	}
+	if _, err := storer.Delete(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := storer.Create(ctx, Post{ID: "post"}); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists creating a post with a deleted post's ID, got %v", err)
+	}
+}
+
+func TestInMemoryStorerRestore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryStorer()
+	for _, post := range []Post{{ID: "deleted", Title: "Deleted"}, {ID: "live"}} {
+		if err := storer.Create(ctx, post); err != nil {
+			t.Fatalf("unexpected error creating post: %s", err)
+		}
+	}
+	if _, err := storer.Delete(ctx, "deleted"); err != nil {
+		t.Fatalf("unexpected error deleting post: %s", err)
+	}
+
+	post, err := storer.Restore(ctx, "deleted")
+	if err != nil {
+		t.Fatalf("unexpected error restoring post: %s", err)
+	}
+	if post.Deleted || post.Title != "Deleted" {
+		t.Errorf("expected the restored post, got %+v", post)
+	}
+	posts, err := storer.List(ctx, PostFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error listing posts: %s", err)
+	}
+	if len(posts) != 2 {
+		t.Errorf("expected restored post to be listed, got %+v", posts)
+	}
+
+	if _, err := storer.Restore(ctx, "live"); !errors.Is(err, ErrNotDeleted) {
+		t.Errorf("expected ErrNotDeleted restoring a live post, got %v", err)
+	}
+	if _, err := storer.Restore(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound restoring a missing post, got %v", err)
+	}
+}
+
+func TestInMemoryStorerPublish(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	first := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	now := first
+	storer := NewInMemoryStorer()
+	storer.now = func() time.Time { return now }
+	scheduledFor := first.Add(time.Hour)
+	if err := storer.Create(ctx, Post{ID: "post", Draft: true, ScheduledFor: &scheduledFor}); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+
+	// publishing a draft for the first time sets PublishedAt.
+	post, err := storer.Publish(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error publishing post: %s", err)
+	}
+	if post.Draft || post.ScheduledFor != nil || !post.PublishedAt.Equal(first) {
+		t.Errorf("expected post published at %s, got %+v", first, post)
+	}
+
+	// publishing a published post changes nothing.
+	now = first.Add(time.Hour)
+	post, err = storer.Publish(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error publishing published post: %s", err)
+	}
+	if post.Draft || !post.PublishedAt.Equal(first) || post.Version != 1 {
+		t.Errorf("expected post to still be published at %s at version 1, got %+v", first, post)
+	}
+
+	post, err = storer.Unpublish(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error unpublishing post: %s", err)
+	}
+	if !post.Draft || !post.PublishedAt.Equal(first) {
+		t.Errorf("expected a draft still published at %s, got %+v", first, post)
+	}
+	post, err = storer.Unpublish(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error unpublishing draft: %s", err)
+	}
+	if !post.Draft || post.Version != 2 {
+		t.Errorf("expected post to still be a draft at version 2, got %+v", post)
+	}
+
+	// republishing keeps the original PublishedAt, unless asked not to.
+	post, err = storer.Publish(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error republishing post: %s", err)
+	}
+	if post.Draft || !post.PublishedAt.Equal(first) {
+		t.Errorf("expected post republished with PublishedAt %s, got %+v", first, post)
+	}
+	if _, err := storer.Unpublish(ctx, "post"); err != nil {
+		t.Fatalf("unexpected error unpublishing post: %s", err)
+	}
+	post, err = storer.Publish(ctx, "post", RefreshPublishedAt())
+	if err != nil {
+		t.Fatalf("unexpected error republishing post: %s", err)
+	}
+	if post.Draft || !post.PublishedAt.Equal(now) {
+		t.Errorf("expected post republished with PublishedAt %s, got %+v", now, post)
+	}
+
+	stored, err := storer.Get(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error getting post: %s", err)
+	}
+	if !reflect.DeepEqual(stored, post) {
+		t.Errorf("expected stored post to be\n%+v\ngot\n%+v", post, stored)
+	}
+
+	if _, err := storer.Publish(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound publishing a missing post, got %v", err)
+	}
+	if _, err := storer.Unpublish(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound unpublishing a missing post, got %v", err)
+	}
+}
+
+func TestInMemoryStorerDeletePermanently(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryStorer()
+	blobs := NewInMemoryBlobStore()
+	sums := map[string]string{}
+	for _, body := range []string{"old", "new", "shared", "forced"} {
+		sums[body] = sha256Hex([]byte(body))
+		if err := blobs.Put(ctx, sums[body], strings.NewReader(body)); err != nil {
+			t.Fatalf("unexpected error putting blob: %s", err)
+		}
+	}
+	post := Post{ID: "post", Parts: []Part{
+		{ID: "image", Position: 0, SHA256: sums["old"]},
+		{ID: "shared", Position: 1, SHA256: sums["shared"]},
+	}}
+	posts := []Post{
+		post,
+		{ID: "other", Parts: []Part{{ID: "shared", SHA256: sums["shared"]}}},
+		{ID: "forced", Parts: []Part{{ID: "image", SHA256: sums["forced"]}}},
+	}
+	for _, post := range posts {
+		if err := storer.Create(ctx, post); err != nil {
+			t.Fatalf("unexpected error creating post: %s", err)
+		}
+	}
+	// the old body is only in the post's history once it's updated, and
+	// should be removed along with the current one.
+	updated := post.Clone()
+	updated.Parts[0].SHA256 = sums["new"]
+	rev, err := GenerateRevision(post, updated)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	if err := storer.Update(ctx, post.ID, 0, rev); err != nil {
+		t.Fatalf("unexpected error updating post: %s", err)
+	}
+
+	if err := storer.DeletePermanently(ctx, post.ID, blobs); !errors.Is(err, ErrNotDeleted) {
+		t.Fatalf("expected ErrNotDeleted permanently deleting a live post, got %v", err)
+	}
+	if _, err := storer.Get(ctx, post.ID); err != nil {
+		t.Fatalf("expected refusing to delete the post to leave it, got %v", err)
+	}
+	if exists, err := blobs.Exists(ctx, sums["new"]); err != nil || !exists {
+		t.Fatalf("expected refusing to delete the post to leave its blobs, got %v, %v", exists, err)
+	}
+
+	if _, err := storer.Delete(ctx, post.ID); err != nil {
+		t.Fatalf("unexpected error deleting post: %s", err)
+	}
+	if err := storer.DeletePermanently(ctx, post.ID, blobs); err != nil {
+		t.Fatalf("unexpected error permanently deleting post: %s", err)
+	}
+	if _, err := storer.Get(ctx, post.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound getting permanently deleted post, got %v", err)
+	}
+	if _, _, err := storer.LatestRevision(ctx, post.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound getting revisions of permanently deleted post, got %v", err)
+	}
+	deleted := true
+	listed, err := storer.List(ctx, PostFilter{Deleted: &deleted})
+	if err != nil {
+		t.Fatalf("unexpected error listing deleted posts: %s", err)
+	}
+	if len(listed) != 0 {
+		t.Errorf("expected permanently deleted post not to be listed, got %+v", listed)
+	}
+	for body, want := range map[string]bool{"old": false, "new": false, "shared": true, "forced": true} {
+		if exists, err := blobs.Exists(ctx, sums[body]); err != nil || exists != want {
+			t.Errorf("expected blob %q to exist to be %t, got %t, %v", body, want, exists, err)
+		}
+	}
+	if err := storer.DeletePermanently(ctx, post.ID, blobs); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound permanently deleting a missing post, got %v", err)
+	}
+
+	if err := storer.DeletePermanently(ctx, "forced", blobs, ForceDelete()); err != nil {
+		t.Fatalf("unexpected error forcing permanent deletion: %s", err)
+	}
+	if _, err := storer.Get(ctx, "forced"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound getting forcibly deleted post, got %v", err)
+	}
+	if exists, err := blobs.Exists(ctx, sums["forced"]); err != nil || exists {
+		t.Errorf("expected forcibly deleted post's blob to be removed, got %t, %v", exists, err)
+	}
+}
+
+func TestInMemoryStorerCanceled(t *testing.T) {
+	t.Parallel()
+
+	storer := NewInMemoryStorer()
+	if err := storer.Create(context.Background(), Post{ID: "post"}); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := map[string]func() error{
+		"create": func() error { return storer.Create(ctx, Post{ID: "new"}) },
+		"update": func() error { return storer.Update(ctx, "post", 0, Revision{ID: "rev", TitleDelta: "+Hello"}) },
+		"delete": func() error {
+			_, err := storer.Delete(ctx, "post")
+			return err
+		},
+		"delete-permanently": func() error {
+			return storer.DeletePermanently(ctx, "post", NewInMemoryBlobStore(), ForceDelete())
+		},
+		"get": func() error {
+			_, err := storer.Get(ctx, "post")
+			return err
+		},
+		"list": func() error {
+			_, err := storer.List(ctx, PostFilter{})
+			return err
+		},
+		"count": func() error {
+			_, err := storer.Count(ctx, PostFilter{})
+			return err
+		},
+		"unpublish": func() error {
+			_, err := storer.Unpublish(ctx, "post")
+			return err
+		},
+		"move-post-stream": func() error {
+			_, err := storer.MovePostStream(ctx, "post", "a", "b")
+			return err
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := test(); !errors.Is(err, context.Canceled) {
+				t.Errorf("expected context.Canceled, got %v", err)
+			}
+		})
+	}
+
+	// none of the canceled calls should have changed anything.
+	t.Cleanup(func() {
+		post, err := storer.Get(context.Background(), "post")
+		if err != nil {
+			t.Fatalf("unexpected error getting post: %s", err)
+		}
+		if !reflect.DeepEqual(post, Post{ID: "post"}) {
+			t.Errorf("expected post to be unchanged, got %+v", post)
+		}
+		if _, err := storer.Get(context.Background(), "new"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected canceled create not to create a post, got %v", err)
+		}
+	})
+}
+
+func TestInMemoryStorerGetMany(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryStorer()
+	for _, id := range []string{"a", "b", "c"} {
+		if err := storer.Create(ctx, Post{ID: id, Title: "Post " + id}); err != nil {
+			t.Fatalf("unexpected error creating post: %s", err)
+		}
+	}
+
+	tests := map[string]struct {
+		ids  []string
+		want []string
+	}{
+		"none":       {ids: nil, want: nil},
+		"existing":   {ids: []string{"a", "c"}, want: []string{"a", "c"}},
+		"missing":    {ids: []string{"x", "y"}, want: nil},
+		"mixed":      {ids: []string{"a", "x", "b"}, want: []string{"a", "b"}},
+		"duplicates": {ids: []string{"b", "b", "x", "x", "c", "b"}, want: []string{"b", "c"}},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			posts, err := storer.GetMany(ctx, test.ids)
+			if err != nil {
+				t.Fatalf("unexpected error getting posts: %s", err)
+			}
+			if len(posts) != len(test.want) {
+				t.Errorf("expected %d posts, got %+v", len(test.want), posts)
+			}
+			for _, id := range test.want {
+				post, ok := posts[id]
+				if !ok {
+					t.Errorf("expected post %s, got %+v", id, posts)
+					continue
+				}
+				if post.ID != id || post.Title != "Post "+id {
+					t.Errorf("expected post %s under its ID, got %+v", id, post)
+				}
+			}
+		})
+	}
+}
+
+func TestInMemoryStorerList(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	base := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	future := base.Add(24 * time.Hour)
+	storer := NewInMemoryStorer()
+	storer.now = func() time.Time { return base }
+	for _, post := range []Post{
+		{ID: "a", Slug: "a", Title: "Hello World", Authors: []string{"alice", "bob"}, Streams: []string{"blog"}, PublishedAt: base.Add(time.Hour)},
+		{ID: "b", Slug: "b", Title: "Goodbye, world", Authors: []string{"bob", "alice"}, Streams: []string{"blog", "tech"}, PublishedAt: base.Add(2 * time.Hour)},
+		{ID: "c", Slug: "c", Authors: []string{"carol"}, Streams: []string{"tech"}, PublishedAt: base.Add(3 * time.Hour)},
+		{ID: "d", Slug: "d", Authors: []string{"alice"}, Draft: true, ScheduledFor: &future},
+		{ID: "e", Slug: "e", Title: "Deleted Post", Authors: []string{"alice"}, PublishedAt: base.Add(4 * time.Hour)},
+	} {
+		if err := storer.Create(ctx, post); err != nil {
+			t.Fatalf("unexpected error creating post: %s", err)
+		}
+	}
+	if _, err := storer.Delete(ctx, "e"); err != nil {
+		t.Fatalf("unexpected error deleting post: %s", err)
+	}
+
+	slug := "b"
+	draft := true
+	deleted := true
+	live := false
+	title := "WORLD"
+	deletedTitle := "post"
+	scheduled := true
+	before := base.Add(3 * time.Hour)
+	after := base.Add(time.Hour)
+
+	tests := map[string]struct {
+		filter  PostFilter
+		want    []string
+		wantErr bool
+	}{
+		"empty":            {filter: PostFilter{}, want: []string{"c", "b", "a", "d"}},
+		"slug":             {filter: PostFilter{Slug: &slug}, want: []string{"b"}},
+		"published-before": {filter: PostFilter{PublishedBefore: &before}, want: []string{"b", "a", "d"}},
+		"published-after":  {filter: PostFilter{PublishedAfter: &after}, want: []string{"c", "b"}},
+		"draft":            {filter: PostFilter{Draft: &draft}, want: []string{"d"}},
+		"scheduled":        {filter: PostFilter{Scheduled: &scheduled}, want: []string{"d"}},
+		"limit":            {filter: PostFilter{Limit: 2}, want: []string{"c", "b"}},
+		"deleted":          {filter: PostFilter{Deleted: &deleted}, want: []string{"e"}},
+		"live":             {filter: PostFilter{Deleted: &live}, want: []string{"c", "b", "a", "d"}},
+		"title-contains":   {filter: PostFilter{TitleContains: &title}, want: []string{"b", "a"}},
+		"deleted-title":    {filter: PostFilter{TitleContains: &deletedTitle}, want: nil},
+		"deleted-and-title": {
+			filter: PostFilter{Deleted: &deleted, TitleContains: &deletedTitle},
+			want:   []string{"e"},
+		},
+		"published-before-inclusive": {
+			filter: PostFilter{PublishedBefore: &before, PublishedBeforeInclusive: true},
+			want:   []string{"c", "b", "a", "d"},
+		},
+		"published-after-inclusive": {
+			filter: PostFilter{PublishedAfter: &after, PublishedAfterInclusive: true},
+			want:   []string{"c", "b", "a"},
+		},
+		"authors-exact": {
+			filter: PostFilter{Authors: []string{"alice", "bob"}, AuthorsMode: StringListFilterModeExact},
+			want:   []string{"a"},
+		},
+		"authors-exact-unordered": {
+			filter: PostFilter{Authors: []string{"alice", "bob"}, AuthorsMode: StringListFilterModeExactUnordered},
+			want:   []string{"b", "a"},
+		},
+		"authors-contains-all": {
+			filter: PostFilter{Authors: []string{"alice"}, AuthorsMode: StringListFilterModeContainsAll},
+			want:   []string{"b", "a", "d"},
+		},
+		"authors-contains-any": {
+			filter: PostFilter{Authors: []string{"bob", "carol"}, AuthorsMode: StringListFilterModeContainsAny},
+			want:   []string{"c", "b", "a"},
+		},
+		"authors-excludes": {
+			filter: PostFilter{Authors: []string{"bob"}, AuthorsMode: StringListFilterModeExcludes},
+			want:   []string{"c", "d"},
+		},
+		"streams-contains-all": {
+			filter: PostFilter{Streams: []string{"blog", "tech"}, StreamsMode: StringListFilterModeContainsAll},
+			want:   []string{"b"},
+		},
+		"streams-excludes": {
+			filter: PostFilter{Streams: []string{"blog"}, StreamsMode: StringListFilterModeExcludes},
+			want:   []string{"c", "d"},
+		},
+		"invalid-mode": {
+			filter:  PostFilter{Streams: []string{"blog"}},
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			posts, err := storer.List(ctx, test.filter)
+			count, countErr := storer.Count(ctx, test.filter)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", posts)
+				}
+				if countErr == nil {
+					t.Errorf("expected an error counting, got %d", count)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error listing posts: %s", err)
+			}
+			if countErr != nil {
+				t.Fatalf("unexpected error counting posts: %s", countErr)
+			}
+			var got []string
+			for _, post := range posts {
+				got = append(got, post.ID)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+
+			unpaginated := test.filter
+			unpaginated.Limit = 0
+			all, err := storer.List(ctx, unpaginated)
+			if err != nil {
+				t.Fatalf("unexpected error listing unpaginated posts: %s", err)
+			}
+			if count != len(all) {
+				t.Errorf("expected count %d, got %d", len(all), count)
+			}
+		})
+	}
+
+	posts, total, err := storer.PostsByAuthor(ctx, "alice", PostFilter{Limit: 1})
+	if err != nil {
+		t.Fatalf("unexpected error listing posts by author: %s", err)
+	}
+	if len(posts) != 1 || posts[0].ID != "b" || total != 3 {
+		t.Errorf("expected post b out of 3, got %+v out of %d", posts, total)
+	}
+}
+
+func TestInMemoryStorerListScheduled(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	storer := NewInMemoryStorer()
+	storer.now = func() time.Time { return now }
+	for _, post := range []Post{
+		{ID: "pending", Draft: true, ScheduledFor: &future},
+		{ID: "past-due", Draft: true, ScheduledFor: &past},
+		{ID: "due-now", Draft: true, ScheduledFor: &now},
+		{ID: "unscheduled", Draft: true},
+		{ID: "published", ScheduledFor: &future, PublishedAt: past},
+	} {
+		if err := storer.Create(ctx, post); err != nil {
+			t.Fatalf("unexpected error creating post: %s", err)
+		}
+	}
+
+	yes, no := true, false
+	tests := map[string]struct {
+		filter PostFilter
+		want   []string
+	}{
+		"scheduled": {
+			filter: PostFilter{Scheduled: &yes},
+			want:   []string{"pending"},
+		},
+		// drafts that are due, or were never scheduled, aren't
+		// scheduled.
+		"not-scheduled": {
+			filter: PostFilter{Scheduled: &no},
+			want:   []string{"published", "due-now", "past-due", "unscheduled"},
+		},
+		"scheduled-drafts": {
+			filter: PostFilter{Scheduled: &yes, Draft: &yes},
+			want:   []string{"pending"},
+		},
+		"unscheduled-drafts": {
+			filter: PostFilter{Scheduled: &no, Draft: &yes},
+			want:   []string{"due-now", "past-due", "unscheduled"},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			posts, err := storer.List(ctx, test.filter)
+			if err != nil {
+				t.Fatalf("unexpected error listing posts: %s", err)
+			}
+			var got []string
+			for _, post := range posts {
+				got = append(got, post.ID)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestInMemoryStorerListOrder(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	base := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	storer := NewInMemoryStorer()
+	for _, post := range []Post{
+		{ID: "a", Title: "banana", Slug: "zebra", PublishedAt: base.Add(2 * time.Hour)},
+		{ID: "b", Title: "Apple", Slug: "yak", PublishedAt: base.Add(time.Hour)},
+		{ID: "c", Title: "cherry", Slug: "xerus", PublishedAt: base.Add(3 * time.Hour)},
+		{ID: "d", Title: "apple", Slug: "yak", PublishedAt: base.Add(time.Hour)},
+	} {
+		if err := storer.Create(ctx, post); err != nil {
+			t.Fatalf("unexpected error creating post: %s", err)
+		}
+	}
+
+	tests := map[string]struct {
+		filter  PostFilter
+		want    []string
+		wantErr bool
+	}{
+		"default":                    {filter: PostFilter{}, want: []string{"c", "a", "b", "d"}},
+		"default-ignores-descending": {filter: PostFilter{Descending: true}, want: []string{"c", "a", "b", "d"}},
+		"published-at-ascending":     {filter: PostFilter{OrderBy: PostOrderFieldPublishedAt}, want: []string{"b", "d", "a", "c"}},
+		"published-at-descending":    {filter: PostFilter{OrderBy: PostOrderFieldPublishedAt, Descending: true}, want: []string{"c", "a", "b", "d"}},
+		"title-ascending":            {filter: PostFilter{OrderBy: PostOrderFieldTitle}, want: []string{"b", "d", "a", "c"}},
+		"title-descending":           {filter: PostFilter{OrderBy: PostOrderFieldTitle, Descending: true}, want: []string{"c", "a", "b", "d"}},
+		"slug-ascending":             {filter: PostFilter{OrderBy: PostOrderFieldSlug}, want: []string{"c", "b", "d", "a"}},
+		"slug-descending":            {filter: PostFilter{OrderBy: PostOrderFieldSlug, Descending: true}, want: []string{"a", "b", "d", "c"}},
+		"slug-limit":                 {filter: PostFilter{OrderBy: PostOrderFieldSlug, Limit: 2}, want: []string{"c", "b"}},
+		"unknown":                    {filter: PostFilter{OrderBy: "updated_at"}, wantErr: true},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			posts, err := storer.List(ctx, test.filter)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", posts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error listing posts: %s", err)
+			}
+			var got []string
+			for _, post := range posts {
+				got = append(got, post.ID)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+// TestInMemoryStorerListIter doesn't run in parallel, so the number of
+// running goroutines is stable enough to notice one left behind.
+func TestInMemoryStorerListIter(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	storer := NewInMemoryStorer()
+	for i, id := range []string{"a", "b", "c", "d"} {
+		if err := storer.Create(ctx, Post{ID: id, PublishedAt: base.Add(time.Duration(i) * time.Hour)}); err != nil {
+			t.Fatalf("unexpected error creating post: %s", err)
+		}
+	}
+
+	goroutines := runtime.NumGoroutine()
+	var got []string
+	for post, err := range storer.ListIter(ctx, PostFilter{}) {
+		if err != nil {
+			t.Fatalf("unexpected error listing posts: %s", err)
+		}
+		got = append(got, post.ID)
+		// the storer isn't locked while the loop runs, so it can be
+		// changed from inside it.
+		if _, err := storer.Delete(ctx, post.ID); err != nil {
+			t.Fatalf("unexpected error deleting post: %s", err)
+		}
+		if len(got) == 2 {
+			break
+		}
+	}
+	if want := []string{"d", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if after := runtime.NumGoroutine(); after > goroutines {
+		t.Errorf("expected no more than %d goroutines after breaking, got %d", goroutines, after)
+	}
+
+	posts, err := storer.List(ctx, PostFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error listing posts: %s", err)
+	}
+	if len(posts) != 2 {
+		t.Errorf("expected the 2 posts left, got %+v", posts)
+	}
+}
+
+func TestInMemoryStorerListIterCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storer := NewInMemoryStorer()
+	for _, id := range []string{"a", "b", "c"} {
+		if err := storer.Create(ctx, Post{ID: id}); err != nil {
+			t.Fatalf("unexpected error creating post: %s", err)
+		}
+	}
+
+	var yielded int
+	var gotErr error
+	for _, err := range storer.ListIter(ctx, PostFilter{}) {
+		if err != nil {
+			gotErr = err
+			continue
+		}
+		yielded++
+		cancel()
+	}
+	if yielded != 1 {
+		t.Errorf("expected 1 post before cancellation, got %d", yielded)
+	}
+	if !errors.Is(gotErr, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", gotErr)
+	}
+	if _, err := storer.List(ctx, PostFilter{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected List to return context.Canceled, got %v", err)
+	}
+}
+
+func TestInMemoryStorerSubscribeRevisions(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storer := NewInMemoryStorer()
+	if err := storer.Create(ctx, Post{ID: "post", Streams: []string{"blog"}}); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+	revisions, err := storer.SubscribeRevisions(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error subscribing: %s", err)
+	}
+
+	// nobody's reading yet, so these need to be queued rather than
+	// blocking
+	for _, title := range []string{"a", "b"} {
+		post, err := storer.Get(ctx, "post")
+		if err != nil {
+			t.Fatalf("unexpected error getting post: %s", err)
+		}
+		updated := post
+		updated.Title = title
+		rev, err := GenerateRevision(post, updated)
+		if err != nil {
+			t.Fatalf("unexpected error generating revision: %s", err)
+		}
+		rev.ID = title
+		if err := storer.Update(ctx, "post", post.Version, rev); err != nil {
+			t.Fatalf("unexpected error updating post: %s", err)
+		}
+	}
+	moved, err := storer.MovePostStream(ctx, "post", "blog", "archive")
+	if err != nil {
+		t.Fatalf("unexpected error moving post: %s", err)
+	}
+	if !reflect.DeepEqual(moved.Streams, []string{"archive"}) {
+		t.Errorf("expected post to be moved to archive, got %v", moved.Streams)
+	}
+
+	for _, want := range []string{"a", "b"} {
+		if rev := <-revisions; rev.ID != want {
+			t.Errorf("expected revision %q, got %q", want, rev.ID)
+		}
+	}
+	if rev := <-revisions; len(rev.StreamsDeltas) == 0 {
+		t.Errorf("expected the move to be recorded with StreamsDeltas, got %+v", rev)
+	}
+	cancel()
+	for range revisions {
+	}
+
+	if _, err := storer.MovePostStream(context.Background(), "post", "blog", "archive"); !errors.Is(err, ErrPostNotInStream) {
+		t.Errorf("expected ErrPostNotInStream, got %v", err)
+	}
+}
+
+func TestInMemoryStorerSubscribeRevisionsClone(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storer := NewInMemoryStorer()
+	post := Post{ID: "post", Parts: []Part{inlinePart("a", 0, "one")}}
+	if err := storer.Create(ctx, post); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+	first, err := storer.SubscribeRevisions(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error subscribing: %s", err)
+	}
+	second, err := storer.SubscribeRevisions(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error subscribing: %s", err)
+	}
+	rev, err := GenerateRevision(post, Post{ID: "post", Parts: []Part{inlinePart("a", 0, "one"), inlinePart("b", 1, "two")}})
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	rev.ID = "rev"
+	want := rev.Clone()
+	if err := storer.Update(ctx, "post", 0, rev); err != nil {
+		t.Fatalf("unexpected error updating post: %s", err)
+	}
+
+	// each subscriber, and the storer itself, should be unaffected by
+	// another subscriber changing the revision it received.
+	got := <-first
+	got.PartsDeltas[0].PartID = "changed"
+	got.PartsDeltas[0].Body = "+changed"
+	if got := <-second; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected second subscriber to get %+v, got %+v", want, got)
+	}
+	latest, _, err := storer.LatestRevision(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error getting latest revision: %s", err)
+	}
+	if !reflect.DeepEqual(latest, want) {
+		t.Errorf("expected latest revision %+v, got %+v", want, latest)
+	}
+}
+
+func TestInMemoryStorerQuery(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryStorer()
+	for _, post := range []Post{
+		{ID: "once", Title: "Gardening", Streams: []string{"blog"}},
+		{ID: "twice", Title: "Gardening", Streams: []string{"blog"}, Parts: []Part{inlinePart("a", 0, "More gardening.")}},
+		{ID: "other-stream", Title: "Gardening", Streams: []string{"tech"}},
+		{ID: "no-match", Title: "Cooking", Streams: []string{"blog"}},
+	} {
+		if err := storer.Create(ctx, post); err != nil {
+			t.Fatalf("unexpected error creating post: %s", err)
+		}
+	}
+	results, err := storer.Query(ctx, "garden", PostFilter{Streams: []string{"blog"}, StreamsMode: StringListFilterModeContainsAny})
+	if err != nil {
+		t.Fatalf("unexpected error querying: %s", err)
+	}
+	var got []string
+	for _, result := range results {
+		got = append(got, result.Post.ID)
+	}
+	want := []string{"twice", "once"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestInMemoryEventStorer(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryEventStorer()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []PostEvent{
+		{ID: "1", PostID: "post", Type: PostEventTypeCreated, Actor: "alice", Timestamp: start},
+		{ID: "2", PostID: "post", Type: PostEventTypeUpdated, Actor: "bob", Timestamp: start.Add(2 * time.Hour)},
+		{ID: "3", PostID: "post", Type: PostEventTypePublished, Actor: "alice", Timestamp: start.Add(time.Hour)},
+		{ID: "4", PostID: "other", Type: PostEventTypeCreated, Actor: "alice", Timestamp: start},
+	}
+	for _, event := range events {
+		if err := storer.RecordEvent(ctx, event); err != nil {
+			t.Fatalf("unexpected error recording event %s: %s", event.ID, err)
+		}
+	}
+	if err := storer.RecordEvent(ctx, events[0]); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists recording a duplicate event, got %v", err)
+	}
+	if err := storer.RecordEvent(ctx, PostEvent{ID: "5"}); err == nil {
+		t.Errorf("expected an error recording an event without a post ID")
+	}
+	if _, err := storer.ListEvents(ctx, "missing", EventFilter{}); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("expected ErrEventNotFound listing events for a missing post, got %v", err)
+	}
+
+	after := start.Add(30 * time.Minute)
+	before := start.Add(90 * time.Minute)
+	tests := map[string]struct {
+		filter EventFilter
+		want   []string
+	}{
+		"all":       {want: []string{"2", "3", "1"}},
+		"types":     {filter: EventFilter{Types: []PostEventType{PostEventTypeCreated, PostEventTypeUpdated}}, want: []string{"2", "1"}},
+		"actors":    {filter: EventFilter{Actors: []string{"alice"}}, want: []string{"3", "1"}},
+		"after":     {filter: EventFilter{After: &after}, want: []string{"2", "3"}},
+		"before":    {filter: EventFilter{Before: &before}, want: []string{"3", "1"}},
+		"range":     {filter: EventFilter{After: &after, Before: &before}, want: []string{"3"}},
+		"exclusive": {filter: EventFilter{After: &start}, want: []string{"2", "3"}},
+		"none":      {filter: EventFilter{Actors: []string{"carol"}}, want: []string{}},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := storer.ListEvents(ctx, "post", test.filter)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			ids := []string{}
+			for _, event := range got {
+				ids = append(ids, event.ID)
+			}
+			if !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("expected %v, got %v", test.want, ids)
+			}
+		})
+	}
+}
+
+func TestInMemoryBlobStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := NewInMemoryBlobStore()
+	body := []byte("\xff\xfe binary")
+	sum := sha256Hex(body)
+
+	if err := store.Put(ctx, sum, bytes.NewReader(body)); err != nil {
+		t.Fatalf("unexpected error putting blob: %s", err)
+	}
+	// content-addressed, so putting the same thing again is fine.
+	if err := store.Put(ctx, sum, bytes.NewReader(body)); err != nil {
+		t.Errorf("unexpected error putting blob again: %s", err)
+	}
+	if got := readBlob(t, store, sum); !bytes.Equal(got, body) {
+		t.Errorf("expected %q, got %q", body, got)
+	}
+
+	other := sha256Hex([]byte("other"))
+	if err := store.Put(ctx, other, bytes.NewReader(body)); !errors.Is(err, ErrSHA256Mismatch) {
+		t.Errorf("expected ErrSHA256Mismatch putting a blob under the wrong hash, got %v", err)
+	}
+	if exists, err := store.Exists(ctx, other); err != nil || exists {
+		t.Errorf("expected mismatched blob not to be stored, got %v, %v", exists, err)
+	}
+	if _, err := store.Get(ctx, other); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound getting a missing blob, got %v", err)
+	}
+
+	if err := store.Delete(ctx, sum); err != nil {
+		t.Fatalf("unexpected error deleting blob: %s", err)
+	}
+	if exists, err := store.Exists(ctx, sum); err != nil || exists {
+		t.Errorf("expected deleted blob not to exist, got %v, %v", exists, err)
+	}
+	// deleting a missing blob is fine, so deletes can be retried.
+	if err := store.Delete(ctx, sum); err != nil {
+		t.Errorf("unexpected error deleting a missing blob: %s", err)
+	}
+}
+
+func TestInMemoryStorerVersionConflict(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryStorer()
+	if err := storer.Create(ctx, Post{ID: "post", Title: "Hello"}); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+
+	// two editors get the same version of the post and change it
+	// independently.
+	base, err := storer.Get(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error getting post: %s", err)
+	}
+	first, err := GenerateRevision(base, Post{ID: "post", Title: "Hello, world"})
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	first.ID = "first"
+	second, err := GenerateRevision(base, Post{ID: "post", Title: "Hello there"})
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	second.ID = "second"
+
+	if err := storer.Update(ctx, "post", base.Version, first); err != nil {
+		t.Fatalf("unexpected error applying first update: %s", err)
+	}
+	if err := storer.Update(ctx, "post", base.Version, second); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict applying second update, got %v", err)
+	}
+	// retrying the update that won is still fine.
+	if err := storer.Update(ctx, "post", base.Version, first); err != nil {
+		t.Errorf("unexpected error retrying first update: %s", err)
+	}
+
+	got, err := storer.Get(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error getting post: %s", err)
+	}
+	if got.Title != "Hello, world" {
+		t.Errorf("expected the losing update not to be applied, got title %q", got.Title)
+	}
+	if got.Version != base.Version+1 {
+		t.Errorf("expected version %d, got %d", base.Version+1, got.Version)
+	}
+
+	// the losing editor regenerates their revision against the current
+	// version and tries again.
+	second, err = GenerateRevision(got, Post{ID: "post", Title: "Hello there"})
+	if err != nil {
+		t.Fatalf("unexpected error regenerating revision: %s", err)
+	}
+	second.ID = "second"
+	if err := storer.Update(ctx, "post", got.Version, second); err != nil {
+		t.Fatalf("unexpected error applying regenerated update: %s", err)
+	}
+	got, err = storer.Get(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error getting post: %s", err)
+	}
+	if got.Title != "Hello there" || got.Version != base.Version+2 {
+		t.Errorf("expected title %q at version %d, got %q at version %d", "Hello there", base.Version+2, got.Title, got.Version)
+	}
+}
+
+func TestInMemoryStorerVersionConflictAfterStateChange(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		post   Post
+		change func(ctx context.Context, storer *InMemoryStorer) (Post, error)
+	}{
+		"delete": {
+			post: Post{ID: "post", Title: "Hello"},
+			change: func(ctx context.Context, storer *InMemoryStorer) (Post, error) {
+				return storer.Delete(ctx, "post")
+			},
+		},
+		"restore": {
+			post: Post{ID: "post", Title: "Hello", Deleted: true},
+			change: func(ctx context.Context, storer *InMemoryStorer) (Post, error) {
+				return storer.Restore(ctx, "post")
+			},
+		},
+		"publish": {
+			post: Post{ID: "post", Title: "Hello", Draft: true},
+			change: func(ctx context.Context, storer *InMemoryStorer) (Post, error) {
+				return storer.Publish(ctx, "post")
+			},
+		},
+		"unpublish": {
+			post: Post{ID: "post", Title: "Hello"},
+			change: func(ctx context.Context, storer *InMemoryStorer) (Post, error) {
+				return storer.Unpublish(ctx, "post")
+			},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			storer := NewInMemoryStorer()
+			if err := storer.Create(ctx, test.post); err != nil {
+				t.Fatalf("unexpected error creating post: %s", err)
+			}
+			base, err := storer.Get(ctx, "post")
+			if err != nil {
+				t.Fatalf("unexpected error getting post: %s", err)
+			}
+			rev, err := GenerateRevision(base, Post{ID: "post", Title: "Hello, world"})
+			if err != nil {
+				t.Fatalf("unexpected error generating revision: %s", err)
+			}
+
+			changed, err := test.change(ctx, storer)
+			if err != nil {
+				t.Fatalf("unexpected error changing post: %s", err)
+			}
+			if changed.Version != base.Version+1 {
+				t.Errorf("expected version %d, got %d", base.Version+1, changed.Version)
+			}
+			// the revision was generated before the change, so it has
+			// to be regenerated against the changed post.
+			if err := storer.Update(ctx, "post", base.Version, rev); !errors.Is(err, ErrVersionConflict) {
+				t.Errorf("expected ErrVersionConflict, got %v", err)
+			}
+			if err := storer.Update(ctx, "post", changed.Version, rev); err != nil {
+				t.Errorf("unexpected error updating the changed post: %s", err)
+			}
+		})
+	}
+}
+
+func TestInMemoryStorerStreams(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryStorer()
+	for _, stream := range []Stream{{ID: "tech", Title: "Tech"}, {ID: "blog", Title: "Blog"}} {
+		if err := storer.CreateStream(ctx, stream); err != nil {
+			t.Fatalf("unexpected error creating stream: %s", err)
+		}
+	}
+	if err := storer.CreateStream(ctx, Stream{ID: "blog"}); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists, got %v", err)
+	}
+	if err := storer.UpdateStream(ctx, Stream{ID: "blog", Title: "The Blog"}); err != nil {
+		t.Fatalf("unexpected error updating stream: %s", err)
+	}
+	if err := storer.UpdateStream(ctx, Stream{ID: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating a missing stream, got %v", err)
+	}
+	stream, err := storer.GetStream(ctx, "blog")
+	if err != nil {
+		t.Fatalf("unexpected error getting stream: %s", err)
+	}
+	if stream.Title != "The Blog" {
+		t.Errorf("expected title %q, got %q", "The Blog", stream.Title)
+	}
+	if _, err := storer.GetStream(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound getting a missing stream, got %v", err)
+	}
+	streams, err := storer.ListStreams(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error listing streams: %s", err)
+	}
+	if len(streams) != 2 || streams[0].ID != "tech" || streams[1].ID != "blog" {
+		t.Errorf("expected streams tech and blog, got %+v", streams)
+	}
+
+	if err := storer.Create(ctx, Post{ID: "post", Streams: []string{"tech"}}); err != nil {
+		t.Fatalf("unexpected error creating post: %s", err)
+	}
+	if err := storer.AddPostToStream(ctx, "post", "blog"); err != nil {
+		t.Fatalf("unexpected error adding post to stream: %s", err)
+	}
+	if err := storer.AddPostToStream(ctx, "post", "blog"); err != nil {
+		t.Fatalf("unexpected error adding post to a stream it's in: %s", err)
+	}
+	if err := storer.AddPostToStream(ctx, "post", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound adding to a missing stream, got %v", err)
+	}
+	if err := storer.AddPostToStream(ctx, "missing", "blog"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound adding a missing post, got %v", err)
+	}
+	post, err := storer.Get(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error getting post: %s", err)
+	}
+	if !reflect.DeepEqual(post.Streams, []string{"tech", "blog"}) {
+		t.Errorf("expected streams [tech blog], got %v", post.Streams)
+	}
+	if post.Version != 1 {
+		t.Errorf("expected adding a post to a stream it's already in to change nothing, got version %d", post.Version)
+	}
+
+	if err := storer.RemovePostFromStream(ctx, "post", "tech"); err != nil {
+		t.Fatalf("unexpected error removing post from stream: %s", err)
+	}
+	if err := storer.RemovePostFromStream(ctx, "post", "tech"); !errors.Is(err, ErrPostNotInStream) {
+		t.Errorf("expected ErrPostNotInStream, got %v", err)
+	}
+	post, err = storer.Get(ctx, "post")
+	if err != nil {
+		t.Fatalf("unexpected error getting post: %s", err)
+	}
+	if !reflect.DeepEqual(post.Streams, []string{"blog"}) {
+		t.Errorf("expected streams [blog], got %v", post.Streams)
+	}
+	rev, ok, err := storer.LatestRevision(ctx, "post")
+	if err != nil || !ok {
+		t.Fatalf("expected a revision, got %v, %v", ok, err)
+	}
+	if len(rev.StreamsDeltas) == 0 || rev.StreamsDeltas[0].Op != DeltaRemove || rev.StreamsDeltas[0].Stream != "tech" {
+		t.Errorf("expected the removal to be recorded, got %+v", rev.StreamsDeltas)
+	}
+}
+
+func TestInMemoryStorerDeleteStream(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	storer := NewInMemoryStorer()
+	if err := storer.CreateStream(ctx, Stream{ID: "blog"}); err != nil {
+		t.Fatalf("unexpected error creating stream: %s", err)
+	}
+	for _, post := range []Post{
+		{ID: "a", Streams: []string{"blog", "tech"}},
+		{ID: "b", Streams: []string{"tech"}},
+		{ID: "c", Streams: []string{"blog"}, Deleted: true},
+	} {
+		if err := storer.Create(ctx, post); err != nil {
+			t.Fatalf("unexpected error creating post: %s", err)
+		}
+	}
+
+	if err := storer.DeleteStream(ctx, "blog", DeleteStreamModeInvalid); err == nil {
+		t.Errorf("expected an error deleting with an invalid mode")
+	}
+	if err := storer.DeleteStream(ctx, "blog", DeleteStreamModeRefuse); !errors.Is(err, ErrStreamNotEmpty) {
+		t.Errorf("expected ErrStreamNotEmpty, got %v", err)
+	}
+	if _, err := storer.GetStream(ctx, "blog"); err != nil {
+		t.Errorf("expected refused stream to still exist, got %v", err)
+	}
+	if err := storer.DeleteStream(ctx, "blog", DeleteStreamModeCascade); err != nil {
+		t.Fatalf("unexpected error deleting stream: %s", err)
+	}
+	if _, err := storer.GetStream(ctx, "blog"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for deleted stream, got %v", err)
+	}
+	if err := storer.DeleteStream(ctx, "blog", DeleteStreamModeCascade); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting a missing stream, got %v", err)
+	}
+
+	want := map[string][]string{"a": {"tech"}, "b": {"tech"}, "c": {}}
+	for id, streams := range want {
+		post, err := storer.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("unexpected error getting post %s: %s", id, err)
+		}
+		if len(post.Streams) != len(streams) || (len(streams) > 0 && !reflect.DeepEqual(post.Streams, streams)) {
+			t.Errorf("expected post %s to be in %v, got %v", id, streams, post.Streams)
+		}
+	}
+
+	if err := storer.CreateStream(ctx, Stream{ID: "empty"}); err != nil {
+		t.Fatalf("unexpected error creating stream: %s", err)
+	}
+	if err := storer.DeleteStream(ctx, "empty", DeleteStreamModeRefuse); err != nil {
+		t.Errorf("unexpected error deleting empty stream: %s", err)
+	}
+}
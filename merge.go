@@ -0,0 +1,551 @@
+package posts
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ConflictKind is an enum of the ways two Revisions can disagree about a
+// change to a Post.
+type ConflictKind string
+
+const (
+	// ConflictTitle is used when both Revisions change the same part of
+	// the title.
+	ConflictTitle ConflictKind = "title"
+
+	// ConflictSlug is used when both Revisions change the same part of
+	// the slug.
+	ConflictSlug ConflictKind = "slug"
+
+	// ConflictAuthorPosition is used when both Revisions reorder the
+	// authors in different ways.
+	ConflictAuthorPosition ConflictKind = "author_position"
+
+	// ConflictStreamPosition is used when both Revisions reorder the
+	// streams in different ways.
+	ConflictStreamPosition ConflictKind = "stream_position"
+
+	// ConflictPartBody is used when both Revisions change the same part
+	// of a part's body, or change a non-inline body in different ways.
+	ConflictPartBody ConflictKind = "part_body"
+
+	// ConflictPartHeader is used when both Revisions change the values
+	// of the same header of a part in different ways.
+	ConflictPartHeader ConflictKind = "part_header"
+
+	// ConflictPartAnchor is used when both Revisions change a part's
+	// anchor to different values.
+	ConflictPartAnchor ConflictKind = "part_anchor"
+
+	// ConflictPartPosition is used when both Revisions move a part to
+	// different places.
+	ConflictPartPosition ConflictKind = "part_position"
+
+	// ConflictPartRemoved is used when one Revision removes a part the
+	// other changes.
+	ConflictPartRemoved ConflictKind = "part_removed"
+
+	// ConflictPartAdded is used when both Revisions add a part with the
+	// same ID, but different contents.
+	ConflictPartAdded ConflictKind = "part_added"
+)
+
+// Conflict describes a change two Revisions both make to a Post that
+// MergeRevisions can't combine automatically. It holds the conflicting
+// values from the base Post and each Revision, so they can be presented to
+// someone to resolve.
+type Conflict struct {
+	// Kind describes what the Revisions disagree about.
+	Kind ConflictKind
+
+	// PartID is the ID of the part the conflict is in, for conflicts
+	// about parts.
+	PartID string
+
+	// Metadata is true when PartID refers to one of the Post's Metadata
+	// parts, rather than one of its Parts.
+	Metadata bool
+
+	// Value is the author or stream being reordered, for author and
+	// stream position conflicts, or the name of the header, for part
+	// header conflicts.
+	Value string
+
+	// Base, A, and B are the conflicting values in the base Post and
+	// after each Revision is applied to it: the title or slug, the part's
+	// inline body, or its SHA256 if it isn't inline, its anchor, or its
+	// header's values, separated by newlines. For part additions and
+	// removals, they're the part's body, empty where the part doesn't
+	// exist.
+	Base, A, B string
+
+	// BasePosition, APosition, and BPosition are the positions of the
+	// author, stream, or part in the base Post and after each Revision is
+	// applied to it, or -1 where it doesn't exist.
+	BasePosition, APosition, BPosition int
+}
+
+// MergeRevisions combines two Revisions that were both generated against
+// base into one Revision that makes both sets of changes to base. It's meant
+// for recovering from ErrVersionConflict: rather than making someone redo
+// their work, their Revision can be merged with the one that beat it.
+//
+// Changes to different things, like the title in one Revision and a part in
+// the other, or different regions of the same text, merge cleanly. Changes
+// that overlap are returned as Conflicts, and the merged Revision keeps a's
+// side of each of them, so it's always safe to apply; resolving a Conflict
+// differently means generating a new Revision. Removing something and
+// changing it is a conflict, as is moving the same part to different places,
+// but both Revisions making the same change is not.
+//
+// The merged Revision applies to base. To apply it to the Post a produced,
+// generate a Revision between that Post and the result of applying the
+// merged Revision to base.
+//
+// If either Revision can't be applied to base, an error wrapping
+// ErrRevisionMismatch is returned.
+func MergeRevisions(base Post, a, b Revision) (Revision, []Conflict, error) {
+	postA, err := ApplyRevision(base, a)
+	if err != nil {
+		return Revision{}, nil, fmt.Errorf("can't apply first revision: %w", err)
+	}
+	postB, err := ApplyRevision(base, b)
+	if err != nil {
+		return Revision{}, nil, fmt.Errorf("can't apply second revision: %w", err)
+	}
+	base.NormalizeParts()
+
+	var conflicts []Conflict
+	merged := base
+	var ok bool
+	if merged.Title, ok = mergeText(base.Title, postA.Title, postB.Title); !ok {
+		conflicts = append(conflicts, Conflict{Kind: ConflictTitle, Base: base.Title, A: postA.Title, B: postB.Title})
+	}
+	if merged.Slug, ok = mergeText(base.Slug, postA.Slug, postB.Slug); !ok {
+		conflicts = append(conflicts, Conflict{Kind: ConflictSlug, Base: base.Slug, A: postA.Slug, B: postB.Slug})
+	}
+
+	var moved []string
+	merged.Authors, moved = mergeStrings(base.Authors, postA.Authors, postB.Authors)
+	for _, author := range moved {
+		conflicts = append(conflicts, listConflict(ConflictAuthorPosition, author, base.Authors, postA.Authors, postB.Authors))
+	}
+	merged.Streams, moved = mergeStrings(base.Streams, postA.Streams, postB.Streams)
+	for _, stream := range moved {
+		conflicts = append(conflicts, listConflict(ConflictStreamPosition, stream, base.Streams, postA.Streams, postB.Streams))
+	}
+
+	var partConflicts []Conflict
+	merged.Parts, partConflicts = mergeParts(base.Parts, postA.Parts, postB.Parts)
+	conflicts = append(conflicts, partConflicts...)
+	merged.Metadata, partConflicts = mergeParts(base.Metadata, postA.Metadata, postB.Metadata)
+	for _, conflict := range partConflicts {
+		conflict.Metadata = true
+		conflicts = append(conflicts, conflict)
+	}
+
+	rev, err := GenerateRevision(base, merged)
+	if err != nil {
+		return Revision{}, nil, err
+	}
+	rev.Public = a.Public || b.Public
+	return rev, conflicts, nil
+}
+
+// textEdit replaces the runes between start and end of some base text with
+// text.
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// textEdits returns the edits that turn base into changed, in order, with
+// positions in runes.
+func textEdits(base, changed string) []textEdit {
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffCleanupSemantic(dmp.DiffMain(base, changed, false))
+	var edits []textEdit
+	// open is true while the last edit can still be extended, which is
+	// until some text is kept.
+	pos, open := 0, false
+	for _, diff := range diffs {
+		length := utf8.RuneCountInString(diff.Text)
+		if diff.Type == diffmatchpatch.DiffEqual {
+			pos += length
+			open = false
+			continue
+		}
+		if !open {
+			edits = append(edits, textEdit{start: pos, end: pos})
+			open = true
+		}
+		edit := &edits[len(edits)-1]
+		if diff.Type == diffmatchpatch.DiffDelete {
+			pos += length
+			edit.end = pos
+		} else {
+			edit.text += diff.Text
+		}
+	}
+	return edits
+}
+
+// mergeText combines the changes from base to a and from base to b. If they
+// change the same region of base, or regions right next to each other, a and
+// false are returned.
+func mergeText(base, a, b string) (string, bool) {
+	switch {
+	case a == b || b == base:
+		return a, true
+	case a == base:
+		return b, true
+	}
+	editsA, editsB := textEdits(base, a), textEdits(base, b)
+	edits := append([]textEdit(nil), editsA...)
+	for _, editB := range editsB {
+		duplicate := false
+		for _, editA := range editsA {
+			if editA == editB {
+				duplicate = true
+				break
+			}
+			if editA.start <= editB.end && editB.start <= editA.end {
+				return a, false
+			}
+		}
+		if !duplicate {
+			edits = append(edits, editB)
+		}
+	}
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+	runes := []rune(base)
+	var merged strings.Builder
+	pos := 0
+	for _, edit := range edits {
+		merged.WriteString(string(runes[pos:edit.start]))
+		merged.WriteString(edit.text)
+		pos = edit.end
+	}
+	merged.WriteString(string(runes[pos:]))
+	return merged.String(), true
+}
+
+// mergeStrings combines the changes from base to a and from base to b for a
+// list of unique values, like authors. Values removed by either side are
+// removed, and values added by either side are added. If both sides reorder
+// the values differently, the values that end up in different places are
+// returned, and a's order is kept.
+func mergeStrings(base, a, b []string) ([]string, []string) {
+	inBase, inA, inB := stringSet(base), stringSet(a), stringSet(b)
+	keep := map[string]bool{}
+	for _, values := range [][]string{a, b} {
+		for _, value := range values {
+			_, based := inBase[value]
+			_, kept := inA[value]
+			_, keptB := inB[value]
+			keep[value] = !based || (kept && keptB)
+		}
+	}
+	merged, moved := mergeOrder(base, a, b, keep)
+	if len(merged) == 0 {
+		return nil, moved
+	}
+	return merged, moved
+}
+
+func stringSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[value] = struct{}{}
+	}
+	return set
+}
+
+// mergeOrder combines the orders of base, a, and b, each a list of unique
+// values, into the order of the values keep is true for.
+//
+// Values kept from base are ordered the way whichever side reordered them
+// says, or a's way, with the values that end up in different places
+// returned, if both sides did. Every other value is placed after the value
+// before it in the side it comes from.
+func mergeOrder(base, a, b []string, keep map[string]bool) ([]string, []string) {
+	inA, inB := stringSet(a), stringSet(b)
+	var common []string
+	inCommon := map[string]struct{}{}
+	for _, value := range base {
+		_, okA := inA[value]
+		_, okB := inB[value]
+		if keep[value] && okA && okB {
+			common = append(common, value)
+			inCommon[value] = struct{}{}
+		}
+	}
+	filter := func(values []string) []string {
+		var filtered []string
+		for _, value := range values {
+			if _, ok := inCommon[value]; ok {
+				filtered = append(filtered, value)
+			}
+		}
+		return filtered
+	}
+	orderA, orderB := filter(a), filter(b)
+
+	var moved []string
+	order := orderA
+	switch {
+	case stringsEqual(orderA, common):
+		order = orderB
+	case stringsEqual(orderB, common), stringsEqual(orderA, orderB):
+	default:
+		for pos := range orderA {
+			if orderA[pos] != orderB[pos] {
+				moved = append(moved, orderA[pos])
+			}
+		}
+	}
+
+	merged := append([]string(nil), order...)
+	placed := stringSet(merged)
+	for _, side := range [][]string{a, b} {
+		prev := -1
+		for _, value := range side {
+			if _, ok := placed[value]; ok {
+				prev = indexOf(merged, value)
+				continue
+			}
+			if !keep[value] {
+				continue
+			}
+			merged = append(merged, "")
+			copy(merged[prev+2:], merged[prev+1:])
+			merged[prev+1] = value
+			placed[value] = struct{}{}
+			prev++
+		}
+	}
+	return merged, moved
+}
+
+func indexOf(values []string, value string) int {
+	for pos, v := range values {
+		if v == value {
+			return pos
+		}
+	}
+	return -1
+}
+
+// listConflict returns a Conflict of kind about value being reordered in
+// base, a, and b.
+func listConflict(kind ConflictKind, value string, base, a, b []string) Conflict {
+	return Conflict{
+		Kind:         kind,
+		Value:        value,
+		BasePosition: indexOf(base, value),
+		APosition:    indexOf(a, value),
+		BPosition:    indexOf(b, value),
+	}
+}
+
+// mergeParts combines the changes from base to a and from base to b for a
+// list of parts, all of which must have contiguous Positions starting at 0.
+// Conflicts are resolved in a's favor.
+func mergeParts(base, a, b []Part) ([]Part, []Conflict) {
+	byID := func(parts []Part) map[string]Part {
+		ids := make(map[string]Part, len(parts))
+		for _, part := range parts {
+			ids[part.ID] = part
+		}
+		return ids
+	}
+	ids := func(parts []Part) []string {
+		ids := make([]string, 0, len(parts))
+		for _, part := range parts {
+			ids = append(ids, part.ID)
+		}
+		return ids
+	}
+	partsBase, partsA, partsB := byID(base), byID(a), byID(b)
+	idsBase, idsA, idsB := ids(base), ids(a), ids(b)
+
+	var conflicts []Conflict
+	keep := map[string]bool{}
+	merged := map[string]Part{}
+	for _, id := range union(idsA, idsB) {
+		partBase, inBase := partsBase[id]
+		partA, inA := partsA[id]
+		partB, inB := partsB[id]
+		conflict := Conflict{
+			PartID:       id,
+			Base:         partText(partBase),
+			A:            partText(partA),
+			B:            partText(partB),
+			BasePosition: indexOf(idsBase, id),
+			APosition:    indexOf(idsA, id),
+			BPosition:    indexOf(idsB, id),
+		}
+		switch {
+		case !inBase && inA && inB:
+			if !partContentEqual(partA, partB) || !headersEqual(partA.Headers, partB.Headers) || partA.Anchor != partB.Anchor {
+				conflict.Kind = ConflictPartAdded
+				conflicts = append(conflicts, conflict)
+			}
+			merged[id], keep[id] = partA, true
+		case !inBase && inA:
+			merged[id], keep[id] = partA, true
+		case !inBase:
+			merged[id], keep[id] = partB, true
+		case !inA:
+			// removing a part the other side changed is a
+			// conflict, and a's side of it is the removal.
+			if partChanged(partBase, partB) {
+				conflict.Kind = ConflictPartRemoved
+				conflicts = append(conflicts, conflict)
+			}
+		case !inB:
+			if partChanged(partBase, partA) {
+				conflict.Kind = ConflictPartRemoved
+				conflicts = append(conflicts, conflict)
+				merged[id], keep[id] = partA, true
+			}
+		default:
+			part, partConflicts := mergePart(partBase, partA, partB)
+			for _, partConflict := range partConflicts {
+				partConflict.BasePosition, partConflict.APosition, partConflict.BPosition = conflict.BasePosition, conflict.APosition, conflict.BPosition
+				conflicts = append(conflicts, partConflict)
+			}
+			merged[id], keep[id] = part, true
+		}
+	}
+
+	order, moved := mergeOrder(idsBase, idsA, idsB, keep)
+	for _, id := range moved {
+		conflicts = append(conflicts, Conflict{
+			Kind:         ConflictPartPosition,
+			PartID:       id,
+			BasePosition: indexOf(idsBase, id),
+			APosition:    indexOf(idsA, id),
+			BPosition:    indexOf(idsB, id),
+		})
+	}
+	if len(order) == 0 {
+		return nil, conflicts
+	}
+	parts := make([]Part, 0, len(order))
+	for pos, id := range order {
+		part := merged[id]
+		part.Position = pos
+		parts = append(parts, part)
+	}
+	return parts, conflicts
+}
+
+// mergePart combines the changes from base to a and from base to b for a
+// single part.
+func mergePart(base, a, b Part) (Part, []Conflict) {
+	var conflicts []Conflict
+	merged := a
+
+	switch {
+	case partContentEqual(a, b) || partContentEqual(b, base):
+	case partContentEqual(a, base):
+		merged.Inline, merged.Body, merged.SHA256 = b.Inline, b.Body, b.SHA256
+	default:
+		body, ok := "", false
+		if base.Inline && a.Inline && b.Inline && !hasBinaryBody(base) && !hasBinaryBody(a) && !hasBinaryBody(b) {
+			body, ok = mergeText(string(base.Body), string(a.Body), string(b.Body))
+		}
+		if ok {
+			merged.Body = []byte(body)
+			merged.ComputeSHA256()
+		} else {
+			conflicts = append(conflicts, Conflict{Kind: ConflictPartBody, PartID: base.ID, Base: partText(base), A: partText(a), B: partText(b)})
+		}
+	}
+
+	switch {
+	case a.Anchor == b.Anchor || b.Anchor == base.Anchor:
+	case a.Anchor == base.Anchor:
+		merged.Anchor = b.Anchor
+	default:
+		conflicts = append(conflicts, Conflict{Kind: ConflictPartAnchor, PartID: base.ID, Base: base.Anchor, A: a.Anchor, B: b.Anchor})
+	}
+
+	headersBase, headersA, headersB := canonicalHeaders(base.Headers), canonicalHeaders(a.Headers), canonicalHeaders(b.Headers)
+	var keys []string
+	seen := map[string]struct{}{}
+	for _, h := range []map[string][]string{headersBase, headersA, headersB} {
+		for key := range h {
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+	}
+	// sort the keys so conflicts are always reported in the same order.
+	sort.Strings(keys)
+	headers := map[string][]string{}
+	for _, key := range keys {
+		valuesBase, valuesA, valuesB := headersBase[key], headersA[key], headersB[key]
+		switch {
+		case stringsEqual(valuesA, valuesB) || stringsEqual(valuesB, valuesBase):
+			headers[key] = valuesA
+		case stringsEqual(valuesA, valuesBase):
+			headers[key] = valuesB
+		default:
+			headers[key] = valuesA
+			conflicts = append(conflicts, Conflict{
+				Kind:   ConflictPartHeader,
+				PartID: base.ID,
+				Value:  key,
+				Base:   strings.Join(valuesBase, "\n"),
+				A:      strings.Join(valuesA, "\n"),
+				B:      strings.Join(valuesB, "\n"),
+			})
+		}
+		if len(headers[key]) == 0 {
+			delete(headers, key)
+		}
+	}
+	merged.Headers = headers
+	if len(headers) == 0 {
+		merged.Headers = nil
+	}
+	return merged, conflicts
+}
+
+// partContentEqual returns true if a and b have the same content: they're
+// both inline with the same body, or both non-inline with the same SHA256.
+func partContentEqual(a, b Part) bool {
+	if a.Inline != b.Inline {
+		return false
+	}
+	if a.Inline {
+		return bytes.Equal(a.Body, b.Body)
+	}
+	return a.SHA256 == b.SHA256
+}
+
+// partChanged returns true if changed has different content, headers, or an
+// anchor than base. Moving a part doesn't change it.
+func partChanged(base, changed Part) bool {
+	return !partContentEqual(base, changed) || !headersEqual(base.Headers, changed.Headers) || base.Anchor != changed.Anchor
+}
+
+// partText returns the text used to describe part in a Conflict: its inline
+// body, or its SHA256 if it isn't inline.
+func partText(part Part) string {
+	if part.Inline {
+		return string(part.Body)
+	}
+	return part.SHA256
+}
@@ -0,0 +1,206 @@
+package posts
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMergeRevisions(t *testing.T) {
+	t.Parallel()
+
+	base := Post{
+		ID:      "post",
+		Title:   "Hello world",
+		Authors: []string{"alice"},
+		Parts: []Part{
+			inlinePart("a", 0, "The quick brown fox jumps over the lazy dog."),
+			inlinePart("b", 1, "Second part."),
+			inlinePart("c", 2, "Third part."),
+		},
+	}
+
+	tests := map[string]struct {
+		a, b      func(post *Post)
+		want      func(post *Post)
+		conflicts []ConflictKind
+	}{
+		"title-and-body": {
+			a: func(post *Post) { post.Title = "Goodbye world" },
+			b: func(post *Post) { post.Parts[1] = inlinePart("b", 1, "Second part, edited.") },
+			want: func(post *Post) {
+				post.Title = "Goodbye world"
+				post.Parts[1] = inlinePart("b", 1, "Second part, edited.")
+			},
+		},
+		"different-parts": {
+			a: func(post *Post) { post.Parts[0] = inlinePart("a", 0, "A new first part.") },
+			b: func(post *Post) { post.Parts[2] = inlinePart("c", 2, "A new third part.") },
+			want: func(post *Post) {
+				post.Parts[0] = inlinePart("a", 0, "A new first part.")
+				post.Parts[2] = inlinePart("c", 2, "A new third part.")
+			},
+		},
+		"disjoint-regions": {
+			a:    func(post *Post) { post.Parts[0] = inlinePart("a", 0, "The quick red fox jumps over the lazy dog.") },
+			b:    func(post *Post) { post.Parts[0] = inlinePart("a", 0, "The quick brown fox jumps over the sleepy dog.") },
+			want: func(post *Post) { post.Parts[0] = inlinePart("a", 0, "The quick red fox jumps over the sleepy dog.") },
+		},
+		"same-change": {
+			a:    func(post *Post) { post.Title = "Hello, world" },
+			b:    func(post *Post) { post.Title = "Hello, world" },
+			want: func(post *Post) { post.Title = "Hello, world" },
+		},
+		"both-add": {
+			a: func(post *Post) {
+				post.Authors = []string{"alice", "bob"}
+				post.Parts = append(post.Parts, inlinePart("d", 3, "Added by a."))
+			},
+			b: func(post *Post) {
+				post.Authors = []string{"carol", "alice"}
+				post.Parts = append([]Part{inlinePart("e", 0, "Added by b.")}, post.Parts...)
+				normalizePositions(post.Parts)
+			},
+			want: func(post *Post) {
+				post.Authors = []string{"carol", "alice", "bob"}
+				post.Parts = append([]Part{inlinePart("e", 0, "Added by b.")}, append(post.Parts, inlinePart("d", 3, "Added by a."))...)
+				normalizePositions(post.Parts)
+			},
+		},
+		"remove-and-move": {
+			a: func(post *Post) { post.Parts = []Part{post.Parts[0], post.Parts[2]}; normalizePositions(post.Parts) },
+			b: func(post *Post) {
+				post.Parts = []Part{post.Parts[2], post.Parts[0], post.Parts[1]}
+				normalizePositions(post.Parts)
+			},
+			want: func(post *Post) {
+				post.Parts = []Part{post.Parts[2], post.Parts[0]}
+				normalizePositions(post.Parts)
+			},
+		},
+		"overlapping-body": {
+			a:         func(post *Post) { post.Parts[0] = inlinePart("a", 0, "The quick red fox jumps over the lazy dog.") },
+			b:         func(post *Post) { post.Parts[0] = inlinePart("a", 0, "The quick green fox jumps over the lazy dog.") },
+			want:      func(post *Post) { post.Parts[0] = inlinePart("a", 0, "The quick red fox jumps over the lazy dog.") },
+			conflicts: []ConflictKind{ConflictPartBody},
+		},
+		"overlapping-title": {
+			a:         func(post *Post) { post.Title = "Hello there" },
+			b:         func(post *Post) { post.Title = "Hello everyone" },
+			want:      func(post *Post) { post.Title = "Hello there" },
+			conflicts: []ConflictKind{ConflictTitle},
+		},
+		"moved-differently": {
+			a: func(post *Post) {
+				post.Parts = []Part{post.Parts[1], post.Parts[2], post.Parts[0]}
+				normalizePositions(post.Parts)
+			},
+			b: func(post *Post) {
+				post.Parts = []Part{post.Parts[1], post.Parts[0], post.Parts[2]}
+				normalizePositions(post.Parts)
+			},
+			want: func(post *Post) {
+				post.Parts = []Part{post.Parts[1], post.Parts[2], post.Parts[0]}
+				normalizePositions(post.Parts)
+			},
+			conflicts: []ConflictKind{ConflictPartPosition, ConflictPartPosition},
+		},
+		"remove-and-edit": {
+			a:         func(post *Post) { post.Parts = []Part{post.Parts[0], post.Parts[2]}; normalizePositions(post.Parts) },
+			b:         func(post *Post) { post.Parts[1] = inlinePart("b", 1, "Second part, edited.") },
+			want:      func(post *Post) { post.Parts = []Part{post.Parts[0], post.Parts[2]}; normalizePositions(post.Parts) },
+			conflicts: []ConflictKind{ConflictPartRemoved},
+		},
+		"different-headers": {
+			a: func(post *Post) { post.Parts[1].Headers = map[string][]string{"X-Role": {"heading"}} },
+			b: func(post *Post) { post.Parts[1].Headers = map[string][]string{"X-Role": {"pullquote"}} },
+			want: func(post *Post) {
+				post.Parts[1].Headers = map[string][]string{"X-Role": {"heading"}}
+			},
+			conflicts: []ConflictKind{ConflictPartHeader},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			postA, postB, want := base.Clone(), base.Clone(), base.Clone()
+			test.a(&postA)
+			test.b(&postB)
+			test.want(&want)
+			a, err := GenerateRevision(base, postA)
+			if err != nil {
+				t.Fatalf("unexpected error generating first revision: %s", err)
+			}
+			b, err := GenerateRevision(base, postB)
+			if err != nil {
+				t.Fatalf("unexpected error generating second revision: %s", err)
+			}
+
+			merged, conflicts, err := MergeRevisions(base, a, b)
+			if err != nil {
+				t.Fatalf("unexpected error merging revisions: %s", err)
+			}
+			var kinds []ConflictKind
+			for _, conflict := range conflicts {
+				kinds = append(kinds, conflict.Kind)
+			}
+			if !reflect.DeepEqual(kinds, test.conflicts) {
+				t.Errorf("expected conflicts %v, got %+v", test.conflicts, conflicts)
+			}
+			got, err := ApplyRevision(base, merged)
+			if err != nil {
+				t.Fatalf("unexpected error applying merged revision: %s", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected\n%+v\ngot\n%+v", want, got)
+			}
+		})
+	}
+}
+
+func TestMergeRevisionsConflictDetails(t *testing.T) {
+	t.Parallel()
+
+	base := Post{ID: "post", Parts: []Part{inlinePart("a", 0, "one two three")}}
+	a, err := GenerateRevision(base, Post{ID: "post", Parts: []Part{inlinePart("a", 0, "one 2 three")}})
+	if err != nil {
+		t.Fatalf("unexpected error generating first revision: %s", err)
+	}
+	b, err := GenerateRevision(base, Post{ID: "post", Parts: []Part{inlinePart("a", 0, "one II three")}})
+	if err != nil {
+		t.Fatalf("unexpected error generating second revision: %s", err)
+	}
+	_, conflicts, err := MergeRevisions(base, a, b)
+	if err != nil {
+		t.Fatalf("unexpected error merging revisions: %s", err)
+	}
+	want := []Conflict{{
+		Kind:   ConflictPartBody,
+		PartID: "a",
+		Base:   "one two three",
+		A:      "one 2 three",
+		B:      "one II three",
+	}}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("expected %+v, got %+v", want, conflicts)
+	}
+}
+
+func TestMergeRevisionsMismatch(t *testing.T) {
+	t.Parallel()
+
+	base := Post{ID: "post", Title: "Hello"}
+	_, _, err := MergeRevisions(base, Revision{}, Revision{TitleDelta: "=100"})
+	if !errors.Is(err, ErrRevisionMismatch) {
+		t.Errorf("expected ErrRevisionMismatch, got %v", err)
+	}
+}
+
+func normalizePositions(parts []Part) {
+	for pos := range parts {
+		parts[pos].Position = pos
+	}
+}
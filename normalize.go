@@ -0,0 +1,71 @@
+package posts
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+	"sync"
+)
+
+var (
+	bodyNormalizersMu sync.RWMutex
+	bodyNormalizers   = map[string]func([]byte) []byte{}
+)
+
+// RegisterBodyNormalizer registers fn as the normalizer for inline Parts with
+// the media type contentType, like "text/html". Any parameters in
+// contentType are ignored. Registering a nil fn removes the normalizer for
+// contentType. It's safe to call concurrently with GenerateRevision, but
+// normalizers are usually registered once, when a program starts.
+//
+// When GenerateRevision compares two versions of an inline Part that have
+// the same media type, and their bodies differ, it runs both bodies through
+// the normalizer for that media type. If the normalized bodies are equal, the
+// change is treated as cosmetic and no body change is recorded, so the
+// Revision leaves the first version's body in place. When the normalized
+// bodies differ, the change is recorded between the real bodies, not the
+// normalized ones, so applying the Revision produces the second version's
+// body exactly.
+//
+// fn must not modify its argument, and must return equal bodies for any two
+// bodies that should be considered the same, like HTML that only differs in
+// insignificant whitespace.
+func RegisterBodyNormalizer(contentType string, fn func([]byte) []byte) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	bodyNormalizersMu.Lock()
+	defer bodyNormalizersMu.Unlock()
+	if fn == nil {
+		delete(bodyNormalizers, mediaType)
+		return
+	}
+	bodyNormalizers[mediaType] = fn
+}
+
+// bodyNormalizer returns the normalizer registered for mediaType, or nil if
+// there isn't one.
+func bodyNormalizer(mediaType string) func([]byte) []byte {
+	bodyNormalizersMu.RLock()
+	defer bodyNormalizersMu.RUnlock()
+	return bodyNormalizers[mediaType]
+}
+
+// cosmeticallyEqual returns true if part1 and part2 are both inline, have the
+// same media type, and have bodies that differ but are equal once they're run
+// through the normalizer registered for that media type.
+func cosmeticallyEqual(part1, part2 Part) bool {
+	if !part1.Inline || !part2.Inline || bytes.Equal(part1.Body, part2.Body) {
+		return false
+	}
+	mediaType := part1.ContentType()
+	if mediaType == "" || mediaType != part2.ContentType() {
+		return false
+	}
+	normalize := bodyNormalizer(mediaType)
+	if normalize == nil {
+		return false
+	}
+	return bytes.Equal(normalize(part1.Body), normalize(part2.Body))
+}
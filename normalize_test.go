@@ -0,0 +1,97 @@
+package posts
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+var (
+	whitespace        = regexp.MustCompile(`\s+`)
+	whitespaceBetween = regexp.MustCompile(`> <`)
+)
+
+// collapseWhitespace is a simple HTML normalizer that treats all runs of
+// whitespace as a single space, and drops whitespace between tags and at
+// either end.
+func collapseWhitespace(body []byte) []byte {
+	body = whitespace.ReplaceAll(bytes.TrimSpace(body), []byte(" "))
+	return whitespaceBetween.ReplaceAll(body, []byte("><"))
+}
+
+func TestGenerateRevisionBodyNormalizer(t *testing.T) {
+	t.Parallel()
+
+	// the normalizer is registered globally, so register it for a media
+	// type no other test uses.
+	RegisterBodyNormalizer("application/xhtml+xml; charset=utf-8", collapseWhitespace)
+	headers := map[string][]string{"Content-Type": {"application/xhtml+xml"}}
+
+	p1 := Post{ID: "post", Parts: []Part{
+		{ID: "a", Inline: true, Body: []byte("<p>Hello, <b>world</b>!</p><p>Bye.</p>"), Headers: headers},
+		{ID: "b", Position: 1, Inline: true, Body: []byte("<p>Hello,   world!</p>")},
+	}}
+
+	tests := map[string]struct {
+		body    string
+		headers map[string][]string
+		want    bool
+	}{
+		"reformatted": {
+			body:    "<p>Hello,\n  <b>world</b>!</p>\n<p>Bye.</p>\n",
+			headers: headers,
+		},
+		"text-changed": {
+			body:    "<p>Hello,\n  <b>world</b>?</p>\n<p>Bye.</p>\n",
+			headers: headers,
+			want:    true,
+		},
+		"content-type-changed": {
+			body:    "<p>Hello,\n  <b>world</b>!</p>\n<p>Bye.</p>\n",
+			headers: map[string][]string{"Content-Type": {"text/html"}},
+			want:    true,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p2 := p1.Clone()
+			p2.Parts[0].Body = []byte(test.body)
+			p2.Parts[0].Headers = test.headers
+			// parts without a normalizer are diffed as usual.
+			p2.Parts[1].Body = []byte("<p>Hello, world!</p>")
+			rev, err := GenerateRevision(p1, p2)
+			if err != nil {
+				t.Fatalf("unexpected error generating revision: %s", err)
+			}
+			var changed bool
+			for _, delta := range rev.PartsDeltas {
+				if delta.PartID == "a" {
+					changed = true
+				} else if delta.PartID != "b" {
+					t.Errorf("unexpected delta for part %s", delta.PartID)
+				}
+			}
+			if len(rev.PartsDeltas) < 1 || rev.PartsDeltas[len(rev.PartsDeltas)-1].PartID != "b" {
+				t.Errorf("expected part b to be updated, got %+v", rev.PartsDeltas)
+			}
+			if changed != test.want {
+				t.Errorf("expected part a changed to be %v, got %+v", test.want, rev.PartsDeltas)
+			}
+			got, err := ApplyRevision(p1, rev)
+			if err != nil {
+				t.Fatalf("unexpected error applying revision: %s", err)
+			}
+			wantBody := string(p1.Parts[0].Body)
+			if test.want {
+				wantBody = test.body
+			}
+			if string(got.Parts[0].Body) != wantBody {
+				t.Errorf("expected body %q, got %q", wantBody, got.Parts[0].Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package posts
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidPatch is returned when a Patch can't be applied to a Post, like
+// when it removes a part the Post doesn't have.
+var ErrInvalidPatch = errors.New("invalid patch")
+
+// PatchOpType is an enum of the changes a PatchOp can make to a Post.
+type PatchOpType string
+
+const (
+	// PatchOpSetTitle sets the Post's Title to the PatchOp's Value.
+	PatchOpSetTitle PatchOpType = "set_title"
+
+	// PatchOpSetSlug sets the Post's Slug to the PatchOp's Value.
+	PatchOpSetSlug PatchOpType = "set_slug"
+
+	// PatchOpAddAuthor adds the PatchOp's Value to the end of the Post's
+	// Authors. The author must not already be one of the Post's Authors.
+	PatchOpAddAuthor PatchOpType = "add_author"
+
+	// PatchOpRemoveAuthor removes the PatchOp's Value from the Post's
+	// Authors. The author must be one of the Post's Authors.
+	PatchOpRemoveAuthor PatchOpType = "remove_author"
+
+	// PatchOpUpsertPart replaces the Post's Part with the same ID as the
+	// PatchOp's Part, or adds the PatchOp's Part if the Post doesn't have
+	// one with its ID. Either way, the Part ends up at the PatchOp's
+	// Part's Position, and the Parts after it are shifted down.
+	PatchOpUpsertPart PatchOpType = "upsert_part"
+
+	// PatchOpRemovePart removes the Post's Part with the PatchOp's PartID.
+	PatchOpRemovePart PatchOpType = "remove_part"
+
+	// PatchOpMovePart moves the Post's Part with the PatchOp's PartID to
+	// the PatchOp's Position, shifting the Parts in between.
+	PatchOpMovePart PatchOpType = "move_part"
+)
+
+// PatchOp is a single change to a Post, described by what the change is meant
+// to do, rather than by the difference it makes. Use the functions named
+// after each PatchOpType, like SetTitle, to create them.
+type PatchOp struct {
+	// Type indicates the change being made.
+	Type PatchOpType
+
+	// Value is the title, slug, or author ID being set, added, or
+	// removed.
+	Value string
+
+	// Part is the Part being added or replaced.
+	Part Part
+
+	// PartID is the ID of the Part being removed or moved.
+	PartID string
+
+	// Position is the position the Part is being moved to.
+	Position int
+}
+
+// SetTitle returns a PatchOp that sets a Post's Title to title.
+func SetTitle(title string) PatchOp {
+	return PatchOp{Type: PatchOpSetTitle, Value: title}
+}
+
+// SetSlug returns a PatchOp that sets a Post's Slug to slug.
+func SetSlug(slug string) PatchOp {
+	return PatchOp{Type: PatchOpSetSlug, Value: slug}
+}
+
+// AddAuthor returns a PatchOp that adds author to the end of a Post's
+// Authors.
+func AddAuthor(author string) PatchOp {
+	return PatchOp{Type: PatchOpAddAuthor, Value: author}
+}
+
+// RemoveAuthor returns a PatchOp that removes author from a Post's Authors.
+func RemoveAuthor(author string) PatchOp {
+	return PatchOp{Type: PatchOpRemoveAuthor, Value: author}
+}
+
+// UpsertPart returns a PatchOp that replaces the Part with the same ID as
+// part, or adds part if there isn't one, placing it at part's Position.
+func UpsertPart(part Part) PatchOp {
+	return PatchOp{Type: PatchOpUpsertPart, Part: part}
+}
+
+// RemovePart returns a PatchOp that removes the Part with the ID partID.
+func RemovePart(partID string) PatchOp {
+	return PatchOp{Type: PatchOpRemovePart, PartID: partID}
+}
+
+// MovePart returns a PatchOp that moves the Part with the ID partID to
+// position.
+func MovePart(partID string, position int) PatchOp {
+	return PatchOp{Type: PatchOpMovePart, PartID: partID, Position: position}
+}
+
+// Patch is a list of changes to make to a Post, in order. Each PatchOp sees
+// the Post as the PatchOps before it left it, so positions are relative to
+// the Parts at that point, not to the Parts the Post started with.
+type Patch []PatchOp
+
+// ApplyPatch makes the changes in patch to a copy of the Post, returning the
+// changed Post and the Revision that describes the changes, as generated by
+// GenerateRevision, so the changes can be stored with Storer.Update. The
+// returned Post is the same as the one ApplyRevision would produce from the
+// Revision, so inline Parts that changed have their SHA256 set.
+//
+// Patches only change the Post's Parts, not its Metadata. If any PatchOp
+// refers to a part or author the Post doesn't have, or to a position out of
+// range, an error wrapping ErrInvalidPatch is returned and nothing is
+// changed.
+func (p Post) ApplyPatch(patch Patch) (Post, Revision, error) {
+	p.NormalizeParts()
+	patched := p
+	patched.Authors = append([]string(nil), p.Authors...)
+	patched.Parts = append([]Part(nil), p.Parts...)
+	for i, op := range patch {
+		if err := patched.applyPatchOp(op); err != nil {
+			return Post{}, Revision{}, fmt.Errorf("%w: op %d (%s): %v", ErrInvalidPatch, i, op.Type, err)
+		}
+	}
+	for pos := range patched.Parts {
+		patched.Parts[pos].Position = pos
+	}
+	rev, err := GenerateRevision(p, patched)
+	if err != nil {
+		return Post{}, Revision{}, err
+	}
+	result, err := ApplyRevision(p, rev)
+	if err != nil {
+		return Post{}, Revision{}, err
+	}
+	return result, rev, nil
+}
+
+// applyPatchOp makes the change op describes to the Post, whose Parts are in
+// order, though their Positions may not match their order yet.
+func (p *Post) applyPatchOp(op PatchOp) error {
+	switch op.Type {
+	case PatchOpSetTitle:
+		p.Title = op.Value
+	case PatchOpSetSlug:
+		p.Slug = op.Value
+	case PatchOpAddAuthor:
+		if indexOf(p.Authors, op.Value) >= 0 {
+			return fmt.Errorf("%s is already an author", op.Value)
+		}
+		p.Authors = append(p.Authors, op.Value)
+	case PatchOpRemoveAuthor:
+		pos := indexOf(p.Authors, op.Value)
+		if pos < 0 {
+			return fmt.Errorf("%s is not an author", op.Value)
+		}
+		p.Authors = append(p.Authors[:pos], p.Authors[pos+1:]...)
+	case PatchOpUpsertPart:
+		if op.Part.ID == "" {
+			return errors.New("part has no ID")
+		}
+		if pos := partIndex(p.Parts, op.Part.ID); pos >= 0 {
+			p.Parts = append(p.Parts[:pos], p.Parts[pos+1:]...)
+		}
+		if op.Part.Position < 0 || op.Part.Position > len(p.Parts) {
+			return fmt.Errorf("position %d is out of range for %d parts", op.Part.Position, len(p.Parts)+1)
+		}
+		p.Parts = insertPart(p.Parts, op.Part.Position, op.Part)
+	case PatchOpRemovePart:
+		pos := partIndex(p.Parts, op.PartID)
+		if pos < 0 {
+			return fmt.Errorf("part %s does not exist", op.PartID)
+		}
+		p.Parts = append(p.Parts[:pos], p.Parts[pos+1:]...)
+	case PatchOpMovePart:
+		pos := partIndex(p.Parts, op.PartID)
+		if pos < 0 {
+			return fmt.Errorf("part %s does not exist", op.PartID)
+		}
+		if op.Position < 0 || op.Position >= len(p.Parts) {
+			return fmt.Errorf("position %d is out of range for %d parts", op.Position, len(p.Parts))
+		}
+		part := p.Parts[pos]
+		p.Parts = insertPart(append(p.Parts[:pos], p.Parts[pos+1:]...), op.Position, part)
+	default:
+		return errors.New("unknown op type")
+	}
+	return nil
+}
+
+// partIndex returns the index of the Part with the ID id in parts, or -1 if
+// there isn't one.
+func partIndex(parts []Part, id string) int {
+	for pos, part := range parts {
+		if part.ID == id {
+			return pos
+		}
+	}
+	return -1
+}
+
+// insertPart returns parts with part inserted at pos, which must be between 0
+// and len(parts), inclusive.
+func insertPart(parts []Part, pos int, part Part) []Part {
+	parts = append(parts, Part{})
+	copy(parts[pos+1:], parts[pos:])
+	parts[pos] = part
+	return parts
+}
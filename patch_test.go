@@ -0,0 +1,159 @@
+package posts
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPostApplyPatch(t *testing.T) {
+	t.Parallel()
+
+	base := Post{
+		ID:      "post",
+		Title:   "Hello",
+		Slug:    "hello",
+		Authors: []string{"alice", "bob"},
+		Parts: []Part{
+			inlinePart("a", 0, "First"),
+			inlinePart("b", 1, "Second"),
+			inlinePart("c", 2, "Third"),
+		},
+	}
+
+	tests := map[string]struct {
+		patch Patch
+		want  func(post *Post)
+	}{
+		"set-title": {
+			patch: Patch{SetTitle("Goodbye")},
+			want:  func(post *Post) { post.Title = "Goodbye" },
+		},
+		"set-slug": {
+			patch: Patch{SetSlug("goodbye")},
+			want:  func(post *Post) { post.Slug = "goodbye" },
+		},
+		"add-author": {
+			patch: Patch{AddAuthor("carol")},
+			want:  func(post *Post) { post.Authors = []string{"alice", "bob", "carol"} },
+		},
+		"remove-author": {
+			patch: Patch{RemoveAuthor("alice")},
+			want:  func(post *Post) { post.Authors = []string{"bob"} },
+		},
+		"insert-part": {
+			patch: Patch{UpsertPart(inlinePart("d", 1, "Inserted"))},
+			want: func(post *Post) {
+				post.Parts = []Part{post.Parts[0], inlinePart("d", 1, "Inserted"), post.Parts[1], post.Parts[2]}
+				normalizePositions(post.Parts)
+			},
+		},
+		"append-part": {
+			patch: Patch{UpsertPart(inlinePart("d", 3, "Appended"))},
+			want:  func(post *Post) { post.Parts = append(post.Parts, inlinePart("d", 3, "Appended")) },
+		},
+		"update-part": {
+			patch: Patch{UpsertPart(inlinePart("b", 1, "Second, edited"))},
+			want:  func(post *Post) { post.Parts[1] = inlinePart("b", 1, "Second, edited") },
+		},
+		"update-and-move-part": {
+			patch: Patch{UpsertPart(inlinePart("c", 0, "Third, first"))},
+			want: func(post *Post) {
+				post.Parts = []Part{inlinePart("c", 0, "Third, first"), post.Parts[0], post.Parts[1]}
+				normalizePositions(post.Parts)
+			},
+		},
+		"remove-part": {
+			patch: Patch{RemovePart("b")},
+			want: func(post *Post) {
+				post.Parts = []Part{post.Parts[0], post.Parts[2]}
+				normalizePositions(post.Parts)
+			},
+		},
+		"move-part": {
+			patch: Patch{MovePart("a", 2)},
+			want: func(post *Post) {
+				post.Parts = []Part{post.Parts[1], post.Parts[2], post.Parts[0]}
+				normalizePositions(post.Parts)
+			},
+		},
+		"combined": {
+			patch: Patch{
+				SetTitle("Hello, world"),
+				RemoveAuthor("bob"),
+				AddAuthor("carol"),
+				RemovePart("a"),
+				UpsertPart(inlinePart("d", 0, "New first")),
+				MovePart("c", 1),
+				UpsertPart(inlinePart("b", 2, "Second, last")),
+			},
+			want: func(post *Post) {
+				post.Title = "Hello, world"
+				post.Authors = []string{"alice", "carol"}
+				post.Parts = []Part{inlinePart("d", 0, "New first"), post.Parts[2], inlinePart("b", 2, "Second, last")}
+				normalizePositions(post.Parts)
+			},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			want := base.Clone()
+			test.want(&want)
+			for pos := range want.Parts {
+				want.Parts[pos].ComputeSHA256()
+			}
+			got, rev, err := base.ApplyPatch(test.patch)
+			if err != nil {
+				t.Fatalf("unexpected error applying patch: %s", err)
+			}
+			for pos := range got.Parts {
+				got.Parts[pos].ComputeSHA256()
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected\n%+v\ngot\n%+v", want, got)
+			}
+			applied, err := ApplyRevision(base, rev)
+			if err != nil {
+				t.Fatalf("unexpected error applying revision: %s", err)
+			}
+			if diff, err := GenerateRevision(applied, got); err != nil || !diff.IsEmpty() {
+				t.Errorf("expected the revision to make the same changes as the patch, got\n%+v", applied)
+			}
+		})
+	}
+}
+
+func TestPostApplyPatchInvalid(t *testing.T) {
+	t.Parallel()
+
+	base := Post{ID: "post", Authors: []string{"alice"}, Parts: []Part{inlinePart("a", 0, "First")}}
+
+	tests := map[string]Patch{
+		"existing-author":      {AddAuthor("alice")},
+		"missing-author":       {RemoveAuthor("bob")},
+		"missing-part-removed": {RemovePart("b")},
+		"missing-part-moved":   {MovePart("b", 0)},
+		"move-out-of-range":    {MovePart("a", 1)},
+		"insert-out-of-range":  {UpsertPart(inlinePart("b", 2, "Too far"))},
+		"negative-position":    {UpsertPart(inlinePart("b", -1, "Too far"))},
+		"no-part-id":           {UpsertPart(inlinePart("", 0, "No ID"))},
+		"removed-then-moved":   {RemovePart("a"), MovePart("a", 0)},
+		"unknown-op":           {{Type: "rename"}},
+	}
+
+	for name, patch := range tests {
+		name, patch := name, patch
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, _, err := base.ApplyPatch(patch)
+			if !errors.Is(err, ErrInvalidPatch) {
+				t.Errorf("expected ErrInvalidPatch, got %v", err)
+			}
+		})
+	}
+}
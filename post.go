@@ -1,6 +1,20 @@
 package posts
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/textproto"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -51,6 +65,56 @@ type Post struct {
 	// instead of reconstructing it from event logs so we can filter and
 	// sort on it cheaply when coming up with post listings.
 	PublishedAt time.Time
+
+	// ScheduledFor, when non-nil on a draft, indicates the time the post
+	// should automatically be published at.
+	ScheduledFor *time.Time
+
+	// Version counts the changes that have been made to the post.
+	// Storers increment it every time they apply a Revision to it, and
+	// every time they delete, restore, publish, or unpublish it, and use
+	// it to detect updates based on a stale copy of the post; see
+	// Storer.Update.
+	Version int
+}
+
+// IsScheduled returns true if the Post is a draft that is scheduled to be
+// published after now. Drafts whose scheduled time is at or before now are
+// due to be published, not pending, and so are not considered scheduled;
+// neither are published Posts, regardless of their ScheduledFor property.
+func (p Post) IsScheduled(now time.Time) bool {
+	if !p.Draft || p.ScheduledFor == nil {
+		return false
+	}
+	return p.ScheduledFor.After(now)
+}
+
+// Clone returns a deep copy of the Post, which shares no slices, maps, or
+// pointers with it, so either can be modified without affecting the other.
+// Nil and empty slices and maps stay nil and empty, respectively, so the
+// copy is reflect.DeepEqual to the original.
+func (p Post) Clone() Post {
+	p.Authors = slices.Clone(p.Authors)
+	p.Streams = slices.Clone(p.Streams)
+	p.Parts = cloneParts(p.Parts)
+	p.Metadata = cloneParts(p.Metadata)
+	if p.ScheduledFor != nil {
+		scheduledFor := *p.ScheduledFor
+		p.ScheduledFor = &scheduledFor
+	}
+	return p
+}
+
+// cloneParts returns a copy of parts with each Part cloned.
+func cloneParts(parts []Part) []Part {
+	if parts == nil {
+		return nil
+	}
+	cloned := make([]Part, len(parts))
+	for i, part := range parts {
+		cloned[i] = part.Clone()
+	}
+	return cloned
 }
 
 // Part is a single part of a post, either a paragraph
@@ -69,6 +133,11 @@ type Part struct {
 	// Position indicates the order of the part in the post.
 	Position int
 
+	// Anchor is an optional, slug-like identifier for the part that's
+	// stable across edits, suitable for linking directly to the part
+	// with a URL fragment. Anchors must be unique within a post.
+	Anchor string
+
 	// Body is the content of the part.
 	Body []byte
 
@@ -81,6 +150,679 @@ type Part struct {
 	Inline bool
 
 	// SHA256 is the SHA 256 sum of Body. It's mostly
-	// used as the filename for non-inline Parts.
+	// used as the filename for non-inline Parts. ComputeSHA256 will
+	// set it from Body.
 	SHA256 string
 }
+
+// Clone returns a deep copy of the Part, including its Body and Headers, so
+// either can be modified without affecting the other.
+func (p Part) Clone() Part {
+	p.Body = slices.Clone(p.Body)
+	if p.Headers != nil {
+		headers := make(map[string][]string, len(p.Headers))
+		for key, values := range p.Headers {
+			headers[key] = slices.Clone(values)
+		}
+		p.Headers = headers
+	}
+	return p
+}
+
+// partJSON is the JSON representation of a Part.
+type partJSON struct {
+	ID       string
+	Headers  map[string][]string
+	Position int
+	Anchor   string
+	Body     []byte `json:",omitempty"`
+	Inline   bool
+	SHA256   string
+
+	// Compression is the algorithm Body is compressed with, or empty if
+	// it isn't compressed.
+	Compression string `json:",omitempty"`
+}
+
+// compressionGzip is the partJSON Compression of Bodies compressed with gzip.
+const compressionGzip = "gzip"
+
+// MarshalJSON encodes the Part as JSON, with its Body base64-encoded. The
+// Body of a non-inline Part lives in blob storage, not with the Part, so it's
+// left out; the Part's SHA256 is always included so the Body can be found.
+// Headers are encoded with their keys sorted, so the output is deterministic.
+//
+// Bodies are never compressed by MarshalJSON; use MarshalForStorage with
+// CompressBodiesOver for that.
+func (p Part) MarshalJSON() ([]byte, error) {
+	return p.marshalJSON(0)
+}
+
+// marshalJSON encodes the Part as JSON like MarshalJSON does, compressing its
+// Body with gzip if it's inline, longer than threshold bytes, and shrinks
+// when compressed. A threshold of zero or less never compresses the Body.
+func (p Part) marshalJSON(threshold int) ([]byte, error) {
+	encoded := partJSON{
+		ID:       p.ID,
+		Headers:  p.Headers,
+		Position: p.Position,
+		Anchor:   p.Anchor,
+		Inline:   p.Inline,
+		SHA256:   p.SHA256,
+	}
+	if p.Inline {
+		encoded.Body = p.Body
+	}
+	if p.Inline && threshold > 0 && len(p.Body) > threshold {
+		compressed, err := gzipBody(p.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error compressing body of part %s: %w", p.ID, err)
+		}
+		if len(compressed) < len(p.Body) {
+			encoded.Body = compressed
+			encoded.Compression = compressionGzip
+		}
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes a Part from JSON produced by MarshalJSON or
+// MarshalForStorage, decompressing its Body if it was compressed. Parts
+// without a Body, like non-inline Parts, are decoded with a nil Body. An
+// error is returned if the Body was compressed with an unknown algorithm,
+// can't be decompressed, or decompresses to more than
+// MaxDecompressedBodySize bytes.
+func (p *Part) UnmarshalJSON(data []byte) error {
+	var decoded partJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	switch decoded.Compression {
+	case "":
+	case compressionGzip:
+		body, err := gunzipBody(decoded.Body, MaxDecompressedBodySize)
+		if err != nil {
+			return fmt.Errorf("error decompressing body of part %s: %w", decoded.ID, err)
+		}
+		decoded.Body = body
+	default:
+		return fmt.Errorf("part %s body has unknown compression %q", decoded.ID, decoded.Compression)
+	}
+	*p = Part{
+		ID:       decoded.ID,
+		Headers:  decoded.Headers,
+		Position: decoded.Position,
+		Anchor:   decoded.Anchor,
+		Body:     decoded.Body,
+		Inline:   decoded.Inline,
+		SHA256:   decoded.SHA256,
+	}
+	return nil
+}
+
+// gzipBody returns body compressed with gzip. The gzip header is left
+// empty, so the same body always compresses to the same bytes.
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MaxDecompressedBodySize is the largest a compressed Body can be once it's
+// decompressed. A few bytes of gzip can decompress to gigabytes, so
+// UnmarshalJSON stops and returns an error wrapping ErrBodyTooLarge rather
+// than decompressing past it.
+const MaxDecompressedBodySize = 64 << 20
+
+// ErrBodyTooLarge is returned when a compressed Body decompresses to more
+// than MaxDecompressedBodySize bytes.
+var ErrBodyTooLarge = errors.New("body too large")
+
+// gunzipBody returns the body gzipBody compressed into compressed. An error
+// wrapping ErrBodyTooLarge is returned if it's more than limit bytes.
+func gunzipBody(compressed []byte, limit int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// read one byte past the limit, so a body that's exactly limit bytes
+	// can be told apart from one that's longer.
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: body decompresses to more than %d bytes", ErrBodyTooLarge, limit)
+	}
+	return body, nil
+}
+
+// StorageOption configures the way MarshalForStorage encodes a Post.
+type StorageOption func(*storageOptions)
+
+type storageOptions struct {
+	compressionThreshold int
+}
+
+// CompressBodiesOver makes MarshalForStorage compress the Body of every
+// inline Part and Metadata part that's longer than threshold bytes with
+// gzip, recording the compression in the Part's JSON so it's decompressed
+// again when the Part is unmarshaled. Bodies that don't get smaller when
+// compressed are left as they are, and so are the Bodies of every Part when
+// threshold is zero or less.
+func CompressBodiesOver(threshold int) StorageOption {
+	return func(opts *storageOptions) {
+		opts.compressionThreshold = threshold
+	}
+}
+
+// storagePost is the JSON representation MarshalForStorage encodes Posts
+// as. Its Parts and Metadata fields take the place of the Post's when it's
+// marshaled, so the Post's other fields are encoded as they always are.
+type storagePost struct {
+	Post
+	Parts    []storagePart
+	Metadata []storagePart
+}
+
+// storagePart is a Part encoded by MarshalForStorage.
+type storagePart struct {
+	part      Part
+	threshold int
+}
+
+// MarshalJSON encodes the Part as JSON, compressing its Body if it's over
+// the threshold.
+func (s storagePart) MarshalJSON() ([]byte, error) {
+	return s.part.marshalJSON(s.threshold)
+}
+
+// MarshalForStorage encodes post as JSON, for storing it. Without options,
+// it's encoded exactly like json.Marshal encodes it; CompressBodiesOver
+// compresses large Part bodies. Whatever options are used, the Post can be
+// decoded with json.Unmarshal.
+func MarshalForStorage(post Post, opts ...StorageOption) ([]byte, error) {
+	var options storageOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.compressionThreshold <= 0 {
+		return json.Marshal(post)
+	}
+	return json.Marshal(storagePost{
+		Post:     post,
+		Parts:    storageParts(post.Parts, options.compressionThreshold),
+		Metadata: storageParts(post.Metadata, options.compressionThreshold),
+	})
+}
+
+// storageParts wraps parts to be encoded by MarshalForStorage. Nil stays
+// nil, so it's still encoded as null.
+func storageParts(parts []Part, threshold int) []storagePart {
+	if parts == nil {
+		return nil
+	}
+	wrapped := make([]storagePart, 0, len(parts))
+	for _, part := range parts {
+		wrapped = append(wrapped, storagePart{part: part, threshold: threshold})
+	}
+	return wrapped
+}
+
+// RoleHeader is the Part header that describes the role the Part plays in
+// its Post. For example, the Metadata part holding a Post's summary has a
+// RoleHeader of RoleSummary. It's used by renderers to give assistive
+// technologies like screen readers the context they need, and to find the
+// Metadata parts holding particular information about a Post; see
+// Post.MetadataPart. Like all headers, its key is matched case-insensitively.
+const RoleHeader = "X-Role"
+
+const (
+	// RoleSummary is the RoleHeader value for the Metadata part holding
+	// a short summary of the Post.
+	RoleSummary = "summary"
+
+	// RoleHeading is the RoleHeader value for a Part that's a heading.
+	RoleHeading = "heading"
+
+	// RoleFigure is the RoleHeader value for a Part that's a figure, like
+	// an image or a chart. Figures must have a CaptionHeader or an
+	// AltHeader describing them.
+	RoleFigure = "figure"
+
+	// RoleCaption is the RoleHeader value for a Part that's a caption for
+	// the figure before it.
+	RoleCaption = "caption"
+
+	// RolePullquote is the RoleHeader value for a Part that's a pull
+	// quote, repeating part of the Post for emphasis.
+	RolePullquote = "pullquote"
+
+	// RoleHeaderImage is the RoleHeader value for the Metadata part
+	// holding the image displayed at the top of a Post or Stream.
+	RoleHeaderImage = "header-image"
+)
+
+// Roles are all the valid values for a Part's RoleHeader.
+var Roles = []string{RoleSummary, RoleHeading, RoleFigure, RoleCaption, RolePullquote, RoleHeaderImage}
+
+const (
+	// CaptionHeader is the Part header holding a caption for the Part,
+	// to be displayed with it.
+	CaptionHeader = "X-Caption"
+
+	// AltHeader is the Part header holding a text description of the
+	// Part, for people who can't see it.
+	AltHeader = "X-Alt"
+)
+
+// Role returns the role the Part plays in its Post, as described by its
+// RoleHeader, or an empty string if it doesn't have one.
+func (p Part) Role() string {
+	values := p.GetHeader(RoleHeader)
+	if len(values) < 1 {
+		return ""
+	}
+	return values[0]
+}
+
+// SetRole sets the Part's RoleHeader to role, returning an error if role
+// isn't one of the Roles. Setting an empty role removes the RoleHeader.
+func (p *Part) SetRole(role string) error {
+	if role == "" {
+		p.SetHeader(RoleHeader)
+		return nil
+	}
+	if !validRole(role) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	p.SetHeader(RoleHeader, role)
+	return nil
+}
+
+// ValidateRole returns an error if the Part's role isn't one of the Roles, or
+// if the Part is a figure without a CaptionHeader or AltHeader describing it.
+func (p Part) ValidateRole() error {
+	role := p.Role()
+	if role == "" {
+		return nil
+	}
+	if !validRole(role) {
+		return fmt.Errorf("part %s has unknown role %q", p.ID, role)
+	}
+	if role == RoleFigure && len(p.GetHeader(CaptionHeader)) < 1 && len(p.GetHeader(AltHeader)) < 1 {
+		return fmt.Errorf("part %s is a figure, but has no %s or %s header", p.ID, CaptionHeader, AltHeader)
+	}
+	return nil
+}
+
+func validRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// MetadataPart returns the inline Metadata part whose RoleHeader is role.
+// If more than one has that role, the one with the lowest Position is
+// returned. Non-inline Metadata parts are ignored, as their bodies aren't
+// part of the Post. The returned bool is false if there's no such part.
+func (p Post) MetadataPart(role string) (Part, bool) {
+	var found Part
+	var ok bool
+	for _, part := range p.Metadata {
+		if !part.Inline || part.Role() != role {
+			continue
+		}
+		if !ok || part.Position < found.Position {
+			found, ok = part, true
+		}
+	}
+	return found, ok
+}
+
+// Summary returns the body of the Post's summary, the inline Metadata part
+// with a RoleHeader of RoleSummary, as described by MetadataPart. The
+// returned bool is false if the Post has no summary.
+func (p Post) Summary() (string, bool) {
+	part, ok := p.MetadataPart(RoleSummary)
+	if !ok {
+		return "", false
+	}
+	return string(part.Body), true
+}
+
+// DefaultSingleValuedHeaders are the Part headers that only make sense with a
+// single value.
+var DefaultSingleValuedHeaders = []string{"Content-Type", RoleHeader}
+
+// NormalizeHeaders canonicalizes the keys of the Part's headers using the
+// same rules as MIME headers, so "content-type" becomes "Content-Type".
+// Values for keys that canonicalize to the same key are combined. If any of
+// the headers in singleValued end up with more than one value, an error is
+// returned and the Part is left untouched.
+func (p *Part) NormalizeHeaders(singleValued []string) error {
+	if p.Headers == nil {
+		return nil
+	}
+	headers := canonicalHeaders(p.Headers)
+	for _, key := range singleValued {
+		key = textproto.CanonicalMIMEHeaderKey(key)
+		if len(headers[key]) > 1 {
+			return fmt.Errorf("part %s has %d values for header %s, only one is allowed", p.ID, len(headers[key]), key)
+		}
+	}
+	p.Headers = headers
+	return nil
+}
+
+// canonicalHeaders returns headers with its keys canonicalized using the same
+// rules as MIME headers, so "content-type" becomes "Content-Type". Values for
+// keys that canonicalize to the same key are combined. If every key is
+// already canonical, headers itself is returned.
+func canonicalHeaders(headers map[string][]string) map[string][]string {
+	canonical := true
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+		if textproto.CanonicalMIMEHeaderKey(key) != key {
+			canonical = false
+		}
+	}
+	if canonical {
+		return headers
+	}
+	// sort the keys so values combined from keys that only differ in case
+	// always end up in the same order.
+	sort.Strings(keys)
+	combined := make(map[string][]string, len(headers))
+	for _, key := range keys {
+		canonicalKey := textproto.CanonicalMIMEHeaderKey(key)
+		combined[canonicalKey] = append(combined[canonicalKey], headers[key]...)
+	}
+	return combined
+}
+
+// GetHeader returns the values of the Part's header named key, ignoring
+// case, so GetHeader("content-type") finds a Content-Type header. If the
+// Part's headers have more than one key that only differ in case, their
+// values are combined, the same way NormalizeHeaders would.
+func (p Part) GetHeader(key string) []string {
+	return canonicalHeaders(p.Headers)[textproto.CanonicalMIMEHeaderKey(key)]
+}
+
+// SetHeader sets the values of the Part's header named key, canonicalizing
+// the key the same way NormalizeHeaders does and replacing any values set
+// under a key that only differs in case. Setting no values removes the
+// header.
+func (p *Part) SetHeader(key string, values ...string) {
+	canonical := textproto.CanonicalMIMEHeaderKey(key)
+	for existing := range p.Headers {
+		if textproto.CanonicalMIMEHeaderKey(existing) == canonical {
+			delete(p.Headers, existing)
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+	if p.Headers == nil {
+		p.Headers = map[string][]string{}
+	}
+	p.Headers[canonical] = values
+}
+
+// ContentType returns the media type of the Part's Content-Type header,
+// lowercased and without any parameters, or an empty string if the Part has
+// no valid Content-Type header.
+func (p Part) ContentType() string {
+	values := p.GetHeader("Content-Type")
+	if len(values) < 1 {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(values[0])
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// sha256Hex returns the hex-encoded SHA 256 sum of body, suitable for use as
+// a Part's SHA256.
+func sha256Hex(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// ErrSHA256Mismatch is returned when a Part's SHA256 doesn't match its Body.
+var ErrSHA256Mismatch = errors.New("SHA256 does not match body")
+
+// ComputeSHA256 sets the Part's SHA256 to the hex-encoded SHA 256 sum of its
+// Body. A Part with an empty Body gets the SHA 256 sum of the empty string,
+// not an empty SHA256.
+func (p *Part) ComputeSHA256() {
+	p.SHA256 = sha256Hex(p.Body)
+}
+
+// VerifySHA256 returns an error wrapping ErrSHA256Mismatch if the Part's
+// SHA256 isn't the SHA 256 sum of its Body. Non-inline Parts need their Body
+// loaded from wherever it's stored before they can be verified.
+func (p Part) VerifySHA256() error {
+	sum := sha256Hex(p.Body)
+	if p.SHA256 != sum {
+		return fmt.Errorf("%w: part %s has SHA256 %q, body has %q", ErrSHA256Mismatch, p.ID, p.SHA256, sum)
+	}
+	return nil
+}
+
+// CoalesceTextParts merges each run of adjacent inline Parts that share a
+// text/* content type into a single Part, joining their bodies with a blank
+// line. The merged Part keeps the ID and headers of the first Part in the
+// run. Every Part's Position is updated to match its new place in the Post.
+func (p *Post) CoalesceTextParts() {
+	var coalesced []Part
+	for _, part := range p.Parts {
+		if len(coalesced) > 0 {
+			last := &coalesced[len(coalesced)-1]
+			if coalescible(*last, part) {
+				body := make([]byte, 0, len(last.Body)+len(part.Body)+2)
+				body = append(body, last.Body...)
+				body = append(body, "\n\n"...)
+				body = append(body, part.Body...)
+				last.Body = body
+				last.ComputeSHA256()
+				continue
+			}
+		}
+		coalesced = append(coalesced, part)
+	}
+	for pos := range coalesced {
+		coalesced[pos].Position = pos
+	}
+	p.Parts = coalesced
+}
+
+// coalescible returns true if b can be merged into a by CoalesceTextParts.
+func coalescible(a, b Part) bool {
+	if !a.Inline || !b.Inline {
+		return false
+	}
+	mediaType := a.ContentType()
+	if !strings.HasPrefix(mediaType, "text/") {
+		return false
+	}
+	return mediaType == b.ContentType()
+}
+
+// HasPositionGaps returns true if the Positions of the Post's Parts or
+// Metadata, in the order they're stored, aren't 0, 1, 2, and so on. This
+// usually happens after Parts are removed without the remaining Parts being
+// renumbered. NormalizeParts will close the gaps.
+func (p Post) HasPositionGaps() bool {
+	return hasPositionGaps(p.Parts) || hasPositionGaps(p.Metadata)
+}
+
+func hasPositionGaps(parts []Part) bool {
+	for pos, part := range parts {
+		if part.Position != pos {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeParts sorts the Post's Parts and Metadata by their Position, then
+// renumbers them so their Positions are contiguous, starting at 0.
+func (p *Post) NormalizeParts() {
+	p.Parts = normalizedParts(p.Parts)
+	p.Metadata = normalizedParts(p.Metadata)
+}
+
+// normalizedParts returns a copy of parts sorted by Position and renumbered
+// to have contiguous Positions starting at 0.
+func normalizedParts(parts []Part) []Part {
+	if parts == nil {
+		return nil
+	}
+	normalized := make([]Part, len(parts))
+	copy(normalized, parts)
+	sort.SliceStable(normalized, func(i, j int) bool {
+		return normalized[i].Position < normalized[j].Position
+	})
+	for pos := range normalized {
+		normalized[pos].Position = pos
+	}
+	return normalized
+}
+
+// PostFieldSet records which of a Post's properties differ between two
+// versions of the Post.
+type PostFieldSet struct {
+	TitleChanged        bool
+	SlugChanged         bool
+	AuthorsChanged      bool
+	PartsChanged        bool
+	MetadataChanged     bool
+	StreamsChanged      bool
+	DraftChanged        bool
+	DeletedChanged      bool
+	PublishedAtChanged  bool
+	ScheduledForChanged bool
+}
+
+// ChangedFields reports which of the Post's properties are different in
+// other. It only compares the properties, without working out how they
+// changed, so it's much cheaper than GenerateRevision; callers can use it to
+// decide whether there's any work to do before doing it.
+func (p Post) ChangedFields(other Post) PostFieldSet {
+	return PostFieldSet{
+		TitleChanged:        p.Title != other.Title,
+		SlugChanged:         p.Slug != other.Slug,
+		AuthorsChanged:      !stringsEqual(p.Authors, other.Authors),
+		PartsChanged:        !partsEqual(p.Parts, other.Parts),
+		MetadataChanged:     !partsEqual(p.Metadata, other.Metadata),
+		StreamsChanged:      !stringsEqual(p.Streams, other.Streams),
+		DraftChanged:        p.Draft != other.Draft,
+		DeletedChanged:      p.Deleted != other.Deleted,
+		PublishedAtChanged:  !p.PublishedAt.Equal(other.PublishedAt),
+		ScheduledForChanged: !timesEqual(p.ScheduledFor, other.ScheduledFor),
+	}
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for pos := range a {
+		if a[pos] != b[pos] {
+			return false
+		}
+	}
+	return true
+}
+
+func partsEqual(a, b []Part) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for pos := range a {
+		if a[pos].ID != b[pos].ID ||
+			a[pos].Position != b[pos].Position ||
+			a[pos].Anchor != b[pos].Anchor ||
+			a[pos].Inline != b[pos].Inline ||
+			a[pos].SHA256 != b[pos].SHA256 ||
+			!bytes.Equal(a[pos].Body, b[pos].Body) ||
+			!headersEqual(a[pos].Headers, b[pos].Headers) {
+			return false
+		}
+	}
+	return true
+}
+
+func headersEqual(a, b map[string][]string) bool {
+	a, b = canonicalHeaders(a), canonicalHeaders(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for key, values := range a {
+		other, ok := b[key]
+		if !ok || !stringsEqual(values, other) {
+			return false
+		}
+	}
+	return true
+}
+
+func timesEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// anchorPattern matches valid Part anchors: lowercase letters and numbers,
+// separated by single hyphens.
+var anchorPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// PartByAnchor returns the Part in the Post's Parts with the passed anchor.
+// If there isn't one, the returned bool will be false.
+func (p Post) PartByAnchor(anchor string) (Part, bool) {
+	if anchor == "" {
+		return Part{}, false
+	}
+	for _, part := range p.Parts {
+		if part.Anchor == anchor {
+			return part, true
+		}
+	}
+	return Part{}, false
+}
+
+// ValidateAnchors returns an error if any of the Post's Parts or Metadata
+// have an anchor that isn't slug-like, or if any two have the same anchor.
+func (p Post) ValidateAnchors() error {
+	seen := map[string]string{}
+	for _, parts := range [][]Part{p.Parts, p.Metadata} {
+		for _, part := range parts {
+			if part.Anchor == "" {
+				continue
+			}
+			if !anchorPattern.MatchString(part.Anchor) {
+				return fmt.Errorf("part %s has invalid anchor %q", part.ID, part.Anchor)
+			}
+			if other, ok := seen[part.Anchor]; ok {
+				return fmt.Errorf("parts %s and %s have the same anchor %q", other, part.ID, part.Anchor)
+			}
+			seen[part.Anchor] = part.ID
+		}
+	}
+	return nil
+}
@@ -1,6 +1,14 @@
 package posts
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrEventNotFound is returned when an EventStorer is asked for the events of
+// a Post it has no events for.
+var ErrEventNotFound = errors.New("event not found")
 
 // PostEventType is an enum of different types of events that can happen to a
 // post.
@@ -22,6 +30,9 @@ const (
 	// PostEventTypeUnpublished is used when an event is recording that a
 	// published post was reverted to a draft.
 	PostEventTypeUnpublished PostEventType = "unpublished"
+	// PostEventTypeRestored is used when an event is recording that a
+	// deleted post was restored.
+	PostEventTypeRestored PostEventType = "restored"
 )
 
 // PostEventActorType is an enum of different types of actors that can take
@@ -41,6 +52,8 @@ const (
 type PostEvent struct {
 	// A UUID for this event.
 	ID string
+	// The ID of the post the action was taken on.
+	PostID string
 	// The type of the event, describing what happened.
 	Type PostEventType
 	// The IP the action was taken from, for audit purposes.
@@ -56,3 +69,113 @@ type PostEvent struct {
 	// The date and time the action was taken.
 	Timestamp time.Time
 }
+
+// PostEventTypeFor returns the type of event describing a Storer operation
+// that changed a Post from before to after. before is nil when the Post was
+// just created.
+//
+// Deleting or restoring a Post takes precedence over publishing or
+// unpublishing it, and any other change is an update.
+func PostEventTypeFor(before *Post, after Post) PostEventType {
+	switch {
+	case before == nil:
+		return PostEventTypeCreated
+	case after.Deleted && !before.Deleted:
+		return PostEventTypeDeleted
+	case before.Deleted && !after.Deleted:
+		return PostEventTypeRestored
+	case before.Draft && !after.Draft:
+		return PostEventTypePublished
+	case !before.Draft && after.Draft:
+		return PostEventTypeUnpublished
+	}
+	return PostEventTypeUpdated
+}
+
+// NewPostEvent returns a PostEvent recording a Storer operation that changed
+// a Post from before to after at now, as described by PostEventTypeFor. The
+// event gets a new random ID; callers are expected to fill in who took the
+// action and where they took it from.
+func NewPostEvent(before *Post, after Post, now time.Time) (PostEvent, error) {
+	id, err := newUUID()
+	if err != nil {
+		return PostEvent{}, err
+	}
+	return PostEvent{
+		ID:        id,
+		PostID:    after.ID,
+		Type:      PostEventTypeFor(before, after),
+		Timestamp: now,
+	}, nil
+}
+
+// EventFilter represents a filter that can be applied to PostEvents to return
+// only the events the caller is interested in.
+type EventFilter struct {
+	// Types, when non-empty, filters for events with one of its values as
+	// their Type.
+	Types []PostEventType
+
+	// Actors, when non-empty, filters for events with one of its values
+	// as their Actor.
+	Actors []string
+
+	// Before specifies the maximum timestamp, exclusive, that events
+	// should have in their Timestamp property.
+	Before *time.Time
+
+	// After specifies the minimum timestamp, exclusive, that events should
+	// have in their Timestamp property.
+	After *time.Time
+}
+
+// Matches returns true if event passes the filter.
+func (f EventFilter) Matches(event PostEvent) bool {
+	if len(f.Types) > 0 {
+		found := false
+		for _, typ := range f.Types {
+			if event.Type == typ {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Actors) > 0 {
+		found := false
+		for _, actor := range f.Actors {
+			if event.Actor == actor {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Before != nil && !event.Timestamp.Before(*f.Before) {
+		return false
+	}
+	if f.After != nil && !event.Timestamp.After(*f.After) {
+		return false
+	}
+	return true
+}
+
+// EventStorer captures the interface for storing and retrieving PostEvents,
+// building an audit log of the actions taken on Posts.
+type EventStorer interface {
+	// RecordEvent persists event, returning an error if any necessary
+	// fields are missing or if the event can't be written.
+	RecordEvent(ctx context.Context, event PostEvent) error
+
+	// ListEvents retrieves the events recorded for the Post indicated by
+	// the passed postID that match the passed filter, sorted by their
+	// Timestamp descending, so the most recent event comes first. If no
+	// events have been recorded for the Post at all, an error wrapping
+	// ErrEventNotFound is returned; if events have been recorded but none
+	// match the filter, an empty list is returned.
+	ListEvents(ctx context.Context, postID string, filter EventFilter) ([]PostEvent, error)
+}
@@ -0,0 +1,59 @@
+package posts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPostEventTypeFor(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		before *Post
+		after  Post
+		want   PostEventType
+	}{
+		"created":       {before: nil, after: Post{ID: "post", Draft: true}, want: PostEventTypeCreated},
+		"updated":       {before: &Post{ID: "post", Title: "Old"}, after: Post{ID: "post", Title: "New"}, want: PostEventTypeUpdated},
+		"published":     {before: &Post{ID: "post", Draft: true}, after: Post{ID: "post"}, want: PostEventTypePublished},
+		"unpublished":   {before: &Post{ID: "post"}, after: Post{ID: "post", Draft: true}, want: PostEventTypeUnpublished},
+		"deleted":       {before: &Post{ID: "post"}, after: Post{ID: "post", Deleted: true}, want: PostEventTypeDeleted},
+		"deleted-draft": {before: &Post{ID: "post"}, after: Post{ID: "post", Draft: true, Deleted: true}, want: PostEventTypeDeleted},
+		"restored":      {before: &Post{ID: "post", Deleted: true}, after: Post{ID: "post"}, want: PostEventTypeRestored},
+		"still-deleted": {before: &Post{ID: "post", Deleted: true}, after: Post{ID: "post", Deleted: true, Title: "New"}, want: PostEventTypeUpdated},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := PostEventTypeFor(test.before, test.after)
+			if got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestNewPostEvent(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	event, err := NewPostEvent(nil, Post{ID: "post"}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !uuidPattern.MatchString(event.ID) {
+		t.Errorf("expected a UUID ID, got %q", event.ID)
+	}
+	if event.PostID != "post" {
+		t.Errorf("expected post ID %q, got %q", "post", event.PostID)
+	}
+	if event.Type != PostEventTypeCreated {
+		t.Errorf("expected type %s, got %s", PostEventTypeCreated, event.Type)
+	}
+	if !event.Timestamp.Equal(now) {
+		t.Errorf("expected timestamp %s, got %s", now, event.Timestamp)
+	}
+}
@@ -0,0 +1,783 @@
+package posts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPostIsScheduled(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+
+	tests := map[string]struct {
+		post Post
+		want bool
+	}{
+		"future-draft": {
+			post: Post{Draft: true, ScheduledFor: &future},
+			want: true,
+		},
+		"past-due-draft": {
+			post: Post{Draft: true, ScheduledFor: &past},
+			want: false,
+		},
+		"due-now-draft": {
+			post: Post{Draft: true, ScheduledFor: &now},
+			want: false,
+		},
+		"unscheduled-draft": {
+			post: Post{Draft: true},
+			want: false,
+		},
+		"published": {
+			post: Post{ScheduledFor: &future},
+			want: false,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := test.post.IsScheduled(now); got != test.want {
+				t.Errorf("expected IsScheduled to return %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestPostClone(t *testing.T) {
+	t.Parallel()
+
+	scheduledFor := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	original := Post{
+		ID:           "post",
+		Title:        "Hello",
+		Authors:      []string{"alice"},
+		Streams:      []string{},
+		ScheduledFor: &scheduledFor,
+		Parts: []Part{
+			{ID: "intro", Inline: true, Body: []byte("Hello, world"), Headers: map[string][]string{"Content-Type": {"text/plain"}}},
+			{ID: "image", Position: 1, SHA256: "abc123"},
+		},
+		Metadata: []Part{
+			{ID: "summary", Inline: true, Body: []byte("A summary."), Headers: map[string][]string{RoleHeader: {RoleSummary}}},
+		},
+	}
+	want := Post{
+		ID:           "post",
+		Title:        "Hello",
+		Authors:      []string{"alice"},
+		Streams:      []string{},
+		ScheduledFor: &scheduledFor,
+		Parts: []Part{
+			{ID: "intro", Inline: true, Body: []byte("Hello, world"), Headers: map[string][]string{"Content-Type": {"text/plain"}}},
+			{ID: "image", Position: 1, SHA256: "abc123"},
+		},
+		Metadata: []Part{
+			{ID: "summary", Inline: true, Body: []byte("A summary."), Headers: map[string][]string{RoleHeader: {RoleSummary}}},
+		},
+	}
+
+	clone := original.Clone()
+	if !reflect.DeepEqual(clone, original) {
+		t.Fatalf("expected clone to equal the original\n%+v\ngot\n%+v", original, clone)
+	}
+
+	clone.Authors[0] = "bob"
+	clone.Parts[0].Body[0] = 'J'
+	clone.Parts[0].Headers["Content-Type"][0] = "text/markdown"
+	clone.Parts[0].Headers["X-Tag"] = []string{"new"}
+	clone.Parts[1].SHA256 = "def456"
+	clone.Metadata[0].Body = append(clone.Metadata[0].Body[:0], "Changed."...)
+	*clone.ScheduledFor = clone.ScheduledFor.Add(time.Hour)
+
+	if !reflect.DeepEqual(original, want) {
+		t.Errorf("expected modifying the clone to leave the original unchanged\n%+v\ngot\n%+v", want, original)
+	}
+}
+
+func TestPartNormalizeHeaders(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		headers map[string][]string
+		want    map[string][]string
+		wantErr bool
+	}{
+		"canonicalizes-keys": {
+			headers: map[string][]string{
+				"content-type": {"text/plain"},
+				"x-custom":     {"a", "b"},
+			},
+			want: map[string][]string{
+				"Content-Type": {"text/plain"},
+				"X-Custom":     {"a", "b"},
+			},
+		},
+		"combines-keys": {
+			headers: map[string][]string{
+				"x-custom": {"b"},
+				"X-Custom": {"a"},
+			},
+			want: map[string][]string{
+				"X-Custom": {"a", "b"},
+			},
+		},
+		"duplicated-content-type": {
+			headers: map[string][]string{
+				"Content-Type": {"text/plain", "text/html"},
+			},
+			wantErr: true,
+		},
+		"content-type-differing-in-case": {
+			headers: map[string][]string{
+				"Content-Type": {"text/plain"},
+				"content-type": {"text/html"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			part := Part{ID: "part", Headers: test.headers}
+			err := part.NormalizeHeaders(DefaultSingleValuedHeaders)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got headers %v", part.Headers)
+				}
+				if !reflect.DeepEqual(part.Headers, test.headers) {
+					t.Errorf("expected headers to be untouched, got %v", part.Headers)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(part.Headers, test.want) {
+				t.Errorf("expected headers %v, got %v", test.want, part.Headers)
+			}
+		})
+	}
+}
+
+func TestPartRole(t *testing.T) {
+	t.Parallel()
+
+	var part Part
+	if role := part.Role(); role != "" {
+		t.Errorf("expected no role, got %q", role)
+	}
+	if err := part.SetRole(RoleHeading); err != nil {
+		t.Fatalf("unexpected error setting role: %s", err)
+	}
+	if role := part.Role(); role != RoleHeading {
+		t.Errorf("expected role %q, got %q", RoleHeading, role)
+	}
+	if err := part.SetRole("banner"); err == nil {
+		t.Errorf("expected an error setting an unknown role")
+	}
+	if role := part.Role(); role != RoleHeading {
+		t.Errorf("expected unknown role not to be set, got %q", role)
+	}
+	if err := part.SetRole(""); err != nil {
+		t.Fatalf("unexpected error clearing role: %s", err)
+	}
+	if _, ok := part.Headers[RoleHeader]; ok {
+		t.Errorf("expected clearing the role to remove the header, got %v", part.Headers)
+	}
+}
+
+func TestPostSummary(t *testing.T) {
+	t.Parallel()
+
+	role := func(role string) map[string][]string {
+		return map[string][]string{RoleHeader: {role}, "Content-Type": {"text/plain"}}
+	}
+	tests := map[string]struct {
+		metadata []Part
+		want     string
+		wantOK   bool
+	}{
+		"no-metadata": {},
+		"no-summary": {
+			metadata: []Part{{ID: "cover", Position: 0, SHA256: "abc123", Headers: role(RoleHeaderImage)}},
+		},
+		"summary": {
+			metadata: []Part{
+				{ID: "cover", Position: 0, SHA256: "abc123", Headers: role(RoleHeaderImage)},
+				{ID: "summary", Position: 1, Inline: true, Body: []byte("A short summary."), Headers: role(RoleSummary)},
+			},
+			want:   "A short summary.",
+			wantOK: true,
+		},
+		"lowest-position": {
+			metadata: []Part{
+				{ID: "second", Position: 2, Inline: true, Body: []byte("Second."), Headers: role(RoleSummary)},
+				{ID: "first", Position: 1, Inline: true, Body: []byte("First."), Headers: role(RoleSummary)},
+			},
+			want:   "First.",
+			wantOK: true,
+		},
+		"not-inline": {
+			metadata: []Part{{ID: "summary", SHA256: "abc123", Headers: role(RoleSummary)}},
+		},
+		"lowercase-header": {
+			metadata: []Part{{ID: "summary", Inline: true, Body: []byte("Summary."), Headers: map[string][]string{"x-role": {RoleSummary}}}},
+			want:     "Summary.",
+			wantOK:   true,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			post := Post{ID: "post", Metadata: test.metadata}
+			got, ok := post.Summary()
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("expected %q (%v), got %q (%v)", test.want, test.wantOK, got, ok)
+			}
+			if _, ok := post.MetadataPart(RoleHeaderImage); ok {
+				t.Errorf("expected non-inline header image not to be found")
+			}
+		})
+	}
+}
+
+func TestPartHeaders(t *testing.T) {
+	t.Parallel()
+
+	part := Part{Headers: map[string][]string{"content-type": {"text/plain"}}}
+	if got := part.GetHeader("Content-Type"); !reflect.DeepEqual(got, []string{"text/plain"}) {
+		t.Errorf("expected a lowercase key to be found, got %v", got)
+	}
+	if got := part.ContentType(); got != "text/plain" {
+		t.Errorf("expected content type %q, got %q", "text/plain", got)
+	}
+
+	part.SetHeader("CONTENT-TYPE", "text/html")
+	want := map[string][]string{"Content-Type": {"text/html"}}
+	if !reflect.DeepEqual(part.Headers, want) {
+		t.Errorf("expected headers %v, got %v", want, part.Headers)
+	}
+
+	part.SetHeader("x-custom", "a", "b")
+	if got := part.GetHeader("X-CUSTOM"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("expected both values, got %v", got)
+	}
+	part.SetHeader("X-Custom")
+	if _, ok := part.Headers["X-Custom"]; ok {
+		t.Errorf("expected setting no values to remove the header, got %v", part.Headers)
+	}
+
+	var empty Part
+	if got := empty.ContentType(); got != "" {
+		t.Errorf("expected no content type, got %q", got)
+	}
+}
+
+func TestPartValidateRole(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		headers map[string][]string
+		wantErr bool
+	}{
+		"no-role": {},
+		"heading": {
+			headers: map[string][]string{RoleHeader: {RoleHeading}},
+		},
+		"unknown-role": {
+			headers: map[string][]string{RoleHeader: {"banner"}},
+			wantErr: true,
+		},
+		"figure-with-caption": {
+			headers: map[string][]string{RoleHeader: {RoleFigure}, CaptionHeader: {"A cat."}},
+		},
+		"figure-with-alt": {
+			headers: map[string][]string{RoleHeader: {RoleFigure}, AltHeader: {"A cat asleep in the sun."}},
+		},
+		"figure-without-caption": {
+			headers: map[string][]string{RoleHeader: {RoleFigure}},
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := Part{ID: "part", Headers: test.headers}.ValidateRole()
+			if test.wantErr && err == nil {
+				t.Errorf("expected an error, got nil")
+			} else if !test.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestPostCoalesceTextParts(t *testing.T) {
+	t.Parallel()
+
+	markdown := map[string][]string{"Content-Type": {"text/markdown"}}
+	image := map[string][]string{"Content-Type": {"image/png"}}
+	post := Post{
+		Parts: []Part{
+			{ID: "a", Position: 0, Inline: true, Headers: markdown, Body: []byte("# Title")},
+			{ID: "b", Position: 1, Inline: true, Headers: markdown, Body: []byte("First paragraph.")},
+			{ID: "c", Position: 2, Inline: true, Headers: markdown, Body: []byte("Second paragraph.")},
+			{ID: "d", Position: 3, Headers: image, SHA256: "abc123"},
+			{ID: "e", Position: 4, Inline: true, Headers: markdown, Body: []byte("After the image.")},
+			{ID: "f", Position: 5, Inline: true, Headers: map[string][]string{"Content-Type": {"text/html"}}, Body: []byte("<p>HTML.</p>")},
+		},
+	}
+
+	post.CoalesceTextParts()
+
+	wantBody := "# Title\n\nFirst paragraph.\n\nSecond paragraph."
+	want := []Part{
+		{ID: "a", Position: 0, Inline: true, Headers: markdown, Body: []byte(wantBody), SHA256: sha256Hex([]byte(wantBody))},
+		{ID: "d", Position: 1, Headers: image, SHA256: "abc123"},
+		{ID: "e", Position: 2, Inline: true, Headers: markdown, Body: []byte("After the image.")},
+		{ID: "f", Position: 3, Inline: true, Headers: map[string][]string{"Content-Type": {"text/html"}}, Body: []byte("<p>HTML.</p>")},
+	}
+	if !reflect.DeepEqual(post.Parts, want) {
+		t.Errorf("expected parts\n%+v\ngot\n%+v", want, post.Parts)
+	}
+}
+
+func TestPostNormalizeParts(t *testing.T) {
+	t.Parallel()
+
+	post := Post{
+		Parts: []Part{
+			{ID: "a", Position: 0},
+			{ID: "b", Position: 1},
+			{ID: "d", Position: 4},
+			{ID: "c", Position: 3},
+		},
+		Metadata: []Part{
+			{ID: "summary", Position: 0},
+		},
+	}
+	original := make([]Part, len(post.Parts))
+	copy(original, post.Parts)
+
+	if !post.HasPositionGaps() {
+		t.Fatalf("expected gaps to be detected")
+	}
+	post.NormalizeParts()
+	if post.HasPositionGaps() {
+		t.Errorf("expected no gaps after normalizing, got %+v", post.Parts)
+	}
+	want := []Part{
+		{ID: "a", Position: 0},
+		{ID: "b", Position: 1},
+		{ID: "c", Position: 2},
+		{ID: "d", Position: 3},
+	}
+	if !reflect.DeepEqual(post.Parts, want) {
+		t.Errorf("expected parts %+v, got %+v", want, post.Parts)
+	}
+	if original[2].Position != 4 {
+		t.Errorf("expected the original slice to be untouched, got %+v", original)
+	}
+
+	if (Post{Metadata: []Part{{ID: "a", Position: 1}}}).HasPositionGaps() != true {
+		t.Errorf("expected gaps in Metadata to be detected")
+	}
+	if (Post{}).HasPositionGaps() {
+		t.Errorf("expected an empty post to have no gaps")
+	}
+}
+
+func TestPostChangedFields(t *testing.T) {
+	t.Parallel()
+
+	published := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	base := Post{
+		ID:          "post",
+		Title:       "Title",
+		Slug:        "title",
+		Authors:     []string{"alice"},
+		Streams:     []string{"blog"},
+		PublishedAt: published,
+		Parts: []Part{
+			{ID: "a", Inline: true, Body: []byte("body"), Headers: map[string][]string{"Content-Type": {"text/plain"}}},
+		},
+		Metadata: []Part{
+			{ID: "summary", Inline: true, Body: []byte("summary")},
+		},
+	}
+
+	tests := map[string]struct {
+		modify func(post *Post)
+		want   PostFieldSet
+	}{
+		"unchanged": {
+			modify: func(post *Post) {
+				// same instant, different location
+				post.PublishedAt = published.In(time.FixedZone("EST", -5*60*60))
+			},
+		},
+		"title-and-body": {
+			modify: func(post *Post) {
+				post.Title = "New Title"
+				post.Parts = []Part{
+					{ID: "a", Inline: true, Body: []byte("new body"), Headers: map[string][]string{"Content-Type": {"text/plain"}}},
+				}
+			},
+			want: PostFieldSet{TitleChanged: true, PartsChanged: true},
+		},
+		"part-headers": {
+			modify: func(post *Post) {
+				post.Parts = []Part{
+					{ID: "a", Inline: true, Body: []byte("body"), Headers: map[string][]string{"Content-Type": {"text/markdown"}}},
+				}
+			},
+			want: PostFieldSet{PartsChanged: true},
+		},
+		"authors-and-streams": {
+			modify: func(post *Post) {
+				post.Authors = []string{"alice", "bob"}
+				post.Streams = []string{"archive"}
+			},
+			want: PostFieldSet{AuthorsChanged: true, StreamsChanged: true},
+		},
+		"metadata": {
+			modify: func(post *Post) {
+				post.Metadata = nil
+			},
+			want: PostFieldSet{MetadataChanged: true},
+		},
+		"status": {
+			modify: func(post *Post) {
+				scheduled := published.Add(time.Hour)
+				post.Slug = "new-title"
+				post.Draft = true
+				post.Deleted = true
+				post.PublishedAt = time.Time{}
+				post.ScheduledFor = &scheduled
+			},
+			want: PostFieldSet{
+				SlugChanged:         true,
+				DraftChanged:        true,
+				DeletedChanged:      true,
+				PublishedAtChanged:  true,
+				ScheduledForChanged: true,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			other := base
+			test.modify(&other)
+			if got := base.ChangedFields(other); got != test.want {
+				t.Errorf("expected %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestPostPartByAnchor(t *testing.T) {
+	t.Parallel()
+
+	post := Post{Parts: []Part{
+		{ID: "a"},
+		{ID: "b", Anchor: "section-2"},
+		{ID: "c", Anchor: "section-3"},
+	}}
+
+	part, ok := post.PartByAnchor("section-3")
+	if !ok || part.ID != "c" {
+		t.Errorf("expected to find part c, got %+v (%v)", part, ok)
+	}
+	if part, ok := post.PartByAnchor("section-4"); ok {
+		t.Errorf("expected not to find a part, got %+v", part)
+	}
+	if part, ok := post.PartByAnchor(""); ok {
+		t.Errorf("expected an empty anchor not to match, got %+v", part)
+	}
+}
+
+func TestPostValidateAnchors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		post    Post
+		wantErr bool
+	}{
+		"unique": {
+			post: Post{
+				Parts:    []Part{{ID: "a", Anchor: "intro"}, {ID: "b"}, {ID: "c"}, {ID: "d", Anchor: "section-2"}},
+				Metadata: []Part{{ID: "summary", Anchor: "summary"}},
+			},
+		},
+		"duplicate": {
+			post:    Post{Parts: []Part{{ID: "a", Anchor: "intro"}, {ID: "b", Anchor: "intro"}}},
+			wantErr: true,
+		},
+		"duplicate-across-sections": {
+			post: Post{
+				Parts:    []Part{{ID: "a", Anchor: "summary"}},
+				Metadata: []Part{{ID: "summary", Anchor: "summary"}},
+			},
+			wantErr: true,
+		},
+		"not-slug-like": {
+			post:    Post{Parts: []Part{{ID: "a", Anchor: "Section 2"}}},
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := test.post.ValidateAnchors()
+			if test.wantErr && err == nil {
+				t.Errorf("expected an error, got nil")
+			} else if !test.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestPartJSON(t *testing.T) {
+	t.Parallel()
+
+	post := Post{
+		ID: "post",
+		Parts: []Part{
+			{ID: "text", Position: 0, Inline: true, Body: []byte("Hello"), SHA256: sha256Hex([]byte("Hello")), Headers: map[string][]string{
+				"X-Role":       {RoleHeading},
+				"Content-Type": {"text/plain"},
+			}},
+			{ID: "image", Position: 1, Anchor: "photo", Body: []byte("not serialized"), SHA256: "abc123"},
+		},
+	}
+
+	encoded, err := json.Marshal(post)
+	if err != nil {
+		t.Fatalf("unexpected error marshaling post: %s", err)
+	}
+	if bytes.Contains(encoded, []byte(base64.StdEncoding.EncodeToString([]byte("not serialized")))) {
+		t.Errorf("expected non-inline body to be left out, got %s", encoded)
+	}
+	if !bytes.Contains(encoded, []byte(`"Headers":{"Content-Type":["text/plain"],"X-Role":["heading"]}`)) {
+		t.Errorf("expected headers to be sorted, got %s", encoded)
+	}
+	again, err := json.Marshal(post)
+	if err != nil {
+		t.Fatalf("unexpected error marshaling post: %s", err)
+	}
+	if !bytes.Equal(encoded, again) {
+		t.Errorf("expected marshaling to be deterministic, got\n%s\nand\n%s", encoded, again)
+	}
+
+	var decoded Post
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unexpected error unmarshaling post: %s", err)
+	}
+	want := post
+	want.Parts = append([]Part(nil), post.Parts...)
+	want.Parts[1].Body = nil
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("expected\n%+v\ngot\n%+v", want, decoded)
+	}
+}
+
+func TestMarshalForStorage(t *testing.T) {
+	t.Parallel()
+
+	// incompressible is a body that's long enough to be compressed, but
+	// doesn't shrink when it is.
+	var incompressible []byte
+	sum := []byte("seed")
+	for len(incompressible) < 512 {
+		next := sha256.Sum256(sum)
+		sum = next[:]
+		incompressible = append(incompressible, sum...)
+	}
+	large := bytes.Repeat([]byte("All work and no play makes Jack a dull boy. "), 100)
+
+	tests := map[string]struct {
+		part           Part
+		wantCompressed bool
+	}{
+		"small": {
+			part: inlinePart("small", 0, "Hello"),
+		},
+		"large": {
+			part:           inlinePart("large", 0, string(large)),
+			wantCompressed: true,
+		},
+		"incompressible": {
+			part: inlinePart("incompressible", 0, string(incompressible)),
+		},
+		"non-inline": {
+			part: Part{ID: "image", Position: 0, Body: large, SHA256: sha256Hex(large)},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			post := Post{ID: "post", Parts: []Part{test.part}, Metadata: []Part{test.part}}
+			plain, err := MarshalForStorage(post)
+			if err != nil {
+				t.Fatalf("unexpected error marshaling post: %s", err)
+			}
+			unmarshaled, err := json.Marshal(post)
+			if err != nil {
+				t.Fatalf("unexpected error marshaling post: %s", err)
+			}
+			if !bytes.Equal(plain, unmarshaled) {
+				t.Errorf("expected marshaling without options to match json.Marshal, got\n%s\nand\n%s", plain, unmarshaled)
+			}
+
+			encoded, err := MarshalForStorage(post, CompressBodiesOver(256))
+			if err != nil {
+				t.Fatalf("unexpected error marshaling post: %s", err)
+			}
+			compressed := bytes.Count(encoded, []byte(`"Compression":"gzip"`))
+			if test.wantCompressed && compressed != 2 {
+				t.Errorf("expected the part and metadata bodies to be compressed, got %s", encoded)
+			}
+			if !test.wantCompressed && compressed != 0 {
+				t.Errorf("expected bodies not to be compressed, got %s", encoded)
+			}
+			if test.wantCompressed && len(encoded) >= len(plain)/4 {
+				t.Errorf("expected compressing to shrink the post from %d bytes, got %d", len(plain), len(encoded))
+			}
+
+			var decoded Post
+			if err := json.Unmarshal(encoded, &decoded); err != nil {
+				t.Fatalf("unexpected error unmarshaling post: %s", err)
+			}
+			want := post.Clone()
+			for _, parts := range [][]Part{want.Parts, want.Metadata} {
+				for pos := range parts {
+					if !parts[pos].Inline {
+						parts[pos].Body = nil
+					}
+				}
+			}
+			if !reflect.DeepEqual(decoded, want) {
+				t.Errorf("expected\n%+v\ngot\n%+v", want, decoded)
+			}
+		})
+	}
+}
+
+func TestPartUnmarshalJSONUnknownCompression(t *testing.T) {
+	t.Parallel()
+
+	var part Part
+	err := json.Unmarshal([]byte(`{"ID":"part","Body":"SGVsbG8=","Inline":true,"Compression":"zstd"}`), &part)
+	if err == nil {
+		t.Errorf("expected an error for an unknown compression, got %+v", part)
+	}
+	err = json.Unmarshal([]byte(`{"ID":"part","Body":"SGVsbG8=","Inline":true,"Compression":"gzip"}`), &part)
+	if err == nil {
+		t.Errorf("expected an error for a body that isn't gzipped, got %+v", part)
+	}
+}
+
+func TestGunzipBodyLimit(t *testing.T) {
+	t.Parallel()
+
+	body := bytes.Repeat([]byte("a"), 1024)
+	compressed, err := gzipBody(body)
+	if err != nil {
+		t.Fatalf("unexpected error compressing body: %s", err)
+	}
+
+	got, err := gunzipBody(compressed, int64(len(body)))
+	if err != nil {
+		t.Fatalf("unexpected error decompressing body at the limit: %s", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("expected %d bytes of body, got %d", len(body), len(got))
+	}
+	if _, err := gunzipBody(compressed, int64(len(body))-1); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("expected ErrBodyTooLarge decompressing past the limit, got %v", err)
+	}
+}
+
+func TestPartComputeSHA256(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		body []byte
+		want string
+	}{
+		"nil-body":   {body: nil, want: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		"empty-body": {body: []byte{}, want: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		"body":       {body: []byte("abc"), want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			part := Part{ID: "part", Body: test.body, SHA256: "stale"}
+			part.ComputeSHA256()
+			if part.SHA256 != test.want {
+				t.Errorf("expected SHA256 %q, got %q", test.want, part.SHA256)
+			}
+			if err := part.VerifySHA256(); err != nil {
+				t.Errorf("expected computed SHA256 to verify, got %s", err)
+			}
+		})
+	}
+}
+
+func TestPartVerifySHA256(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]Part{
+		"wrong-sum":  {ID: "part", Body: []byte("abc"), SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		"empty-sum":  {ID: "part", Body: []byte("abc")},
+		"empty-body": {ID: "part", SHA256: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+
+	for name, part := range tests {
+		name, part := name, part
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := part.VerifySHA256()
+			if !errors.Is(err, ErrSHA256Mismatch) {
+				t.Errorf("expected ErrSHA256Mismatch, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package posts
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// QueryResult is a Post that matched a Storer's Query, along with how well
+// it matched.
+type QueryResult struct {
+	// Post is the Post that matched.
+	Post Post
+
+	// Score indicates how well the Post matched the query, with higher
+	// scores being better matches. Scores are only meaningful relative
+	// to other results for the same query from the same Storer.
+	Score float64
+
+	// Snippets are short excerpts from the Post's parts showing where
+	// the query matched. Storers that can't produce snippets will leave
+	// this empty.
+	Snippets []string
+}
+
+// snippetContext is the number of characters on either side of a match that
+// are included in a snippet.
+const snippetContext = 40
+
+// MatchQuery is a naive reference implementation of searching a Post for q,
+// for Storers without a real search backend. It returns true if q appears in
+// the Post's title or the body of any of its inline Parts, ignoring case.
+// The QueryResult's Score is the number of times q appears, and it has a
+// Snippet for the first match in each Part that matched. An empty q matches
+// nothing.
+func MatchQuery(post Post, q string) (QueryResult, bool) {
+	result := QueryResult{Post: post}
+	query := foldRunes(strings.TrimSpace(q))
+	if len(query) == 0 {
+		return result, false
+	}
+	result.Score += float64(len(matchRunes(foldRunes(post.Title), query)))
+	for _, part := range post.Parts {
+		if !part.Inline {
+			continue
+		}
+		body := []rune(string(part.Body))
+		matches := matchRunes(foldRunes(string(part.Body)), query)
+		if len(matches) == 0 {
+			continue
+		}
+		result.Score += float64(len(matches))
+		result.Snippets = append(result.Snippets, snippet(body, matches[0], len(query)))
+	}
+	return result, result.Score > 0
+}
+
+// SortQueryResults sorts results so the best matches come first, breaking
+// ties by PublishedAt, descending.
+func SortQueryResults(results []QueryResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Post.PublishedAt.After(results[j].Post.PublishedAt)
+	})
+}
+
+// foldRunes returns the runes of s, lowercased. Lowercasing rune by rune,
+// instead of with strings.ToLower, keeps the positions of the runes the same
+// as in s.
+func foldRunes(s string) []rune {
+	runes := []rune(s)
+	for pos, r := range runes {
+		runes[pos] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+// matchRunes returns the positions of every non-overlapping occurrence of
+// query in text.
+func matchRunes(text, query []rune) []int {
+	var matches []int
+	for pos := 0; pos+len(query) <= len(text); pos++ {
+		if string(text[pos:pos+len(query)]) == string(query) {
+			matches = append(matches, pos)
+			pos += len(query) - 1
+		}
+	}
+	return matches
+}
+
+// snippet returns the part of text around the match of length runes at pos,
+// with whitespace collapsed, and ellipses marking where text was cut off.
+func snippet(text []rune, pos, length int) string {
+	start, end := pos-snippetContext, pos+length+snippetContext
+	var prefix, suffix string
+	if start <= 0 {
+		start = 0
+	} else {
+		prefix = "…"
+	}
+	if end >= len(text) {
+		end = len(text)
+	} else {
+		suffix = "…"
+	}
+	return prefix + strings.Join(strings.Fields(string(text[start:end])), " ") + suffix
+}
@@ -0,0 +1,91 @@
+package posts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchQuery(t *testing.T) {
+	t.Parallel()
+
+	post := Post{
+		ID:    "post",
+		Title: "Gardening in Winter",
+		Parts: []Part{
+			{ID: "intro", Inline: true, Body: []byte("Winter gardening is\nall about planning.")},
+			{ID: "photo", Body: []byte("winter winter winter")},
+			{ID: "long", Inline: true, Body: []byte(strings.Repeat("a", 50) + " WINTER " + strings.Repeat("b", 50))},
+		},
+	}
+
+	tests := map[string]struct {
+		q            string
+		wantMatch    bool
+		wantScore    float64
+		wantSnippets []string
+	}{
+		"title-and-parts": {
+			q:         "winter",
+			wantMatch: true,
+			wantScore: 3,
+			wantSnippets: []string{
+				"Winter gardening is all about planning.",
+				"…" + strings.Repeat("a", 39) + " WINTER " + strings.Repeat("b", 39) + "…",
+			},
+		},
+		"title-only": {
+			q:         "in winter",
+			wantMatch: true,
+			wantScore: 1,
+		},
+		"no-match": {
+			q: "summer",
+		},
+		"non-inline-ignored": {
+			q: "winter winter",
+		},
+		"empty": {
+			q: "  ",
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			result, ok := MatchQuery(post, test.q)
+			if ok != test.wantMatch {
+				t.Fatalf("expected match to be %v, got %v", test.wantMatch, ok)
+			}
+			if result.Score != test.wantScore {
+				t.Errorf("expected score %v, got %v", test.wantScore, result.Score)
+			}
+			if !reflect.DeepEqual(result.Snippets, test.wantSnippets) {
+				t.Errorf("expected snippets %q, got %q", test.wantSnippets, result.Snippets)
+			}
+		})
+	}
+}
+
+func TestSortQueryResults(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	results := []QueryResult{
+		{Post: Post{ID: "old"}, Score: 2},
+		{Post: Post{ID: "best"}, Score: 5},
+		{Post: Post{ID: "new", PublishedAt: now}, Score: 2},
+	}
+	SortQueryResults(results)
+	var got []string
+	for _, result := range results {
+		got = append(got, result.Post.ID)
+	}
+	want := []string{"best", "new", "old"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected order %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,79 @@
+package posts
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// WordsPerMinute is the reading speed ReadingTime assumes. If it's not
+// greater than zero, ReadingTime returns zero.
+var WordsPerMinute = 200
+
+// htmlTagPattern matches HTML tags, comments, and doctypes, so they can be
+// stripped before words are counted.
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// WordCount returns the number of words in the bodies of the Post's inline
+// text/* Parts. HTML tags are stripped before counting, and each Chinese or
+// Japanese character is counted as a word, because those languages aren't
+// written with spaces between words. Parts with other content types, and
+// Parts that aren't inline, aren't counted.
+func (p Post) WordCount() int {
+	var count int
+	for _, part := range p.Parts {
+		if !part.Inline {
+			continue
+		}
+		mediaType := part.ContentType()
+		if !strings.HasPrefix(mediaType, "text/") {
+			continue
+		}
+		text := string(part.Body)
+		if mediaType == "text/html" {
+			text = html.UnescapeString(htmlTagPattern.ReplaceAllString(text, " "))
+		}
+		count += countWords(text)
+	}
+	return count
+}
+
+// ReadingTime estimates how long the Post takes to read, based on its
+// WordCount and WordsPerMinute.
+func (p Post) ReadingTime() time.Duration {
+	if WordsPerMinute <= 0 {
+		return 0
+	}
+	return time.Duration(p.WordCount()) * time.Minute / time.Duration(WordsPerMinute)
+}
+
+// countWords returns the number of words in text. A word is a run of
+// characters that aren't spaces, containing at least one letter or number,
+// so punctuation and markup like Markdown's # and * aren't counted on their
+// own. Chinese and Japanese characters are each counted as a word.
+func countWords(text string) int {
+	var count int
+	inWord := false
+	for _, r := range text {
+		switch {
+		case isIdeographic(r):
+			count++
+			inWord = false
+		case unicode.IsSpace(r):
+			inWord = false
+		case !inWord && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			count++
+			inWord = true
+		}
+	}
+	return count
+}
+
+// isIdeographic returns true if r is written without spaces between words,
+// so it should be counted as a word on its own. Korean uses spaces between
+// words, so Hangul isn't included.
+func isIdeographic(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
@@ -0,0 +1,88 @@
+package posts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPostWordCount(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		parts []Part
+		want  int
+	}{
+		"empty": {want: 0},
+		"plain": {
+			parts: []Part{textPart("a", "text/plain", "The quick brown fox jumps over the lazy dog.")},
+			want:  9,
+		},
+		"punctuation": {
+			parts: []Part{textPart("a", "text/markdown", "# Heading\n\n* Don't -- stop, e-mail me!")},
+			want:  5,
+		},
+		"html": {
+			parts: []Part{textPart("a", "text/html", `<p>Hello <a href="https://example.com">there</a>,</p><p>world&nbsp;&amp; friends</p>`)},
+			want:  4,
+		},
+		"cjk": {
+			parts: []Part{textPart("a", "text/plain", "我喜欢读书。日本語のテキスト")},
+			want:  13,
+		},
+		"mixed-scripts": {
+			parts: []Part{textPart("a", "text/plain", "Go语言 is fun")},
+			want:  5,
+		},
+		"text-and-image": {
+			parts: []Part{
+				textPart("a", "text/plain", "A caption for the photo."),
+				{ID: "b", Position: 1, Inline: true, Body: []byte("binary words words words"), Headers: map[string][]string{"Content-Type": {"image/png"}}},
+				textPart("c", "text/plain", "More words."),
+			},
+			want: 7,
+		},
+		"not-inline": {
+			parts: []Part{{ID: "a", SHA256: "abc", Headers: map[string][]string{"Content-Type": {"text/plain"}}}},
+			want:  0,
+		},
+		"no-content-type": {
+			parts: []Part{{ID: "a", Inline: true, Body: []byte("untyped words")}},
+			want:  0,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			post := Post{ID: "post", Parts: test.parts}
+			if got := post.WordCount(); got != test.want {
+				t.Errorf("expected %d words, got %d", test.want, got)
+			}
+		})
+	}
+}
+
+func TestPostReadingTime(t *testing.T) {
+	t.Parallel()
+
+	if got := (Post{}).ReadingTime(); got != 0 {
+		t.Errorf("expected an empty post to take no time to read, got %s", got)
+	}
+
+	words := make([]byte, 0, 500*5)
+	for i := 0; i < 500; i++ {
+		words = append(words, "word "...)
+	}
+	post := Post{ID: "post", Parts: []Part{textPart("a", "text/plain", string(words))}}
+	want := 150 * time.Second
+	if got := post.ReadingTime(); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+// textPart returns an inline Part with the passed content type and body.
+func textPart(id, contentType, body string) Part {
+	return Part{ID: id, Inline: true, Body: []byte(body), Headers: map[string][]string{"Content-Type": {contentType}}}
+}
@@ -0,0 +1,121 @@
+package posts
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+)
+
+// BlobURLPlaceholder is replaced with a Part's SHA256 in the BlobURL of
+// RenderOptions.
+const BlobURLPlaceholder = "{sha256}"
+
+// RenderOptions configures the way RenderHTML renders a Post.
+type RenderOptions struct {
+	// BlobURL is the URL non-inline Parts can be retrieved from, with
+	// BlobURLPlaceholder standing in for the Part's SHA256, like
+	// "https://cdn.example.com/blobs/{sha256}". Non-inline images are
+	// skipped when it's empty.
+	BlobURL string
+
+	// Markdown converts a text/markdown body to HTML. When it's nil,
+	// text/markdown Parts are rendered as if they were text/plain.
+	Markdown func(source []byte) ([]byte, error)
+
+	// Sanitizer, when non-nil, sanitizes the HTML of text/html Parts and
+	// the output of Markdown before it's included. When it's nil, that
+	// HTML is trusted and included as-is.
+	Sanitizer Sanitizer
+}
+
+// RenderHTML renders the Post's Parts as HTML, in Position order, joined by
+// newlines. How each Part is rendered depends on its content type:
+//
+//   - text/markdown is converted using the Markdown option.
+//   - text/html is included after being run through the Sanitizer option.
+//   - text/plain is escaped, and each paragraph, separated by a blank line,
+//     is wrapped in a p element.
+//   - image/* Parts that aren't inline become an img element, using the
+//     BlobURL option.
+//
+// Parts that can't be rendered, like Parts with any other content type or
+// text Parts that aren't inline, are rendered as an HTML comment noting
+// they were skipped. The Post's Metadata isn't rendered.
+func (p Post) RenderHTML(opts RenderOptions) (template.HTML, error) {
+	var rendered []string
+	for _, part := range normalizedParts(p.Parts) {
+		out, err := renderPart(part, opts)
+		if err != nil {
+			return "", fmt.Errorf("error rendering part %s: %w", part.ID, err)
+		}
+		rendered = append(rendered, out)
+	}
+	return template.HTML(strings.Join(rendered, "\n")), nil
+}
+
+// renderPart returns the HTML rendering of part, as described by RenderHTML.
+func renderPart(part Part, opts RenderOptions) (string, error) {
+	mediaType := part.ContentType()
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		if part.Inline || opts.BlobURL == "" {
+			break
+		}
+		src := strings.ReplaceAll(opts.BlobURL, BlobURLPlaceholder, part.SHA256)
+		return `<img src="` + html.EscapeString(src) + `" alt="">`, nil
+	case !part.Inline:
+	case mediaType == "text/markdown" && opts.Markdown != nil:
+		body, err := opts.Markdown(part.Body)
+		if err != nil {
+			return "", err
+		}
+		return sanitizeHTML(body, opts.Sanitizer)
+	case mediaType == "text/html":
+		return sanitizeHTML(part.Body, opts.Sanitizer)
+	case mediaType == "text/plain", mediaType == "text/markdown":
+		return renderPlainText(string(part.Body)), nil
+	}
+	return skippedPartComment(part, mediaType), nil
+}
+
+// sanitizeHTML returns body run through s, or body unchanged if s is nil.
+func sanitizeHTML(body []byte, s Sanitizer) (string, error) {
+	if s == nil {
+		return string(body), nil
+	}
+	sanitized, err := s.Sanitize("text/html", body)
+	if err != nil {
+		return "", err
+	}
+	return string(sanitized), nil
+}
+
+// renderPlainText escapes text and wraps each of its paragraphs, separated by
+// blank lines, in a p element.
+func renderPlainText(text string) string {
+	var paragraphs []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		paragraphs = append(paragraphs, "<p>"+html.EscapeString(paragraph)+"</p>")
+	}
+	return strings.Join(paragraphs, "\n")
+}
+
+// skippedPartComment returns an HTML comment noting that part, which has the
+// media type mediaType, couldn't be rendered.
+func skippedPartComment(part Part, mediaType string) string {
+	if mediaType == "" {
+		mediaType = "no content type"
+	}
+	text := fmt.Sprintf("part %s skipped: %s", part.ID, mediaType)
+	if !part.Inline {
+		text += ", not inline"
+	}
+	// comments can't contain --, so part IDs can't end the comment early.
+	text = strings.ReplaceAll(text, "--", "")
+	return "<!-- " + html.EscapeString(text) + " -->"
+}
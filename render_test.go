@@ -0,0 +1,98 @@
+package posts
+
+import (
+	"errors"
+	"html/template"
+	"regexp"
+	"testing"
+)
+
+var markdownHeading = regexp.MustCompile(`(?m)^# (.*)$`)
+
+// fakeMarkdown converts Markdown headings to h1 elements and leaves
+// everything else alone, which is enough Markdown for testing.
+func fakeMarkdown(source []byte) ([]byte, error) {
+	return markdownHeading.ReplaceAll(source, []byte("<h1>$1</h1>")), nil
+}
+
+func TestPostRenderHTML(t *testing.T) {
+	t.Parallel()
+
+	post := Post{ID: "post", Parts: []Part{
+		{ID: "caption", Position: 2, Inline: true, Body: []byte("A photo of a <cat>.\n\nTaken last week."), Headers: map[string][]string{"Content-Type": {"text/plain"}}},
+		{ID: "intro", Position: 0, Inline: true, Body: []byte("# Hello\n<script>alert(1)</script>"), Headers: map[string][]string{"Content-Type": {"text/markdown"}}},
+		{ID: "photo", Position: 1, SHA256: "abc123", Headers: map[string][]string{"Content-Type": {"image/jpeg"}}},
+		{ID: "video", Position: 3, SHA256: "def456", Headers: map[string][]string{"Content-Type": {"video/mp4"}}},
+		{ID: "html", Position: 4, Inline: true, Body: []byte("<p>Bye<script>x</script></p>"), Headers: map[string][]string{"Content-Type": {"text/html; charset=utf-8"}}},
+	}}
+
+	tests := map[string]struct {
+		opts RenderOptions
+		want template.HTML
+	}{
+		"all-options": {
+			opts: RenderOptions{
+				BlobURL:   "https://cdn.example.com/blobs/{sha256}?size=large&fmt=webp",
+				Markdown:  fakeMarkdown,
+				Sanitizer: &scriptStripper{},
+			},
+			want: "<h1>Hello</h1>\n\n" +
+				`<img src="https://cdn.example.com/blobs/abc123?size=large&amp;fmt=webp" alt="">` + "\n" +
+				"<p>A photo of a &lt;cat&gt;.</p>\n<p>Taken last week.</p>\n" +
+				"<!-- part video skipped: video/mp4, not inline -->\n" +
+				"<p>Bye</p>",
+		},
+		"no-options": {
+			want: "<p># Hello\n&lt;script&gt;alert(1)&lt;/script&gt;</p>\n" +
+				"<!-- part photo skipped: image/jpeg, not inline -->\n" +
+				"<p>A photo of a &lt;cat&gt;.</p>\n<p>Taken last week.</p>\n" +
+				"<!-- part video skipped: video/mp4, not inline -->\n" +
+				"<p>Bye<script>x</script></p>",
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := post.RenderHTML(test.opts)
+			if err != nil {
+				t.Fatalf("unexpected error rendering post: %s", err)
+			}
+			if got != test.want {
+				t.Errorf("expected\n%s\ngot\n%s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestPostRenderHTMLSkipped(t *testing.T) {
+	t.Parallel()
+
+	post := Post{ID: "post", Parts: []Part{
+		{ID: "a--> <b>", Inline: true, Body: []byte{0xff}, Headers: map[string][]string{"Content-Type": {"application/octet-stream"}}},
+		{ID: "c", Position: 1, Inline: true, Body: []byte("untyped")},
+	}}
+	got, err := post.RenderHTML(RenderOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error rendering post: %s", err)
+	}
+	want := template.HTML("<!-- part a&gt; &lt;b&gt; skipped: application/octet-stream -->\n<!-- part c skipped: no content type -->")
+	if got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestPostRenderHTMLMarkdownError(t *testing.T) {
+	t.Parallel()
+
+	errMarkdown := errors.New("bad markdown")
+	post := Post{ID: "post", Parts: []Part{
+		{ID: "a", Inline: true, Body: []byte("# Hello"), Headers: map[string][]string{"Content-Type": {"text/markdown"}}},
+	}}
+	_, err := post.RenderHTML(RenderOptions{Markdown: func([]byte) ([]byte, error) { return nil, errMarkdown }})
+	if !errors.Is(err, errMarkdown) {
+		t.Errorf("expected the markdown error, got %v", err)
+	}
+}
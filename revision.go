@@ -1,5 +1,16 @@
 package posts
 
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+)
+
 // DeltaOp is the type of change that is happenging to a
 // Part. It can be added, removed, updated, moved, or
 // moved and updated.
@@ -29,9 +40,84 @@ const (
 	DeltaMoveUpdate DeltaOp = "mvup"
 )
 
+// ErrUnknownDeltaOp is returned when a DeltaOp isn't one of the DeltaOps
+// defined in this package.
+var ErrUnknownDeltaOp = errors.New("unknown delta op")
+
+// ParseDeltaOp returns the DeltaOp s represents, or an error wrapping
+// ErrUnknownDeltaOp if it isn't one.
+func ParseDeltaOp(s string) (DeltaOp, error) {
+	op := DeltaOp(s)
+	if !op.Valid() {
+		return "", fmt.Errorf("%w: %q", ErrUnknownDeltaOp, s)
+	}
+	return op, nil
+}
+
+// Valid returns true if the DeltaOp is one of the DeltaOps defined in this
+// package.
+func (o DeltaOp) Valid() bool {
+	switch o {
+	case DeltaAdd, DeltaRemove, DeltaUpdate, DeltaMove, DeltaMoveUpdate:
+		return true
+	}
+	return false
+}
+
+// String returns the DeltaOp as a string, which ParseDeltaOp can turn back
+// into the DeltaOp.
+func (o DeltaOp) String() string {
+	return string(o)
+}
+
+// UnmarshalJSON decodes a DeltaOp from a JSON string, returning an error
+// wrapping ErrUnknownDeltaOp if it isn't a valid DeltaOp, so Revisions written
+// by a newer version of this package, or mangled in storage, can't be read
+// as if they made sense.
+func (o *DeltaOp) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	op, err := ParseDeltaOp(str)
+	if err != nil {
+		return err
+	}
+	*o = op
+	return nil
+}
+
+// RevisionStatus is an enum of the states a Revision can be in as it moves
+// through the editorial approval workflow.
+type RevisionStatus string
+
+const (
+	// RevisionStatusUnset is the status of a Revision that isn't part of
+	// the approval workflow, like one that is applied directly.
+	RevisionStatusUnset RevisionStatus = ""
+
+	// RevisionStatusProposed is the status of a Revision that has been
+	// proposed but not yet reviewed.
+	RevisionStatusProposed RevisionStatus = "proposed"
+
+	// RevisionStatusApproved is the status of a Revision that has been
+	// reviewed and approved, but not yet applied.
+	RevisionStatusApproved RevisionStatus = "approved"
+
+	// RevisionStatusRejected is the status of a Revision that has been
+	// reviewed and rejected. It should never be applied.
+	RevisionStatusRejected RevisionStatus = "rejected"
+
+	// RevisionStatusApplied is the status of a Revision that has been
+	// applied to its Post.
+	RevisionStatusApplied RevisionStatus = "applied"
+)
+
 // Revision is an atomic update to a Post.
 type Revision struct {
-	// ID is a UUID suitable for uniquely identifying a revision.
+	// ID is a UUID suitable for uniquely identifying a revision. Storers
+	// use it to make sure a revision is only ever applied once, so retries
+	// must reuse the same ID.
 	ID string
 
 	// Public tracks whether the revision should be publicly visible or is
@@ -42,22 +128,49 @@ type Revision struct {
 	// public.
 	Reason string
 
+	// Status tracks where the revision is in the approval workflow.
+	Status RevisionStatus
+
+	// AuthorID is the ID of the actor that made the revision. It's the
+	// same as the Actor of the PostEvent recording the update.
+	AuthorID string
+
+	// ActorType is the type of actor that made the revision. It's the
+	// same as the ActorType of the PostEvent recording the update.
+	ActorType PostEventActorType
+
+	// CreatedAt is when the revision was made. It's the same as the
+	// Timestamp of the PostEvent recording the update.
+	CreatedAt time.Time
+
 	// TitleDelta contains a diff of the post's title before the revision
 	// and after the revision, such that patching the post's title before
 	// the revision with TitleDelta will result in the post's title after
 	// the revision.
-	TitleDelta string
+	TitleDelta Delta
 
 	// SlugDelta contains a diff of the post's slug before the revision and
 	// after the revision, such that patching the post's slug before the
 	// revision with SlugDelta will result in the post's slug after the
 	// revision.
-	SlugDelta string
+	SlugDelta Delta
+
+	// TitleUndo and SlugUndo are the reverse of TitleDelta and
+	// SlugDelta, patching the post's title and slug after the revision
+	// to match them before the revision. Compact deltas only record how
+	// many characters were deleted, not what they were, so these are
+	// needed to invert the revision; see InvertRevision.
+	TitleUndo Delta
+	SlugUndo  Delta
 
 	// AuthorsDeltas describes a set of changes to the collection of
 	// authors for the post.
 	AuthorsDeltas []AuthorsDelta
 
+	// StreamsDeltas describes a set of changes to the collection of
+	// streams the post is in.
+	StreamsDeltas []StreamsDelta
+
 	// PartsDeltas describes a set of changes to the parts of the post
 	// body.
 	PartsDeltas []PartDelta
@@ -67,6 +180,16 @@ type Revision struct {
 }
 
 // PartDelta tracks the change that occurred between two versions of a Part.
+//
+// The PartDeltas in a list describe a single rearrangement of the parts, not
+// a sequence of steps, so they can be applied in any order. FromPosition is
+// always relative to the list of parts before any of the changes, and
+// ToPosition is always relative to the list after all of them. To apply the
+// list, ApplyRevision takes out the parts being removed or moved, places the
+// parts being added, moved, or updated at their ToPosition, and fills the
+// remaining positions with the untouched parts, in their original order. No
+// two PartDeltas in a list may have the same FromPosition or the same
+// ToPosition.
 type PartDelta struct {
 	// PartID records the ID of the part that the change being described
 	// applies to.
@@ -75,13 +198,19 @@ type PartDelta struct {
 	// Op indicates the type of change being described.
 	Op DeltaOp
 
-	// FromPosition indicates the position the part started in. It must
-	// always be set, even when Op is not DeltaMove or DelteMoveUpdate.
+	// FromPosition indicates the position the part started in, in the
+	// list of parts before the revision. It must always be set, even
+	// when Op is not DeltaMove or DelteMoveUpdate. When the part is being
+	// added, it's -1.
 	FromPosition int
 
-	// ToPosition indicates the position the part ended up in. It must
-	// always be set, even when Op is not DeltaMove or DeltaMoveUpdate. In
-	// these situations, it should match FromPosition.
+	// ToPosition indicates the position the part ended up in, in the
+	// list of parts after the revision. It must always be set, even when
+	// Op is not DeltaMove or DeltaMoveUpdate. In these situations, it can
+	// still differ from FromPosition, when parts before it were added,
+	// removed, or moved; only parts that change order relative to the
+	// parts around them are moved. When the part is being removed, it's
+	// -1.
 	ToPosition int
 
 	// Headers tracks the change to the headers of the part.
@@ -98,11 +227,47 @@ type PartDelta struct {
 	//
 	// This will be empty for non-inline parts that remain non-inline
 	// parts; instead, SHA256From and SHA256To will record those changes.
-	Body string
+	// It's also empty when Binary is set.
+	Body Delta
+
+	// BodyUndo is the reverse of Body, suitable for patching the second
+	// part to match the first part. It's needed to invert the change;
+	// see InvertRevision.
+	BodyUndo Delta
+
+	// Replace indicates that Body deletes the entire old body of the part
+	// and inserts the entire new body, rather than describing a minimal
+	// change. This happens when a minimal change would be too large to be
+	// worth storing; see WithMaxDeltaRatio. Body is a valid delta either
+	// way, so patching it works the same regardless.
+	Replace bool
+
+	// Binary indicates that the part's inline body was binary, rather
+	// than UTF-8 text, before or after the change, so it couldn't be
+	// recorded as a Body delta. Instead, Body and BodyUndo are empty,
+	// BinaryBody and BinaryBodyUndo record the entire inline body after
+	// and before the change, byte for byte, and Replace is set.
+	Binary bool
+
+	// BinaryBody is the entire inline body of the part after the change,
+	// when Binary is set. It's empty when the part ends up non-inline.
+	BinaryBody []byte
+
+	// BinaryBodyUndo is the entire inline body of the part before the
+	// change, when Binary is set. It's empty when the part started out
+	// non-inline.
+	BinaryBodyUndo []byte
+
+	// AnchorFrom and AnchorTo record the part's anchor before and after
+	// the change, when the anchor changed. When they're equal, the anchor
+	// didn't change.
+	AnchorFrom string
+	AnchorTo   string
 
 	// SHA256From describes the SHA256 hash the part started with. This is
 	// used in lieu of Body for non-inline parts that are stored in blob
-	// storage. If this is set, it means the first
+	// storage. If this is set, it means the part wasn't inline before the
+	// change, and ValidateAgainst checks it against the part's SHA256.
 	SHA256From string
 
 	// SHA256To describes the SHA256 hash the part ended with. This is used
@@ -146,6 +311,9 @@ type AuthorsDelta struct {
 	// Op indicates the type of change being described.
 	Op DeltaOp
 
+	// Author is the ID of the author being added, removed, or moved.
+	Author string
+
 	// FromPosition indicates the original position of the author in the
 	// list of authors. It must always be set, even when Op is not
 	// DeltaMove or DeltaMoveUpdate.
@@ -156,3 +324,315 @@ type AuthorsDelta struct {
 	// that situation, it should match FromPosition.
 	ToPosition int
 }
+
+// StreamsDelta tracks the change of a Streams field in a Post.
+//
+// Like AuthorsDelta, no diffing is done on values, as values are opaque IDs.
+// The Op should always be DeltaAdd, DeltaRemove, or DeltaMove.
+type StreamsDelta struct {
+	// Op indicates the type of change being described.
+	Op DeltaOp
+
+	// Stream is the ID of the stream being added, removed, or moved.
+	Stream string
+
+	// FromPosition indicates the original position of the stream in the
+	// list of streams, or -1 if the stream is being added.
+	FromPosition int
+
+	// ToPosition indicates the final position of the stream in the list
+	// of streams, or -1 if the stream is being removed.
+	ToPosition int
+}
+
+// revisionContentNamespace is the UUID namespace ContentIDs are generated in.
+var revisionContentNamespace = [16]byte{
+	0x1b, 0x6d, 0x0c, 0x66, 0x3c, 0x5e, 0x4c, 0x55,
+	0x9a, 0x0b, 0x6f, 0x0e, 0x8c, 0x2f, 0x4a, 0x1d,
+}
+
+// Clone returns a deep copy of the Revision, so changes to the copy don't
+// affect the original, or vice versa.
+func (r Revision) Clone() Revision {
+	r.AuthorsDeltas = slices.Clone(r.AuthorsDeltas)
+	r.StreamsDeltas = slices.Clone(r.StreamsDeltas)
+	r.PartsDeltas = clonePartDeltas(r.PartsDeltas)
+	r.MetadataDeltas = clonePartDeltas(r.MetadataDeltas)
+	return r
+}
+
+// clonePartDeltas returns a copy of deltas with each PartDelta cloned.
+func clonePartDeltas(deltas []PartDelta) []PartDelta {
+	if deltas == nil {
+		return nil
+	}
+	cloned := make([]PartDelta, len(deltas))
+	for i, delta := range deltas {
+		cloned[i] = delta.Clone()
+	}
+	return cloned
+}
+
+// Clone returns a deep copy of the PartDelta, so changes to the copy don't
+// affect the original, or vice versa.
+func (d PartDelta) Clone() PartDelta {
+	d.BinaryBody = slices.Clone(d.BinaryBody)
+	d.BinaryBodyUndo = slices.Clone(d.BinaryBodyUndo)
+	if d.Headers != nil {
+		headers := make(map[string][]HeaderDelta, len(d.Headers))
+		for key, deltas := range d.Headers {
+			headers[key] = slices.Clone(deltas)
+		}
+		d.Headers = headers
+	}
+	return d
+}
+
+// ContentID returns a UUID derived from the changes the Revision describes
+// and the ID of the Post it applies to, so the same change to the same Post
+// always produces the same ContentID. Properties that describe the Revision
+// instead of the change, like ID, Public, Reason, Status, and who made it
+// and when, are ignored.
+//
+// The ID is a version 5 UUID in a namespace reserved for Revisions.
+func (r Revision) ContentID(basePostID string) string {
+	r.ID = ""
+	r.Public = false
+	r.Reason = ""
+	r.Status = RevisionStatusUnset
+	r.AuthorID = ""
+	r.ActorType = ""
+	r.CreatedAt = time.Time{}
+
+	// with CreatedAt zeroed, a Revision is all strings, ints, bools,
+	// slices, and maps with string keys, so marshaling it can't fail,
+	// and map keys are always sorted, so the output is stable.
+	content, _ := json.Marshal(r)
+
+	hash := sha1.New()
+	hash.Write(revisionContentNamespace[:])
+	hash.Write([]byte(basePostID))
+	hash.Write([]byte{0})
+	hash.Write(content)
+	sum := hash.Sum(nil)
+
+	var id [16]byte
+	copy(id[:], sum)
+	id[6] = (id[6] & 0x0f) | 0x50 // version 5
+	id[8] = (id[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
+// IsEmpty returns true if the Revision doesn't change anything, so applying
+// it would leave a Post as it is. Title and slug deltas that only keep
+// characters, like =5, count as empty.
+func (r Revision) IsEmpty() bool {
+	return r.TitleDelta.IsEmpty() && r.SlugDelta.IsEmpty() &&
+		len(r.AuthorsDeltas) == 0 && len(r.StreamsDeltas) == 0 &&
+		len(r.PartsDeltas) == 0 && len(r.MetadataDeltas) == 0
+}
+
+// HasStructuralChanges returns true if the Revision adds, removes, or moves
+// any parts or metadata, or changes the Post's authors or streams. Revisions
+// that only change the title, the slug, or the contents of parts in place
+// don't have structural changes.
+func (r Revision) HasStructuralChanges() bool {
+	if len(r.AuthorsDeltas) > 0 || len(r.StreamsDeltas) > 0 {
+		return true
+	}
+	for _, deltas := range [][]PartDelta{r.PartsDeltas, r.MetadataDeltas} {
+		for _, delta := range deltas {
+			if delta.Op != DeltaUpdate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ChangePreview returns a short, human-readable preview of the text the
+// Revision inserts into the Post's title and parts, suitable for things like
+// notification emails. It's derived entirely from the Revision's deltas, so
+// it doesn't need the Post the Revision applies to, but it can only show
+// what was added, not what was removed.
+//
+// Whitespace is collapsed, and the preview is cut off at maxChars characters,
+// ending in an ellipsis if it had to be shortened.
+func (r Revision) ChangePreview(maxChars int) string {
+	if maxChars <= 0 {
+		return ""
+	}
+	deltas := []Delta{r.TitleDelta}
+	for _, delta := range r.PartsDeltas {
+		deltas = append(deltas, delta.Body)
+	}
+	var snippets []string
+	for _, delta := range deltas {
+		snippets = append(snippets, insertedText(delta)...)
+	}
+	preview := []rune(strings.Join(strings.Fields(strings.Join(snippets, " ")), " "))
+	if len(preview) <= maxChars {
+		return string(preview)
+	}
+	return string(preview[:maxChars-1]) + "…"
+}
+
+// insertedText returns the text inserted by each insertion in delta.
+// Insertions that can't be decoded are skipped.
+func insertedText(delta Delta) []string {
+	var inserted []string
+	for _, token := range strings.Split(string(delta), "\t") {
+		if !strings.HasPrefix(token, "+") {
+			continue
+		}
+		text, err := decodeInsert(token[1:])
+		if err != nil {
+			continue
+		}
+		inserted = append(inserted, text)
+	}
+	return inserted
+}
+
+// Validate returns an error if the Revision isn't well-formed: every Op must
+// be valid, and every Delta must be well-formed compact delta format. It
+// doesn't check whether the Revision can be applied to any particular Post;
+// see ValidateAgainst.
+func (r Revision) Validate() error {
+	for _, delta := range []Delta{r.TitleDelta, r.TitleUndo, r.SlugDelta, r.SlugUndo} {
+		if err := delta.Validate(); err != nil {
+			return fmt.Errorf("invalid title or slug delta: %w", err)
+		}
+	}
+	for _, delta := range r.AuthorsDeltas {
+		if !delta.Op.Valid() {
+			return fmt.Errorf("invalid authors delta: %w: author %s has op %q", ErrUnknownDeltaOp, delta.Author, delta.Op)
+		}
+	}
+	for _, delta := range r.StreamsDeltas {
+		if !delta.Op.Valid() {
+			return fmt.Errorf("invalid streams delta: %w: stream %s has op %q", ErrUnknownDeltaOp, delta.Stream, delta.Op)
+		}
+	}
+	if err := validatePartDeltaOps(r.PartsDeltas); err != nil {
+		return fmt.Errorf("invalid parts delta: %w", err)
+	}
+	if err := validatePartDeltaOps(r.MetadataDeltas); err != nil {
+		return fmt.Errorf("invalid metadata delta: %w", err)
+	}
+	return nil
+}
+
+// validatePartDeltaOps returns an error if any of deltas, or any of their
+// HeaderDeltas, has an invalid Op, or if their Body deltas aren't well-formed.
+func validatePartDeltaOps(deltas []PartDelta) error {
+	for _, delta := range deltas {
+		if !delta.Op.Valid() {
+			return fmt.Errorf("%w: part %s has op %q", ErrUnknownDeltaOp, delta.PartID, delta.Op)
+		}
+		for key, headerDeltas := range delta.Headers {
+			for _, headerDelta := range headerDeltas {
+				if !headerDelta.Op.Valid() {
+					return fmt.Errorf("%w: part %s header %s has op %q", ErrUnknownDeltaOp, delta.PartID, key, headerDelta.Op)
+				}
+			}
+		}
+		for _, body := range []Delta{delta.Body, delta.BodyUndo} {
+			if err := body.Validate(); err != nil {
+				return fmt.Errorf("part %s: %w", delta.PartID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateAgainst returns an error if the Revision can't be applied to base,
+// which usually means the Revision was generated against a different version
+// of the Post. Every part, author, stream, or header value the Revision
+// removes, moves, or updates must be in base at the position the Revision
+// says it started at, and every part the Revision adds must not already be
+// in base. Every part with a SHA256From must be a non-inline part in base
+// with that SHA256, which catches Revisions generated against an older body
+// of a non-inline part, even though the body itself isn't in the Post. The
+// Revision must also be well-formed; see Validate.
+//
+// Revisions don't record the ID of the Post they were generated against, so
+// applying a Revision to an entirely different Post that happens to have the
+// same shape isn't caught.
+func (r Revision) ValidateAgainst(base Post) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	if err := validatePartDeltas(r.PartsDeltas, base.Parts); err != nil {
+		return fmt.Errorf("invalid parts delta: %w", err)
+	}
+	if err := validatePartDeltas(r.MetadataDeltas, base.Metadata); err != nil {
+		return fmt.Errorf("invalid metadata delta: %w", err)
+	}
+	for _, delta := range r.AuthorsDeltas {
+		if err := validateListDelta("author", delta.Op, delta.Author, delta.FromPosition, base.Authors); err != nil {
+			return fmt.Errorf("invalid authors delta: %w", err)
+		}
+	}
+	for _, delta := range r.StreamsDeltas {
+		if err := validateListDelta("stream", delta.Op, delta.Stream, delta.FromPosition, base.Streams); err != nil {
+			return fmt.Errorf("invalid streams delta: %w", err)
+		}
+	}
+	return nil
+}
+
+func validatePartDeltas(deltas []PartDelta, parts []Part) error {
+	positions := make(map[string]int, len(parts))
+	for pos, part := range parts {
+		positions[part.ID] = pos
+	}
+	for _, delta := range deltas {
+		pos, exists := positions[delta.PartID]
+		if delta.Op == DeltaAdd {
+			if exists {
+				return fmt.Errorf("part %s is being added, but already exists", delta.PartID)
+			}
+			continue
+		}
+		if !exists {
+			return fmt.Errorf("part %s does not exist", delta.PartID)
+		}
+		if delta.FromPosition < 0 || delta.FromPosition >= len(parts) {
+			return fmt.Errorf("part %s position %d is out of range for %d parts", delta.PartID, delta.FromPosition, len(parts))
+		}
+		if pos != delta.FromPosition {
+			return fmt.Errorf("part %s is at position %d, not %d", delta.PartID, pos, delta.FromPosition)
+		}
+		part := parts[pos]
+		if delta.SHA256From != "" && (part.Inline || part.SHA256 != delta.SHA256From) {
+			return fmt.Errorf("part %s has SHA256 %q, not %q", delta.PartID, part.SHA256, delta.SHA256From)
+		}
+		headers := canonicalHeaders(part.Headers)
+		for key, headerDeltas := range delta.Headers {
+			values := headers[textproto.CanonicalMIMEHeaderKey(key)]
+			for _, headerDelta := range headerDeltas {
+				if err := validateListDelta("header "+key+" value", headerDelta.Op, headerDelta.Value, headerDelta.FromPosition, values); err != nil {
+					return fmt.Errorf("part %s: %w", delta.PartID, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateListDelta returns an error if a delta with op, describing a change
+// to value, which started at from, can't be applied to values. Values being
+// added don't need to be in values; all others must be at from.
+func validateListDelta(kind string, op DeltaOp, value string, from int, values []string) error {
+	if op == DeltaAdd {
+		return nil
+	}
+	if from < 0 || from >= len(values) {
+		return fmt.Errorf("%s %s position %d is out of range for %d values", kind, value, from, len(values))
+	}
+	if value != "" && values[from] != value {
+		return fmt.Errorf("expected %s %s at position %d, found %s", kind, value, from, values[from])
+	}
+	return nil
+}
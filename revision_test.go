@@ -0,0 +1,578 @@
+package posts
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var uuidV5 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRevisionContentID(t *testing.T) {
+	t.Parallel()
+
+	rev := Revision{
+		TitleDelta: "=5\t+!",
+		PartsDeltas: []PartDelta{{
+			PartID:       "part",
+			Op:           DeltaUpdate,
+			FromPosition: 1,
+			ToPosition:   1,
+			Body:         "=3\t-1",
+			Headers: map[string][]HeaderDelta{
+				"B": {{Op: DeltaAdd, Value: "b"}},
+				"A": {{Op: DeltaRemove, Value: "a"}},
+			},
+		}},
+	}
+
+	same := rev
+	same.ID = "a-different-id"
+	same.Public = true
+	same.Reason = "a different reason"
+	same.Status = RevisionStatusApproved
+	same.AuthorID = "alice"
+	same.ActorType = PostEventActorTypeUser
+	same.CreatedAt = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	different := rev
+	different.TitleDelta = "=5\t+?"
+
+	id := rev.ContentID("post")
+	if !uuidV5.MatchString(id) {
+		t.Errorf("expected a version 5 UUID, got %q", id)
+	}
+	if got := rev.ContentID("post"); got != id {
+		t.Errorf("expected ContentID to be stable, got %q then %q", id, got)
+	}
+	if got := same.ContentID("post"); got != id {
+		t.Errorf("expected identical deltas to produce %q, got %q", id, got)
+	}
+	if got := different.ContentID("post"); got == id {
+		t.Errorf("expected different deltas to produce a different ContentID, got %q for both", got)
+	}
+	if got := rev.ContentID("other-post"); got == id {
+		t.Errorf("expected a different base post to produce a different ContentID, got %q for both", got)
+	}
+}
+
+func TestRevisionClone(t *testing.T) {
+	t.Parallel()
+
+	newRevision := func() Revision {
+		return Revision{
+			ID:            "rev",
+			TitleDelta:    "=5\t+!",
+			AuthorsDeltas: []AuthorsDelta{{Op: DeltaAdd, Author: "alice", FromPosition: -1, ToPosition: 0}},
+			StreamsDeltas: []StreamsDelta{{Op: DeltaAdd, Stream: "news", FromPosition: -1, ToPosition: 0}},
+			PartsDeltas: []PartDelta{
+				{
+					PartID:  "intro",
+					Op:      DeltaUpdate,
+					Headers: map[string][]HeaderDelta{"Content-Type": {{Op: DeltaAdd, Header: "Content-Type", FromPosition: -1, Value: "+text/plain"}}},
+					Body:    "=5\t+!",
+				},
+				{
+					PartID:         "blob",
+					Op:             DeltaUpdate,
+					FromPosition:   1,
+					ToPosition:     1,
+					Binary:         true,
+					Replace:        true,
+					BinaryBody:     []byte{0xff, 0x01},
+					BinaryBodyUndo: []byte{0xff, 0x02},
+				},
+			},
+			MetadataDeltas: []PartDelta{
+				{PartID: "summary", Op: DeltaAdd, FromPosition: -1, Body: "+A summary."},
+			},
+		}
+	}
+	original := newRevision()
+
+	clone := original.Clone()
+	if !reflect.DeepEqual(clone, original) {
+		t.Fatalf("expected clone to equal the original\n%+v\ngot\n%+v", original, clone)
+	}
+
+	clone.AuthorsDeltas[0].Author = "bob"
+	clone.StreamsDeltas[0].Stream = "sports"
+	clone.PartsDeltas[0].Headers["Content-Type"][0].Value = "+text/markdown"
+	clone.PartsDeltas[0].Headers["X-Tag"] = []HeaderDelta{{Op: DeltaAdd, Header: "X-Tag", Value: "+new"}}
+	clone.PartsDeltas[1].BinaryBody[1] = 0x09
+	clone.PartsDeltas[1].BinaryBodyUndo[1] = 0x09
+	clone.MetadataDeltas[0].Body = "+Changed."
+
+	if want := newRevision(); !reflect.DeepEqual(original, want) {
+		t.Errorf("expected modifying the clone to leave the original unchanged\n%+v\ngot\n%+v", want, original)
+	}
+}
+
+func TestGenerateRevisionAuthor(t *testing.T) {
+	t.Parallel()
+
+	p1 := Post{ID: "post", Title: "Hello"}
+	p2 := Post{ID: "post", Title: "Hello!"}
+	createdAt := time.Date(2020, time.January, 1, 12, 30, 0, 0, time.UTC)
+
+	rev, err := GenerateRevision(p1, p2)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	if rev.AuthorID != "" || rev.ActorType != "" || !rev.CreatedAt.IsZero() {
+		t.Errorf("expected no author by default, got %q, %q, %s", rev.AuthorID, rev.ActorType, rev.CreatedAt)
+	}
+
+	rev, err = GenerateRevision(p1, p2, WithAuthor("alice", PostEventActorTypeUser), WithCreatedAt(createdAt))
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+	if rev.AuthorID != "alice" || rev.ActorType != PostEventActorTypeUser || !rev.CreatedAt.Equal(createdAt) {
+		t.Errorf("expected alice, a user, at %s, got %q, %q, %s", createdAt, rev.AuthorID, rev.ActorType, rev.CreatedAt)
+	}
+
+	encoded, err := json.Marshal(rev)
+	if err != nil {
+		t.Fatalf("unexpected error marshaling revision: %s", err)
+	}
+	var decoded Revision
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unexpected error unmarshaling revision: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, rev) {
+		t.Errorf("expected\n%+v\ngot\n%+v", rev, decoded)
+	}
+
+}
+
+func TestRevisionHasStructuralChanges(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		rev  Revision
+		want bool
+	}{
+		"empty": {
+			rev:  Revision{},
+			want: false,
+		},
+		"title-and-slug": {
+			rev:  Revision{TitleDelta: "=5\t+!", SlugDelta: "=5\t+-1"},
+			want: false,
+		},
+		"content-edit": {
+			rev: Revision{PartsDeltas: []PartDelta{
+				{PartID: "part", Op: DeltaUpdate, Body: "=3\t+!"},
+			}},
+			want: false,
+		},
+		"header-edit": {
+			rev: Revision{MetadataDeltas: []PartDelta{
+				{PartID: "part", Op: DeltaUpdate, Headers: map[string][]HeaderDelta{
+					"Content-Type": {{Op: DeltaAdd, Value: "text/plain"}},
+				}},
+			}},
+			want: false,
+		},
+		"reorder": {
+			rev: Revision{PartsDeltas: []PartDelta{
+				{PartID: "a", Op: DeltaMove, FromPosition: 0, ToPosition: 1},
+				{PartID: "b", Op: DeltaMove, FromPosition: 1, ToPosition: 0},
+			}},
+			want: true,
+		},
+		"move-and-edit": {
+			rev: Revision{PartsDeltas: []PartDelta{
+				{PartID: "a", Op: DeltaMoveUpdate, FromPosition: 0, ToPosition: 1, Body: "+!"},
+			}},
+			want: true,
+		},
+		"add": {
+			rev: Revision{PartsDeltas: []PartDelta{
+				{PartID: "a", Op: DeltaAdd, FromPosition: -1, ToPosition: 0},
+			}},
+			want: true,
+		},
+		"remove-metadata": {
+			rev: Revision{MetadataDeltas: []PartDelta{
+				{PartID: "a", Op: DeltaRemove, FromPosition: 0, ToPosition: -1},
+			}},
+			want: true,
+		},
+		"authors": {
+			rev: Revision{AuthorsDeltas: []AuthorsDelta{
+				{Op: DeltaAdd, Author: "alice", FromPosition: -1, ToPosition: 0},
+			}},
+			want: true,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := test.rev.HasStructuralChanges(); got != test.want {
+				t.Errorf("expected HasStructuralChanges to return %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestRevisionIsEmpty(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		rev  Revision
+		want bool
+	}{
+		"zero":           {rev: Revision{}, want: true},
+		"keep-only":      {rev: Revision{TitleDelta: "=5", SlugDelta: "=3", TitleUndo: "=5"}, want: true},
+		"metadata-only":  {rev: Revision{ID: "rev", Reason: "no reason", Public: true}, want: true},
+		"title":          {rev: Revision{TitleDelta: "=5\t+!"}, want: false},
+		"slug":           {rev: Revision{SlugDelta: "-1\t=4"}, want: false},
+		"authors":        {rev: Revision{AuthorsDeltas: []AuthorsDelta{{Op: DeltaAdd, Author: "alice", FromPosition: -1}}}, want: false},
+		"streams":        {rev: Revision{StreamsDeltas: []StreamsDelta{{Op: DeltaAdd, Stream: "blog", FromPosition: -1}}}, want: false},
+		"parts":          {rev: Revision{PartsDeltas: []PartDelta{{PartID: "a", Op: DeltaUpdate, Body: "=3\t+!"}}}, want: false},
+		"metadata-parts": {rev: Revision{MetadataDeltas: []PartDelta{{PartID: "a", Op: DeltaRemove, ToPosition: -1}}}, want: false},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := test.rev.IsEmpty(); got != test.want {
+				t.Errorf("expected IsEmpty to return %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestGenerateRevisionIdenticalIsEmpty(t *testing.T) {
+	t.Parallel()
+
+	post := Post{
+		ID:      "post",
+		Title:   "Hello, world",
+		Slug:    "hello-world",
+		Authors: []string{"alice", "bob"},
+		Streams: []string{"blog"},
+		Parts: []Part{
+			inlinePart("intro", 0, "An introduction."),
+			{ID: "image", Position: 1, Headers: map[string][]string{"Content-Type": {"image/png"}}, SHA256: "abc123"},
+		},
+		Metadata: []Part{inlinePart("summary", 0, "A summary.")},
+	}
+	rev, err := GenerateRevision(post, post)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !rev.IsEmpty() {
+		t.Errorf("expected an empty revision, got %+v", rev)
+	}
+	if rev.TitleDelta != "" || rev.SlugDelta != "" {
+		t.Errorf("expected empty title and slug deltas, got %q and %q", rev.TitleDelta, rev.SlugDelta)
+	}
+
+	// moving a part leaves its body alone, so its body delta should be
+	// empty, not one that keeps every character.
+	moved := post
+	moved.Parts = []Part{post.Parts[1], post.Parts[0]}
+	moved.Parts[0].Position, moved.Parts[1].Position = 0, 1
+	rev, err = GenerateRevision(post, moved)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rev.IsEmpty() {
+		t.Errorf("expected moving a part to produce a non-empty revision")
+	}
+	for _, delta := range rev.PartsDeltas {
+		if delta.Body != "" || delta.BodyUndo != "" {
+			t.Errorf("expected part %s to have empty body deltas, got %q and %q", delta.PartID, delta.Body, delta.BodyUndo)
+		}
+	}
+}
+
+func TestRevisionChangePreview(t *testing.T) {
+	t.Parallel()
+
+	p1 := Post{
+		ID:    "post",
+		Title: "Notes",
+		Parts: []Part{
+			{ID: "intro", Inline: true, Body: []byte("Some thoughts.")},
+		},
+	}
+	p2 := Post{
+		ID:    "post",
+		Title: "Notes on café",
+		Parts: []Part{
+			{ID: "intro", Inline: true, Body: []byte("Some thoughts.\n\nCoffee + cake, 100% worth it.")},
+		},
+	}
+	rev, err := GenerateRevision(p1, p2)
+	if err != nil {
+		t.Fatalf("unexpected error generating revision: %s", err)
+	}
+
+	tests := map[string]struct {
+		maxChars int
+		want     string
+	}{
+		"fits": {
+			maxChars: 100,
+			want:     "on café Coffee + cake, 100% worth it.",
+		},
+		"truncated-after-multibyte": {
+			maxChars: 8,
+			want:     "on café…",
+		},
+		"truncated-at-multibyte": {
+			maxChars: 7,
+			want:     "on caf…",
+		},
+		"zero": {
+			maxChars: 0,
+			want:     "",
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := rev.ChangePreview(test.maxChars)
+			if got != test.want {
+				t.Errorf("expected preview %q, got %q", test.want, got)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("expected preview to be valid UTF-8, got %q", got)
+			}
+		})
+	}
+}
+
+func TestRevisionValidateAgainst(t *testing.T) {
+	t.Parallel()
+
+	base := Post{
+		ID:      "post",
+		Authors: []string{"alice", "bob"},
+		Streams: []string{"blog"},
+		Parts: []Part{
+			{ID: "a", Inline: true, Body: []byte("one"), Headers: map[string][]string{"X-Tag": {"x", "y"}}},
+			{ID: "b", Inline: true, Body: []byte("two")},
+		},
+		Metadata: []Part{
+			{ID: "summary", Inline: true, Body: []byte("A summary.")},
+			{ID: "cover", SHA256: "abc123"},
+		},
+	}
+
+	tests := map[string]struct {
+		rev     Revision
+		wantErr bool
+	}{
+		"valid": {
+			rev: Revision{
+				AuthorsDeltas: []AuthorsDelta{
+					{Op: DeltaMove, Author: "bob", FromPosition: 1, ToPosition: 0},
+					{Op: DeltaAdd, Author: "carol", FromPosition: -1, ToPosition: 2},
+				},
+				PartsDeltas: []PartDelta{
+					{PartID: "b", Op: DeltaUpdate, FromPosition: 1, ToPosition: 1, Body: "=3\t+!"},
+					{PartID: "c", Op: DeltaAdd, FromPosition: -1, ToPosition: 2, Body: "+three"},
+				},
+				MetadataDeltas: []PartDelta{
+					{PartID: "summary", Op: DeltaRemove, FromPosition: 0, ToPosition: -1},
+					{PartID: "cover", Op: DeltaMove, FromPosition: 1, ToPosition: 0, SHA256From: "abc123", SHA256To: "abc123"},
+				},
+			},
+		},
+		"valid-headers": {
+			rev: Revision{PartsDeltas: []PartDelta{
+				{PartID: "a", Op: DeltaUpdate, FromPosition: 0, ToPosition: 0, Headers: map[string][]HeaderDelta{"x-tag": {
+					{Op: DeltaRemove, Value: "y", FromPosition: 1, ToPosition: -1},
+					{Op: DeltaAdd, Value: "z", FromPosition: -1, ToPosition: 1},
+				}}},
+			}},
+		},
+		"stale-sha256-from": {
+			rev: Revision{MetadataDeltas: []PartDelta{
+				{PartID: "cover", Op: DeltaUpdate, FromPosition: 1, ToPosition: 1, SHA256From: "def456", SHA256To: "0a1b2c"},
+			}},
+			wantErr: true,
+		},
+		"sha256-from-inline-part": {
+			rev: Revision{PartsDeltas: []PartDelta{
+				{PartID: "b", Op: DeltaUpdate, FromPosition: 1, ToPosition: 1, SHA256From: "abc123", Body: "-3"},
+			}},
+			wantErr: true,
+		},
+		"header-position-out-of-range": {
+			rev: Revision{PartsDeltas: []PartDelta{
+				{PartID: "a", Op: DeltaUpdate, FromPosition: 0, ToPosition: 0, Headers: map[string][]HeaderDelta{"X-Tag": {
+					{Op: DeltaRemove, Value: "z", FromPosition: 2, ToPosition: -1},
+				}}},
+			}},
+			wantErr: true,
+		},
+		"header-mismatch": {
+			rev: Revision{PartsDeltas: []PartDelta{
+				{PartID: "b", Op: DeltaUpdate, FromPosition: 1, ToPosition: 1, Headers: map[string][]HeaderDelta{"X-Tag": {
+					{Op: DeltaRemove, Value: "x", FromPosition: 0, ToPosition: -1},
+				}}},
+			}},
+			wantErr: true,
+		},
+		"stream-mismatch": {
+			rev: Revision{StreamsDeltas: []StreamsDelta{
+				{Op: DeltaRemove, Stream: "news", FromPosition: 0, ToPosition: -1},
+			}},
+			wantErr: true,
+		},
+		"part-position-out-of-range": {
+			rev: Revision{PartsDeltas: []PartDelta{
+				{PartID: "b", Op: DeltaUpdate, FromPosition: 2, ToPosition: 2},
+			}},
+			wantErr: true,
+		},
+		"part-position-mismatch": {
+			rev: Revision{PartsDeltas: []PartDelta{
+				{PartID: "b", Op: DeltaMove, FromPosition: 0, ToPosition: 1},
+			}},
+			wantErr: true,
+		},
+		"missing-part": {
+			rev: Revision{PartsDeltas: []PartDelta{
+				{PartID: "missing", Op: DeltaRemove, FromPosition: 0, ToPosition: -1},
+			}},
+			wantErr: true,
+		},
+		"metadata-in-parts": {
+			rev: Revision{PartsDeltas: []PartDelta{
+				{PartID: "summary", Op: DeltaUpdate, FromPosition: 0, ToPosition: 0},
+			}},
+			wantErr: true,
+		},
+		"adding-existing-part": {
+			rev: Revision{PartsDeltas: []PartDelta{
+				{PartID: "a", Op: DeltaAdd, FromPosition: -1, ToPosition: 2},
+			}},
+			wantErr: true,
+		},
+		"author-position-out-of-range": {
+			rev: Revision{AuthorsDeltas: []AuthorsDelta{
+				{Op: DeltaRemove, Author: "carol", FromPosition: 2, ToPosition: -1},
+			}},
+			wantErr: true,
+		},
+		"author-mismatch": {
+			rev: Revision{AuthorsDeltas: []AuthorsDelta{
+				{Op: DeltaRemove, Author: "bob", FromPosition: 0, ToPosition: -1},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := test.rev.ValidateAgainst(base)
+			if test.wantErr && err == nil {
+				t.Errorf("expected an error, got nil")
+			} else if !test.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestParseDeltaOp(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		want    DeltaOp
+		wantErr bool
+	}{
+		"add":  {want: DeltaAdd},
+		"rm":   {want: DeltaRemove},
+		"up":   {want: DeltaUpdate},
+		"mv":   {want: DeltaMove},
+		"mvup": {want: DeltaMoveUpdate},
+		"":     {wantErr: true},
+		"foo":  {wantErr: true},
+		"ADD":  {wantErr: true},
+		"mv ":  {wantErr: true},
+	}
+
+	for input, test := range tests {
+		input, test := input, test
+		t.Run(input, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseDeltaOp(input)
+			if test.wantErr {
+				if !errors.Is(err, ErrUnknownDeltaOp) {
+					t.Errorf("expected ErrUnknownDeltaOp, got %v", err)
+				}
+				if DeltaOp(input).Valid() {
+					t.Errorf("expected %q not to be valid", input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+			if !got.Valid() {
+				t.Errorf("expected %q to be valid", got)
+			}
+			if again, err := ParseDeltaOp(got.String()); err != nil || again != got {
+				t.Errorf("expected %q to round-trip through String, got %q, %v", got, again, err)
+			}
+		})
+	}
+}
+
+func TestRevisionUnknownDeltaOp(t *testing.T) {
+	t.Parallel()
+
+	var rev Revision
+	err := json.Unmarshal([]byte(`{"PartsDeltas":[{"PartID":"a","Op":"foo"}]}`), &rev)
+	if !errors.Is(err, ErrUnknownDeltaOp) {
+		t.Errorf("expected ErrUnknownDeltaOp unmarshaling, got %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{"AuthorsDeltas":[{"Author":"alice","Op":"add","ToPosition":0}]}`), &rev); err != nil {
+		t.Errorf("unexpected error unmarshaling valid op: %s", err)
+	}
+
+	base := Post{ID: "post", Authors: []string{"alice"}, Parts: []Part{inlinePart("a", 0, "Hello")}}
+	revs := map[string]Revision{
+		"authors": {AuthorsDeltas: []AuthorsDelta{{Op: "foo", Author: "alice"}}},
+		"streams": {StreamsDeltas: []StreamsDelta{{Op: "mvv", Stream: "blog", FromPosition: -1}}},
+		"parts":   {PartsDeltas: []PartDelta{{Op: "update", PartID: "a"}}},
+		"headers": {PartsDeltas: []PartDelta{{Op: DeltaUpdate, PartID: "a", Headers: map[string][]HeaderDelta{"X-Role": {{Op: "set"}}}}}},
+	}
+	for name, rev := range revs {
+		if _, err := ApplyRevision(base, rev); !errors.Is(err, ErrUnknownDeltaOp) {
+			t.Errorf("%s: expected ErrUnknownDeltaOp applying, got %v", name, err)
+		}
+		if _, err := ComposeRevisions(Revision{}, rev); !errors.Is(err, ErrUnknownDeltaOp) {
+			t.Errorf("%s: expected ErrUnknownDeltaOp composing, got %v", name, err)
+		}
+		if _, _, err := MergeRevisions(base, Revision{}, rev); !errors.Is(err, ErrUnknownDeltaOp) {
+			t.Errorf("%s: expected ErrUnknownDeltaOp merging, got %v", name, err)
+		}
+	}
+}
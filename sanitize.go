@@ -0,0 +1,42 @@
+package posts
+
+import "fmt"
+
+// Sanitizer cleans up untrusted content before it gets rendered or stored.
+// The posts package doesn't sanitize anything itself; callers are expected to
+// supply a Sanitizer backed by something like bluemonday.
+type Sanitizer interface {
+	// Sanitize returns a safe version of body, which has the media type
+	// contentType, or an error if body can't be made safe.
+	Sanitize(contentType string, body []byte) ([]byte, error)
+}
+
+// Sanitize runs s over the body of every inline text/html Part and Metadata
+// part in the Post, replacing the body with the sanitized version and
+// updating the Part's SHA256 to match. Parts with any other content type, and
+// non-inline parts, are left untouched.
+func (p *Post) Sanitize(s Sanitizer) error {
+	if err := sanitizeParts(p.Parts, s); err != nil {
+		return err
+	}
+	return sanitizeParts(p.Metadata, s)
+}
+
+func sanitizeParts(parts []Part, s Sanitizer) error {
+	for pos, part := range parts {
+		if !part.Inline {
+			continue
+		}
+		mediaType := part.ContentType()
+		if mediaType != "text/html" {
+			continue
+		}
+		body, err := s.Sanitize(mediaType, part.Body)
+		if err != nil {
+			return fmt.Errorf("error sanitizing part %s: %w", part.ID, err)
+		}
+		parts[pos].Body = body
+		parts[pos].ComputeSHA256()
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package posts
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"testing"
+)
+
+var scriptTags = regexp.MustCompile(`(?s)<script.*?</script>`)
+
+// scriptStripper is a Sanitizer that strips script tags from HTML.
+type scriptStripper struct {
+	calls int
+}
+
+func (s *scriptStripper) Sanitize(contentType string, body []byte) ([]byte, error) {
+	s.calls++
+	if contentType != "text/html" {
+		return nil, errors.New("unexpected content type " + contentType)
+	}
+	return scriptTags.ReplaceAll(body, nil), nil
+}
+
+func TestPostSanitize(t *testing.T) {
+	t.Parallel()
+
+	unsafe := []byte(`<p>Hello</p><script>alert("hi")</script>`)
+	post := Post{
+		ID: "post",
+		Parts: []Part{
+			{ID: "html", Inline: true, Body: unsafe, SHA256: sha256Hex(unsafe), Headers: map[string][]string{
+				"Content-Type": {"text/html; charset=utf-8"},
+			}},
+			{ID: "markdown", Inline: true, Body: unsafe, SHA256: sha256Hex(unsafe), Headers: map[string][]string{
+				"Content-Type": {"text/markdown"},
+			}},
+			{ID: "blob", SHA256: "abc123", Headers: map[string][]string{
+				"Content-Type": {"text/html"},
+			}},
+		},
+	}
+
+	sanitizer := &scriptStripper{}
+	if err := post.Sanitize(sanitizer); err != nil {
+		t.Fatalf("unexpected error sanitizing: %s", err)
+	}
+	if sanitizer.calls != 1 {
+		t.Errorf("expected sanitizer to be called once, was called %d times", sanitizer.calls)
+	}
+
+	want := []byte("<p>Hello</p>")
+	if !bytes.Equal(post.Parts[0].Body, want) {
+		t.Errorf("expected HTML body %q, got %q", want, post.Parts[0].Body)
+	}
+	if post.Parts[0].SHA256 != sha256Hex(want) {
+		t.Errorf("expected HTML SHA256 %q, got %q", sha256Hex(want), post.Parts[0].SHA256)
+	}
+	if !bytes.Equal(post.Parts[1].Body, unsafe) {
+		t.Errorf("expected markdown body to be untouched, got %q", post.Parts[1].Body)
+	}
+	if post.Parts[2].SHA256 != "abc123" {
+		t.Errorf("expected non-inline part to be untouched, got SHA256 %q", post.Parts[2].SHA256)
+	}
+}
@@ -0,0 +1,88 @@
+package posts
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxSlugLength is the longest slug Slugify will return.
+const MaxSlugLength = 80
+
+// FallbackSlug is the slug Slugify returns for titles with nothing in them
+// that can be used in a slug, like a title that's all punctuation.
+const FallbackSlug = "untitled"
+
+// transliterations maps common accented and ligature characters to the ASCII
+// text Slugify replaces them with. Uppercase characters are lowercased before
+// they're looked up, so only lowercase characters are listed.
+var transliterations = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae",
+	'ç': "c", 'ć': "c", 'č': "c",
+	'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ľ': "l",
+	'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'œ': "oe",
+	'ř': "r",
+	'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss",
+	'ť': "t", 'ţ': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y",
+	'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// Slugify returns a URL-safe slug for title, suitable for use as a Post's
+// Slug. The slug is lowercase ASCII letters and numbers, separated by single
+// hyphens.
+//
+// Common accented characters are transliterated to ASCII, so "Héllo" becomes
+// "hello", and apostrophes are dropped. Every other character that isn't an
+// ASCII letter or number, including letters from non-Latin scripts,
+// separates words. Slugs longer than MaxSlugLength are truncated at the last
+// hyphen that fits, or at MaxSlugLength if there isn't one. If nothing in
+// title can be used, like when it's all punctuation, FallbackSlug is
+// returned.
+func Slugify(title string) string {
+	var slug strings.Builder
+	// hyphen is true when a separator has been seen since the last
+	// character written, so runs of separators become a single hyphen and
+	// leading separators are dropped.
+	hyphen := false
+	for _, r := range strings.ToLower(title) {
+		// apostrophes are dropped without separating words, so
+		// "don't" becomes "dont", not "don-t".
+		if r == '\'' || r == '’' {
+			continue
+		}
+		text, ok := transliterations[r]
+		if !ok && r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			text, ok = string(r), true
+		}
+		if !ok {
+			hyphen = true
+			continue
+		}
+		if hyphen && slug.Len() > 0 {
+			slug.WriteByte('-')
+		}
+		hyphen = false
+		slug.WriteString(text)
+	}
+	result := slug.String()
+	if len(result) > MaxSlugLength {
+		result = result[:MaxSlugLength+1]
+		if cut := strings.LastIndexByte(result, '-'); cut > 0 {
+			result = result[:cut]
+		} else {
+			result = result[:MaxSlugLength]
+		}
+	}
+	if result == "" {
+		return FallbackSlug
+	}
+	return result
+}
@@ -0,0 +1,49 @@
+package posts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("word ", 30)
+	tests := map[string]struct {
+		title string
+		want  string
+	}{
+		"simple":              {title: "Hello World", want: "hello-world"},
+		"accents-and-space":   {title: "  Héllo, World!!  ", want: "hello-world"},
+		"non-latin":           {title: "日本語", want: FallbackSlug},
+		"mixed-scripts":       {title: "Tokyo 東京 Guide", want: "tokyo-guide"},
+		"punctuation-only":    {title: "?!...---", want: FallbackSlug},
+		"empty":               {title: "", want: FallbackSlug},
+		"hyphens":             {title: "--a--b--", want: "a-b"},
+		"numbers":             {title: "Top 10 of 2024", want: "top-10-of-2024"},
+		"ligatures":           {title: "Straße Œuvre Ærø", want: "strasse-oeuvre-aero"},
+		"uppercase-accents":   {title: "ÉCOLE ÇA", want: "ecole-ca"},
+		"apostrophe":          {title: "Don't Panic, it’s fine", want: "dont-panic-its-fine"},
+		"truncated":           {title: long, want: strings.TrimSuffix(strings.Repeat("word-", 16), "-")},
+		"truncated-exactly":   {title: strings.Repeat("a", 80) + " b", want: strings.Repeat("a", 80)},
+		"truncated-no-hyphen": {title: strings.Repeat("a", 100), want: strings.Repeat("a", 80)},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := Slugify(test.title)
+			if got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+			if len(got) > MaxSlugLength {
+				t.Errorf("expected at most %d characters, got %d", MaxSlugLength, len(got))
+			}
+			if !slugPattern.MatchString(got) {
+				t.Errorf("expected %q to be a valid slug", got)
+			}
+		})
+	}
+}
@@ -2,32 +2,260 @@ package posts
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
 	"time"
 )
 
+// ErrNotFound is returned when a Storer is asked for a Post or Revision that
+// doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrAlreadyExists is returned when a Storer is asked to create a Post or
+// Revision with the same ID as one that already exists.
+var ErrAlreadyExists = errors.New("already exists")
+
+// ErrInvalidPost is returned when a Post is missing required properties or
+// breaks the invariants Storers rely on, like when it has no ID. The errors
+// Post.Validate returns wrap it.
+var ErrInvalidPost = errors.New("invalid post")
+
+// ErrUnsupported is returned when a Storer doesn't support an optional
+// operation, like Query.
+var ErrUnsupported = errors.New("unsupported operation")
+
+// ErrVersionConflict is returned when a Storer is asked to update a Post
+// based on a version of it that's no longer current, because another update
+// was applied first.
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrNotDeleted is returned when a Storer is asked to restore a Post that
+// isn't deleted, or to permanently delete one without ForceDelete.
+var ErrNotDeleted = errors.New("not deleted")
+
+// ErrRevisionNotApproved is returned when a Storer that requires approval for
+// changes is asked to apply a Revision that hasn't been approved.
+var ErrRevisionNotApproved = errors.New("revision not approved")
+
 // Storer captures the interface for storing and retrieving post contents in a
 // database of some kind.
+//
+// Errors are reported by wrapping the sentinel errors in this package, like
+// ErrNotFound and ErrAlreadyExists, so callers can check for them with
+// errors.Is regardless of the implementation. Implementations may add
+// context to them, but must not replace them.
+//
+// Every method takes a context, and implementations must honor it: if ctx is
+// canceled or its deadline passes before a method has made its changes, the
+// method must stop and return an error wrapping ctx.Err(), without making
+// any of them. A method that can't be interrupted part way through must at
+// least check ctx before it starts.
 type Storer interface {
 	// Create persists the Post as it is, returning an error if any
-	// necessary fields are missing or if the Post can't be written.
+	// necessary fields are missing or if the Post can't be written. An
+	// error wrapping ErrInvalidPost is returned if the Post has no ID,
+	// and an error wrapping ErrAlreadyExists if a Post with the same ID
+	// already exists.
 	Create(ctx context.Context, post Post) error
 
 	// Update applies the specified Revision to the Post indicated by the
-	// passed postID.
-	Update(ctx context.Context, postID string, rev Revision) error
+	// passed postID, incrementing the Post's Version. An error wrapping
+	// ErrNotFound is returned if the Post doesn't exist.
+	//
+	// version is the Version of the Post the Revision was generated
+	// against. If the stored Post's Version is different, another update
+	// got there first and the Revision may no longer describe the change
+	// the caller meant to make, so Update must return an error wrapping
+	// ErrVersionConflict without changing the Post. The caller can get
+	// the Post again, generate a new Revision against it, and retry.
+	//
+	// Update must be idempotent per Revision ID: implementations need to
+	// record the IDs of the Revisions they've applied to each Post, and if
+	// a Revision with an ID that has already been applied to the Post is
+	// passed again, Update must return nil without changing the Post.
+	// This lets callers safely retry an Update that timed out without
+	// applying the same change twice.
+	//
+	// Storers that require approval for changes must refuse to apply a
+	// Revision that hasn't been approved using ApproveRevision, returning
+	// ErrRevisionNotApproved.
+	Update(ctx context.Context, postID string, version int, rev Revision) error
 
 	// Delete marks the Post indicated by the passed ID as deleted,
-	// returning the Post that was deleted.
-	Delete(ctx context.Context, id string) error
+	// incrementing its Version, and returns the deleted Post. Deleting a
+	// Post that's already deleted changes nothing and returns the Post as
+	// it is. An error wrapping
+	// ErrNotFound is returned if the Post doesn't exist.
+	//
+	// Callers recording PostEvents can pass the deleted Post, with
+	// Deleted cleared, as the before Post to NewPostEvent, to get a
+	// PostEventTypeDeleted event.
+	Delete(ctx context.Context, id string) (Post, error)
 
-	// Get retrieves a Post by its ID, returning an error if it can't be
-	// found.
+	// DeletePermanently removes the Post indicated by the passed ID
+	// entirely, along with its Revisions, and removes the bodies of its
+	// non-inline Parts and Metadata from blobs, for erasing a Post
+	// beyond recovery. Bodies that are still used by another Post, like
+	// an image shared between Posts, are left in blobs. An error wrapping
+	// ErrNotFound is returned if the Post doesn't exist.
+	//
+	// To prevent accidentally erasing a Post that's still in use, the
+	// Post must already have been deleted with Delete; otherwise, an
+	// error wrapping ErrNotDeleted is returned and nothing is removed,
+	// unless ForceDelete is passed.
+	//
+	// If removing a body from blobs fails, the error is returned and
+	// the Post isn't removed, so the call can be retried.
+	DeletePermanently(ctx context.Context, id string, blobs BlobStore, opts ...DeleteOption) error
+
+	// Restore marks the Post indicated by the passed ID as no longer
+	// deleted, incrementing its Version, and returns the restored Post.
+	// An error wrapping ErrNotDeleted is returned if the Post isn't
+	// deleted, and an error wrapping ErrNotFound if it doesn't exist.
+	//
+	// Callers recording PostEvents can pass the restored Post, with
+	// Deleted set, as the before Post to NewPostEvent, to get a
+	// PostEventTypeRestored event.
+	Restore(ctx context.Context, id string) (Post, error)
+
+	// Publish marks the Post indicated by the passed ID as published,
+	// clearing its Draft and ScheduledFor properties and incrementing its
+	// Version, and returns the published Post. The first time a Post is
+	// published, when its PublishedAt is zero, PublishedAt is set to the
+	// current time; after that, it's kept as it is, so unpublishing and
+	// republishing a Post doesn't move it in listings, unless
+	// RefreshPublishedAt is passed. Publishing a Post that's already
+	// published changes nothing and returns the Post as it is. An error
+	// wrapping ErrNotFound is returned if the Post doesn't exist.
+	Publish(ctx context.Context, id string, opts ...PublishOption) (Post, error)
+
+	// Unpublish marks the Post indicated by the passed ID as a draft,
+	// keeping its PublishedAt and incrementing its Version, and returns
+	// the unpublished Post. Unpublishing a Post that's already a draft
+	// changes nothing and returns the Post as it is. An error wrapping
+	// ErrNotFound is returned if the Post doesn't exist.
+	Unpublish(ctx context.Context, id string) (Post, error)
+
+	// Get retrieves a Post by its ID, returning an error wrapping
+	// ErrNotFound if it can't be found. Deleted Posts can still be
+	// retrieved.
+	//
+	// Implementations should return a clone of the Post, as returned by
+	// Post.Clone, or one freshly decoded from storage, so callers can
+	// modify it without changing the stored Post or what other callers
+	// see. The same goes for every other method returning Posts.
 	Get(ctx context.Context, id string) (Post, error)
 
-	// List retrieves an list of Posts sorted by their PublishedAt property
-	// descending, filtered according to the passed filter.
+	// GetMany retrieves the Posts indicated by the passed IDs, keyed by
+	// their IDs. IDs that don't match a Post are left out of the result
+	// instead of returning an error, and IDs passed more than once are
+	// only looked up once.
+	GetMany(ctx context.Context, ids []string) (map[string]Post, error)
+
+	// List retrieves an list of Posts filtered according to the passed
+	// filter, sorted by its OrderBy property, or by their PublishedAt
+	// property descending if it's not set. Posts must match the filter
+	// the same way PostFilter.Matches says they do, and an error should
+	// be returned for filters PostFilter.Validate rejects.
 	List(ctx context.Context, filter PostFilter) ([]Post, error)
-	// TODO: query, for full-text search?
+
+	// ListIter yields the Posts List would return for the passed filter,
+	// in the same order, one at a time, so large result sets don't need
+	// to be held in memory at once. Iteration stops when the caller
+	// breaks out of the loop. If ctx is canceled, or a Post can't be
+	// retrieved, the error is yielded with an empty Post and iteration
+	// stops.
+	ListIter(ctx context.Context, filter PostFilter) iter.Seq2[Post, error]
+
+	// Count returns the number of Posts that match the passed filter,
+	// using exactly the same semantics as List. The filter's Limit is
+	// ignored, so Count returns the total number of matching Posts, not
+	// the number a List with the same filter would return.
+	Count(ctx context.Context, filter PostFilter) (int, error)
+
+	// LatestRevision retrieves the Revision most recently applied to the
+	// Post indicated by the passed postID. If no Revisions have been
+	// applied to the Post since it was created, the returned bool will be
+	// false.
+	LatestRevision(ctx context.Context, postID string) (Revision, bool, error)
+
+	// PostsByAuthor retrieves the Posts written by author that match the
+	// passed filter, sorted the same way List sorts them, along with the
+	// total number of Posts by author that match the filter. The total
+	// ignores the filter's Limit, so it can be larger than the number of
+	// Posts returned. The filter's Authors and AuthorsMode properties are
+	// ignored.
+	PostsByAuthor(ctx context.Context, author string, filter PostFilter) (posts []Post, total int, err error)
+
+	// ProposeRevision records rev as a proposed change to the Post
+	// indicated by the passed postID, without applying it, and returns
+	// the ID the Revision can be reviewed under.
+	ProposeRevision(ctx context.Context, postID string, rev Revision) (string, error)
+
+	// ApproveRevision marks the proposed Revision indicated by the passed
+	// revisionID as approved, allowing it to be applied with Update.
+	ApproveRevision(ctx context.Context, revisionID string) error
+
+	// RejectRevision marks the proposed Revision indicated by the passed
+	// revisionID as rejected, preventing it from being applied.
+	RejectRevision(ctx context.Context, revisionID string) error
+
+	// SubscribeRevisions returns a channel that receives every Revision
+	// applied to the Post indicated by the passed postID from the time
+	// it's called, in the order they're applied. The channel is closed
+	// when ctx is canceled.
+	SubscribeRevisions(ctx context.Context, postID string) (<-chan Revision, error)
+
+	// MovePostStream moves the Post indicated by the passed postID from
+	// fromStream to toStream in a single operation, as described by
+	// Post.MoveStream, recording the change as a Revision with
+	// StreamsDeltas so it shows up in the Post's history. An error
+	// wrapping ErrPostNotInStream is returned if the Post isn't in
+	// fromStream. The updated Post is returned.
+	MovePostStream(ctx context.Context, postID, fromStream, toStream string) (Post, error)
+
+	// Query searches the titles and inline Part bodies of the Posts that
+	// match the passed filter for q, returning a QueryResult for each
+	// Post that matches, best match first. How q is interpreted is up to
+	// the implementation, but it should at least find Posts containing q
+	// verbatim, ignoring case; see MatchQuery.
+	//
+	// Storers that can't search Posts should return an error wrapping
+	// ErrUnsupported.
+	Query(ctx context.Context, q string, filter PostFilter) ([]QueryResult, error)
+}
+
+// DeleteOption changes how Storer.DeletePermanently deletes a Post.
+type DeleteOption func(*deleteOptions)
+
+type deleteOptions struct {
+	force bool
+}
+
+// ForceDelete makes Storer.DeletePermanently delete a Post even if it hasn't
+// been deleted with Delete first.
+func ForceDelete() DeleteOption {
+	return func(opts *deleteOptions) {
+		opts.force = true
+	}
+}
+
+// PublishOption changes how Storer.Publish publishes a Post.
+type PublishOption func(*publishOptions)
+
+type publishOptions struct {
+	refresh bool
+}
+
+// RefreshPublishedAt makes Storer.Publish set the Post's PublishedAt to the
+// current time even if it has been published before, for republishing a
+// Post as if it were new.
+func RefreshPublishedAt() PublishOption {
+	return func(opts *publishOptions) {
+		opts.refresh = true
+	}
 }
 
 // StringListFilterMode is an enum for indicating how a list of strings should
@@ -63,6 +291,40 @@ const (
 	StringListFilterModeExcludes StringListFilterMode = "excludes"
 )
 
+// Valid returns true if the StringListFilterMode is one of the
+// StringListFilterModes defined in this package, other than
+// StringListFilterModeInvalid.
+func (s StringListFilterMode) Valid() bool {
+	switch s {
+	case StringListFilterModeExact, StringListFilterModeExactUnordered, StringListFilterModeContainsAll,
+		StringListFilterModeContainsAny, StringListFilterModeExcludes:
+		return true
+	}
+	return false
+}
+
+// PostOrderField is an enum for indicating which property of a Post a list of
+// Posts should be sorted by.
+type PostOrderField string
+
+const (
+	// PostOrderFieldDefault sorts Posts by their PublishedAt property,
+	// descending, so the most recently published Posts come first.
+	PostOrderFieldDefault PostOrderField = ""
+
+	// PostOrderFieldPublishedAt sorts Posts by their PublishedAt
+	// property.
+	PostOrderFieldPublishedAt PostOrderField = "published_at"
+
+	// PostOrderFieldTitle sorts Posts by their Title property,
+	// alphabetically, ignoring case.
+	PostOrderFieldTitle PostOrderField = "title"
+
+	// PostOrderFieldSlug sorts Posts by their Slug property,
+	// alphabetically.
+	PostOrderFieldSlug PostOrderField = "slug"
+)
+
 // PostFilter represents a filter that can be applied to Posts to return only
 // the Posts the caller is interested in.
 type PostFilter struct {
@@ -79,18 +341,38 @@ type PostFilter struct {
 	// match for the Authors property.
 	AuthorsMode StringListFilterMode
 
-	// PublishedBefore specifies the maximum timestamp, exclusive, that
-	// Posts should have in their PublishedAt property.
+	// PublishedBefore specifies the maximum timestamp, exclusive unless
+	// PublishedBeforeInclusive is set, that Posts should have in their
+	// PublishedAt property.
 	PublishedBefore *time.Time
 
-	// PublishedAfter specifies the minimum timestamp, exclusive, that
-	// Posts should have in their PublishedAt property.
+	// PublishedBeforeInclusive makes PublishedBefore an inclusive bound,
+	// so Posts published at exactly that time match too.
+	PublishedBeforeInclusive bool
+
+	// PublishedAfter specifies the minimum timestamp, exclusive unless
+	// PublishedAfterInclusive is set, that Posts should have in their
+	// PublishedAt property.
 	PublishedAfter *time.Time
 
+	// PublishedAfterInclusive makes PublishedAfter an inclusive bound, so
+	// Posts published at exactly that time match too.
+	PublishedAfterInclusive bool
+
 	// Draft, when non-nil, filters out Posts with a Draft property
 	// different than its value.
 	Draft *bool
 
+	// Deleted, when non-nil, filters out Posts with a Deleted property
+	// different than its value. When nil, deleted Posts are filtered out,
+	// the same as when it's false; set it to true to find only deleted
+	// Posts.
+	Deleted *bool
+
+	// TitleContains, when non-nil, filters for Posts with a Title that
+	// contains its value, ignoring case.
+	TitleContains *string
+
 	// Streams, when non-nil and non-empty, filters for Posts with streams
 	// that match its value, where StreamsMode controls how "match" is
 	// defined.
@@ -99,6 +381,35 @@ type PostFilter struct {
 	// StreamsMode specifies the type of values that will be considered a
 	// match for the Streams property.
 	StreamsMode StringListFilterMode
+
+	// Scheduled, when non-nil, filters out Posts whose IsScheduled method
+	// returns something different than its value when called with the
+	// time the filter is applied. Drafts that were scheduled for a time
+	// that has already passed, but haven't been published yet, are not
+	// considered scheduled, and neither are drafts without a
+	// ScheduledFor, so both are left out when Scheduled is true and
+	// included when it's false.
+	Scheduled *bool
+
+	// Limit, when greater than zero, is the maximum number of Posts that
+	// should be returned.
+	Limit int
+
+	// OrderBy specifies the property the Posts should be sorted by. Posts
+	// with the same value for it are sorted by their ID, ascending, so the
+	// order is always the same. When it's PostOrderFieldDefault, Posts
+	// are sorted by their PublishedAt property, descending, and
+	// Descending is ignored.
+	//
+	// Paginating with a cursor only works if the cursor records the
+	// value of the property the Posts are sorted by, along with the ID,
+	// for the last Post on the page, so changing OrderBy invalidates any
+	// cursors created with a different value.
+	OrderBy PostOrderField
+
+	// Descending sorts the Posts in descending order of their OrderBy
+	// property, instead of ascending.
+	Descending bool
 }
 
 // IsEmpty returns true if the PostFilter is semantically an empty value, i.e.,
@@ -110,23 +421,169 @@ func (p PostFilter) IsEmpty() bool {
 	if len(p.Authors) != 0 {
 		return false
 	}
-	if p.AuthorsMode == StringListFilterModeInvalid {
+	if p.AuthorsMode != StringListFilterModeInvalid {
 		return false
 	}
 	if p.PublishedBefore != nil {
 		return false
 	}
+	if p.PublishedBeforeInclusive {
+		return false
+	}
 	if p.PublishedAfter != nil {
 		return false
 	}
+	if p.PublishedAfterInclusive {
+		return false
+	}
 	if p.Draft != nil {
 		return false
 	}
+	if p.Deleted != nil {
+		return false
+	}
+	if p.TitleContains != nil {
+		return false
+	}
 	if len(p.Streams) != 0 {
 		return false
 	}
-	if p.StreamsMode == StringListFilterModeInvalid {
+	if p.StreamsMode != StringListFilterModeInvalid {
+		return false
+	}
+	if p.Scheduled != nil {
+		return false
+	}
+	if p.Limit > 0 {
+		return false
+	}
+	if p.OrderBy != PostOrderFieldDefault {
+		return false
+	}
+	if p.Descending {
 		return false
 	}
 	return true
 }
+
+// Validate returns an error if the PostFilter can't be applied, because its
+// Authors or Streams are set without a valid mode to match them with. Modes
+// are ignored when their lists are empty, so they're only checked then.
+func (p PostFilter) Validate() error {
+	if len(p.Authors) > 0 && !p.AuthorsMode.Valid() {
+		return fmt.Errorf("invalid authors filter: unknown mode %q", p.AuthorsMode)
+	}
+	if len(p.Streams) > 0 && !p.StreamsMode.Valid() {
+		return fmt.Errorf("invalid streams filter: unknown mode %q", p.StreamsMode)
+	}
+	return nil
+}
+
+// Matches returns true if post matches every property set in the PostFilter,
+// as of the current time; see MatchesAt.
+func (p PostFilter) Matches(post Post) bool {
+	return p.MatchesAt(post, time.Now())
+}
+
+// MatchesAt returns true if post matches every property set in the
+// PostFilter, with now as the time the filter is applied, for deciding
+// whether the Post is scheduled. It's the canonical definition of what each
+// property of a PostFilter means, for Storers that can't apply a filter in
+// their database to fall back on, so they all agree on the details:
+//
+//   - PublishedBefore and PublishedAfter are exclusive, so a Post published at
+//     exactly that time doesn't match, unless PublishedBeforeInclusive or
+//     PublishedAfterInclusive, respectively, is set.
+//   - Deleted Posts only match when Deleted is set to true.
+//   - Authors and Streams match everything when they're empty, whatever
+//     their mode, and nothing when they're set with a mode that isn't Valid;
+//     use Validate to report that as an error.
+//
+// The PostFilter's Limit, OrderBy, and Descending properties are ignored, as
+// they don't apply to a single Post.
+func (p PostFilter) MatchesAt(post Post, now time.Time) bool {
+	if p.Slug != nil && post.Slug != *p.Slug {
+		return false
+	}
+	if p.PublishedBefore != nil && !withinBound(compareTimes(post.PublishedAt, *p.PublishedBefore), p.PublishedBeforeInclusive) {
+		return false
+	}
+	if p.PublishedAfter != nil && !withinBound(compareTimes(*p.PublishedAfter, post.PublishedAt), p.PublishedAfterInclusive) {
+		return false
+	}
+	if p.Draft != nil && post.Draft != *p.Draft {
+		return false
+	}
+	// deleted Posts are only included when they're asked for.
+	if p.Deleted == nil && post.Deleted {
+		return false
+	}
+	if p.Deleted != nil && post.Deleted != *p.Deleted {
+		return false
+	}
+	if p.TitleContains != nil && !strings.Contains(strings.ToLower(post.Title), strings.ToLower(*p.TitleContains)) {
+		return false
+	}
+	if p.Scheduled != nil && post.IsScheduled(now) != *p.Scheduled {
+		return false
+	}
+	return matchesStringList(post.Authors, p.Authors, p.AuthorsMode) &&
+		matchesStringList(post.Streams, p.Streams, p.StreamsMode)
+}
+
+// withinBound returns true if a value that compares to a bound as c does, as
+// returned by compareTimes, is on the right side of it: before it, or equal
+// to it if the bound is inclusive.
+func withinBound(c int, inclusive bool) bool {
+	return c < 0 || (c == 0 && inclusive)
+}
+
+// matchesStringList returns true if values matches filter according to mode.
+// An empty filter matches everything, regardless of mode, and a non-empty one
+// with an unknown mode matches nothing.
+func matchesStringList(values, filter []string, mode StringListFilterMode) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	present := make(map[string]int, len(values))
+	for _, value := range values {
+		present[value]++
+	}
+	switch mode {
+	case StringListFilterModeExact:
+		return stringsEqual(values, filter)
+	case StringListFilterModeExactUnordered:
+		if len(values) != len(filter) {
+			return false
+		}
+		for _, value := range filter {
+			present[value]--
+			if present[value] < 0 {
+				return false
+			}
+		}
+		return true
+	case StringListFilterModeContainsAll:
+		for _, value := range filter {
+			if present[value] == 0 {
+				return false
+			}
+		}
+		return true
+	case StringListFilterModeContainsAny:
+		for _, value := range filter {
+			if present[value] > 0 {
+				return true
+			}
+		}
+		return false
+	case StringListFilterModeExcludes:
+		for _, value := range filter {
+			if present[value] > 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -1 +1,331 @@
 package posts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPostFilterIsEmpty(t *testing.T) {
+	t.Parallel()
+
+	slug := "hello-world"
+	now := time.Now()
+	draft := false
+	scheduled := true
+
+	tests := map[string]struct {
+		filter PostFilter
+		want   bool
+	}{
+		"empty": {
+			filter: PostFilter{},
+			want:   true,
+		},
+		"slug": {
+			filter: PostFilter{Slug: &slug},
+		},
+		"authors": {
+			filter: PostFilter{Authors: []string{"alice"}},
+		},
+		"authors-mode": {
+			filter: PostFilter{AuthorsMode: StringListFilterModeContainsAny},
+		},
+		"published-before": {
+			filter: PostFilter{PublishedBefore: &now},
+		},
+		"published-after": {
+			filter: PostFilter{PublishedAfter: &now},
+		},
+		"published-before-inclusive": {
+			filter: PostFilter{PublishedBeforeInclusive: true},
+		},
+		"published-after-inclusive": {
+			filter: PostFilter{PublishedAfterInclusive: true},
+		},
+		"draft": {
+			filter: PostFilter{Draft: &draft},
+		},
+		"deleted": {
+			filter: PostFilter{Deleted: &draft},
+		},
+		"title-contains": {
+			filter: PostFilter{TitleContains: &slug},
+		},
+		"streams": {
+			filter: PostFilter{Streams: []string{"blog"}},
+		},
+		"streams-mode": {
+			filter: PostFilter{StreamsMode: StringListFilterModeExcludes},
+		},
+		"scheduled": {
+			filter: PostFilter{Scheduled: &scheduled},
+		},
+		"limit": {
+			filter: PostFilter{Limit: 10},
+		},
+		"order-by": {
+			filter: PostFilter{OrderBy: PostOrderFieldTitle},
+		},
+		"descending": {
+			filter: PostFilter{Descending: true},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := test.filter.IsEmpty(); got != test.want {
+				t.Errorf("expected IsEmpty to return %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestPostFilterMatchesStringListModes(t *testing.T) {
+	t.Parallel()
+
+	lists := map[string][]string{
+		"none":            nil,
+		"alice":           {"alice"},
+		"alice-bob":       {"alice", "bob"},
+		"bob-alice":       {"bob", "alice"},
+		"alice-alice":     {"alice", "alice"},
+		"alice-bob-carol": {"alice", "bob", "carol"},
+		"carol":           {"carol"},
+	}
+
+	tests := map[string]struct {
+		mode   StringListFilterMode
+		filter []string
+		want   []string
+	}{
+		"exact": {
+			mode:   StringListFilterModeExact,
+			filter: []string{"alice", "bob"},
+			want:   []string{"alice-bob"},
+		},
+		"exact-unordered": {
+			mode:   StringListFilterModeExactUnordered,
+			filter: []string{"alice", "bob"},
+			want:   []string{"alice-bob", "bob-alice"},
+		},
+		"exact-unordered-duplicates": {
+			mode:   StringListFilterModeExactUnordered,
+			filter: []string{"alice", "alice"},
+			want:   []string{"alice-alice"},
+		},
+		"contains-all": {
+			mode:   StringListFilterModeContainsAll,
+			filter: []string{"alice", "bob"},
+			want:   []string{"alice-bob", "bob-alice", "alice-bob-carol"},
+		},
+		"contains-any": {
+			mode:   StringListFilterModeContainsAny,
+			filter: []string{"alice", "bob"},
+			want:   []string{"alice", "alice-bob", "bob-alice", "alice-alice", "alice-bob-carol"},
+		},
+		"excludes": {
+			mode:   StringListFilterModeExcludes,
+			filter: []string{"alice", "bob"},
+			want:   []string{"none", "carol"},
+		},
+		"empty-exact": {
+			mode: StringListFilterModeExact,
+			want: []string{"none", "alice", "alice-bob", "bob-alice", "alice-alice", "alice-bob-carol", "carol"},
+		},
+		"empty-contains-any": {
+			mode:   StringListFilterModeContainsAny,
+			filter: []string{},
+			want:   []string{"none", "alice", "alice-bob", "bob-alice", "alice-alice", "alice-bob-carol", "carol"},
+		},
+		"empty-invalid": {
+			want: []string{"none", "alice", "alice-bob", "bob-alice", "alice-alice", "alice-bob-carol", "carol"},
+		},
+		"invalid": {
+			filter: []string{"alice"},
+		},
+		"unknown": {
+			mode:   StringListFilterMode("some"),
+			filter: []string{"alice"},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			want := map[string]bool{}
+			for _, list := range test.want {
+				want[list] = true
+			}
+			filters := map[string]PostFilter{
+				"authors": {Authors: test.filter, AuthorsMode: test.mode},
+				"streams": {Streams: test.filter, StreamsMode: test.mode},
+			}
+			for field, filter := range filters {
+				for list, values := range lists {
+					post := Post{ID: "post", Authors: values, Streams: values}
+					if got := filter.Matches(post); got != want[list] {
+						t.Errorf("expected %s filter %q to return %v for %q, got %v", field, test.filter, want[list], values, got)
+					}
+				}
+				if err := filter.Validate(); (err == nil) != (len(test.filter) == 0 || test.mode.Valid()) {
+					t.Errorf("unexpected result validating %s filter: %v", field, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPostFilterMatches(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+	slug := "hello-world"
+	title := "WORLD"
+	yes, no := true, false
+	post := Post{
+		ID:          "post",
+		Title:       "Hello, world",
+		Slug:        slug,
+		PublishedAt: now,
+	}
+
+	tests := map[string]struct {
+		filter PostFilter
+		modify func(post *Post)
+		want   bool
+	}{
+		"empty": {
+			want: true,
+		},
+		"slug": {
+			filter: PostFilter{Slug: &slug},
+			want:   true,
+		},
+		"other-slug": {
+			filter: PostFilter{Slug: &title},
+		},
+		"published-before": {
+			filter: PostFilter{PublishedBefore: &after},
+			want:   true,
+		},
+		"published-before-exclusive": {
+			filter: PostFilter{PublishedBefore: &now},
+		},
+		"published-after": {
+			filter: PostFilter{PublishedAfter: &before},
+			want:   true,
+		},
+		"published-after-exclusive": {
+			filter: PostFilter{PublishedAfter: &now},
+		},
+		"published-before-inclusive": {
+			filter: PostFilter{PublishedBefore: &now, PublishedBeforeInclusive: true},
+			want:   true,
+		},
+		"published-before-inclusive-after": {
+			filter: PostFilter{PublishedBefore: &before, PublishedBeforeInclusive: true},
+		},
+		"published-after-inclusive": {
+			filter: PostFilter{PublishedAfter: &now, PublishedAfterInclusive: true},
+			want:   true,
+		},
+		"published-after-inclusive-before": {
+			filter: PostFilter{PublishedAfter: &after, PublishedAfterInclusive: true},
+		},
+		"published-between-inclusive": {
+			filter: PostFilter{PublishedAfter: &now, PublishedAfterInclusive: true, PublishedBefore: &now, PublishedBeforeInclusive: true},
+			want:   true,
+		},
+		"published-between-half-open": {
+			filter: PostFilter{PublishedAfter: &now, PublishedAfterInclusive: true, PublishedBefore: &now},
+		},
+		// the flags do nothing without a bound.
+		"inclusive-without-bounds": {
+			filter: PostFilter{PublishedBeforeInclusive: true, PublishedAfterInclusive: true},
+			want:   true,
+		},
+		"draft": {
+			filter: PostFilter{Draft: &yes},
+		},
+		"not-draft": {
+			filter: PostFilter{Draft: &no},
+			want:   true,
+		},
+		"deleted-unset": {
+			modify: func(post *Post) { post.Deleted = true },
+		},
+		"deleted-false": {
+			filter: PostFilter{Deleted: &no},
+			modify: func(post *Post) { post.Deleted = true },
+		},
+		"deleted-true": {
+			filter: PostFilter{Deleted: &yes},
+			modify: func(post *Post) { post.Deleted = true },
+			want:   true,
+		},
+		"deleted-true-live": {
+			filter: PostFilter{Deleted: &yes},
+		},
+		"title-contains": {
+			filter: PostFilter{TitleContains: &title},
+			want:   true,
+		},
+		"scheduled": {
+			filter: PostFilter{Scheduled: &yes},
+			modify: func(post *Post) {
+				post.Draft = true
+				post.ScheduledFor = &after
+			},
+			want: true,
+		},
+		"scheduled-past-due": {
+			filter: PostFilter{Scheduled: &yes},
+			modify: func(post *Post) {
+				post.Draft = true
+				post.ScheduledFor = &before
+			},
+		},
+		"not-scheduled-past-due": {
+			filter: PostFilter{Scheduled: &no},
+			modify: func(post *Post) {
+				post.Draft = true
+				post.ScheduledFor = &before
+			},
+			want: true,
+		},
+		"scheduled-unscheduled-draft": {
+			filter: PostFilter{Scheduled: &yes},
+			modify: func(post *Post) { post.Draft = true },
+		},
+		"not-scheduled-unscheduled-draft": {
+			filter: PostFilter{Scheduled: &no},
+			modify: func(post *Post) { post.Draft = true },
+			want:   true,
+		},
+		"ignores-limit-and-order": {
+			filter: PostFilter{Limit: 1, OrderBy: PostOrderField("unknown"), Descending: true},
+			want:   true,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			post := post.Clone()
+			if test.modify != nil {
+				test.modify(&post)
+			}
+			if got := test.filter.MatchesAt(post, now); got != test.want {
+				t.Errorf("expected MatchesAt to return %v, got %v", test.want, got)
+			}
+		})
+	}
+}
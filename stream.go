@@ -1,5 +1,19 @@
 package posts
 
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrPostNotInStream is returned when a Post is expected to be in a Stream,
+// but isn't.
+var ErrPostNotInStream = errors.New("post not in stream")
+
+// ErrStreamNotEmpty is returned when a Stream that still has Posts in it is
+// deleted with DeleteStreamModeRefuse.
+var ErrStreamNotEmpty = errors.New("stream not empty")
+
 // A Stream is a series of posts. This struct
 // holds the metadata about a stream.
 type Stream struct {
@@ -21,3 +35,129 @@ type Stream struct {
 	// this stream.
 	Authors []string
 }
+
+// DeleteStreamMode is an enum for indicating what should happen to the Posts
+// in a Stream when the Stream is deleted.
+type DeleteStreamMode string
+
+const (
+	// DeleteStreamModeInvalid is an invalid value placeholder that should
+	// never be intentionally used.
+	DeleteStreamModeInvalid DeleteStreamMode = ""
+
+	// DeleteStreamModeRefuse refuses to delete a Stream that any Post,
+	// including deleted Posts, is still in, returning an error wrapping
+	// ErrStreamNotEmpty.
+	DeleteStreamModeRefuse DeleteStreamMode = "refuse"
+
+	// DeleteStreamModeCascade removes the Stream from the Streams of
+	// every Post that's in it, including deleted Posts, before deleting
+	// the Stream.
+	DeleteStreamModeCascade DeleteStreamMode = "cascade"
+)
+
+// StreamStorer captures the interface for storing and retrieving Streams, and
+// managing which Posts are in them, in a database of some kind.
+//
+// A Post's membership in Streams is recorded in its Streams property, so
+// StreamStorers need to be able to update Posts, too, and are usually
+// implemented by the same type as a Storer.
+type StreamStorer interface {
+	// CreateStream persists the Stream as it is, returning an error
+	// wrapping ErrAlreadyExists if a Stream with the same ID has already
+	// been created.
+	CreateStream(ctx context.Context, stream Stream) error
+
+	// GetStream retrieves a Stream by its ID, returning an error wrapping
+	// ErrNotFound if it can't be found.
+	GetStream(ctx context.Context, id string) (Stream, error)
+
+	// UpdateStream replaces the Stream with the same ID as stream,
+	// returning an error wrapping ErrNotFound if there isn't one.
+	UpdateStream(ctx context.Context, stream Stream) error
+
+	// DeleteStream deletes the Stream indicated by the passed ID. What
+	// happens to the Posts that are still in the Stream depends on mode;
+	// see DeleteStreamMode. Any other mode returns an error without
+	// deleting the Stream.
+	DeleteStream(ctx context.Context, id string, mode DeleteStreamMode) error
+
+	// ListStreams retrieves every Stream, sorted by their Title, then by
+	// their ID.
+	ListStreams(ctx context.Context) ([]Stream, error)
+
+	// AddPostToStream adds the Stream indicated by streamID to the end of
+	// the Streams of the Post indicated by postID. If the Post is already
+	// in the Stream, nothing is changed. An error wrapping ErrNotFound is
+	// returned if the Post or the Stream doesn't exist.
+	AddPostToStream(ctx context.Context, postID, streamID string) error
+
+	// RemovePostFromStream removes the Stream indicated by streamID from
+	// the Streams of the Post indicated by postID. An error wrapping
+	// ErrPostNotInStream is returned if the Post isn't in the Stream.
+	RemovePostFromStream(ctx context.Context, postID, streamID string) error
+}
+
+// ResolvePostMetadata returns the Metadata of post combined with the default
+// Metadata of the stream it's being rendered in. Stream Metadata parts are
+// inherited by the Post unless the Post has its own Metadata part with the
+// same role, in which case the Post's part is used instead. Parts without a
+// role can't be overridden, so they're always included.
+//
+// The Post's Metadata comes first, in Position order, followed by the
+// inherited Stream Metadata, in Position order. The returned parts are
+// clones, with their Positions renumbered to match that order, so they're
+// valid as a Post's Metadata and changing them doesn't affect post or
+// stream.
+func ResolvePostMetadata(post Post, stream Stream) []Part {
+	resolved := make([]Part, 0, len(post.Metadata)+len(stream.Metadata))
+	overridden := map[string]struct{}{}
+	for _, part := range normalizedParts(post.Metadata) {
+		if role := part.Role(); role != "" {
+			overridden[role] = struct{}{}
+		}
+		resolved = append(resolved, part)
+	}
+	for _, part := range normalizedParts(stream.Metadata) {
+		if _, ok := overridden[part.Role()]; ok {
+			continue
+		}
+		resolved = append(resolved, part)
+	}
+	for pos := range resolved {
+		resolved[pos] = resolved[pos].Clone()
+		resolved[pos].Position = pos
+	}
+	return resolved
+}
+
+// MoveStream replaces from with to in the Post's Streams, keeping the Post's
+// place in the order of its Streams. If the Post is already in to, from is
+// just removed, so the Post is never in the same Stream twice. An error
+// wrapping ErrPostNotInStream is returned if the Post isn't in from.
+func (p *Post) MoveStream(from, to string) error {
+	fromPos := -1
+	for pos, stream := range p.Streams {
+		if stream == from {
+			fromPos = pos
+			break
+		}
+	}
+	if fromPos < 0 {
+		return fmt.Errorf("%w: post %s is not in stream %s", ErrPostNotInStream, p.ID, from)
+	}
+	streams := make([]string, 0, len(p.Streams))
+	for pos, stream := range p.Streams {
+		switch {
+		case pos == fromPos:
+			streams = append(streams, to)
+		case stream == to:
+			// it's taking from's place instead
+			continue
+		default:
+			streams = append(streams, stream)
+		}
+	}
+	p.Streams = streams
+	return nil
+}
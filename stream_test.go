@@ -0,0 +1,128 @@
+package posts
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestResolvePostMetadata(t *testing.T) {
+	t.Parallel()
+
+	streamHeader := Part{ID: "stream-header", SHA256: "stream", Headers: map[string][]string{RoleHeader: {RoleHeaderImage}}}
+	streamFooter := Part{ID: "stream-footer", Position: 1, Inline: true, Body: []byte("Thanks for reading.")}
+	postHeader := Part{ID: "post-header", Position: 1, SHA256: "post", Headers: map[string][]string{RoleHeader: {RoleHeaderImage}}}
+	postSummary := Part{ID: "post-summary", Inline: true, Body: []byte("A summary."), Headers: map[string][]string{RoleHeader: {RoleSummary}}}
+	newStream := func() Stream {
+		return Stream{ID: "stream", Metadata: []Part{streamFooter.Clone(), streamHeader.Clone()}}
+	}
+
+	tests := map[string]struct {
+		post Post
+		want []string
+	}{
+		"overrides": {
+			post: Post{Metadata: []Part{postHeader, postSummary}},
+			want: []string{"post-summary", "post-header", "stream-footer"},
+		},
+		"inherits": {
+			post: Post{Metadata: []Part{postSummary}},
+			want: []string{"post-summary", "stream-header", "stream-footer"},
+		},
+		"no-post-metadata": {
+			post: Post{},
+			want: []string{"stream-header", "stream-footer"},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			post, stream := test.post.Clone(), newStream()
+			got := ResolvePostMetadata(post, stream)
+
+			// the result should already be normalized, in the order
+			// it's meant to be in.
+			normalized := normalizedParts(got)
+			if !reflect.DeepEqual(got, normalized) {
+				t.Errorf("expected normalized metadata\n%+v\ngot\n%+v", normalized, got)
+			}
+			ids := make([]string, 0, len(normalized))
+			for _, part := range normalized {
+				ids = append(ids, part.ID)
+			}
+			if !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("expected parts %v, got %v", test.want, ids)
+			}
+
+			for _, part := range got {
+				part.Body = append(part.Body[:0], "changed"...)
+				if part.Headers != nil {
+					part.Headers[RoleHeader] = []string{"changed"}
+				}
+			}
+			if !reflect.DeepEqual(post, test.post) {
+				t.Errorf("expected post to be unchanged\n%+v\ngot\n%+v", test.post, post)
+			}
+			if want := newStream(); !reflect.DeepEqual(stream, want) {
+				t.Errorf("expected stream to be unchanged\n%+v\ngot\n%+v", want, stream)
+			}
+		})
+	}
+}
+
+func TestPostMoveStream(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		streams []string
+		from    string
+		to      string
+		want    []string
+		wantErr error
+	}{
+		"move": {
+			streams: []string{"featured", "blog", "tech"},
+			from:    "blog",
+			to:      "archive",
+			want:    []string{"featured", "archive", "tech"},
+		},
+		"already-in-destination": {
+			streams: []string{"archive", "blog", "tech"},
+			from:    "blog",
+			to:      "archive",
+			want:    []string{"archive", "tech"},
+		},
+		"already-in-destination-later": {
+			streams: []string{"blog", "tech", "archive"},
+			from:    "blog",
+			to:      "archive",
+			want:    []string{"archive", "tech"},
+		},
+		"not-in-source": {
+			streams: []string{"tech"},
+			from:    "blog",
+			to:      "archive",
+			want:    []string{"tech"},
+			wantErr: ErrPostNotInStream,
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			post := Post{ID: "post", Streams: test.streams}
+			err := post.MoveStream(test.from, test.to)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("expected error %v, got %v", test.wantErr, err)
+			}
+			if !reflect.DeepEqual(post.Streams, test.want) {
+				t.Errorf("expected streams %v, got %v", test.want, post.Streams)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package posts
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// uuidPattern matches UUIDs in their canonical, hyphenated form.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// slugPattern matches valid Post slugs: lowercase letters and numbers,
+// separated by single hyphens.
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Validate returns an error if the Post is missing required properties or
+// breaks any of the invariants Storers rely on. A valid Post has:
+//
+//   - an ID that's a UUID
+//   - a non-empty Title
+//   - a non-empty Slug made of lowercase letters and numbers, separated by
+//     single hyphens
+//   - Parts and Metadata that each have an ID and a Content-Type header,
+//     a non-nil Body if they're inline, a SHA256 if they're not, and a
+//     valid role
+//   - inline Parts and Metadata whose SHA256, if it's set, matches their
+//     Body
+//   - Parts and Metadata whose Positions are unique and contiguous,
+//     starting at 0
+//   - anchors that pass ValidateAnchors
+//
+// Every violation is reported, not just the first; the returned error wraps
+// ErrInvalidPost and an error for each of them.
+func (p Post) Validate() error {
+	var errs []error
+	if !uuidPattern.MatchString(p.ID) {
+		errs = append(errs, fmt.Errorf("ID %q is not a UUID", p.ID))
+	}
+	if p.Title == "" {
+		errs = append(errs, errors.New("title is empty"))
+	}
+	if p.Slug == "" {
+		errs = append(errs, errors.New("slug is empty"))
+	} else if !slugPattern.MatchString(p.Slug) {
+		errs = append(errs, fmt.Errorf("slug %q is not URL-safe", p.Slug))
+	}
+	errs = append(errs, validateParts("part", p.Parts)...)
+	errs = append(errs, validateParts("metadata part", p.Metadata)...)
+	if err := p.ValidateAnchors(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidPost, errors.Join(errs...))
+}
+
+// validateParts returns an error for each way parts break the rules
+// Post.Validate enforces. kind describes the parts in error messages.
+func validateParts(kind string, parts []Part) []error {
+	var errs []error
+	positions := make(map[int]string, len(parts))
+	for i, part := range parts {
+		if part.ID == "" {
+			errs = append(errs, fmt.Errorf("%s %d has no ID", kind, i))
+		}
+		if len(part.GetHeader("Content-Type")) < 1 {
+			errs = append(errs, fmt.Errorf("%s %s has no Content-Type header", kind, part.ID))
+		}
+		if part.Inline && part.Body == nil {
+			errs = append(errs, fmt.Errorf("%s %s is inline, but has no body", kind, part.ID))
+		}
+		if !part.Inline && part.SHA256 == "" {
+			errs = append(errs, fmt.Errorf("%s %s is not inline, but has no SHA256", kind, part.ID))
+		}
+		// inline parts without a SHA256 are fine, ComputeSHA256 can
+		// fill it in, but one that's set has to be right.
+		if part.Inline && part.SHA256 != "" {
+			if err := part.VerifySHA256(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := part.ValidateRole(); err != nil {
+			errs = append(errs, err)
+		}
+		if other, ok := positions[part.Position]; ok {
+			errs = append(errs, fmt.Errorf("%ss %s and %s have the same position %d", kind, other, part.ID, part.Position))
+			continue
+		}
+		positions[part.Position] = part.ID
+	}
+	// with no duplicates, positions are contiguous from 0 as long as
+	// they're all in range.
+	for _, part := range parts {
+		if part.Position < 0 || part.Position >= len(parts) {
+			errs = append(errs, fmt.Errorf("%s positions aren't contiguous from 0: %s has position %d", kind, part.ID, part.Position))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,147 @@
+package posts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func validPost() Post {
+	text := map[string][]string{"Content-Type": {"text/plain"}}
+	return Post{
+		ID:    "0b6c4ff2-9f4c-4c5e-8a43-2f8f1b7b1d3e",
+		Title: "Hello, world",
+		Slug:  "hello-world",
+		Parts: []Part{
+			{ID: "intro", Position: 0, Inline: true, Headers: text, Body: []byte("Hi.")},
+			{ID: "image", Position: 1, Headers: map[string][]string{"Content-Type": {"image/png"}}, SHA256: "abc123"},
+		},
+		Metadata: []Part{
+			{ID: "summary", Position: 0, Inline: true, Headers: text, Body: []byte("A summary.")},
+		},
+	}
+}
+
+func TestPostValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		modify func(post *Post)
+		errs   []string
+	}{
+		"valid": {
+			modify: func(post *Post) {},
+		},
+		"empty-inline-body": {
+			modify: func(post *Post) { post.Parts[0].Body = []byte{} },
+		},
+		"id-not-uuid": {
+			modify: func(post *Post) { post.ID = "post" },
+			errs:   []string{`ID "post" is not a UUID`},
+		},
+		"empty-title": {
+			modify: func(post *Post) { post.Title = "" },
+			errs:   []string{"title is empty"},
+		},
+		"empty-slug": {
+			modify: func(post *Post) { post.Slug = "" },
+			errs:   []string{"slug is empty"},
+		},
+		"slug-with-spaces": {
+			modify: func(post *Post) { post.Slug = "hello world" },
+			errs:   []string{`slug "hello world" is not URL-safe`},
+		},
+		"slug-with-capitals": {
+			modify: func(post *Post) { post.Slug = "Hello-World" },
+			errs:   []string{`slug "Hello-World" is not URL-safe`},
+		},
+		"part-without-id": {
+			modify: func(post *Post) { post.Parts[1].ID = "" },
+			errs:   []string{"part 1 has no ID"},
+		},
+		"part-without-content-type": {
+			modify: func(post *Post) { post.Parts[0].Headers = nil },
+			errs:   []string{"part intro has no Content-Type header"},
+		},
+		"inline-part-without-body": {
+			modify: func(post *Post) { post.Parts[0].Body = nil },
+			errs:   []string{"part intro is inline, but has no body"},
+		},
+		"non-inline-part-without-sha": {
+			modify: func(post *Post) { post.Parts[1].SHA256 = "" },
+			errs:   []string{"part image is not inline, but has no SHA256"},
+		},
+		"metadata-without-content-type": {
+			modify: func(post *Post) { post.Metadata[0].Headers = nil },
+			errs:   []string{"metadata part summary has no Content-Type header"},
+		},
+		"duplicate-positions": {
+			modify: func(post *Post) { post.Parts[1].Position = 0 },
+			errs:   []string{"parts intro and image have the same position 0"},
+		},
+		"position-gap": {
+			modify: func(post *Post) { post.Parts[1].Position = 2 },
+			errs:   []string{"part positions aren't contiguous from 0: image has position 2"},
+		},
+		"inline-sha-matches": {
+			modify: func(post *Post) { post.Parts[0].ComputeSHA256() },
+		},
+		"inline-sha-mismatch": {
+			modify: func(post *Post) { post.Parts[0].SHA256 = "abc123" },
+			errs:   []string{`part intro has SHA256 "abc123"`},
+		},
+		"positions-out-of-order": {
+			modify: func(post *Post) { post.Parts[0].Position, post.Parts[1].Position = 1, 0 },
+		},
+		"invalid-anchor": {
+			modify: func(post *Post) { post.Parts[0].Anchor = "Not An Anchor" },
+			errs:   []string{`part intro has invalid anchor "Not An Anchor"`},
+		},
+		"figure-without-alt": {
+			modify: func(post *Post) {
+				post.Parts[1].Headers = map[string][]string{"Content-Type": {"image/png"}, RoleHeader: {RoleFigure}}
+			},
+			errs: []string{"part image is a figure"},
+		},
+		"multiple": {
+			modify: func(post *Post) {
+				post.ID = ""
+				post.Title = ""
+				post.Parts[0].Body = nil
+			},
+			errs: []string{`ID "" is not a UUID`, "title is empty", "part intro is inline, but has no body"},
+		},
+	}
+
+	for name, test := range tests {
+		name, test := name, test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			post := validPost()
+			test.modify(&post)
+			err := post.Validate()
+			if len(test.errs) == 0 {
+				if err != nil {
+					t.Errorf("expected no error, got %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %q, got nil", test.errs)
+			}
+			if !errors.Is(err, ErrInvalidPost) {
+				t.Errorf("expected ErrInvalidPost, got %v", err)
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(test.errs) {
+				t.Errorf("expected %d errors, got %d: %s", len(test.errs), len(lines), err)
+			}
+			for _, want := range test.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q, got %s", want, err)
+				}
+			}
+		})
+	}
+}